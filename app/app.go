@@ -6,17 +6,17 @@ package app
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"github.com/dmalix/financelime-authorization/app/authorization"
 	authorizationModel "github.com/dmalix/financelime-authorization/app/authorization/model"
-	authorizationRepository "github.com/dmalix/financelime-authorization/app/authorization/repository"
 	authorizationREST "github.com/dmalix/financelime-authorization/app/authorization/rest"
 	authorizationService "github.com/dmalix/financelime-authorization/app/authorization/service"
 	"github.com/dmalix/financelime-authorization/app/information"
 	informationREST "github.com/dmalix/financelime-authorization/app/information/rest"
 	informationService "github.com/dmalix/financelime-authorization/app/information/service"
 	"github.com/dmalix/financelime-authorization/config"
+	"github.com/dmalix/financelime-authorization/jose"
+	"github.com/dmalix/financelime-authorization/revocation"
 	"github.com/dmalix/jwt"
 	"github.com/dmalix/middleware"
 	"github.com/dmalix/secretdata"
@@ -41,16 +41,17 @@ type App struct {
 	authService              authorization.Service
 	infoREST                 information.REST
 	infoService              information.Service
+	keyRings                 []KeyRing
 }
 
+// keyRingReloadInterval is how soon the instances pick up the generated and promoted keys
+const keyRingReloadInterval = time.Minute
+
 func NewApp(logger *zap.Logger, version config.Version) (*App, error) {
 
 	var (
 		app                *App
 		err                error
-		dbAuthMain         *sql.DB
-		dbAuthRead         *sql.DB
-		dbBlade            *sql.DB
 		appConfig          config.App
 		appLanguageContent config.LanguageContent
 		// TODO Move the number of messages in the queue to configs
@@ -69,73 +70,30 @@ func NewApp(logger *zap.Logger, version config.Version) (*App, error) {
 	logger.Info("Configuration initialized successfully")
 
 	// Databases
-	dbAuthMain, err = authorizationRepository.NewPostgresDB(logger, authorizationModel.ConfigPostgresDB{
-		Host:     appConfig.Db.AuthMain.Connect.Host,
-		Port:     appConfig.Db.AuthMain.Connect.Port,
-		SSLMode:  appConfig.Db.AuthMain.Connect.SslMode,
-		DBName:   appConfig.Db.AuthMain.Connect.DbName,
-		User:     appConfig.Db.AuthMain.Connect.User,
-		Password: appConfig.Db.AuthMain.Connect.Password,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to init the AuthMain DB: %s", err)
-	}
-	dbAuthRead, err = authorizationRepository.NewPostgresDB(logger, authorizationModel.ConfigPostgresDB{
-		Host:     appConfig.Db.AuthRead.Connect.Host,
-		Port:     appConfig.Db.AuthRead.Connect.Port,
-		SSLMode:  appConfig.Db.AuthRead.Connect.SslMode,
-		DBName:   appConfig.Db.AuthRead.Connect.DbName,
-		User:     appConfig.Db.AuthRead.Connect.User,
-		Password: appConfig.Db.AuthRead.Connect.Password,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to init the AuthRead DB: %s", err)
-	}
-	dbBlade, err = authorizationRepository.NewPostgresDB(logger, authorizationModel.ConfigPostgresDB{
-		Host:     appConfig.Db.Blade.Connect.Host,
-		Port:     appConfig.Db.Blade.Connect.Port,
-		SSLMode:  appConfig.Db.Blade.Connect.SslMode,
-		DBName:   appConfig.Db.Blade.Connect.DbName,
-		User:     appConfig.Db.Blade.Connect.User,
-		Password: appConfig.Db.Blade.Connect.Password,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to init the Blade DB: %s", err)
-	}
-	err = config.Migrate(dbAuthMain,
-		appConfig.Db.AuthMain.Migration.DropFile,
-		appConfig.Db.AuthMain.Migration.CreateFile,
-		appConfig.Db.AuthMain.Migration.InsertFile)
+	databases, err := NewDatabases(logger, appConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to migrate the AuthMain DB: %s", err)
+		return nil, err
 	}
-	err = config.Migrate(dbBlade,
-		appConfig.Db.Blade.Migration.DropFile,
-		appConfig.Db.Blade.Migration.CreateFile,
-		"")
-	if err != nil {
-		return nil, fmt.Errorf("failed to migrate the Blade DB: %s", err)
-	}
-	closeDB := func() error {
-		if err := dbAuthMain.Close(); err != nil {
-			return fmt.Errorf("failed to close AuthMain DB: %s", err)
-		}
-		if err := dbAuthRead.Close(); err != nil {
-			return fmt.Errorf("failed to close AuthRead DB: %s", err)
+	if appConfig.Db.Migrate.OnStart {
+		migratorAuthMain, migratorBlade := NewMigrators(appConfig, databases, appConfig.Db.Migrate.DryRun)
+		err = migratorAuthMain.Up(context.Background(), logger.Named("migrationAuthMain"), 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate the AuthMain DB: %s", err)
 		}
-		if err := dbBlade.Close(); err != nil {
-			return fmt.Errorf("failed to close Blade DB: %s", err)
+		err = migratorBlade.Up(context.Background(), logger.Named("migrationBlade"), 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate the Blade DB: %s", err)
 		}
-		return nil
 	}
 	logger.Info("Databases initialized successfully")
 
 	// Secret Data
-	dataAccess := secretdata.NewSecretData(appConfig.Jwt.AccessSecretKey)
-	dataRefresh := secretdata.NewSecretData(appConfig.Jwt.RefreshSecretKey)
+	dataAccess := NewSecretData(appConfig.Jwt.AccessSecretKey, appConfig.Jwt.AccessPreviousSecretKeys)
+	dataRefresh := NewSecretData(appConfig.Jwt.RefreshSecretKey, appConfig.Jwt.RefreshPreviousSecretKeys)
+	dataMfa := secretdata.NewSecretData(appConfig.Crypto.MfaSecretKey)
 
 	// JWT
-	jwtAccess, err := jwt.NewToken(jwt.Config{
+	jwtAccess, err := NewJwt(jwt.Config{
 		Headers: jwt.Headers{
 			Type:               jwt.TokenType,
 			SignatureAlgorithm: appConfig.Jwt.AccessSignatureAlgorithm,
@@ -152,8 +110,16 @@ func NewApp(logger *zap.Logger, version config.Version) (*App, error) {
 		},
 		TokenLifetimeSec: appConfig.Jwt.AccessTokenLifetime,
 		Key:              appConfig.Jwt.AccessSecretKey,
+	}, JwtKeys{
+		PreviousSecretKeys: appConfig.Jwt.AccessPreviousSecretKeys,
+		PrivateKeyFile:     appConfig.Jwt.AccessPrivateKeyFile,
+		KeyRingDir:         appConfig.Jwt.AccessKeyRingDir,
 	})
-	jwtRefresh, err := jwt.NewToken(jwt.Config{
+	if err != nil {
+		return nil, err
+	}
+	// The refresh tokens are verified by the service only, their public keys are not published
+	jwtRefresh, err := NewJwt(jwt.Config{
 		Headers: jwt.Headers{
 			Type:               jwt.TokenType,
 			SignatureAlgorithm: appConfig.Jwt.RefreshSignatureAlgorithm,
@@ -170,7 +136,25 @@ func NewApp(logger *zap.Logger, version config.Version) (*App, error) {
 		},
 		TokenLifetimeSec: appConfig.Jwt.RefreshTokenLifetime,
 		Key:              appConfig.Jwt.RefreshSecretKey,
+	}, JwtKeys{
+		PreviousSecretKeys: appConfig.Jwt.RefreshPreviousSecretKeys,
+		PrivateKeyFile:     appConfig.Jwt.RefreshPrivateKeyFile,
+		KeyRingDir:         appConfig.Jwt.RefreshKeyRingDir,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	// OpenID Connect
+	oidcSigningKeyPEM, err := os.ReadFile(appConfig.Oidc.SigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the OIDC signing key: %s", err)
+	}
+	oidcSigningKey, err := jose.ParsePrivateKey(oidcSigningKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the OIDC signing key: %s", err)
+	}
+	idTokenSigner := jose.NewSigner(oidcSigningKey)
 
 	// Email Message
 	sendMailDaemon := sendmail.NewDaemon(
@@ -188,26 +172,30 @@ func NewApp(logger *zap.Logger, version config.Version) (*App, error) {
 	}
 	commonMiddleware := middleware.NewMiddleware(
 		middlewareConfig,
-		jwtAccess,
+		jwtAccess.Token,
 		dataAccess)
 	contextGetter := middleware.NewContextGetter()
 
+	// The revoked access tokens are shared by all the instances of the service and the CLI
+	revocationStore := revocation.NewStore(revocation.NewPostgresBackend(databases.Blade))
+
 	// Authorization
-	authRepoConfig := authorizationModel.ConfigRepository{
-		CryptoSalt:              appConfig.Crypto.Salt,
-		JwtRefreshTokenLifetime: appConfig.Jwt.RefreshTokenLifetime,
+	authRepo, err := NewAuthorizationRepository(appConfig, databases, contextGetter)
+	if err != nil {
+		return nil, err
 	}
-	authRepo := authorizationRepository.NewRepository(
-		authRepoConfig,
-		contextGetter,
-		dbAuthMain,
-		dbAuthRead,
-		dbBlade)
 	authServiceConfig := authorizationModel.ConfigService{
-		DomainAPP:              appConfig.Domain.App,
-		DomainAPI:              appConfig.Domain.Api,
-		AuthInviteCodeRequired: appConfig.Auth.InviteCodeRequired,
-		CryptoSalt:             appConfig.Crypto.Salt,
+		DomainAPP:                    appConfig.Domain.App,
+		DomainAPI:                    appConfig.Domain.Api,
+		AuthInviteCodeRequired:       appConfig.Auth.InviteCodeRequired,
+		CryptoSalt:                   appConfig.Crypto.Salt,
+		AccessTokenLifetime:          appConfig.Jwt.AccessTokenLifetime,
+		OidcIssuer:                   "https://" + appConfig.Domain.Api,
+		SessionAbsoluteExpiry:        appConfig.Auth.SessionExpiry == config.SessionExpiryAbsolute,
+		SessionIdleTimeout:           appConfig.Auth.SessionIdleTimeout,
+		SessionMaxAge:                appConfig.Auth.SessionMaxAge,
+		SessionRememberMeIdleTimeout: appConfig.Auth.SessionRememberMeIdleTimeout,
+		SessionRememberMeMaxAge:      appConfig.Auth.SessionRememberMeMaxAge,
 	}
 	authService := authorizationService.NewService(
 		authServiceConfig,
@@ -218,8 +206,12 @@ func NewApp(logger *zap.Logger, version config.Version) (*App, error) {
 		authRepo,
 		dataAccess,
 		dataRefresh,
-		jwtAccess,
-		jwtRefresh)
+		dataMfa,
+		jwtAccess.Token,
+		jwtRefresh.Token,
+		revocationStore,
+		idTokenSigner,
+		jose.JoinKeySets(idTokenSigner, jwtAccess.PublicKeys))
 	authREST := authorizationREST.NewREST(
 		contextGetter,
 		authService)
@@ -237,7 +229,7 @@ func NewApp(logger *zap.Logger, version config.Version) (*App, error) {
 	// Implementation of prepared objects into the application
 	app = &App{
 		httpPort:                 appConfig.Http.Port,
-		closeDB:                  closeDB,
+		closeDB:                  databases.Close,
 		emailMessageSenderDaemon: sendMailDaemon,
 		commonMiddleware:         commonMiddleware,
 		authREST:                 authREST,
@@ -245,6 +237,11 @@ func NewApp(logger *zap.Logger, version config.Version) (*App, error) {
 		infoREST:                 infoREST,
 		infoService:              infoService,
 	}
+	for _, token := range []Jwt{jwtAccess, jwtRefresh} {
+		if token.KeyRing != nil {
+			app.keyRings = append(app.keyRings, token.KeyRing)
+		}
+	}
 
 	return app, nil
 }
@@ -255,6 +252,12 @@ func (app *App) Run(ctx context.Context, logger *zap.Logger) error {
 
 	go app.emailMessageSenderDaemon.Run(ctx, logger.Named("emailSender"))
 
+	// Start the reload of the key rings
+
+	if len(app.keyRings) > 0 {
+		go app.reloadKeyRings(ctx, logger.Named("keyRing"))
+	}
+
 	// Start application
 
 	router := mux.NewRouter()
@@ -322,3 +325,22 @@ func (app *App) Run(ctx context.Context, logger *zap.Logger) error {
 
 	return nil
 }
+
+func (app *App) reloadKeyRings(ctx context.Context, logger *zap.Logger) {
+
+	ticker := time.NewTicker(keyRingReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, keyRing := range app.keyRings {
+				if err := keyRing.Reload(); err != nil {
+					logger.Error("failed to reload the key ring", zap.Error(err))
+				}
+			}
+		}
+	}
+}
@@ -7,6 +7,8 @@ package authorization
 import (
 	"context"
 	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/financelime-authorization/jose"
+	"github.com/dmalix/financelime-authorization/webauthn"
 	"go.uber.org/zap"
 	"net/http"
 )
@@ -14,34 +16,186 @@ import (
 type REST interface {
 	SignUpStep1(logger *zap.Logger) http.Handler
 	SignUpStep2(logger *zap.Logger) http.Handler
+	SignUpStep3(logger *zap.Logger) http.Handler
 	CreateAccessToken(logger *zap.Logger) http.Handler
 	RefreshAccessToken(logger *zap.Logger) http.Handler
 	GetListActiveSessions(logger *zap.Logger) http.Handler
 	RevokeRefreshToken(logger *zap.Logger) http.Handler
+	RevokeAllSessions(logger *zap.Logger) http.Handler
+	RevokeOtherSessions(logger *zap.Logger) http.Handler
 	ResetUserPasswordStep1(logger *zap.Logger) http.Handler
 	ResetUserPasswordStep2(logger *zap.Logger) http.Handler
+	ResetUserPasswordStep3(logger *zap.Logger) http.Handler
+	UpdateUserPassword(logger *zap.Logger) http.Handler
+	CreateTotp(logger *zap.Logger) http.Handler
+	ConfirmTotp(logger *zap.Logger) http.Handler
+	VerifyMfaChallenge(logger *zap.Logger) http.Handler
+	RegenerateRecoveryCodes(logger *zap.Logger) http.Handler
+	BeginWebauthnRegistration(logger *zap.Logger) http.Handler
+	FinishWebauthnRegistration(logger *zap.Logger) http.Handler
+	BeginWebauthnLogin(logger *zap.Logger) http.Handler
+	FinishWebauthnLogin(logger *zap.Logger) http.Handler
+	AccessTokenRevocation(logger *zap.Logger) func(http.Handler) http.Handler
+	RequireUserAccessToken(logger *zap.Logger) func(http.Handler) http.Handler
+	RequireScope(logger *zap.Logger, scopes ...string) func(http.Handler) http.Handler
+	RequirePermission(logger *zap.Logger, permissions ...string) func(http.Handler) http.Handler
+	Authorize(logger *zap.Logger) http.Handler
+	ExchangeToken(logger *zap.Logger) http.Handler
+	GetOpenIDConfiguration(logger *zap.Logger) http.Handler
+	GetJwks(logger *zap.Logger) http.Handler
+	GetUserInfo(logger *zap.Logger) http.Handler
+	IntrospectToken(logger *zap.Logger) http.Handler
+	RevokeToken(logger *zap.Logger) http.Handler
+	CreateDeviceAuthorization(logger *zap.Logger) http.Handler
+	GetDeviceAuthorization(logger *zap.Logger) http.Handler
+	ApproveDeviceAuthorization(logger *zap.Logger) http.Handler
+	GetListRoles(logger *zap.Logger) http.Handler
+	AssignUserRole(logger *zap.Logger) http.Handler
+	RevokeUserRole(logger *zap.Logger) http.Handler
+	SearchUsers(logger *zap.Logger) http.Handler
+	GetUserDetail(logger *zap.Logger) http.Handler
+	DisableUser(logger *zap.Logger) http.Handler
+	EnableUser(logger *zap.Logger) http.Handler
+	ForceUserPasswordReset(logger *zap.Logger) http.Handler
+	ResendSignUpConfirmation(logger *zap.Logger) http.Handler
+	DeleteUser(logger *zap.Logger) http.Handler
+	UpdateUserStatus(logger *zap.Logger) http.Handler
+	GetListOauthClients(logger *zap.Logger) http.Handler
+	CreateOauthClient(logger *zap.Logger) http.Handler
+	UpdateOauthClient(logger *zap.Logger) http.Handler
+	DisableOauthClient(logger *zap.Logger) http.Handler
+	GetListServiceAccounts(logger *zap.Logger) http.Handler
+	CreateServiceAccount(logger *zap.Logger) http.Handler
+	UpdateServiceAccount(logger *zap.Logger) http.Handler
+	DeleteServiceAccount(logger *zap.Logger) http.Handler
 }
 
 type Service interface {
 	SignUpStep1(ctx context.Context, logger *zap.Logger, param model.ServiceSignUpParam) error
 	SignUpStep2(ctx context.Context, logger *zap.Logger, confirmationKey string) (string, error)
+	SignUpStep3(ctx context.Context, logger *zap.Logger, param model.ServiceSetPasswordParam) error
 	CreateAccessToken(ctx context.Context, logger *zap.Logger, param model.ServiceCreateAccessTokenParam) (model.ServiceAccessTokenReturn, error)
-	RefreshAccessToken(ctx context.Context, logger *zap.Logger, refreshToken string) (model.ServiceAccessTokenReturn, error)
+	RefreshAccessToken(ctx context.Context, logger *zap.Logger, param model.ServiceRefreshAccessTokenParam) (model.ServiceAccessTokenReturn, error)
 	RevokeRefreshToken(ctx context.Context, logger *zap.Logger, param model.ServiceRevokeRefreshTokenParam) error
+	CheckAccessTokenRevocation(ctx context.Context, logger *zap.Logger, publicSessionID string) error
+	CheckUserAccessToken(ctx context.Context, logger *zap.Logger, accessTokenData []byte) error
+	RevokeAllSessions(ctx context.Context, logger *zap.Logger, param model.ServiceRevokeAllSessionsParam) error
 	GetListActiveSessions(ctx context.Context, logger *zap.Logger, accessTokenData []byte) ([]model.Session, error)
 	ResetUserPasswordStep1(ctx context.Context, logger *zap.Logger, email string) error
 	ResetUserPasswordStep2(ctx context.Context, logger *zap.Logger, confirmationKey string) (string, error)
+	ResetUserPasswordStep3(ctx context.Context, logger *zap.Logger, param model.ServiceSetPasswordParam) error
+	UpdateUserPassword(ctx context.Context, logger *zap.Logger, param model.ServiceUpdateUserPasswordParam) error
+	CreateTotp(ctx context.Context, logger *zap.Logger, accessTokenData []byte) (model.ServiceCreateTotpReturn, error)
+	ConfirmTotp(ctx context.Context, logger *zap.Logger, param model.ServiceConfirmTotpParam) ([]string, error)
+	VerifyMfaChallenge(ctx context.Context, logger *zap.Logger, param model.ServiceVerifyMfaChallengeParam) (model.ServiceAccessTokenReturn, error)
+	RegenerateRecoveryCodes(ctx context.Context, logger *zap.Logger, accessTokenData []byte) ([]string, error)
+	BeginWebauthnRegistration(ctx context.Context, logger *zap.Logger, accessTokenData []byte) (webauthn.CreationOptions, error)
+	FinishWebauthnRegistration(ctx context.Context, logger *zap.Logger, param model.ServiceFinishWebauthnRegistrationParam) error
+	BeginWebauthnLogin(ctx context.Context, logger *zap.Logger) (webauthn.RequestOptions, error)
+	FinishWebauthnLogin(ctx context.Context, logger *zap.Logger, param model.ServiceFinishWebauthnLoginParam) (model.ServiceAccessTokenReturn, error)
+	Authorize(ctx context.Context, logger *zap.Logger, param model.ServiceAuthorizeParam) (string, error)
+	ExchangeToken(ctx context.Context, logger *zap.Logger, param model.ServiceExchangeTokenParam) (model.ServiceAccessTokenReturn, error)
+	GetOpenIDConfiguration() model.OpenIDConfiguration
+	GetJwks() jose.JSONWebKeySet
+	GetUserInfo(ctx context.Context, logger *zap.Logger, accessTokenData []byte) (model.UserInfo, error)
+	IntrospectToken(ctx context.Context, logger *zap.Logger, param model.ServiceIntrospectTokenParam) (model.TokenIntrospection, error)
+	RevokeToken(ctx context.Context, logger *zap.Logger, param model.ServiceRevokeTokenParam) error
+	CreateDeviceAuthorization(ctx context.Context, logger *zap.Logger, param model.ServiceDeviceAuthorizationParam) (model.ServiceDeviceAuthorizationReturn, error)
+	GetDeviceAuthorization(ctx context.Context, logger *zap.Logger, userCode string) (model.ServiceDeviceVerificationReturn, error)
+	ApproveDeviceAuthorization(ctx context.Context, logger *zap.Logger, param model.ServiceApproveDeviceAuthorizationParam) error
+	GetListRoles(ctx context.Context, logger *zap.Logger) ([]model.Role, error)
+	AssignUserRole(ctx context.Context, logger *zap.Logger, param model.ServiceUserRoleParam) error
+	RevokeUserRole(ctx context.Context, logger *zap.Logger, param model.ServiceUserRoleParam) error
+	SearchUsers(ctx context.Context, logger *zap.Logger, param model.ServiceSearchUsersParam) ([]model.UserRecord, error)
+	GetUserDetail(ctx context.Context, logger *zap.Logger, userID int64) (model.UserDetail, error)
+	DisableUser(ctx context.Context, logger *zap.Logger, userID int64) error
+	EnableUser(ctx context.Context, logger *zap.Logger, userID int64) error
+	ForceUserPasswordReset(ctx context.Context, logger *zap.Logger, userID int64) error
+	ResendSignUpConfirmation(ctx context.Context, logger *zap.Logger, email string) error
+	DeleteUser(ctx context.Context, logger *zap.Logger, userID int64) error
+	UpdateUserStatus(ctx context.Context, logger *zap.Logger, param model.ServiceUpdateUserStatusParam) error
+	GetListOauthClients(ctx context.Context, logger *zap.Logger) ([]model.OauthClient, error)
+	CreateOauthClient(ctx context.Context, logger *zap.Logger, param model.ServiceCreateOauthClientParam) (model.ServiceClientCredentialsReturn, error)
+	UpdateOauthClient(ctx context.Context, logger *zap.Logger, param model.ServiceUpdateOauthClientParam) error
+	DisableOauthClient(ctx context.Context, logger *zap.Logger, clientID string) error
+	GetListServiceAccounts(ctx context.Context, logger *zap.Logger) ([]model.ServiceAccount, error)
+	CreateServiceAccount(ctx context.Context, logger *zap.Logger, param model.ServiceCreateServiceAccountParam) (model.ServiceClientCredentialsReturn, error)
+	UpdateServiceAccount(ctx context.Context, logger *zap.Logger, param model.ServiceUpdateServiceAccountParam) (model.ServiceClientCredentialsReturn, error)
+	DeleteServiceAccount(ctx context.Context, logger *zap.Logger, clientID string) error
 }
 
 type Repository interface {
 	SignUpStep1(ctx context.Context, logger *zap.Logger, param model.RepoSignUpParam) error
 	SignUpStep2(ctx context.Context, logger *zap.Logger, confirmationKey string) (model.User, error)
+	SignUpStep3(ctx context.Context, logger *zap.Logger, param model.RepoSetPasswordParam) (model.User, error)
 	GetUserByAuth(ctx context.Context, logger *zap.Logger, param model.RepoGetUserByAuthParam) (model.User, error)
 	GetUserByRefreshToken(ctx context.Context, logger *zap.Logger, refreshToken string) (model.User, error)
 	CreateSession(ctx context.Context, logger *zap.Logger, param model.RepoCreateSessionParam) error
 	UpdateSession(ctx context.Context, logger *zap.Logger, param model.RepoUpdateSessionParam) error
+	RevokeRefreshTokenFamily(ctx context.Context, logger *zap.Logger, refreshToken string) (model.User, []string, error)
 	DeleteSession(ctx context.Context, logger *zap.Logger, param model.RepoDeleteSessionParam) error
 	GetListActiveSessions(ctx context.Context, logger *zap.Logger, userID int64) ([]model.Session, error)
 	ResetUserPasswordStep1(ctx context.Context, logger *zap.Logger, param model.RepoResetUserPasswordParam) (model.User, error)
 	ResetUserPasswordStep2(ctx context.Context, logger *zap.Logger, confirmationKey string) (model.User, error)
+	ResetUserPasswordStep3(ctx context.Context, logger *zap.Logger, param model.RepoSetPasswordParam) (model.User, error)
+	UpdateUserPassword(ctx context.Context, logger *zap.Logger, param model.RepoUpdateUserPasswordParam) error
+	CreateUser(ctx context.Context, logger *zap.Logger, param model.RepoCreateUserParam) (model.User, error)
+	GetUserByEmail(ctx context.Context, logger *zap.Logger, email string) (model.User, error)
+	GetListUsers(ctx context.Context, logger *zap.Logger, param model.RepoGetListUsersParam) ([]model.UserRecord, error)
+	DisableUser(ctx context.Context, logger *zap.Logger, userID int64) ([]string, error)
+	GetUserRecord(ctx context.Context, logger *zap.Logger, userID int64) (model.UserRecord, error)
+	EnableUser(ctx context.Context, logger *zap.Logger, userID int64) error
+	DeleteUser(ctx context.Context, logger *zap.Logger, userID int64) error
+	ExpireUserPassword(ctx context.Context, logger *zap.Logger, param model.RepoExpireUserPasswordParam) (model.User, error)
+	RenewSignUpConfirmation(ctx context.Context, logger *zap.Logger, param model.RepoRenewSignUpConfirmationParam) (model.User, error)
+	UpdateUserStatus(ctx context.Context, logger *zap.Logger, param model.RepoUpdateUserStatusParam) ([]string, error)
+	CreateInviteCode(ctx context.Context, logger *zap.Logger, param model.RepoCreateInviteCodeParam) (model.InviteCodeRecord, error)
+	GetListInviteCodes(ctx context.Context, logger *zap.Logger, userID int64) ([]model.InviteCodeRecord, error)
+	RevokeInviteCode(ctx context.Context, logger *zap.Logger, value string) error
+	DeleteUserSessions(ctx context.Context, logger *zap.Logger, param model.RepoDeleteUserSessionsParam) ([]string, error)
+	GetUserByID(ctx context.Context, logger *zap.Logger, userID int64) (model.User, error)
+	CreateTotp(ctx context.Context, logger *zap.Logger, param model.RepoCreateTotpParam) error
+	GetTotp(ctx context.Context, logger *zap.Logger, userID int64) (model.Totp, error)
+	ConfirmTotp(ctx context.Context, logger *zap.Logger, param model.RepoTotpStepParam) error
+	UseTotpStep(ctx context.Context, logger *zap.Logger, param model.RepoTotpStepParam) error
+	CreateMfaChallenge(ctx context.Context, logger *zap.Logger, param model.RepoCreateMfaChallengeParam) error
+	GetMfaChallenge(ctx context.Context, logger *zap.Logger, challengeToken string) (model.MfaChallenge, error)
+	DeleteMfaChallenge(ctx context.Context, logger *zap.Logger, challengeToken string) error
+	ReplaceRecoveryCodes(ctx context.Context, logger *zap.Logger, param model.RepoReplaceRecoveryCodesParam) error
+	UseRecoveryCode(ctx context.Context, logger *zap.Logger, param model.RepoUseRecoveryCodeParam) (int, error)
+	CreateWebauthnChallenge(ctx context.Context, logger *zap.Logger, param model.RepoCreateWebauthnChallengeParam) error
+	GetWebauthnChallenge(ctx context.Context, logger *zap.Logger, param model.RepoGetWebauthnChallengeParam) (int64, error)
+	CreateWebauthnCredential(ctx context.Context, logger *zap.Logger, param model.RepoCreateWebauthnCredentialParam) error
+	GetListWebauthnCredentials(ctx context.Context, logger *zap.Logger, userID int64) ([]model.WebauthnCredential, error)
+	GetWebauthnCredential(ctx context.Context, logger *zap.Logger, credentialID string) (model.WebauthnCredential, error)
+	UpdateWebauthnSignCount(ctx context.Context, logger *zap.Logger, param model.RepoUpdateWebauthnSignCountParam) error
+	CreateOauthClient(ctx context.Context, logger *zap.Logger, param model.RepoCreateOauthClientParam) error
+	GetOauthClient(ctx context.Context, logger *zap.Logger, clientID string) (model.OauthClient, error)
+	AuthenticateOauthClient(ctx context.Context, logger *zap.Logger, param model.RepoAuthenticateOauthClientParam) (model.OauthClient, error)
+	GetListOauthClients(ctx context.Context, logger *zap.Logger) ([]model.OauthClient, error)
+	GetMaxAccessTokenLifetime(ctx context.Context, logger *zap.Logger) (int, error)
+	UpdateOauthClient(ctx context.Context, logger *zap.Logger, param model.RepoUpdateOauthClientParam) error
+	DisableOauthClient(ctx context.Context, logger *zap.Logger, clientID string) error
+	EnableOauthClient(ctx context.Context, logger *zap.Logger, clientID string) error
+	CreateAuthorizationCode(ctx context.Context, logger *zap.Logger, param model.RepoCreateAuthorizationCodeParam) error
+	GetAuthorizationCode(ctx context.Context, logger *zap.Logger, code string) (model.AuthorizationCode, error)
+	GetSessionClientID(ctx context.Context, logger *zap.Logger, publicSessionID string) (string, error)
+	GetActiveSession(ctx context.Context, logger *zap.Logger, publicSessionID string) (model.SessionRecord, error)
+	CreateServiceAccount(ctx context.Context, logger *zap.Logger, param model.RepoCreateServiceAccountParam) error
+	GetServiceAccount(ctx context.Context, logger *zap.Logger, clientID string) (model.ServiceAccount, error)
+	GetListServiceAccounts(ctx context.Context, logger *zap.Logger) ([]model.ServiceAccount, error)
+	UpdateServiceAccount(ctx context.Context, logger *zap.Logger, param model.RepoUpdateServiceAccountParam) error
+	DeleteServiceAccount(ctx context.Context, logger *zap.Logger, clientID string) error
+	AuthenticateServiceAccount(ctx context.Context, logger *zap.Logger, param model.RepoAuthenticateOauthClientParam) (model.ServiceAccount, error)
+	CreateDeviceAuthorization(ctx context.Context, logger *zap.Logger, param model.RepoCreateDeviceAuthorizationParam) error
+	GetDeviceAuthorization(ctx context.Context, logger *zap.Logger, userCode string) (model.DeviceAuthorization, error)
+	UpdateDeviceAuthorization(ctx context.Context, logger *zap.Logger, param model.RepoUpdateDeviceAuthorizationParam) error
+	PollDeviceAuthorization(ctx context.Context, logger *zap.Logger, param model.RepoPollDeviceAuthorizationParam) (model.DeviceAuthorization, error)
+	DeleteDeviceAuthorization(ctx context.Context, logger *zap.Logger, deviceCode string) error
+	CreateRole(ctx context.Context, logger *zap.Logger, param model.RepoCreateRoleParam) error
+	GetListRoles(ctx context.Context, logger *zap.Logger) ([]model.Role, error)
+	DeleteRole(ctx context.Context, logger *zap.Logger, name string) error
+	AssignUserRole(ctx context.Context, logger *zap.Logger, param model.RepoUserRoleParam) error
+	RevokeUserRole(ctx context.Context, logger *zap.Logger, param model.RepoUserRoleParam) error
+	GetUserAccess(ctx context.Context, logger *zap.Logger, userID int64) (model.UserAccess, error)
 }
@@ -1,6 +1,10 @@
 package authorization
 
-import "errors"
+import (
+	"errors"
+	"github.com/dmalix/financelime-authorization/rbac"
+	"github.com/dmalix/financelime-authorization/scope"
+)
 
 var ErrorBadParams = errors.New("BAD_PARAMETERS")                                           // one or more of the requestInput parameters are invalid
 var ErrorBadParamEmail = errors.New("BAD_PARAM_EMAIL")                                      // the email param is not valid
@@ -17,3 +21,47 @@ var ErrorConfirmationKeyAlreadyConfirmed = errors.New("CONFIRMATION_KEY_ALREADY_
 var ErrorUserNotFound = errors.New("USER_NOT_FOUND")                                        // the user is not found
 var ErrorBadRefreshToken = errors.New("BAD_REFRESH_TOKEN")                                  // failed to validate the Refresh Token (JWT)
 var ErrorSessionNotFound = errors.New("SESSION_NOT_FOUND")                                  // the case (the session + hashedRefreshToken) does not exist
+var ErrorInviteAlreadyExist = errors.New("INVITE_ALREADY_EXIST")                            // an invite code with the same value already exists
+var ErrorBadCurrentPassword = errors.New("BAD_CURRENT_PASSWORD")                            // the current password of the user is wrong
+var ErrorMfaRequired = errors.New("MFA_REQUIRED")                                           // the user has to confirm the log in with the second factor
+var ErrorMfaAlreadyEnabled = errors.New("MFA_ALREADY_ENABLED")                              // the two-factor authentication is already enabled
+var ErrorMfaNotFound = errors.New("MFA_NOT_FOUND")                                          // the user has not started the two-factor authentication enrollment
+var ErrorBadMfaCode = errors.New("BAD_MFA_CODE")                                            // the one-time code is wrong, expired or has already been used
+var ErrorMfaChallengeNotFound = errors.New("MFA_CHALLENGE_NOT_FOUND")                       // the challenge token does not exist, is expired or has run out of attempts
+var ErrorBadWebauthnResponse = errors.New("BAD_WEBAUTHN_RESPONSE")                          // the authenticator response failed the verification
+var ErrorWebauthnChallengeNotFound = errors.New("WEBAUTHN_CHALLENGE_NOT_FOUND")             // the ceremony does not exist, is expired or has already been completed
+var ErrorWebauthnCredentialNotFound = errors.New("WEBAUTHN_CREDENTIAL_NOT_FOUND")           // the passkey is not registered or has been deleted
+var ErrorWebauthnCredentialAlreadyExist = errors.New("WEBAUTHN_CREDENTIAL_ALREADY_EXIST")   // the passkey is already registered
+var ErrorRefreshTokenReused = errors.New("REFRESH_TOKEN_REUSED")                            // the refresh token has already been rotated, all the sessions of its family are revoked
+var ErrorAccessTokenRevoked = errors.New("ACCESS_TOKEN_REVOKED")                            // the session of the access token has been revoked before the token expired
+var ErrorAccessTokenNotAccepted = errors.New("ACCESS_TOKEN_NOT_ACCEPTED")                   // the access token is not issued to the user for this API, e.g. it's delegated to another service
+var ErrorInvalidRequest = errors.New("INVALID_REQUEST")                                     // the OAuth 2.0 request is missing a parameter or is malformed
+var ErrorInvalidClient = errors.New("INVALID_CLIENT")                                       // the OAuth 2.0 client is unknown or has failed the authentication
+var ErrorInvalidGrant = errors.New("INVALID_GRANT")                                         // the authorization code or refresh token is invalid, expired or issued to another client
+var ErrorUnauthorizedClient = errors.New("UNAUTHORIZED_CLIENT")                             // the OAuth 2.0 client is not allowed to make the request, e.g. to revoke a token of another client
+var ErrorUnsupportedGrantType = errors.New("UNSUPPORTED_GRANT_TYPE")                        // the token endpoint does not support the grant type
+var ErrorUnsupportedResponseType = errors.New("UNSUPPORTED_RESPONSE_TYPE")                  // the authorization endpoint supports the code response type only
+var ErrorInvalidRedirectURI = errors.New("INVALID_REDIRECT_URI")                            // the redirect URI is not registered for the client
+var ErrorOauthClientAlreadyExist = errors.New("OAUTH_CLIENT_ALREADY_EXIST")                 // a client with the same client ID already exists
+var ErrorOauthClientNotFound = errors.New("OAUTH_CLIENT_NOT_FOUND")                         // the client does not exist, has been deleted or is already in the requested state
+var ErrorAuthorizationCodeNotFound = errors.New("AUTHORIZATION_CODE_NOT_FOUND")             // the authorization code does not exist, is expired or has already been exchanged
+var ErrorInvalidScope = errors.New("INVALID_SCOPE")                                         // the requested scope is malformed or exceeds the scopes allowed to the client
+var ErrorUnsupportedTokenType = errors.New("UNSUPPORTED_TOKEN_TYPE")                        // the revocation endpoint does not support the revocation of the token
+var ErrorServiceAccountAlreadyExist = errors.New("SERVICE_ACCOUNT_ALREADY_EXIST")           // a service account with the same client ID already exists
+var ErrorServiceAccountNotFound = errors.New("SERVICE_ACCOUNT_NOT_FOUND")                   // the service account does not exist or has been deleted
+var ErrorAuthorizationPending = errors.New("AUTHORIZATION_PENDING")                         // the user has not yet approved or denied the device authorization request
+var ErrorSlowDown = errors.New("SLOW_DOWN")                                                 // the device polls the token endpoint more often than the interval
+var ErrorAccessDenied = errors.New("ACCESS_DENIED")                                         // the user has denied the device authorization request
+var ErrorExpiredToken = errors.New("EXPIRED_TOKEN")                                         // the device code has expired, the device has to start a new request
+var ErrorDeviceCodeNotFound = errors.New("DEVICE_CODE_NOT_FOUND")                           // the device code does not exist or has already been exchanged
+var ErrorInvalidTarget = errors.New("INVALID_TARGET")                                       // the audience of the token exchange is not a registered confidential client
+var ErrorInsufficientScope = scope.ErrorInsufficientScope                                   // the access token has not been granted the scopes the endpoint requires
+var ErrorUserCodeNotFound = errors.New("USER_CODE_NOT_FOUND")                               // the user code does not exist, is expired or has already been approved or denied
+var ErrorUserCodeAlreadyExist = errors.New("USER_CODE_ALREADY_EXIST")                       // a pending request with the same user code already exists
+var ErrorRoleNotFound = errors.New("ROLE_NOT_FOUND")                                        // the role does not exist or is not assigned to the user
+var ErrorRoleAlreadyExist = errors.New("ROLE_ALREADY_EXIST")                                // a role with the same name already exists
+var ErrorInsufficientPermission = rbac.ErrorInsufficientPermission                          // the access token has not been granted the permissions the endpoint requires
+var ErrorUserSuspended = errors.New("USER_SUSPENDED")                                       // the account of the user is suspended, e.g. until the investigation ends
+var ErrorUserLocked = errors.New("USER_LOCKED")                                             // the account of the user is locked for the security reasons
+var ErrorUserBanned = errors.New("USER_BANNED")                                             // the account of the user is banned for the violation of the terms
+var ErrorBadParamStatus = errors.New("BAD_PARAM_STATUS")                                    // the account status is unknown
@@ -6,6 +6,17 @@ type ConfigService struct {
 	AuthInviteCodeRequired bool
 	SecretKey              string
 	CryptoSalt             string
+	// The lifetime of the access token in seconds, the revoked tokens are remembered for this time
+	AccessTokenLifetime int
+	// The OpenID Provider identifier, the URL of the API
+	OidcIssuer string
+	// The policy of the new sessions, the idle timeout and the max age are in seconds.
+	// The refresh doesn't extend the absolute session.
+	SessionAbsoluteExpiry        bool
+	SessionIdleTimeout           int
+	SessionMaxAge                int
+	SessionRememberMeIdleTimeout int
+	SessionRememberMeMaxAge      int
 }
 
 type ConfigRepository struct {
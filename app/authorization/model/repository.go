@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type RepoSignUpParam struct {
 	Email              string
 	Language           string
@@ -11,9 +13,17 @@ type RepoCreateSessionParam struct {
 	UserID          int64
 	PublicSessionID string
 	RefreshToken    string
-	ClientID        string
-	UserAgent       string
-	Device          Device
+	// The refresh tokens issued by the rotation inherit the family of the first one
+	TokenFamily string
+	ClientID    string
+	Scope       string
+	UserAgent   string
+	Device      Device
+	// The policy of the session: the seconds of the inactivity and since the log in after which it expires,
+	// zero max age for no limit
+	IdleTimeout int
+	MaxAge      int
+	RememberMe  bool
 }
 
 type RepoGetUserByAuthParam struct {
@@ -28,10 +38,220 @@ type RepoDeleteSessionParam struct {
 
 type RepoUpdateSessionParam struct {
 	PublicSessionID string
+	// The presented refresh token, it's replaced by the new one and can not be used again
 	RefreshToken    string
+	NewRefreshToken string
 }
 
 type RepoResetUserPasswordParam struct {
 	Email           string
 	ConfirmationKey string
 }
+
+type RepoSetPasswordParam struct {
+	ConfirmationKey string
+	Password        string
+}
+
+type RepoUpdateUserPasswordParam struct {
+	UserID          int64
+	CurrentPassword string
+	NewPassword     string
+}
+
+type RepoCreateUserParam struct {
+	Email    string
+	Language string
+	Password string
+}
+
+type RepoGetListUsersParam struct {
+	// The part of the email to search by, all users are listed if it's empty
+	Email  string
+	Limit  int
+	Offset int
+}
+
+type RepoUpdateUserStatusParam struct {
+	UserID int64
+	Status string
+	Reason string
+	// The user is active again at this time, nil if the status has no limit
+	ExpiresAt *time.Time
+}
+
+type RepoExpireUserPasswordParam struct {
+	UserID int64
+	// The random password nobody knows, it replaces the current one
+	Password string
+}
+
+type RepoRenewSignUpConfirmationParam struct {
+	Email           string
+	ConfirmationKey string
+}
+
+type RepoCreateInviteCodeParam struct {
+	UserID      int64
+	Value       string
+	LimitAmount int
+	ExpiresAt   time.Time
+}
+
+type RepoDeleteUserSessionsParam struct {
+	UserID int64
+	// The session is kept, if it's empty all the sessions are deleted
+	ExceptPublicSessionID string
+}
+
+type RepoCreateTotpParam struct {
+	UserID          int64
+	EncryptedSecret string
+}
+
+type RepoTotpStepParam struct {
+	UserID int64
+	Step   int64
+}
+
+type RepoCreateMfaChallengeParam struct {
+	UserID         int64
+	ChallengeToken string
+	// The challenge token lifetime in seconds
+	Lifetime   int
+	ClientID   string
+	UserAgent  string
+	Device     Device
+	Scope      string
+	RememberMe bool
+}
+
+type RepoReplaceRecoveryCodesParam struct {
+	UserID        int64
+	RecoveryCodes []string
+}
+
+type RepoUseRecoveryCodeParam struct {
+	UserID       int64
+	RecoveryCode string
+}
+
+type RepoCreateWebauthnChallengeParam struct {
+	Ceremony string
+	// Zero for the log in ceremony, the user is not known until the assertion
+	UserID    int64
+	Challenge string
+	// The challenge lifetime in seconds
+	Lifetime int
+}
+
+type RepoGetWebauthnChallengeParam struct {
+	Ceremony  string
+	Challenge string
+}
+
+type RepoCreateWebauthnCredentialParam struct {
+	UserID       int64
+	CredentialID string
+	PublicKey    string
+	SignCount    uint32
+}
+
+type RepoUpdateWebauthnSignCountParam struct {
+	CredentialID string
+	SignCount    uint32
+}
+
+type RepoCreateOauthClientParam struct {
+	ClientID string
+	Name     string
+	// Empty for a public client
+	ClientSecret string
+	RedirectURIs []string
+	Scope        string
+	Audience     string
+	GrantTypes   []string
+	// The lifetimes of the tokens in seconds, zero for the lifetimes of the config
+	AccessTokenLifetime  int
+	RefreshTokenLifetime int
+}
+
+type RepoUpdateOauthClientParam struct {
+	ClientID string
+	// The empty params are not changed
+	Name         string
+	RedirectURIs []string
+	Scope        string
+	Audience     string
+	GrantTypes   []string
+	// Nil for no change, zero for the lifetimes of the config
+	AccessTokenLifetime  *int
+	RefreshTokenLifetime *int
+}
+
+type RepoAuthenticateOauthClientParam struct {
+	ClientID     string
+	ClientSecret string
+}
+
+type RepoCreateDeviceAuthorizationParam struct {
+	DeviceCode string
+	UserCode   string
+	ClientID   string
+	Scope      string
+	// The lifetime of the codes in seconds
+	Lifetime int
+	// The minimum time between the polls in seconds
+	Interval int
+}
+
+type RepoUpdateDeviceAuthorizationParam struct {
+	UserCode string
+	UserID   int64
+	Approved bool
+}
+
+type RepoPollDeviceAuthorizationParam struct {
+	DeviceCode string
+	// The seconds added to the interval of the request when the device polls too often
+	SlowDownIncrement int
+}
+
+type RepoCreateServiceAccountParam struct {
+	ClientID     string
+	Name         string
+	ClientSecret string
+	Scope        string
+}
+
+type RepoUpdateServiceAccountParam struct {
+	ClientID string
+	// The empty params are not changed
+	Name         string
+	ClientSecret string
+	Scope        string
+}
+
+type RepoCreateAuthorizationCodeParam struct {
+	Code          string
+	ClientID      string
+	UserID        int64
+	RedirectURI   string
+	CodeChallenge string
+	Scope         string
+	Nonce         string
+	// The code lifetime in seconds
+	Lifetime int
+}
+
+type RepoCreateRoleParam struct {
+	Name        string
+	Description string
+	// The permissions that don't exist yet are created with the role
+	Permissions []string
+}
+
+type RepoUserRoleParam struct {
+	UserID int64
+	Role   string
+}
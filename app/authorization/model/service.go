@@ -1,5 +1,10 @@
 package model
 
+import (
+	"github.com/dmalix/financelime-authorization/webauthn"
+	"time"
+)
+
 type ServiceSignUpParam struct {
 	Email      string
 	Language   string
@@ -12,15 +17,229 @@ type ServiceCreateAccessTokenParam struct {
 	ClientID  string
 	UserAgent string
 	Device    Device
+	// The scopes granted to the client, they are stored in the session
+	Scope string
+	// The session gets the long-lived policy
+	RememberMe bool
 }
 
 type ServiceAccessTokenReturn struct {
 	PublicSessionID string
 	AccessJWT       string
 	RefreshJWT      string
+	// The space-separated scopes granted to the access token
+	Scope string
+	// The access token lifetime in seconds
+	ExpiresIn int
+	// Set by the token endpoint if the openid scope has been granted
+	IDToken string
+	// Set instead of the tokens if the user has to pass the second factor
+	MfaChallengeToken     string
+	MfaChallengeExpiresIn int
+	// Set by the token exchange (RFC 8693, section 2.2.1)
+	IssuedTokenType string
+}
+
+type ServiceRefreshAccessTokenParam struct {
+	RefreshToken string
+	// The scopes of the new access token, they can't exceed the scopes of the session
+	Scope string
 }
 
 type ServiceRevokeRefreshTokenParam struct {
 	AccessTokenData []byte
 	PublicSessionID string
 }
+
+type ServiceRevokeAllSessionsParam struct {
+	AccessTokenData []byte
+	// The session is kept, if it's empty all the sessions of the user are revoked
+	ExceptPublicSessionID string
+}
+
+type ServiceSetPasswordParam struct {
+	ConfirmationKey string
+	Password        string
+}
+
+type ServiceUpdateUserPasswordParam struct {
+	AccessTokenData []byte
+	CurrentPassword string
+	NewPassword     string
+}
+
+type ServiceCreateTotpReturn struct {
+	Secret string
+	URI    string
+}
+
+type ServiceConfirmTotpParam struct {
+	AccessTokenData []byte
+	Code            string
+}
+
+type ServiceVerifyMfaChallengeParam struct {
+	ChallengeToken string
+	Code           string
+	// Used in place of the code if the user has no access to the authenticator app
+	RecoveryCode string
+}
+
+type ServiceFinishWebauthnRegistrationParam struct {
+	AccessTokenData []byte
+	Credential      webauthn.RegistrationCredential
+}
+
+type ServiceFinishWebauthnLoginParam struct {
+	Credential webauthn.AssertionCredential
+	ClientID   string
+	UserAgent  string
+	Device     Device
+	RememberMe bool
+}
+
+type ServiceAuthorizeParam struct {
+	AccessTokenData     []byte
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	State               string
+	Scope               string
+	Nonce               string
+}
+
+type ServiceExchangeTokenParam struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	// The authorization_code grant
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	// The refresh_token grant
+	RefreshToken string
+	// The client_credentials grant, all the scopes of the service account are granted if it's empty.
+	// The token exchange grant, the scopes of the subject token are kept if it's empty.
+	Scope string
+	// The device_code grant
+	DeviceCode string
+	// The token exchange grant
+	SubjectToken       string
+	SubjectTokenType   string
+	RequestedTokenType string
+	Audience           string
+	UserAgent          string
+}
+
+type ServiceDeviceAuthorizationParam struct {
+	ClientID     string
+	ClientSecret string
+	Scope        string
+}
+
+type ServiceDeviceAuthorizationReturn struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	// The lifetime of the codes and the minimum time between the polls, in seconds
+	ExpiresIn int
+	Interval  int
+}
+
+type ServiceDeviceVerificationReturn struct {
+	ClientID   string
+	ClientName string
+	Scope      string
+}
+
+type ServiceApproveDeviceAuthorizationParam struct {
+	AccessTokenData []byte
+	UserCode        string
+	Approved        bool
+}
+
+type ServiceIntrospectTokenParam struct {
+	ClientID     string
+	ClientSecret string
+	Token        string
+	// access_token or refresh_token, it only sets the order of the attempts
+	TokenTypeHint string
+}
+
+type ServiceRevokeTokenParam struct {
+	ClientID     string
+	ClientSecret string
+	Token        string
+	// access_token or refresh_token, it only sets the order of the attempts
+	TokenTypeHint string
+}
+
+type ServiceUserRoleParam struct {
+	UserID int64
+	Role   string
+}
+
+type ServiceUpdateUserStatusParam struct {
+	UserID    int64
+	Status    string
+	Reason    string
+	ExpiresAt *time.Time
+}
+
+type ServiceCreateServiceAccountParam struct {
+	// A random client ID is generated if it's empty
+	ClientID string
+	Name     string
+	Scope    string
+}
+
+type ServiceUpdateServiceAccountParam struct {
+	ClientID string
+	// The empty params are not changed
+	Name         string
+	Scope        string
+	RotateSecret bool
+}
+
+type ServiceCreateOauthClientParam struct {
+	// A random client ID is generated if it's empty
+	ClientID     string
+	Name         string
+	GrantTypes   []string
+	RedirectURIs []string
+	Scope        string
+	Audience     string
+	// The lifetimes of the tokens in seconds, zero for the lifetimes of the config
+	AccessTokenLifetime  int
+	RefreshTokenLifetime int
+	// The client secret is generated for the confidential client only
+	Confidential bool
+}
+
+type ServiceUpdateOauthClientParam struct {
+	ClientID string
+	// The empty params are not changed
+	Name         string
+	GrantTypes   []string
+	RedirectURIs []string
+	Scope        string
+	Audience     string
+	// Nil for no change, zero for the lifetimes of the config
+	AccessTokenLifetime  *int
+	RefreshTokenLifetime *int
+}
+
+type ServiceClientCredentialsReturn struct {
+	ClientID string
+	// Empty if the secret has not been generated
+	ClientSecret string
+}
+
+type ServiceSearchUsersParam struct {
+	Email  string
+	Limit  int
+	Offset int
+}
@@ -12,6 +12,25 @@ type User struct {
 	Email    string
 	Password string
 	Language string
+	// The client ID of the service account the access token is issued to, the user fields are empty then
+	ServiceAccount string `json:",omitempty"`
+	// The space-separated scopes granted to the access token, the first-party session without them has the full access
+	Scope string `json:",omitempty"`
+	// The token is accepted by the audience only, empty for this API. The actor of the exchanged token is
+	// the service that acts for the user.
+	Audience string `json:",omitempty"`
+	Act      *Actor `json:",omitempty"`
+	// The roles of the user and the permissions of the roles, the services check the permissions on their routes.
+	// The first-party session of the full access and the tokens of the admin scope only have them.
+	Roles       []string `json:",omitempty"`
+	Permissions []string `json:",omitempty"`
+}
+
+// Actor is the act claim of the exchanged token (RFC 8693, section 4.1), the nested actor is the previous one
+// in the delegation chain
+type Actor struct {
+	Subject string `json:"sub" example:"finance-api"`
+	Actor   *Actor `json:"act,omitempty"`
 }
 
 type Device struct {
@@ -26,11 +45,236 @@ type Session struct {
 	PublicSessionID string    `json:"sessionID"`
 	UpdatedAt       time.Time `json:"updatedAt"`
 	Platform        string    `json:"platform"`
+	// The session expires at this time unless it's refreshed, the sliding session is extended by the refresh
+	ExpiresAt  time.Time `json:"expiresAt"`
+	RememberMe bool      `json:"rememberMe"`
 }
 
 type InviteCodeRecord struct {
-	Id          int64
+	Id           int64     `json:"id"`
+	UserID       int64     `json:"userID"`
+	LimitAmount  int       `json:"limitAmount"`
+	Value        string    `json:"value"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	IssuedAmount int       `json:"issuedAmount"`
+	UserEmail    string    `json:"userEmail"`
+}
+
+// The account statuses, only the active users can sign in and refresh the tokens
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusLocked    = "locked"
+	UserStatusBanned    = "banned"
+)
+
+// UserStatusReasonDisabled is the reason of the lock of the user disabled by the administrator,
+// only this lock is lifted by the enabling
+const UserStatusReasonDisabled = "disabled"
+
+type UserRecord struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Language  string    `json:"language"`
+	CreatedAt time.Time `json:"createdAt"`
+	// The status is active again once it has expired, the disabled user is locked without a limit
+	Status          string     `json:"status"`
+	StatusReason    string     `json:"statusReason,omitempty"`
+	StatusChangedAt *time.Time `json:"statusChangedAt,omitempty"`
+	StatusExpiresAt *time.Time `json:"statusExpiresAt,omitempty"`
+}
+
+type UserMfa struct {
+	// The TOTP authenticator has been confirmed
+	Totp                bool `json:"totp"`
+	WebauthnCredentials int  `json:"webauthnCredentials"`
+}
+
+// UserDetail is the view of the user for the administrators
+type UserDetail struct {
+	User        UserRecord         `json:"user"`
+	Roles       []string           `json:"roles"`
+	Mfa         UserMfa            `json:"mfa"`
+	Sessions    []Session          `json:"sessions"`
+	InviteCodes []InviteCodeRecord `json:"inviteCodes"`
+}
+
+type Totp struct {
+	EncryptedSecret string
+	ConfirmedAt     *time.Time
+	LastUsedStep    int64
+}
+
+type MfaChallenge struct {
+	UserID     int64
+	ClientID   string
+	UserAgent  string
+	Device     Device
+	Scope      string
+	RememberMe bool
+}
+
+type WebauthnCredential struct {
+	UserID       int64
+	CredentialID string
+	// The base64url-encoded COSE_Key
+	PublicKey string
+	SignCount uint32
+}
+
+// The grant types of the registered clients, the password grant is the log in of the first-party apps
+// with the email and the password, the second factor or the passkey
+const (
+	OauthGrantTypePassword          = "password"
+	OauthGrantTypeAuthorizationCode = "authorization_code"
+	OauthGrantTypeRefreshToken      = "refresh_token"
+	OauthGrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	OauthGrantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+type OauthClient struct {
+	ClientID string `json:"clientID" example:"PWA_v0.0.1"`
+	Name     string `json:"name" example:"Financelime PWA"`
+	// Empty for the public clients, they prove the possession of the code with PKCE only
+	HashedSecret string   `json:"-"`
+	RedirectURIs []string `json:"redirectURIs" example:"https://financelime.com/callback"`
+	// The space-separated scopes the client may request
+	Scope string `json:"scope" example:"openid read:reports"`
+	// The aud claim of the access tokens, empty if the tokens are not restricted to a resource server
+	Audience   string   `json:"audience" example:"finance-api"`
+	GrantTypes []string `json:"grantTypes" example:"password,refresh_token"`
+	// The lifetimes of the tokens in seconds, the lifetimes of the config if zero
+	AccessTokenLifetime  int       `json:"accessTokenLifetime" example:"900"`
+	RefreshTokenLifetime int       `json:"refreshTokenLifetime" example:"2592000"`
+	CreatedAt            time.Time `json:"createdAt"`
+	// The disabled clients are returned by the list only, otherwise they are unknown
+	DisabledAt *time.Time `json:"disabledAt,omitempty"`
+}
+
+type ServiceAccount struct {
+	ClientID     string `json:"clientID"`
+	Name         string `json:"name"`
+	HashedSecret string `json:"-"`
+	// The space-separated scopes the service account may request
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type AuthorizationCode struct {
+	ClientID    string
 	UserID      int64
-	LimitAmount int
-	value       string
+	RedirectURI string
+	// The PKCE S256 challenge: BASE64URL(SHA256(code_verifier))
+	CodeChallenge string
+	// The space-separated scopes and the OpenID Connect nonce of the authorization request
+	Scope string
+	Nonce string
+}
+
+// IDTokenClaims are the claims of the OpenID Connect ID token (OpenID Connect Core 1.0, section 2)
+type IDTokenClaims struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Audience      string `json:"aud"`
+	ExpiresAt     int64  `json:"exp"`
+	IssuedAt      int64  `json:"iat"`
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// The statuses of the device authorization request, the user approves or denies the pending one
+const (
+	DeviceAuthorizationStatusPending  = "pending"
+	DeviceAuthorizationStatusApproved = "approved"
+	DeviceAuthorizationStatusDenied   = "denied"
+)
+
+type DeviceAuthorization struct {
+	ClientID string
+	Scope    string
+	Status   string
+	// The user who has approved the request
+	UserID    int64
+	ExpiresAt time.Time
+	// The minimum time between the polls in seconds
+	Interval int
+	// The poll results: the device code has expired or the device polls more often than the interval
+	Expired  bool
+	SlowDown bool
+}
+
+// PermissionAdmin is the permission of the admin API, the admin role is created with it by the migration
+const PermissionAdmin = "admin"
+
+// The scopes of the routes of this API. The first-party session without a scope has the full access,
+// the other clients get these routes only if the scopes are registered for them.
+const (
+	// The account of the user: the password, the second factors, the sessions and the consent to the clients
+	ScopeUser = "user"
+	// The admin API, the token needs the admin permission as well
+	ScopeAdmin = "admin"
+)
+
+type Role struct {
+	Name        string    `json:"name" example:"admin"`
+	Description string    `json:"description" example:"The administrators of the users"`
+	Permissions []string  `json:"permissions" example:"admin"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// UserAccess is the distinct roles of the user and the permissions of the roles in the alphabetical order
+type UserAccess struct {
+	Roles       []string
+	Permissions []string
+}
+
+type SessionRecord struct {
+	UserID   int64
+	ClientID string
+	// The space-separated scopes granted to the client
+	Scope string
+	// The seconds of the inactivity after which the session expires, zero for the sessions created before the policy
+	IdleTimeout int
+	// The session expires at this time regardless of the activity, nil for no limit
+	ExpiresAt *time.Time
+}
+
+// TokenIntrospection is the introspection response (RFC 7662, section 2.2), an inactive token has no other members
+type TokenIntrospection struct {
+	Active          bool   `json:"active" example:"true"`
+	Subject         string `json:"sub,omitempty" example:"2"`
+	ExpiresAt       int64  `json:"exp,omitempty" example:"1634558400"`
+	IssuedAt        int64  `json:"iat,omitempty" example:"1634554800"`
+	ClientID        string `json:"client_id,omitempty" example:"PWA_v0.0.1"`
+	Scope           string `json:"scope,omitempty" example:"openid"`
+	PublicSessionID string `json:"sid,omitempty" example:"f58f06a96b69083b7c4fb068faa6c8314af0636e44ecc710261abe1759b07755"`
+	Audience        string `json:"aud,omitempty" example:"reporting-api"`
+	Act             *Actor `json:"act,omitempty"`
+}
+
+type UserInfo struct {
+	Subject       string `json:"sub" example:"2"`
+	Email         string `json:"email" example:"user@domain.com"`
+	EmailVerified bool   `json:"email_verified" example:"true"`
+}
+
+// OpenIDConfiguration is the OpenID Provider Metadata (OpenID Connect Discovery 1.0, section 3)
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
 }
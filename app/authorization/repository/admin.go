@@ -0,0 +1,920 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"html"
+	"regexp"
+)
+
+func (r *repository) CreateUser(ctx context.Context, logger *zap.Logger, param model.RepoCreateUserParam) (model.User, error) {
+
+	var userID int64
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.User{}, err
+	}
+
+	// Check parameters
+
+	param.Email = html.EscapeString(param.Email)
+	if len(param.Email) <= 2 || len(param.Email) > 255 {
+		logger.Error("the param is not valid", zap.String("email", param.Email),
+			zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorBadParamEmail
+	}
+
+	param.Language = html.EscapeString(param.Language)
+	paramValueRegexp := regexp.MustCompile(`^[ru|en]{2}$`)
+	if !paramValueRegexp.MatchString(param.Language) {
+		logger.Error("the param is not valid", zap.String("language", param.Language),
+			zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorBadParamLang
+	}
+
+	if !isValidPassword(param.Password) {
+		logger.Error("the param is not valid", zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorBadParamPassword
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n" +
+		"LOCK TABLE \"user\" IN SHARE ROW EXCLUSIVE MODE\n")
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	// Check if an user exists with this email
+
+	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    COUNT (\n"+
+		"        \"user\".\"id\"\n"+
+		"    )\n"+
+		"FROM\n"+
+		"    \"user\"\n"+
+		"WHERE\n"+
+		"    \"user\".email = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n",
+		param.Email).Scan(&userID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	if userID != 0 {
+		logger.Error("a user with the same email address already exists", zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorUserAlreadyExist
+	}
+
+	// Create the new user
+
+	hashedPassword, err := r.passwordHasher.Hash(param.Password)
+	if err != nil {
+		logger.DPanic("failed to hash the password", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    \"user\" (\n"+
+		"        created_at,\n"+
+		"        email,\n"+
+		"        \"language\",\n"+
+		"        \"password\"\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW( ),\n"+
+		"    $1,\n"+
+		"    $2,\n"+
+		"    $3\n"+
+		") RETURNING \"id\"\n",
+		param.Email, param.Language, hashedPassword).
+		Scan(&userID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	return model.User{
+		ID:       userID,
+		Email:    param.Email,
+		Language: param.Language}, nil
+}
+
+func (r *repository) GetUserByEmail(ctx context.Context, logger *zap.Logger, email string) (model.User, error) {
+
+	var user model.User
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.User{}, err
+	}
+
+	if len(email) <= 2 || len(email) > 255 {
+		logger.Error("the param is not valid", zap.String("email", email),
+			zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorBadParamEmail
+	}
+
+	err = r.dbAuthRead.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    \"user\".\"id\",\n"+
+		"    \"user\".email,\n"+
+		"    \"user\".\"language\"\n"+
+		"FROM\n"+
+		"    \"user\"\n"+
+		"WHERE\n"+
+		"    \"user\".email = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n"+
+		"LIMIT 1\n", email).
+		Scan(&user.ID, &user.Email, &user.Language)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the user not found", zap.String(requestIDKey, requestID))
+			return model.User{}, authorization.ErrorUserNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r *repository) GetListUsers(ctx context.Context, logger *zap.Logger, param model.RepoGetListUsersParam) ([]model.UserRecord, error) {
+
+	var users []model.UserRecord
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	if param.Limit <= 0 || param.Offset < 0 {
+		logger.Error("the param is not valid", zap.Int("limit", param.Limit), zap.Int("offset", param.Offset),
+			zap.String(requestIDKey, requestID))
+		return nil, authorization.ErrorBadParams
+	}
+
+	loadUsers, err := r.dbAuthRead.Query("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    \"user\".\"id\",\n"+
+		"    \"user\".email,\n"+
+		"    \"user\".\"language\",\n"+
+		"    \"user\".created_at,\n"+
+		userStatusColumn()+",\n"+
+		"    \"user\".status_reason,\n"+
+		"    \"user\".status_changed_at,\n"+
+		"    \"user\".status_expires_at\n"+
+		"FROM\n"+
+		"    \"user\"\n"+
+		"WHERE\n"+
+		"    \"user\".deleted_at IS NULL\n"+
+		"    AND ( $3 = '' OR \"user\".email ILIKE '%' || $3 || '%' )\n"+
+		"ORDER BY\n"+
+		"    \"user\".\"id\"\n"+
+		"LIMIT $1 OFFSET $2\n",
+		param.Limit, param.Offset, param.Email)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	defer func(loadUsers *sql.Rows) {
+		if err := loadUsers.Close(); err != nil {
+			logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(loadUsers)
+
+	for loadUsers.Next() {
+		user, err := scanUserRecord(loadUsers)
+		if err != nil {
+			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// DisableUser locks the user without a limit and deletes the sessions, their public IDs are returned to revoke
+// the access tokens
+func (r *repository) DisableUser(ctx context.Context, logger *zap.Logger, userID int64) ([]string, error) {
+
+	var publicSessionIDs []string
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	result, err := dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    \"user\"\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    status = $2,\n"+
+		"    status_reason = $3,\n"+
+		"    status_changed_at = NOW( ),\n"+
+		"    status_expires_at = NULL\n"+
+		"WHERE\n"+
+		"    \"user\".\"id\" = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n",
+		userID, model.UserStatusLocked, model.UserStatusReasonDisabled)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	if affected == 0 {
+		logger.Error("the user not found", zap.Int64("userID", userID), zap.String(requestIDKey, requestID))
+		return nil, authorization.ErrorUserNotFound
+	}
+
+	// A disabled user should not keep the active sessions
+
+	loadPublicSessionIDs, err := dbTransactionAuthMain.Query("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    \"session\"\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    \"session\".user_id = $1\n"+
+		"    AND \"session\".deleted_at IS NULL\n"+
+		"RETURNING\n"+
+		"    \"session\".public_id\n",
+		userID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	for loadPublicSessionIDs.Next() {
+		var publicSessionID string
+		err = loadPublicSessionIDs.Scan(&publicSessionID)
+		if err != nil {
+			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+			_ = loadPublicSessionIDs.Close()
+			return nil, err
+		}
+		publicSessionIDs = append(publicSessionIDs, publicSessionID)
+	}
+
+	// The result set must be closed before the commit of the transaction
+	if err := loadPublicSessionIDs.Close(); err != nil {
+		logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	return publicSessionIDs, nil
+}
+
+func (r *repository) CreateInviteCode(ctx context.Context, logger *zap.Logger, param model.RepoCreateInviteCodeParam) (model.InviteCodeRecord, error) {
+
+	var inviteCodeID int64
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.InviteCodeRecord{}, err
+	}
+
+	// Check parameters
+
+	paramValueRegexp := regexp.MustCompile(`^[0-9a-zA-Z_-]{3,16}$`)
+	if !paramValueRegexp.MatchString(param.Value) {
+		logger.Error("the param is not valid", zap.String("inviteCode", param.Value),
+			zap.String(requestIDKey, requestID))
+		return model.InviteCodeRecord{}, authorization.ErrorBadParamInvite
+	}
+
+	if param.LimitAmount <= 0 || param.LimitAmount > 32767 {
+		logger.Error("the param is not valid", zap.Int("limitAmount", param.LimitAmount),
+			zap.String(requestIDKey, requestID))
+		return model.InviteCodeRecord{}, authorization.ErrorBadParams
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.InviteCodeRecord{}, err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n" +
+		"LOCK TABLE invite_code IN SHARE ROW EXCLUSIVE MODE\n")
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.InviteCodeRecord{}, err
+	}
+
+	// Check if an invite code exists with this value
+
+	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    COUNT (\n"+
+		"        invite_code.\"id\"\n"+
+		"    )\n"+
+		"FROM\n"+
+		"    invite_code\n"+
+		"WHERE\n"+
+		"    invite_code.\"value\" = $1\n"+
+		"    AND invite_code.deleted_at IS NULL\n",
+		param.Value).Scan(&inviteCodeID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.InviteCodeRecord{}, err
+	}
+
+	if inviteCodeID != 0 {
+		logger.Error("an invite code with the same value already exists", zap.String(requestIDKey, requestID))
+		return model.InviteCodeRecord{}, authorization.ErrorInviteAlreadyExist
+	}
+
+	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    invite_code (\n"+
+		"        created_at,\n"+
+		"        user_id,\n"+
+		"        expires_at,\n"+
+		"        number_limit,\n"+
+		"        \"value\"\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW( ),\n"+
+		"    $1,\n"+
+		"    $2,\n"+
+		"    $3,\n"+
+		"    $4\n"+
+		") RETURNING \"id\"\n",
+		param.UserID, param.ExpiresAt, param.LimitAmount, param.Value).
+		Scan(&inviteCodeID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.InviteCodeRecord{}, err
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.InviteCodeRecord{}, err
+	}
+
+	return model.InviteCodeRecord{
+		Id:          inviteCodeID,
+		UserID:      param.UserID,
+		LimitAmount: param.LimitAmount,
+		Value:       param.Value,
+		ExpiresAt:   param.ExpiresAt}, nil
+}
+
+// GetListInviteCodes returns the active invite codes. If userID is zero, the invite codes of all users are returned.
+func (r *repository) GetListInviteCodes(ctx context.Context, logger *zap.Logger, userID int64) ([]model.InviteCodeRecord, error) {
+
+	var inviteCodes []model.InviteCodeRecord
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	loadInviteCodes, err := r.dbAuthRead.Query("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    invite_code.\"id\",\n"+
+		"    invite_code.user_id,\n"+
+		"    \"user\".email,\n"+
+		"    invite_code.\"value\",\n"+
+		"    invite_code.number_limit,\n"+
+		"    invite_code.expires_at,\n"+
+		"    COUNT (\n"+
+		"        invite_code_issued.\"id\"\n"+
+		"    )\n"+
+		"FROM\n"+
+		"    invite_code\n"+
+		"INNER JOIN \"user\" ON\n"+
+		"    invite_code.user_id = \"user\".\"id\"\n"+
+		"LEFT JOIN invite_code_issued ON\n"+
+		"    invite_code.\"id\" = invite_code_issued.invite_code_id\n"+
+		"    AND invite_code_issued.deleted_at IS NULL\n"+
+		"WHERE\n"+
+		"    invite_code.deleted_at IS NULL\n"+
+		"    AND ( $1 = 0 OR invite_code.user_id = $1 )\n"+
+		"GROUP BY\n"+
+		"    invite_code.\"id\",\n"+
+		"    \"user\".email\n"+
+		"ORDER BY\n"+
+		"    invite_code.\"id\"\n",
+		userID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	defer func(loadInviteCodes *sql.Rows) {
+		if err := loadInviteCodes.Close(); err != nil {
+			logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(loadInviteCodes)
+
+	for loadInviteCodes.Next() {
+		var inviteCode model.InviteCodeRecord
+		err = loadInviteCodes.Scan(
+			&inviteCode.Id,
+			&inviteCode.UserID,
+			&inviteCode.UserEmail,
+			&inviteCode.Value,
+			&inviteCode.LimitAmount,
+			&inviteCode.ExpiresAt,
+			&inviteCode.IssuedAmount)
+		if err != nil {
+			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+			return nil, err
+		}
+		inviteCodes = append(inviteCodes, inviteCode)
+	}
+
+	return inviteCodes, nil
+}
+
+func (r *repository) RevokeInviteCode(ctx context.Context, logger *zap.Logger, value string) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    invite_code\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    invite_code.\"value\" = $1\n"+
+		"    AND invite_code.deleted_at IS NULL\n",
+		value)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the invite code does not exist", zap.String("inviteCode", value),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorInviteNotFound
+	}
+
+	return nil
+}
+
+// DeleteUserSessions revokes the active sessions of the user and returns their public IDs
+func (r *repository) DeleteUserSessions(ctx context.Context, logger *zap.Logger, param model.RepoDeleteUserSessionsParam) ([]string, error) {
+
+	var publicSessionIDs []string
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	loadPublicSessionIDs, err := r.dbAuthMain.Query("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    \"session\"\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    \"session\".user_id = $1\n"+
+		"    AND \"session\".public_id <> $2\n"+
+		"    AND \"session\".deleted_at IS NULL\n"+
+		"RETURNING\n"+
+		"    \"session\".public_id\n",
+		param.UserID,
+		param.ExceptPublicSessionID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	defer func(loadPublicSessionIDs *sql.Rows) {
+		if err := loadPublicSessionIDs.Close(); err != nil {
+			logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(loadPublicSessionIDs)
+
+	for loadPublicSessionIDs.Next() {
+		var publicSessionID string
+		err = loadPublicSessionIDs.Scan(&publicSessionID)
+		if err != nil {
+			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+			return nil, err
+		}
+		publicSessionIDs = append(publicSessionIDs, publicSessionID)
+	}
+
+	return publicSessionIDs, nil
+}
+
+// GetUserRecord returns the user whatever the status is, unlike GetUserByID
+func (r *repository) GetUserRecord(ctx context.Context, logger *zap.Logger, userID int64) (model.UserRecord, error) {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.UserRecord{}, err
+	}
+
+	user, err := scanUserRecord(r.dbAuthRead.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    \"user\".\"id\",\n"+
+		"    \"user\".email,\n"+
+		"    \"user\".\"language\",\n"+
+		"    \"user\".created_at,\n"+
+		userStatusColumn()+",\n"+
+		"    \"user\".status_reason,\n"+
+		"    \"user\".status_changed_at,\n"+
+		"    \"user\".status_expires_at\n"+
+		"FROM\n"+
+		"    \"user\"\n"+
+		"WHERE\n"+
+		"    \"user\".\"id\" = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n"+
+		"LIMIT 1\n", userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the user not found", zap.Int64("userID", userID), zap.String(requestIDKey, requestID))
+			return model.UserRecord{}, authorization.ErrorUserNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.UserRecord{}, err
+	}
+
+	return user, nil
+}
+
+// rowScanner is either *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUserRecord reads the row of the user with the status
+func scanUserRecord(row rowScanner) (model.UserRecord, error) {
+
+	var user model.UserRecord
+	var statusChangedAt, statusExpiresAt sql.NullTime
+
+	err := row.Scan(&user.ID, &user.Email, &user.Language, &user.CreatedAt,
+		&user.Status, &user.StatusReason, &statusChangedAt, &statusExpiresAt)
+	if err != nil {
+		return model.UserRecord{}, err
+	}
+	if statusChangedAt.Valid {
+		user.StatusChangedAt = &statusChangedAt.Time
+	}
+	if statusExpiresAt.Valid {
+		user.StatusExpiresAt = &statusExpiresAt.Time
+	}
+
+	return user, nil
+}
+
+// EnableUser lifts the lock of DisableUser, the other statuses are kept. It's idempotent, the sessions deleted
+// by DisableUser are not restored.
+func (r *repository) EnableUser(ctx context.Context, logger *zap.Logger, userID int64) error {
+
+	var userExists bool
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    \"user\"\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    status = $2,\n"+
+		"    status_reason = '',\n"+
+		"    status_changed_at = NOW( ),\n"+
+		"    status_expires_at = NULL\n"+
+		"WHERE\n"+
+		"    \"user\".\"id\" = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n"+
+		"    AND \"user\".status = $3\n"+
+		"    AND \"user\".status_reason = $4\n",
+		userID, model.UserStatusActive, model.UserStatusLocked, model.UserStatusReasonDisabled)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	// The user is not disabled or not found
+
+	err = r.dbAuthRead.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    EXISTS (\n"+
+		"        SELECT\n"+
+		"            1\n"+
+		"        FROM\n"+
+		"            \"user\"\n"+
+		"        WHERE\n"+
+		"            \"user\".\"id\" = $1\n"+
+		"            AND \"user\".deleted_at IS NULL\n"+
+		"    )\n",
+		userID).Scan(&userExists)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if !userExists {
+		logger.Error("the user not found", zap.Int64("userID", userID), zap.String(requestIDKey, requestID))
+		return authorization.ErrorUserNotFound
+	}
+
+	return nil
+}
+
+// DeleteUser marks the user and the sessions as deleted, the record is kept for the audit
+func (r *repository) DeleteUser(ctx context.Context, logger *zap.Logger, userID int64) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	result, err := dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    \"user\"\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    \"user\".\"id\" = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n",
+		userID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the user not found", zap.Int64("userID", userID), zap.String(requestIDKey, requestID))
+		return authorization.ErrorUserNotFound
+	}
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    \"session\"\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    \"session\".user_id = $1\n"+
+		"    AND \"session\".deleted_at IS NULL\n",
+		userID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+// ExpireUserPassword replaces the password of the user, so the current one can't be used anymore
+func (r *repository) ExpireUserPassword(ctx context.Context, logger *zap.Logger, param model.RepoExpireUserPasswordParam) (model.User, error) {
+
+	var user model.User
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.User{}, err
+	}
+
+	if len(param.Password) == 0 {
+		logger.DPanic("the password param is empty", zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorBadParams
+	}
+
+	hashedPassword, err := r.passwordHasher.Hash(param.Password)
+	if err != nil {
+		logger.DPanic("failed to hash the password", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	err = r.dbAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    \"user\"\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    \"password\" = $2\n"+
+		"WHERE\n"+
+		"    \"user\".\"id\" = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n"+
+		"RETURNING\n"+
+		"    \"user\".\"id\",\n"+
+		"    \"user\".email,\n"+
+		"    \"user\".\"language\"\n",
+		param.UserID, hashedPassword).
+		Scan(&user.ID, &user.Email, &user.Language)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the user not found", zap.Int64("userID", param.UserID), zap.String(requestIDKey, requestID))
+			return model.User{}, authorization.ErrorUserNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+// RenewSignUpConfirmation sets the new confirmation key of the latest sign-up request of the email,
+// the request gets the new expiration time even if it has already expired
+func (r *repository) RenewSignUpConfirmation(ctx context.Context, logger *zap.Logger, param model.RepoRenewSignUpConfirmationParam) (model.User, error) {
+
+	var userID int64
+	var user model.User
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.User{}, err
+	}
+
+	// Check parameters
+
+	param.Email = html.EscapeString(param.Email)
+	if len(param.Email) <= 2 || len(param.Email) > 255 {
+		logger.Error("the param is not valid", zap.String("email", param.Email),
+			zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorBadParamEmail
+	}
+
+	paramValueRegexp := regexp.MustCompile(`^[abcefghijkmnopqrtuvwxyz23479]{16}$`)
+	if !paramValueRegexp.MatchString(param.ConfirmationKey) {
+		logger.DPanic("the confirmationKey param is not valid", zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorBadParamConfirmationKey
+	}
+
+	// The sign-up has already been confirmed
+
+	err = r.dbAuthRead.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    \"user\".\"id\"\n"+
+		"FROM\n"+
+		"    \"user\"\n"+
+		"WHERE\n"+
+		"    \"user\".email = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n"+
+		"LIMIT 1\n", param.Email).
+		Scan(&userID)
+	if err != nil && err != sql.ErrNoRows {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+	if userID != 0 {
+		logger.Error("the sign-up of the user has already been confirmed", zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorUserAlreadyExist
+	}
+
+	// TODO Move the 1440 value of interval to config
+	err = r.dbBlade.QueryRow("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    confirmation_create_new_user\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    confirmation_key = $2,\n"+
+		"    expires_at = NOW( ) + INTERVAL '1440 minute'\n"+
+		"WHERE\n"+
+		"    confirmation_create_new_user.\"id\" = (\n"+
+		"        SELECT\n"+
+		"            confirmation_create_new_user.\"id\"\n"+
+		"        FROM\n"+
+		"            confirmation_create_new_user\n"+
+		"        WHERE\n"+
+		"            confirmation_create_new_user.email = $1\n"+
+		"            AND confirmation_create_new_user.deleted_at IS NULL\n"+
+		"        ORDER BY\n"+
+		"            confirmation_create_new_user.\"id\" DESC\n"+
+		"        LIMIT 1\n"+
+		"    )\n"+
+		"RETURNING\n"+
+		"    confirmation_create_new_user.email,\n"+
+		"    confirmation_create_new_user.\"language\"\n",
+		param.Email, param.ConfirmationKey).
+		Scan(&user.Email, &user.Language)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the sign-up request not found", zap.String(requestIDKey, requestID))
+			return model.User{}, authorization.ErrorUserNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,317 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+)
+
+// CreateDeviceAuthorization stores the pending request, the user code must be unique among the pending requests
+func (r *repository) CreateDeviceAuthorization(ctx context.Context, logger *zap.Logger, param model.RepoCreateDeviceAuthorizationParam) error {
+
+	var requestAmount int
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	hashedDeviceCode, err := r.hashToken(param.DeviceCode)
+	if err != nil {
+		logger.DPanic("failed to generate hash for device code", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	// Begin the transaction
+
+	dbTransactionBlade, err := r.dbBlade.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin Blade DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	defer func(dbTransactionBlade *sql.Tx) {
+		err := dbTransactionBlade.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback Blade DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionBlade)
+
+	_, err = dbTransactionBlade.Exec("/* postgreSQL query */\n" +
+		"LOCK TABLE device_authorization IN SHARE ROW EXCLUSIVE MODE\n")
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = dbTransactionBlade.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    COUNT( device_authorization.\"id\" )\n"+
+		"FROM\n"+
+		"    device_authorization\n"+
+		"WHERE\n"+
+		"    device_authorization.user_code = $1\n"+
+		"    AND device_authorization.deleted_at IS NULL\n"+
+		"    AND device_authorization.expires_at > NOW( )\n",
+		param.UserCode).
+		Scan(&requestAmount)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if requestAmount > 0 {
+		logger.Error("a request with the same user code already exists", zap.String(requestIDKey, requestID))
+		return authorization.ErrorUserCodeAlreadyExist
+	}
+
+	_, err = dbTransactionBlade.Exec("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    device_authorization (\n"+
+		"        created_at,\n"+
+		"        hashed_device_code,\n"+
+		"        user_code,\n"+
+		"        client_id,\n"+
+		"        scope,\n"+
+		"        expires_at,\n"+
+		"        polling_interval\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW(),\n"+
+		"    $1,\n"+
+		"    $2,\n"+
+		"    $3,\n"+
+		"    $4,\n"+
+		"    NOW( ) + $5 * INTERVAL '1 second',\n"+
+		"    $6\n"+
+		")\n",
+		hashedDeviceCode,
+		param.UserCode,
+		param.ClientID,
+		param.Scope,
+		param.Lifetime,
+		param.Interval)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = dbTransactionBlade.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the Blade DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+// GetDeviceAuthorization returns the pending request of the user code for the verification page
+func (r *repository) GetDeviceAuthorization(ctx context.Context, logger *zap.Logger, userCode string) (model.DeviceAuthorization, error) {
+
+	var deviceAuthorization model.DeviceAuthorization
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.DeviceAuthorization{}, err
+	}
+
+	err = r.dbBlade.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    device_authorization.client_id,\n"+
+		"    device_authorization.scope,\n"+
+		"    device_authorization.status,\n"+
+		"    device_authorization.expires_at\n"+
+		"FROM\n"+
+		"    device_authorization\n"+
+		"WHERE\n"+
+		"    device_authorization.user_code = $1\n"+
+		"    AND device_authorization.status = $2\n"+
+		"    AND device_authorization.deleted_at IS NULL\n"+
+		"    AND device_authorization.expires_at > NOW( )\n"+
+		"LIMIT 1\n",
+		userCode,
+		model.DeviceAuthorizationStatusPending).
+		Scan(&deviceAuthorization.ClientID, &deviceAuthorization.Scope, &deviceAuthorization.Status,
+			&deviceAuthorization.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the user code not found", zap.String(requestIDKey, requestID))
+			return model.DeviceAuthorization{}, authorization.ErrorUserCodeNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.DeviceAuthorization{}, err
+	}
+
+	return deviceAuthorization, nil
+}
+
+// UpdateDeviceAuthorization approves or denies the pending request, the decision can't be changed
+func (r *repository) UpdateDeviceAuthorization(ctx context.Context, logger *zap.Logger, param model.RepoUpdateDeviceAuthorizationParam) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	status := model.DeviceAuthorizationStatusDenied
+	if param.Approved {
+		status = model.DeviceAuthorizationStatusApproved
+	}
+
+	result, err := r.dbBlade.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    device_authorization\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    status = $1,\n"+
+		"    user_id = $2\n"+
+		"WHERE\n"+
+		"    device_authorization.user_code = $3\n"+
+		"    AND device_authorization.status = $4\n"+
+		"    AND device_authorization.deleted_at IS NULL\n"+
+		"    AND device_authorization.expires_at > NOW( )\n",
+		status,
+		param.UserID,
+		param.UserCode,
+		model.DeviceAuthorizationStatusPending)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the user code not found", zap.String(requestIDKey, requestID))
+		return authorization.ErrorUserCodeNotFound
+	}
+
+	return nil
+}
+
+// PollDeviceAuthorization returns the request of the device code and records the time of the poll.
+// The expired request is returned as well, so the device learns it has to start again. The poll that
+// comes earlier than the interval increases the interval of the request (RFC 8628, section 3.5).
+func (r *repository) PollDeviceAuthorization(ctx context.Context, logger *zap.Logger,
+	param model.RepoPollDeviceAuthorizationParam) (model.DeviceAuthorization, error) {
+
+	var deviceAuthorization model.DeviceAuthorization
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.DeviceAuthorization{}, err
+	}
+
+	hashedDeviceCode, err := r.hashToken(param.DeviceCode)
+	if err != nil {
+		logger.DPanic("failed to generate hash for device code", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.DeviceAuthorization{}, err
+	}
+
+	// The previous poll time is read under the row lock, two concurrent polls can't both pass the interval
+
+	err = r.dbBlade.QueryRow("/* postgreSQL query */\n"+
+		"WITH previous AS (\n"+
+		"    SELECT\n"+
+		"        device_authorization.\"id\",\n"+
+		"        COALESCE( device_authorization.polled_at > NOW( ) -\n"+
+		"            device_authorization.polling_interval * INTERVAL '1 second', FALSE ) AS slow_down\n"+
+		"    FROM\n"+
+		"        device_authorization\n"+
+		"    WHERE\n"+
+		"        device_authorization.hashed_device_code = $1\n"+
+		"        AND device_authorization.deleted_at IS NULL\n"+
+		"    LIMIT 1\n"+
+		"    FOR UPDATE\n"+
+		")\n"+
+		"UPDATE\n"+
+		"    device_authorization\n"+
+		"SET\n"+
+		"    polled_at = NOW( ),\n"+
+		"    polling_interval = CASE WHEN previous.slow_down\n"+
+		"        THEN device_authorization.polling_interval + $2\n"+
+		"        ELSE device_authorization.polling_interval END\n"+
+		"FROM\n"+
+		"    previous\n"+
+		"WHERE\n"+
+		"    device_authorization.\"id\" = previous.\"id\"\n"+
+		"RETURNING\n"+
+		"    device_authorization.client_id,\n"+
+		"    device_authorization.scope,\n"+
+		"    device_authorization.status,\n"+
+		"    COALESCE( device_authorization.user_id, 0 ),\n"+
+		"    device_authorization.expires_at,\n"+
+		"    device_authorization.polling_interval,\n"+
+		"    device_authorization.expires_at <= NOW( ),\n"+
+		"    previous.slow_down\n",
+		hashedDeviceCode,
+		param.SlowDownIncrement).
+		Scan(&deviceAuthorization.ClientID, &deviceAuthorization.Scope, &deviceAuthorization.Status,
+			&deviceAuthorization.UserID, &deviceAuthorization.ExpiresAt, &deviceAuthorization.Interval,
+			&deviceAuthorization.Expired, &deviceAuthorization.SlowDown)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the device code not found", zap.String(requestIDKey, requestID))
+			return model.DeviceAuthorization{}, authorization.ErrorDeviceCodeNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.DeviceAuthorization{}, err
+	}
+
+	return deviceAuthorization, nil
+}
+
+// DeleteDeviceAuthorization consumes the approved request, the device code can be exchanged only once
+func (r *repository) DeleteDeviceAuthorization(ctx context.Context, logger *zap.Logger, deviceCode string) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	hashedDeviceCode, err := r.hashToken(deviceCode)
+	if err != nil {
+		logger.DPanic("failed to generate hash for device code", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	result, err := r.dbBlade.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    device_authorization\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    device_authorization.hashed_device_code = $1\n"+
+		"    AND device_authorization.status = $2\n"+
+		"    AND device_authorization.deleted_at IS NULL\n"+
+		"    AND device_authorization.expires_at > NOW( )\n",
+		hashedDeviceCode,
+		model.DeviceAuthorizationStatusApproved)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the device code not found", zap.String(requestIDKey, requestID))
+		return authorization.ErrorDeviceCodeNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,577 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+)
+
+// The number of the one-time codes that can be tried with one challenge token
+const mfaChallengeAttemptsLimit = 5
+
+// GetUserByID returns the user who can sign in, the user who is not active gets the error of the status
+func (r *repository) GetUserByID(ctx context.Context, logger *zap.Logger, userID int64) (model.User, error) {
+
+	var user model.User
+	var status string
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.User{}, err
+	}
+
+	err = r.dbAuthRead.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    \"user\".\"id\",\n"+
+		"    \"user\".email,\n"+
+		"    \"user\".\"language\",\n"+
+		userStatusColumn()+"\n"+
+		"FROM\n"+
+		"    \"user\"\n"+
+		"WHERE\n"+
+		"    \"user\".\"id\" = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n"+
+		"LIMIT 1\n", userID).
+		Scan(&user.ID, &user.Email, &user.Language, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the user not found", zap.Int64("userID", userID), zap.String(requestIDKey, requestID))
+			return model.User{}, authorization.ErrorUserNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	if err = userStatusError(status); err != nil {
+		logger.Error("the user is not active", zap.Int64("userID", user.ID), zap.String("status", status),
+			zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r *repository) CreateTotp(ctx context.Context, logger *zap.Logger, param model.RepoCreateTotpParam) error {
+
+	var confirmedAmount int
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    COUNT( user_totp.\"id\" )\n"+
+		"FROM\n"+
+		"    user_totp\n"+
+		"WHERE\n"+
+		"    user_totp.user_id = $1\n"+
+		"    AND user_totp.deleted_at IS NULL\n"+
+		"    AND user_totp.confirmed_at IS NOT NULL\n",
+		param.UserID).
+		Scan(&confirmedAmount)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if confirmedAmount > 0 {
+		logger.Error("the two-factor authentication is already enabled", zap.Int64("userID", param.UserID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorMfaAlreadyEnabled
+	}
+
+	// Only the latest secret can be confirmed
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    user_totp\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    user_totp.user_id = $1\n"+
+		"    AND user_totp.deleted_at IS NULL\n",
+		param.UserID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    user_totp (\n"+
+		"        created_at,\n"+
+		"        user_id,\n"+
+		"        encrypted_secret\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW(),\n"+
+		"    $1,\n"+
+		"    $2\n"+
+		")\n",
+		param.UserID,
+		param.EncryptedSecret)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) GetTotp(ctx context.Context, logger *zap.Logger, userID int64) (model.Totp, error) {
+
+	var totp model.Totp
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.Totp{}, err
+	}
+
+	err = r.dbAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    user_totp.encrypted_secret,\n"+
+		"    user_totp.confirmed_at,\n"+
+		"    user_totp.last_used_step\n"+
+		"FROM\n"+
+		"    user_totp\n"+
+		"WHERE\n"+
+		"    user_totp.user_id = $1\n"+
+		"    AND user_totp.deleted_at IS NULL\n"+
+		"ORDER BY\n"+
+		"    user_totp.\"id\" DESC\n"+
+		"LIMIT 1\n", userID).
+		Scan(&totp.EncryptedSecret, &totp.ConfirmedAt, &totp.LastUsedStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return model.Totp{}, authorization.ErrorMfaNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.Totp{}, err
+	}
+
+	return totp, nil
+}
+
+func (r *repository) ConfirmTotp(ctx context.Context, logger *zap.Logger, param model.RepoTotpStepParam) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    user_totp\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    confirmed_at = NOW( ),\n"+
+		"    last_used_step = $1\n"+
+		"WHERE\n"+
+		"    user_totp.user_id = $2\n"+
+		"    AND user_totp.deleted_at IS NULL\n"+
+		"    AND user_totp.confirmed_at IS NULL\n",
+		param.Step,
+		param.UserID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the two-factor authentication is already enabled", zap.Int64("userID", param.UserID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorMfaAlreadyEnabled
+	}
+
+	return nil
+}
+
+func (r *repository) UseTotpStep(ctx context.Context, logger *zap.Logger, param model.RepoTotpStepParam) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	// A code can not be used twice, neither can the codes older than the last used one
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    user_totp\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    last_used_step = $1\n"+
+		"WHERE\n"+
+		"    user_totp.user_id = $2\n"+
+		"    AND user_totp.deleted_at IS NULL\n"+
+		"    AND user_totp.confirmed_at IS NOT NULL\n"+
+		"    AND user_totp.last_used_step < $1\n",
+		param.Step,
+		param.UserID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the one-time code has already been used", zap.Int64("userID", param.UserID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadMfaCode
+	}
+
+	return nil
+}
+
+func (r *repository) CreateMfaChallenge(ctx context.Context, logger *zap.Logger, param model.RepoCreateMfaChallengeParam) error {
+
+	remoteAddr, _, err := r.contextGetter.GetRemoteAddr(ctx)
+	if err != nil {
+		logger.DPanic("failed to get remoteAddr", zap.Error(err))
+		return err
+	}
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	hashedChallengeToken, err := r.hashToken(param.ChallengeToken)
+	if err != nil {
+		logger.DPanic("failed to generate hash for challenge token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	_, err = r.dbBlade.Exec("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    mfa_challenge (\n"+
+		"        created_at,\n"+
+		"        user_id,\n"+
+		"        hashed_challenge_token,\n"+
+		"        expires_at,\n"+
+		"        remote_addr,\n"+
+		"        client_id,\n"+
+		"        platform,\n"+
+		"        height,\n"+
+		"        width,\n"+
+		"        \"language\",\n"+
+		"        timezone,\n"+
+		"        user_agent,\n"+
+		"        scope,\n"+
+		"        remember_me\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW(),\n"+
+		"    $1,\n"+
+		"    $2,\n"+
+		"    NOW( ) + $3 * INTERVAL '1 second',\n"+
+		"    $4,\n"+
+		"    $5,\n"+
+		"    $6,\n"+
+		"    $7,\n"+
+		"    $8,\n"+
+		"    $9,\n"+
+		"    $10,\n"+
+		"    $11,\n"+
+		"    $12,\n"+
+		"    $13\n"+
+		")\n",
+		param.UserID,
+		hashedChallengeToken,
+		param.Lifetime,
+		remoteAddr,
+		param.ClientID,
+		param.Device.Platform,
+		param.Device.Height,
+		param.Device.Width,
+		param.Device.Language,
+		param.Device.Timezone,
+		param.UserAgent,
+		param.Scope,
+		param.RememberMe)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+// GetMfaChallenge counts each call as an attempt, so the one-time code can not be brute-forced
+// within the challenge token lifetime
+func (r *repository) GetMfaChallenge(ctx context.Context, logger *zap.Logger, challengeToken string) (model.MfaChallenge, error) {
+
+	var challenge model.MfaChallenge
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.MfaChallenge{}, err
+	}
+
+	hashedChallengeToken, err := r.hashToken(challengeToken)
+	if err != nil {
+		logger.DPanic("failed to generate hash for challenge token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.MfaChallenge{}, err
+	}
+
+	err = r.dbBlade.QueryRow("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    mfa_challenge\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    attempts = mfa_challenge.attempts + 1\n"+
+		"WHERE\n"+
+		"    mfa_challenge.hashed_challenge_token = $1\n"+
+		"    AND mfa_challenge.deleted_at IS NULL\n"+
+		"    AND mfa_challenge.expires_at > NOW( )\n"+
+		"    AND mfa_challenge.attempts < $2\n"+
+		"RETURNING\n"+
+		"    mfa_challenge.user_id,\n"+
+		"    mfa_challenge.client_id,\n"+
+		"    mfa_challenge.platform,\n"+
+		"    mfa_challenge.height,\n"+
+		"    mfa_challenge.width,\n"+
+		"    mfa_challenge.\"language\",\n"+
+		"    mfa_challenge.timezone,\n"+
+		"    mfa_challenge.user_agent,\n"+
+		"    mfa_challenge.scope,\n"+
+		"    mfa_challenge.remember_me\n",
+		hashedChallengeToken,
+		mfaChallengeAttemptsLimit).
+		Scan(&challenge.UserID, &challenge.ClientID, &challenge.Device.Platform, &challenge.Device.Height,
+			&challenge.Device.Width, &challenge.Device.Language, &challenge.Device.Timezone, &challenge.UserAgent,
+			&challenge.Scope, &challenge.RememberMe)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the challenge token not found", zap.String(requestIDKey, requestID))
+			return model.MfaChallenge{}, authorization.ErrorMfaChallengeNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.MfaChallenge{}, err
+	}
+
+	return challenge, nil
+}
+
+func (r *repository) DeleteMfaChallenge(ctx context.Context, logger *zap.Logger, challengeToken string) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	hashedChallengeToken, err := r.hashToken(challengeToken)
+	if err != nil {
+		logger.DPanic("failed to generate hash for challenge token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	_, err = r.dbBlade.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    mfa_challenge\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    mfa_challenge.hashed_challenge_token = $1\n"+
+		"    AND mfa_challenge.deleted_at IS NULL\n",
+		hashedChallengeToken)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) ReplaceRecoveryCodes(ctx context.Context, logger *zap.Logger, param model.RepoReplaceRecoveryCodesParam) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	// The old set is invalidated, including the codes that have not been used yet
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    user_recovery_code\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    user_recovery_code.user_id = $1\n"+
+		"    AND user_recovery_code.deleted_at IS NULL\n",
+		param.UserID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	for _, recoveryCode := range param.RecoveryCodes {
+		hashedRecoveryCode, err := r.hashToken(recoveryCode)
+		if err != nil {
+			logger.DPanic("failed to generate hash for recovery code", zap.Error(err), zap.String(requestIDKey, requestID))
+			return err
+		}
+		_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+			"INSERT\n"+
+			"    INTO\n"+
+			"    user_recovery_code (\n"+
+			"        created_at,\n"+
+			"        user_id,\n"+
+			"        hashed_code\n"+
+			"    )\n"+
+			"VALUES (\n"+
+			"    NOW(),\n"+
+			"    $1,\n"+
+			"    $2\n"+
+			")\n",
+			param.UserID,
+			hashedRecoveryCode)
+		if err != nil {
+			logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+			return err
+		}
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the code as used and returns the number of the unused codes left
+func (r *repository) UseRecoveryCode(ctx context.Context, logger *zap.Logger, param model.RepoUseRecoveryCodeParam) (int, error) {
+
+	var unusedAmount int
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return 0, err
+	}
+
+	hashedRecoveryCode, err := r.hashToken(param.RecoveryCode)
+	if err != nil {
+		logger.DPanic("failed to generate hash for recovery code", zap.Error(err), zap.String(requestIDKey, requestID))
+		return 0, err
+	}
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    user_recovery_code\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    used_at = NOW( )\n"+
+		"WHERE\n"+
+		"    user_recovery_code.user_id = $1\n"+
+		"    AND user_recovery_code.hashed_code = $2\n"+
+		"    AND user_recovery_code.deleted_at IS NULL\n"+
+		"    AND user_recovery_code.used_at IS NULL\n",
+		param.UserID,
+		hashedRecoveryCode)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return 0, err
+	}
+	if affected == 0 {
+		logger.Error("the recovery code not found or has already been used", zap.Int64("userID", param.UserID),
+			zap.String(requestIDKey, requestID))
+		return 0, authorization.ErrorBadMfaCode
+	}
+
+	err = r.dbAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    COUNT( user_recovery_code.\"id\" )\n"+
+		"FROM\n"+
+		"    user_recovery_code\n"+
+		"WHERE\n"+
+		"    user_recovery_code.user_id = $1\n"+
+		"    AND user_recovery_code.deleted_at IS NULL\n"+
+		"    AND user_recovery_code.used_at IS NULL\n",
+		param.UserID).
+		Scan(&unusedAmount)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return 0, err
+	}
+
+	return unusedAmount, nil
+}
+
+func (r *repository) hashToken(token string) (string, error) {
+	hs := sha256.New()
+	_, err := hs.Write([]byte(token + r.config.CryptoSalt))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hs.Sum(nil)), nil
+}
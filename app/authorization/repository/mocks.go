@@ -6,12 +6,46 @@ package repository
 
 import (
 	"context"
+	"github.com/dmalix/financelime-authorization/app/authorization"
 	"github.com/dmalix/financelime-authorization/app/authorization/model"
 	"go.uber.org/zap"
 )
 
 type Mock struct {
 	Props struct {
+		Totp         model.Totp
+		MfaChallenge model.MfaChallenge
+		// The user the WebAuthn ceremony was started for
+		WebauthnChallengeUserID int64
+		// The last registered credential, so a test can log in with it
+		WebauthnCredential model.WebauthnCredential
+		// The owner of the token family a reused refresh token belongs to
+		RefreshTokenFamilyUser model.User
+		// The active sessions of the user
+		PublicSessionIDs []string
+		OauthClient      model.OauthClient
+		// The other registered clients, e.g. the audience of the token exchange
+		OauthClients []model.OauthClient
+		// The last created authorization code, it's consumed by GetAuthorizationCode
+		AuthorizationCode      model.AuthorizationCode
+		AuthorizationCodeValue string
+		// The session of the introspected tokens, it's not found if the user is not set
+		Session model.SessionRecord
+		// The service account of the client_credentials grant, any secret is accepted
+		ServiceAccount model.ServiceAccount
+		// The last device authorization request, the test sets the poll results
+		DeviceAuthorization model.DeviceAuthorization
+		DeviceCode          string
+		UserCode            string
+		// The last created session
+		CreatedSession model.RepoCreateSessionParam
+		// The roles of the list and the access of the users
+		Roles      []model.Role
+		UserAccess model.UserAccess
+		// The user the admin API manages, it's not found unless the ID matches
+		UserRecord model.UserRecord
+		// The status of the user who logs in, refreshes the tokens or is got by the ID, active if it's empty
+		UserStatus string
 	}
 	Expected struct {
 		Error error
@@ -26,11 +60,19 @@ func (repo *Mock) SignUpStep2(_ context.Context, _ *zap.Logger, _ string) (model
 	return model.User{}, repo.Expected.Error
 }
 
+func (repo *Mock) SignUpStep3(_ context.Context, _ *zap.Logger, _ model.RepoSetPasswordParam) (model.User, error) {
+	return model.User{}, repo.Expected.Error
+}
+
 func (repo *Mock) GetUserByAuth(_ context.Context, _ *zap.Logger, _ model.RepoGetUserByAuthParam) (model.User, error) {
+	if repo.Props.UserStatus != "" && repo.Props.UserStatus != model.UserStatusActive {
+		return model.User{}, userStatusError(repo.Props.UserStatus)
+	}
 	return model.User{}, repo.Expected.Error
 }
 
-func (repo *Mock) CreateSession(_ context.Context, _ *zap.Logger, _ model.RepoCreateSessionParam) error {
+func (repo *Mock) CreateSession(_ context.Context, _ *zap.Logger, param model.RepoCreateSessionParam) error {
+	repo.Props.CreatedSession = param
 	return repo.Expected.Error
 }
 
@@ -43,13 +85,33 @@ func (repo *Mock) UpdateSession(_ context.Context, _ *zap.Logger, _ model.RepoUp
 }
 
 func (repo *Mock) GetUserByRefreshToken(_ context.Context, _ *zap.Logger, _ string) (model.User, error) {
+	if repo.Props.UserStatus != "" && repo.Props.UserStatus != model.UserStatusActive {
+		return model.User{}, userStatusError(repo.Props.UserStatus)
+	}
 	return model.User{}, repo.Expected.Error
 }
 
+func (repo *Mock) RevokeRefreshTokenFamily(_ context.Context, _ *zap.Logger, _ string) (model.User, []string, error) {
+	if repo.Props.RefreshTokenFamilyUser.ID == 0 {
+		return model.User{}, nil, authorization.ErrorSessionNotFound
+	}
+	return repo.Props.RefreshTokenFamilyUser, repo.Props.PublicSessionIDs, nil
+}
+
 func (repo *Mock) DeleteSession(_ context.Context, _ *zap.Logger, _ model.RepoDeleteSessionParam) error {
 	return repo.Expected.Error
 }
 
+func (repo *Mock) DeleteUserSessions(_ context.Context, _ *zap.Logger, param model.RepoDeleteUserSessionsParam) ([]string, error) {
+	var publicSessionIDs []string
+	for _, publicSessionID := range repo.Props.PublicSessionIDs {
+		if publicSessionID != param.ExceptPublicSessionID {
+			publicSessionIDs = append(publicSessionIDs, publicSessionID)
+		}
+	}
+	return publicSessionIDs, repo.Expected.Error
+}
+
 func (repo *Mock) ResetUserPasswordStep1(_ context.Context, _ *zap.Logger, _ model.RepoResetUserPasswordParam) (model.User, error) {
 	return model.User{}, repo.Expected.Error
 }
@@ -57,3 +119,368 @@ func (repo *Mock) ResetUserPasswordStep1(_ context.Context, _ *zap.Logger, _ mod
 func (repo *Mock) ResetUserPasswordStep2(_ context.Context, _ *zap.Logger, _ string) (model.User, error) {
 	return model.User{}, repo.Expected.Error
 }
+
+func (repo *Mock) ResetUserPasswordStep3(_ context.Context, _ *zap.Logger, _ model.RepoSetPasswordParam) (model.User, error) {
+	return model.User{}, repo.Expected.Error
+}
+
+func (repo *Mock) UpdateUserPassword(_ context.Context, _ *zap.Logger, _ model.RepoUpdateUserPasswordParam) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) CreateUser(_ context.Context, _ *zap.Logger, _ model.RepoCreateUserParam) (model.User, error) {
+	return model.User{}, repo.Expected.Error
+}
+
+func (repo *Mock) GetUserByEmail(_ context.Context, _ *zap.Logger, _ string) (model.User, error) {
+	return model.User{}, repo.Expected.Error
+}
+
+func (repo *Mock) GetListUsers(_ context.Context, _ *zap.Logger, _ model.RepoGetListUsersParam) ([]model.UserRecord, error) {
+	return nil, repo.Expected.Error
+}
+
+func (repo *Mock) DisableUser(_ context.Context, _ *zap.Logger, _ int64) ([]string, error) {
+	publicSessionIDs := repo.Props.PublicSessionIDs
+	repo.Props.PublicSessionIDs = nil
+	return publicSessionIDs, repo.Expected.Error
+}
+
+func (repo *Mock) GetUserRecord(_ context.Context, _ *zap.Logger, userID int64) (model.UserRecord, error) {
+	if repo.Props.UserRecord.ID != userID {
+		return model.UserRecord{}, authorization.ErrorUserNotFound
+	}
+	return repo.Props.UserRecord, repo.Expected.Error
+}
+
+func (repo *Mock) EnableUser(_ context.Context, _ *zap.Logger, _ int64) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) DeleteUser(_ context.Context, _ *zap.Logger, _ int64) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) ExpireUserPassword(_ context.Context, _ *zap.Logger, param model.RepoExpireUserPasswordParam) (model.User, error) {
+	if repo.Props.UserRecord.ID != param.UserID {
+		return model.User{}, authorization.ErrorUserNotFound
+	}
+	return model.User{
+		ID:       repo.Props.UserRecord.ID,
+		Email:    repo.Props.UserRecord.Email,
+		Language: repo.Props.UserRecord.Language}, repo.Expected.Error
+}
+
+func (repo *Mock) UpdateUserStatus(_ context.Context, _ *zap.Logger, param model.RepoUpdateUserStatusParam) ([]string, error) {
+	if err := userStatusError(param.Status); err == authorization.ErrorBadParamStatus {
+		return nil, err
+	}
+	if repo.Props.UserRecord.ID != param.UserID {
+		return nil, authorization.ErrorUserNotFound
+	}
+	repo.Props.UserStatus = param.Status
+	if param.Status == model.UserStatusActive {
+		return nil, repo.Expected.Error
+	}
+	publicSessionIDs := repo.Props.PublicSessionIDs
+	repo.Props.PublicSessionIDs = nil
+	return publicSessionIDs, repo.Expected.Error
+}
+
+func (repo *Mock) RenewSignUpConfirmation(_ context.Context, _ *zap.Logger, param model.RepoRenewSignUpConfirmationParam) (model.User, error) {
+	return model.User{Email: param.Email, Language: "en"}, repo.Expected.Error
+}
+
+func (repo *Mock) CreateInviteCode(_ context.Context, _ *zap.Logger, _ model.RepoCreateInviteCodeParam) (model.InviteCodeRecord, error) {
+	return model.InviteCodeRecord{}, repo.Expected.Error
+}
+
+func (repo *Mock) GetListInviteCodes(_ context.Context, _ *zap.Logger, _ int64) ([]model.InviteCodeRecord, error) {
+	return nil, repo.Expected.Error
+}
+
+func (repo *Mock) RevokeInviteCode(_ context.Context, _ *zap.Logger, _ string) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) GetUserByID(_ context.Context, _ *zap.Logger, userID int64) (model.User, error) {
+	if repo.Props.UserStatus != "" && repo.Props.UserStatus != model.UserStatusActive {
+		return model.User{}, userStatusError(repo.Props.UserStatus)
+	}
+	return model.User{ID: userID}, repo.Expected.Error
+}
+
+func (repo *Mock) CreateTotp(_ context.Context, _ *zap.Logger, _ model.RepoCreateTotpParam) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) GetTotp(_ context.Context, _ *zap.Logger, _ int64) (model.Totp, error) {
+	return repo.Props.Totp, repo.Expected.Error
+}
+
+func (repo *Mock) ConfirmTotp(_ context.Context, _ *zap.Logger, _ model.RepoTotpStepParam) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) UseTotpStep(_ context.Context, _ *zap.Logger, _ model.RepoTotpStepParam) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) CreateMfaChallenge(_ context.Context, _ *zap.Logger, _ model.RepoCreateMfaChallengeParam) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) GetMfaChallenge(_ context.Context, _ *zap.Logger, _ string) (model.MfaChallenge, error) {
+	return repo.Props.MfaChallenge, repo.Expected.Error
+}
+
+func (repo *Mock) DeleteMfaChallenge(_ context.Context, _ *zap.Logger, _ string) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) ReplaceRecoveryCodes(_ context.Context, _ *zap.Logger, _ model.RepoReplaceRecoveryCodesParam) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) UseRecoveryCode(_ context.Context, _ *zap.Logger, _ model.RepoUseRecoveryCodeParam) (int, error) {
+	return 9, repo.Expected.Error
+}
+
+func (repo *Mock) CreateWebauthnChallenge(_ context.Context, _ *zap.Logger, _ model.RepoCreateWebauthnChallengeParam) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) GetWebauthnChallenge(_ context.Context, _ *zap.Logger, _ model.RepoGetWebauthnChallengeParam) (int64, error) {
+	return repo.Props.WebauthnChallengeUserID, repo.Expected.Error
+}
+
+func (repo *Mock) CreateWebauthnCredential(_ context.Context, _ *zap.Logger, param model.RepoCreateWebauthnCredentialParam) error {
+	repo.Props.WebauthnCredential = model.WebauthnCredential{
+		UserID:       param.UserID,
+		CredentialID: param.CredentialID,
+		PublicKey:    param.PublicKey,
+		SignCount:    param.SignCount}
+	return repo.Expected.Error
+}
+
+func (repo *Mock) GetListWebauthnCredentials(_ context.Context, _ *zap.Logger, _ int64) ([]model.WebauthnCredential, error) {
+	return nil, repo.Expected.Error
+}
+
+func (repo *Mock) GetWebauthnCredential(_ context.Context, _ *zap.Logger, _ string) (model.WebauthnCredential, error) {
+	return repo.Props.WebauthnCredential, repo.Expected.Error
+}
+
+func (repo *Mock) UpdateWebauthnSignCount(_ context.Context, _ *zap.Logger, param model.RepoUpdateWebauthnSignCountParam) error {
+	repo.Props.WebauthnCredential.SignCount = param.SignCount
+	return repo.Expected.Error
+}
+
+func (repo *Mock) CreateOauthClient(_ context.Context, _ *zap.Logger, _ model.RepoCreateOauthClientParam) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) GetOauthClient(_ context.Context, _ *zap.Logger, clientID string) (model.OauthClient, error) {
+	if clientID == repo.Props.OauthClient.ClientID {
+		return repo.Props.OauthClient, repo.Expected.Error
+	}
+	for _, client := range repo.Props.OauthClients {
+		if clientID == client.ClientID {
+			return client, repo.Expected.Error
+		}
+	}
+	return model.OauthClient{}, authorization.ErrorInvalidClient
+}
+
+func (repo *Mock) GetListOauthClients(_ context.Context, _ *zap.Logger) ([]model.OauthClient, error) {
+	return append([]model.OauthClient{repo.Props.OauthClient}, repo.Props.OauthClients...), repo.Expected.Error
+}
+
+// GetMaxAccessTokenLifetime never fails, the revocation of the access tokens is tested with the errors of the other methods
+func (repo *Mock) GetMaxAccessTokenLifetime(_ context.Context, _ *zap.Logger) (int, error) {
+	lifetime := repo.Props.OauthClient.AccessTokenLifetime
+	for _, client := range repo.Props.OauthClients {
+		if client.AccessTokenLifetime > lifetime {
+			lifetime = client.AccessTokenLifetime
+		}
+	}
+	return lifetime, nil
+}
+
+func (repo *Mock) UpdateOauthClient(_ context.Context, _ *zap.Logger, _ model.RepoUpdateOauthClientParam) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) DisableOauthClient(_ context.Context, _ *zap.Logger, _ string) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) EnableOauthClient(_ context.Context, _ *zap.Logger, _ string) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) AuthenticateOauthClient(ctx context.Context, logger *zap.Logger,
+	param model.RepoAuthenticateOauthClientParam) (model.OauthClient, error) {
+	return repo.GetOauthClient(ctx, logger, param.ClientID)
+}
+
+func (repo *Mock) CreateAuthorizationCode(_ context.Context, _ *zap.Logger, param model.RepoCreateAuthorizationCodeParam) error {
+	repo.Props.AuthorizationCodeValue = param.Code
+	repo.Props.AuthorizationCode = model.AuthorizationCode{
+		ClientID:      param.ClientID,
+		UserID:        param.UserID,
+		RedirectURI:   param.RedirectURI,
+		CodeChallenge: param.CodeChallenge,
+		Scope:         param.Scope,
+		Nonce:         param.Nonce}
+	return repo.Expected.Error
+}
+
+func (repo *Mock) GetAuthorizationCode(_ context.Context, _ *zap.Logger, code string) (model.AuthorizationCode, error) {
+	if code == "" || code != repo.Props.AuthorizationCodeValue {
+		return model.AuthorizationCode{}, authorization.ErrorAuthorizationCodeNotFound
+	}
+	repo.Props.AuthorizationCodeValue = ""
+	return repo.Props.AuthorizationCode, repo.Expected.Error
+}
+
+func (repo *Mock) GetSessionClientID(_ context.Context, _ *zap.Logger, _ string) (string, error) {
+	return repo.Props.OauthClient.ClientID, repo.Expected.Error
+}
+
+func (repo *Mock) GetActiveSession(_ context.Context, _ *zap.Logger, _ string) (model.SessionRecord, error) {
+	if repo.Props.Session.UserID == 0 {
+		return model.SessionRecord{}, authorization.ErrorSessionNotFound
+	}
+	return repo.Props.Session, repo.Expected.Error
+}
+
+func (repo *Mock) CreateServiceAccount(_ context.Context, _ *zap.Logger, param model.RepoCreateServiceAccountParam) error {
+	repo.Props.ServiceAccount = model.ServiceAccount{
+		ClientID: param.ClientID,
+		Name:     param.Name,
+		Scope:    param.Scope}
+	return repo.Expected.Error
+}
+
+func (repo *Mock) GetServiceAccount(_ context.Context, _ *zap.Logger, clientID string) (model.ServiceAccount, error) {
+	if clientID == "" || clientID != repo.Props.ServiceAccount.ClientID {
+		return model.ServiceAccount{}, authorization.ErrorServiceAccountNotFound
+	}
+	return repo.Props.ServiceAccount, repo.Expected.Error
+}
+
+func (repo *Mock) GetListServiceAccounts(_ context.Context, _ *zap.Logger) ([]model.ServiceAccount, error) {
+	return []model.ServiceAccount{repo.Props.ServiceAccount}, repo.Expected.Error
+}
+
+func (repo *Mock) UpdateServiceAccount(_ context.Context, _ *zap.Logger, param model.RepoUpdateServiceAccountParam) error {
+	if param.ClientID == "" || param.ClientID != repo.Props.ServiceAccount.ClientID {
+		return authorization.ErrorServiceAccountNotFound
+	}
+	return repo.Expected.Error
+}
+
+func (repo *Mock) DeleteServiceAccount(_ context.Context, _ *zap.Logger, clientID string) error {
+	if clientID == "" || clientID != repo.Props.ServiceAccount.ClientID {
+		return authorization.ErrorServiceAccountNotFound
+	}
+	return repo.Expected.Error
+}
+
+func (repo *Mock) AuthenticateServiceAccount(ctx context.Context, logger *zap.Logger,
+	param model.RepoAuthenticateOauthClientParam) (model.ServiceAccount, error) {
+	account, err := repo.GetServiceAccount(ctx, logger, param.ClientID)
+	if err == authorization.ErrorServiceAccountNotFound {
+		return model.ServiceAccount{}, authorization.ErrorInvalidClient
+	}
+	return account, err
+}
+
+func (repo *Mock) CreateDeviceAuthorization(_ context.Context, _ *zap.Logger, param model.RepoCreateDeviceAuthorizationParam) error {
+	repo.Props.DeviceCode = param.DeviceCode
+	repo.Props.UserCode = param.UserCode
+	repo.Props.DeviceAuthorization = model.DeviceAuthorization{
+		ClientID: param.ClientID,
+		Scope:    param.Scope,
+		Status:   model.DeviceAuthorizationStatusPending,
+		Interval: param.Interval}
+	return repo.Expected.Error
+}
+
+func (repo *Mock) GetDeviceAuthorization(_ context.Context, _ *zap.Logger, userCode string) (model.DeviceAuthorization, error) {
+	if userCode == "" || userCode != repo.Props.UserCode ||
+		repo.Props.DeviceAuthorization.Status != model.DeviceAuthorizationStatusPending {
+		return model.DeviceAuthorization{}, authorization.ErrorUserCodeNotFound
+	}
+	return repo.Props.DeviceAuthorization, repo.Expected.Error
+}
+
+func (repo *Mock) UpdateDeviceAuthorization(ctx context.Context, logger *zap.Logger, param model.RepoUpdateDeviceAuthorizationParam) error {
+	if _, err := repo.GetDeviceAuthorization(ctx, logger, param.UserCode); err != nil {
+		return err
+	}
+	repo.Props.DeviceAuthorization.Status = model.DeviceAuthorizationStatusDenied
+	if param.Approved {
+		repo.Props.DeviceAuthorization.Status = model.DeviceAuthorizationStatusApproved
+	}
+	repo.Props.DeviceAuthorization.UserID = param.UserID
+	return repo.Expected.Error
+}
+
+func (repo *Mock) PollDeviceAuthorization(_ context.Context, _ *zap.Logger, param model.RepoPollDeviceAuthorizationParam) (model.DeviceAuthorization, error) {
+	if param.DeviceCode == "" || param.DeviceCode != repo.Props.DeviceCode {
+		return model.DeviceAuthorization{}, authorization.ErrorDeviceCodeNotFound
+	}
+	if repo.Props.DeviceAuthorization.SlowDown {
+		repo.Props.DeviceAuthorization.Interval += param.SlowDownIncrement
+	}
+	return repo.Props.DeviceAuthorization, repo.Expected.Error
+}
+
+func (repo *Mock) DeleteDeviceAuthorization(_ context.Context, _ *zap.Logger, deviceCode string) error {
+	if deviceCode == "" || deviceCode != repo.Props.DeviceCode ||
+		repo.Props.DeviceAuthorization.Status != model.DeviceAuthorizationStatusApproved {
+		return authorization.ErrorDeviceCodeNotFound
+	}
+	repo.Props.DeviceCode = ""
+	return repo.Expected.Error
+}
+
+func (repo *Mock) CreateRole(_ context.Context, _ *zap.Logger, param model.RepoCreateRoleParam) error {
+	repo.Props.Roles = append(repo.Props.Roles, model.Role{
+		Name:        param.Name,
+		Description: param.Description,
+		Permissions: param.Permissions})
+	return repo.Expected.Error
+}
+
+func (repo *Mock) GetListRoles(_ context.Context, _ *zap.Logger) ([]model.Role, error) {
+	return repo.Props.Roles, repo.Expected.Error
+}
+
+func (repo *Mock) DeleteRole(_ context.Context, _ *zap.Logger, _ string) error {
+	return repo.Expected.Error
+}
+
+func (repo *Mock) AssignUserRole(_ context.Context, _ *zap.Logger, param model.RepoUserRoleParam) error {
+	for _, role := range repo.Props.Roles {
+		if role.Name == param.Role {
+			return repo.Expected.Error
+		}
+	}
+	return authorization.ErrorRoleNotFound
+}
+
+func (repo *Mock) RevokeUserRole(_ context.Context, _ *zap.Logger, param model.RepoUserRoleParam) error {
+	for _, role := range repo.Props.UserAccess.Roles {
+		if role == param.Role {
+			return repo.Expected.Error
+		}
+	}
+	return authorization.ErrorRoleNotFound
+}
+
+func (repo *Mock) GetUserAccess(_ context.Context, _ *zap.Logger, _ int64) (model.UserAccess, error) {
+	return repo.Props.UserAccess, repo.Expected.Error
+}
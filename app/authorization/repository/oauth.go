@@ -0,0 +1,739 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package repository
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	redirectURISeparator = " "
+	grantTypeSeparator   = " "
+)
+
+func (r *repository) CreateOauthClient(ctx context.Context, logger *zap.Logger, param model.RepoCreateOauthClientParam) error {
+
+	var clientAmount int
+	var hashedSecret string
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	if !regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`).MatchString(param.ClientID) || param.Name == "" {
+		logger.Error("the client params are not valid", zap.String("clientID", param.ClientID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+	if len(param.GrantTypes) == 0 || !isValidGrantTypes(param.GrantTypes) {
+		logger.Error("the grant types are not valid", zap.Strings("grantTypes", param.GrantTypes),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+	if param.AccessTokenLifetime < 0 || param.RefreshTokenLifetime < 0 {
+		logger.Error("the token lifetimes are not valid", zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+	// Only the authorization code grant redirects the user back to the client
+	if len(param.RedirectURIs) == 0 && hasGrantType(param.GrantTypes, model.OauthGrantTypeAuthorizationCode) {
+		logger.Error("the client has no redirect URI", zap.String(requestIDKey, requestID))
+		return authorization.ErrorInvalidRedirectURI
+	}
+	for _, redirectURI := range param.RedirectURIs {
+		if !isValidRedirectURI(redirectURI) {
+			logger.Error("the redirect URI is not valid", zap.String("redirectURI", redirectURI),
+				zap.String(requestIDKey, requestID))
+			return authorization.ErrorInvalidRedirectURI
+		}
+	}
+	if param.Scope != "" && !isValidScope(param.Scope) {
+		logger.Error("the scope is not valid", zap.String(requestIDKey, requestID))
+		return authorization.ErrorInvalidScope
+	}
+	if param.Audience != "" && !regexp.MustCompile(`^[\x21-\x7e]{1,255}$`).MatchString(param.Audience) {
+		logger.Error("the audience is not valid", zap.String("audience", param.Audience),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+
+	if param.ClientSecret != "" {
+		hashedSecret, err = r.hashToken(param.ClientSecret)
+		if err != nil {
+			logger.DPanic("failed to generate hash for client secret", zap.Error(err), zap.String(requestIDKey, requestID))
+			return err
+		}
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n" +
+		"LOCK TABLE oauth_client IN SHARE ROW EXCLUSIVE MODE\n")
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    COUNT( oauth_client.\"id\" )\n"+
+		"FROM\n"+
+		"    oauth_client\n"+
+		"WHERE\n"+
+		"    oauth_client.client_id = $1\n",
+		param.ClientID).
+		Scan(&clientAmount)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if clientAmount > 0 {
+		logger.Error("the client already exists", zap.String("clientID", param.ClientID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorOauthClientAlreadyExist
+	}
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    oauth_client (\n"+
+		"        created_at,\n"+
+		"        client_id,\n"+
+		"        \"name\",\n"+
+		"        hashed_secret,\n"+
+		"        redirect_uris,\n"+
+		"        scope,\n"+
+		"        audience,\n"+
+		"        grant_types,\n"+
+		"        access_token_lifetime,\n"+
+		"        refresh_token_lifetime\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW(),\n"+
+		"    $1,\n"+
+		"    $2,\n"+
+		"    $3,\n"+
+		"    $4,\n"+
+		"    $5,\n"+
+		"    $6,\n"+
+		"    $7,\n"+
+		"    $8,\n"+
+		"    $9\n"+
+		")\n",
+		param.ClientID,
+		param.Name,
+		hashedSecret,
+		strings.Join(param.RedirectURIs, redirectURISeparator),
+		strings.Join(strings.Fields(param.Scope), scopeSeparator),
+		param.Audience,
+		strings.Join(param.GrantTypes, grantTypeSeparator),
+		param.AccessTokenLifetime,
+		param.RefreshTokenLifetime)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+// GetOauthClient returns the enabled client, the disabled one is not found as the unknown one
+func (r *repository) GetOauthClient(ctx context.Context, logger *zap.Logger, clientID string) (model.OauthClient, error) {
+
+	var client model.OauthClient
+	var redirectURIs string
+	var grantTypes string
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.OauthClient{}, err
+	}
+
+	err = r.dbAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    oauth_client.client_id,\n"+
+		"    oauth_client.\"name\",\n"+
+		"    oauth_client.hashed_secret,\n"+
+		"    oauth_client.redirect_uris,\n"+
+		"    oauth_client.scope,\n"+
+		"    oauth_client.audience,\n"+
+		"    oauth_client.grant_types,\n"+
+		"    oauth_client.access_token_lifetime,\n"+
+		"    oauth_client.refresh_token_lifetime,\n"+
+		"    oauth_client.created_at\n"+
+		"FROM\n"+
+		"    oauth_client\n"+
+		"WHERE\n"+
+		"    oauth_client.client_id = $1\n"+
+		"    AND oauth_client.deleted_at IS NULL\n"+
+		"    AND oauth_client.disabled_at IS NULL\n"+
+		"LIMIT 1\n", clientID).
+		Scan(&client.ClientID, &client.Name, &client.HashedSecret, &redirectURIs, &client.Scope, &client.Audience,
+			&grantTypes, &client.AccessTokenLifetime, &client.RefreshTokenLifetime, &client.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the client not found", zap.String("clientID", clientID), zap.String(requestIDKey, requestID))
+			return model.OauthClient{}, authorization.ErrorInvalidClient
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.OauthClient{}, err
+	}
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	client.GrantTypes = strings.Fields(grantTypes)
+
+	return client, nil
+}
+
+// AuthenticateOauthClient checks the secret of a confidential client, a public client must not send a secret
+func (r *repository) AuthenticateOauthClient(ctx context.Context, logger *zap.Logger,
+	param model.RepoAuthenticateOauthClientParam) (model.OauthClient, error) {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.OauthClient{}, err
+	}
+
+	client, err := r.GetOauthClient(ctx, logger, param.ClientID)
+	if err != nil {
+		return model.OauthClient{}, err
+	}
+
+	if client.HashedSecret == "" {
+		if param.ClientSecret != "" {
+			logger.Error("the public client has sent a secret", zap.String(requestIDKey, requestID))
+			return model.OauthClient{}, authorization.ErrorInvalidClient
+		}
+		return client, nil
+	}
+
+	hashedSecret, err := r.hashToken(param.ClientSecret)
+	if err != nil {
+		logger.DPanic("failed to generate hash for client secret", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.OauthClient{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashedSecret), []byte(client.HashedSecret)) != 1 {
+		logger.Error("the client secret is wrong", zap.String("clientID", param.ClientID), zap.String(requestIDKey, requestID))
+		return model.OauthClient{}, authorization.ErrorInvalidClient
+	}
+
+	return client, nil
+}
+
+// GetMaxAccessTokenLifetime returns the longest lifetime of the access tokens of the clients in seconds, zero if all
+// the clients have the lifetime of the config. The deleted clients count too, their tokens may not have expired yet.
+func (r *repository) GetMaxAccessTokenLifetime(ctx context.Context, logger *zap.Logger) (int, error) {
+
+	var lifetime int
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return 0, err
+	}
+
+	err = r.dbAuthRead.QueryRow("/* postgreSQL query */\n" +
+		"SELECT\n" +
+		"    COALESCE( MAX( oauth_client.access_token_lifetime ), 0 )\n" +
+		"FROM\n" +
+		"    oauth_client\n").
+		Scan(&lifetime)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return 0, err
+	}
+
+	return lifetime, nil
+}
+
+// GetListOauthClients returns all the clients, the disabled ones too
+func (r *repository) GetListOauthClients(ctx context.Context, logger *zap.Logger) ([]model.OauthClient, error) {
+
+	var clients []model.OauthClient
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	loadClients, err := r.dbAuthMain.Query("/* postgreSQL query */\n" +
+		"SELECT\n" +
+		"    oauth_client.client_id,\n" +
+		"    oauth_client.\"name\",\n" +
+		"    oauth_client.hashed_secret,\n" +
+		"    oauth_client.redirect_uris,\n" +
+		"    oauth_client.scope,\n" +
+		"    oauth_client.audience,\n" +
+		"    oauth_client.grant_types,\n" +
+		"    oauth_client.access_token_lifetime,\n" +
+		"    oauth_client.refresh_token_lifetime,\n" +
+		"    oauth_client.created_at,\n" +
+		"    oauth_client.disabled_at\n" +
+		"FROM\n" +
+		"    oauth_client\n" +
+		"WHERE\n" +
+		"    oauth_client.deleted_at IS NULL\n" +
+		"ORDER BY\n" +
+		"    oauth_client.client_id\n")
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	defer func(loadClients *sql.Rows) {
+		if err := loadClients.Close(); err != nil {
+			logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(loadClients)
+
+	for loadClients.Next() {
+		var client model.OauthClient
+		var redirectURIs, grantTypes string
+		var disabledAt sql.NullTime
+		err = loadClients.Scan(&client.ClientID, &client.Name, &client.HashedSecret, &redirectURIs, &client.Scope,
+			&client.Audience, &grantTypes, &client.AccessTokenLifetime, &client.RefreshTokenLifetime, &client.CreatedAt,
+			&disabledAt)
+		if err != nil {
+			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+			return nil, err
+		}
+		client.RedirectURIs = strings.Fields(redirectURIs)
+		client.GrantTypes = strings.Fields(grantTypes)
+		if disabledAt.Valid {
+			client.DisabledAt = &disabledAt.Time
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+// UpdateOauthClient changes the registration, the tokens already issued keep their scope and lifetime until they expire
+func (r *repository) UpdateOauthClient(ctx context.Context, logger *zap.Logger, param model.RepoUpdateOauthClientParam) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	if len(param.Name) > 255 || !isValidGrantTypes(param.GrantTypes) ||
+		(param.AccessTokenLifetime != nil && *param.AccessTokenLifetime < 0) ||
+		(param.RefreshTokenLifetime != nil && *param.RefreshTokenLifetime < 0) {
+		logger.Error("the client params are not valid", zap.String("clientID", param.ClientID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+	for _, redirectURI := range param.RedirectURIs {
+		if !isValidRedirectURI(redirectURI) {
+			logger.Error("the redirect URI is not valid", zap.String("redirectURI", redirectURI),
+				zap.String(requestIDKey, requestID))
+			return authorization.ErrorInvalidRedirectURI
+		}
+	}
+	if param.Scope != "" && !isValidScope(param.Scope) {
+		logger.Error("the scope is not valid", zap.String("scope", param.Scope), zap.String(requestIDKey, requestID))
+		return authorization.ErrorInvalidScope
+	}
+	if param.Audience != "" && !regexp.MustCompile(`^[\x21-\x7e]{1,255}$`).MatchString(param.Audience) {
+		logger.Error("the audience is not valid", zap.String("audience", param.Audience),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    oauth_client\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    \"name\" = COALESCE( NULLIF( $1, '' ), oauth_client.\"name\" ),\n"+
+		"    redirect_uris = COALESCE( NULLIF( $2, '' ), oauth_client.redirect_uris ),\n"+
+		"    scope = COALESCE( NULLIF( $3, '' ), oauth_client.scope ),\n"+
+		"    audience = COALESCE( NULLIF( $4, '' ), oauth_client.audience ),\n"+
+		"    grant_types = COALESCE( NULLIF( $5, '' ), oauth_client.grant_types ),\n"+
+		"    access_token_lifetime = COALESCE( $6, oauth_client.access_token_lifetime ),\n"+
+		"    refresh_token_lifetime = COALESCE( $7, oauth_client.refresh_token_lifetime )\n"+
+		"WHERE\n"+
+		"    oauth_client.client_id = $8\n"+
+		"    AND oauth_client.deleted_at IS NULL\n",
+		param.Name,
+		strings.Join(param.RedirectURIs, redirectURISeparator),
+		strings.Join(strings.Fields(param.Scope), scopeSeparator),
+		param.Audience,
+		strings.Join(param.GrantTypes, grantTypeSeparator),
+		param.AccessTokenLifetime,
+		param.RefreshTokenLifetime,
+		param.ClientID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the client not found", zap.String("clientID", param.ClientID), zap.String(requestIDKey, requestID))
+		return authorization.ErrorOauthClientNotFound
+	}
+
+	return nil
+}
+
+// DisableOauthClient rejects the client as an unknown one and revokes the sessions created for it
+func (r *repository) DisableOauthClient(ctx context.Context, logger *zap.Logger, clientID string) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	result, err := dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    oauth_client\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    disabled_at = NOW( )\n"+
+		"WHERE\n"+
+		"    oauth_client.client_id = $1\n"+
+		"    AND oauth_client.deleted_at IS NULL\n"+
+		"    AND oauth_client.disabled_at IS NULL\n",
+		clientID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the client not found", zap.String("clientID", clientID), zap.String(requestIDKey, requestID))
+		return authorization.ErrorOauthClientNotFound
+	}
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    \"session\"\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    \"session\".client_id = $1\n"+
+		"    AND \"session\".deleted_at IS NULL\n",
+		clientID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) EnableOauthClient(ctx context.Context, logger *zap.Logger, clientID string) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    oauth_client\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    disabled_at = NULL\n"+
+		"WHERE\n"+
+		"    oauth_client.client_id = $1\n"+
+		"    AND oauth_client.deleted_at IS NULL\n"+
+		"    AND oauth_client.disabled_at IS NOT NULL\n",
+		clientID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the client not found", zap.String("clientID", clientID), zap.String(requestIDKey, requestID))
+		return authorization.ErrorOauthClientNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) CreateAuthorizationCode(ctx context.Context, logger *zap.Logger, param model.RepoCreateAuthorizationCodeParam) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	hashedCode, err := r.hashToken(param.Code)
+	if err != nil {
+		logger.DPanic("failed to generate hash for authorization code", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	_, err = r.dbBlade.Exec("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    authorization_code (\n"+
+		"        created_at,\n"+
+		"        hashed_code,\n"+
+		"        client_id,\n"+
+		"        user_id,\n"+
+		"        redirect_uri,\n"+
+		"        code_challenge,\n"+
+		"        scope,\n"+
+		"        nonce,\n"+
+		"        expires_at\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW(),\n"+
+		"    $1,\n"+
+		"    $2,\n"+
+		"    $3,\n"+
+		"    $4,\n"+
+		"    $5,\n"+
+		"    $6,\n"+
+		"    $7,\n"+
+		"    NOW( ) + $8 * INTERVAL '1 second'\n"+
+		")\n",
+		hashedCode,
+		param.ClientID,
+		param.UserID,
+		param.RedirectURI,
+		param.CodeChallenge,
+		param.Scope,
+		param.Nonce,
+		param.Lifetime)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+// GetAuthorizationCode consumes the code, it can be exchanged only once
+func (r *repository) GetAuthorizationCode(ctx context.Context, logger *zap.Logger, code string) (model.AuthorizationCode, error) {
+
+	var authorizationCode model.AuthorizationCode
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.AuthorizationCode{}, err
+	}
+
+	hashedCode, err := r.hashToken(code)
+	if err != nil {
+		logger.DPanic("failed to generate hash for authorization code", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.AuthorizationCode{}, err
+	}
+
+	err = r.dbBlade.QueryRow("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    authorization_code\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    authorization_code.hashed_code = $1\n"+
+		"    AND authorization_code.deleted_at IS NULL\n"+
+		"    AND authorization_code.expires_at > NOW( )\n"+
+		"RETURNING\n"+
+		"    authorization_code.client_id,\n"+
+		"    authorization_code.user_id,\n"+
+		"    authorization_code.redirect_uri,\n"+
+		"    authorization_code.code_challenge,\n"+
+		"    authorization_code.scope,\n"+
+		"    authorization_code.nonce\n",
+		hashedCode).
+		Scan(&authorizationCode.ClientID, &authorizationCode.UserID, &authorizationCode.RedirectURI,
+			&authorizationCode.CodeChallenge, &authorizationCode.Scope, &authorizationCode.Nonce)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the authorization code not found", zap.String(requestIDKey, requestID))
+			return model.AuthorizationCode{}, authorization.ErrorAuthorizationCodeNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.AuthorizationCode{}, err
+	}
+
+	return authorizationCode, nil
+}
+
+// GetSessionClientID returns the client the session has been created for
+func (r *repository) GetSessionClientID(ctx context.Context, logger *zap.Logger, publicSessionID string) (string, error) {
+
+	var clientID string
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return "", err
+	}
+
+	err = r.dbAuthRead.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    \"session\".client_id\n"+
+		"FROM\n"+
+		"    \"session\"\n"+
+		"WHERE\n"+
+		"    \"session\".public_id = $1\n"+
+		"    AND \"session\".deleted_at IS NULL\n"+
+		"LIMIT 1\n", publicSessionID).
+		Scan(&clientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the session not found", zap.String("publicSessionID", publicSessionID),
+				zap.String(requestIDKey, requestID))
+			return "", authorization.ErrorSessionNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return "", err
+	}
+
+	return clientID, nil
+}
+
+// GetActiveSession returns the session unless it's deleted, expired by its policy or its user is deleted or disabled
+func (r *repository) GetActiveSession(ctx context.Context, logger *zap.Logger, publicSessionID string) (model.SessionRecord, error) {
+
+	var session model.SessionRecord
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.SessionRecord{}, err
+	}
+
+	err = r.dbAuthRead.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    \"session\".user_id,\n"+
+		"    \"session\".client_id,\n"+
+		"    \"session\".\"scope\",\n"+
+		"    \"session\".idle_timeout,\n"+
+		"    \"session\".expires_at\n"+
+		"FROM\n"+
+		"    \"session\"\n"+
+		"INNER JOIN \"user\" ON\n"+
+		"    \"session\".user_id = \"user\".\"id\"\n"+
+		"WHERE\n"+
+		"    \"session\".public_id = $1\n"+
+		"    AND \"session\".deleted_at IS NULL\n"+
+		r.activeSessionCondition()+
+		"    AND \"user\".deleted_at IS NULL\n"+
+		activeUserCondition()+
+		"LIMIT 1\n", publicSessionID).
+		Scan(&session.UserID, &session.ClientID, &session.Scope, &session.IdleTimeout, &session.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the session not found", zap.String("publicSessionID", publicSessionID),
+				zap.String(requestIDKey, requestID))
+			return model.SessionRecord{}, authorization.ErrorSessionNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.SessionRecord{}, err
+	}
+
+	return session, nil
+}
+
+// isValidRedirectURI accepts the absolute https URIs and, for the native apps, the http loopback ones (RFC 8252)
+func isValidRedirectURI(redirectURI string) bool {
+
+	uri, err := url.Parse(redirectURI)
+	if err != nil || uri.Host == "" || uri.Fragment != "" || strings.ContainsAny(redirectURI, " \t\r\n") {
+		return false
+	}
+
+	switch uri.Scheme {
+	case "https":
+		return true
+	case "http":
+		hostname := uri.Hostname()
+		return hostname == "127.0.0.1" || hostname == "::1" || hostname == "localhost"
+	default:
+		return false
+	}
+}
+
+func isValidGrantTypes(grantTypes []string) bool {
+	for _, grantType := range grantTypes {
+		switch grantType {
+		case model.OauthGrantTypePassword, model.OauthGrantTypeAuthorizationCode, model.OauthGrantTypeRefreshToken,
+			model.OauthGrantTypeDeviceCode, model.OauthGrantTypeTokenExchange:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func hasGrantType(grantTypes []string, grantType string) bool {
+	for _, value := range grantTypes {
+		if value == grantType {
+			return true
+		}
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
@@ -19,6 +20,7 @@ func NewPostgresDB(logger *zap.Logger, c model.ConfigPostgresDB) (*sql.DB, error
 	err = db.Ping()
 	if err != nil {
 		logger.DPanic("failed to ping for PostgresDB", zap.Error(err))
+		_ = db.Close()
 		return nil, err
 	}
 
@@ -0,0 +1,368 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"regexp"
+	"strings"
+)
+
+// The names of the roles and the permissions are the claims of the access token, e.g. admin or reports:write
+var accessNameRegexp = regexp.MustCompile(`^[a-z0-9_.:-]{1,64}$`)
+
+func (r *repository) CreateRole(ctx context.Context, logger *zap.Logger, param model.RepoCreateRoleParam) error {
+
+	var roleID int64
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	// Check parameters
+
+	if !accessNameRegexp.MatchString(param.Name) {
+		logger.Error("the param is not valid", zap.String("role", param.Name), zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+	if len(param.Description) > 255 {
+		logger.Error("the param is not valid", zap.String("description", param.Description),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+	for _, permission := range param.Permissions {
+		if !accessNameRegexp.MatchString(permission) {
+			logger.Error("the param is not valid", zap.String("permission", permission),
+				zap.String(requestIDKey, requestID))
+			return authorization.ErrorBadParams
+		}
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    \"role\" (\n"+
+		"        created_at,\n"+
+		"        \"name\",\n"+
+		"        description\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW( ),\n"+
+		"    $1,\n"+
+		"    $2\n"+
+		") ON CONFLICT DO NOTHING\n"+
+		"RETURNING \"id\"\n",
+		param.Name, param.Description).Scan(&roleID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("a role with the same name already exists", zap.String("role", param.Name),
+				zap.String(requestIDKey, requestID))
+			return authorization.ErrorRoleAlreadyExist
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	// The permissions are shared by the roles, the missing ones are created
+
+	for _, permission := range param.Permissions {
+		_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+			"INSERT\n"+
+			"    INTO\n"+
+			"    \"permission\" (\n"+
+			"        created_at,\n"+
+			"        \"name\"\n"+
+			"    )\n"+
+			"VALUES (\n"+
+			"    NOW( ),\n"+
+			"    $1\n"+
+			") ON CONFLICT DO NOTHING\n",
+			permission)
+		if err != nil {
+			logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+			return err
+		}
+
+		_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+			"INSERT\n"+
+			"    INTO\n"+
+			"    role_permission (\n"+
+			"        role_id,\n"+
+			"        permission_id,\n"+
+			"        created_at\n"+
+			"    )\n"+
+			"SELECT\n"+
+			"    $1,\n"+
+			"    \"permission\".\"id\",\n"+
+			"    NOW( )\n"+
+			"FROM\n"+
+			"    \"permission\"\n"+
+			"WHERE\n"+
+			"    \"permission\".\"name\" = $2\n"+
+			"ON CONFLICT DO NOTHING\n",
+			roleID, permission)
+		if err != nil {
+			logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+			return err
+		}
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) GetListRoles(ctx context.Context, logger *zap.Logger) ([]model.Role, error) {
+
+	var roles []model.Role
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	loadRoles, err := r.dbAuthRead.Query("/* postgreSQL query */\n" +
+		"SELECT\n" +
+		"    \"role\".\"name\",\n" +
+		"    \"role\".description,\n" +
+		"    \"role\".created_at,\n" +
+		"    COALESCE(STRING_AGG(\"permission\".\"name\", ' ' ORDER BY \"permission\".\"name\"), '')\n" +
+		"FROM\n" +
+		"    \"role\"\n" +
+		"LEFT JOIN role_permission ON\n" +
+		"    \"role\".\"id\" = role_permission.role_id\n" +
+		"LEFT JOIN \"permission\" ON\n" +
+		"    role_permission.permission_id = \"permission\".\"id\"\n" +
+		"GROUP BY\n" +
+		"    \"role\".\"id\"\n" +
+		"ORDER BY\n" +
+		"    \"role\".\"name\"\n")
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	defer func(loadRoles *sql.Rows) {
+		if err := loadRoles.Close(); err != nil {
+			logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(loadRoles)
+
+	for loadRoles.Next() {
+		var role model.Role
+		var permissions string
+		err = loadRoles.Scan(&role.Name, &role.Description, &role.CreatedAt, &permissions)
+		if err != nil {
+			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+			return nil, err
+		}
+		role.Permissions = strings.Fields(permissions)
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+// DeleteRole deletes the role with its assignments, the permissions stay for the other roles
+func (r *repository) DeleteRole(ctx context.Context, logger *zap.Logger, name string) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"DELETE\n"+
+		"FROM\n"+
+		"    \"role\"\n"+
+		"WHERE\n"+
+		"    \"role\".\"name\" = $1\n",
+		name)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the role not found", zap.String("role", name), zap.String(requestIDKey, requestID))
+		return authorization.ErrorRoleNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) AssignUserRole(ctx context.Context, logger *zap.Logger, param model.RepoUserRoleParam) error {
+
+	var userID, roleID int64
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	err = r.dbAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    \"user\".\"id\"\n"+
+		"FROM\n"+
+		"    \"user\"\n"+
+		"WHERE\n"+
+		"    \"user\".\"id\" = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n",
+		param.UserID).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the user not found", zap.Int64("userID", param.UserID), zap.String(requestIDKey, requestID))
+			return authorization.ErrorUserNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = r.dbAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    \"role\".\"id\"\n"+
+		"FROM\n"+
+		"    \"role\"\n"+
+		"WHERE\n"+
+		"    \"role\".\"name\" = $1\n",
+		param.Role).Scan(&roleID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the role not found", zap.String("role", param.Role), zap.String(requestIDKey, requestID))
+			return authorization.ErrorRoleNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	// The role that is already assigned is not an error, the assignment is idempotent
+
+	_, err = r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    user_role (\n"+
+		"        user_id,\n"+
+		"        role_id,\n"+
+		"        created_at\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    $1,\n"+
+		"    $2,\n"+
+		"    NOW( )\n"+
+		") ON CONFLICT DO NOTHING\n",
+		userID, roleID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) RevokeUserRole(ctx context.Context, logger *zap.Logger, param model.RepoUserRoleParam) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"DELETE\n"+
+		"FROM\n"+
+		"    user_role\n"+
+		"USING\n"+
+		"    \"role\"\n"+
+		"WHERE\n"+
+		"    user_role.role_id = \"role\".\"id\"\n"+
+		"    AND user_role.user_id = $1\n"+
+		"    AND \"role\".\"name\" = $2\n",
+		param.UserID, param.Role)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the role is not assigned to the user", zap.Int64("userID", param.UserID),
+			zap.String("role", param.Role), zap.String(requestIDKey, requestID))
+		return authorization.ErrorRoleNotFound
+	}
+
+	return nil
+}
+
+// GetUserAccess returns the roles of the user and the permissions of the roles, the user without the roles
+// has no permissions
+func (r *repository) GetUserAccess(ctx context.Context, logger *zap.Logger, userID int64) (model.UserAccess, error) {
+
+	var access model.UserAccess
+	var roles, permissions string
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.UserAccess{}, err
+	}
+
+	err = r.dbAuthRead.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    COALESCE(STRING_AGG(DISTINCT \"role\".\"name\", ' ' ORDER BY \"role\".\"name\"), ''),\n"+
+		"    COALESCE(STRING_AGG(DISTINCT \"permission\".\"name\", ' ' ORDER BY \"permission\".\"name\"), '')\n"+
+		"FROM\n"+
+		"    user_role\n"+
+		"INNER JOIN \"role\" ON\n"+
+		"    user_role.role_id = \"role\".\"id\"\n"+
+		"LEFT JOIN role_permission ON\n"+
+		"    \"role\".\"id\" = role_permission.role_id\n"+
+		"LEFT JOIN \"permission\" ON\n"+
+		"    role_permission.permission_id = \"permission\".\"id\"\n"+
+		"WHERE\n"+
+		"    user_role.user_id = $1\n",
+		userID).Scan(&roles, &permissions)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.UserAccess{}, err
+	}
+
+	access.Roles = strings.Fields(roles)
+	access.Permissions = strings.Fields(permissions)
+
+	return access, nil
+}
@@ -11,35 +11,48 @@ import (
 	"encoding/hex"
 	"github.com/dmalix/financelime-authorization/app/authorization"
 	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/financelime-authorization/hasher"
 	"github.com/dmalix/middleware"
-	"github.com/dmalix/utils/generate"
 	"go.uber.org/zap"
 	"html"
 	"regexp"
 	"strconv"
-	"strings"
+	"sync"
+)
+
+const (
+	passwordMinLength = 8
+	passwordMaxLength = 64
+	// The password of the dummy hash verified when the user is not found
+	dummyPassword = "dummy-password"
 )
 
 type repository struct {
-	config        model.ConfigRepository
-	contextGetter middleware.ContextGetter
-	dbAuthMain    *sql.DB
-	dbAuthRead    *sql.DB
-	dbBlade       *sql.DB
+	config         model.ConfigRepository
+	contextGetter  middleware.ContextGetter
+	passwordHasher hasher.Hasher
+	dbAuthMain     *sql.DB
+	dbAuthRead     *sql.DB
+	dbBlade        *sql.DB
+
+	dummyPasswordHashOnce sync.Once
+	dummyPasswordHash     string
 }
 
 func NewRepository(
 	config model.ConfigRepository,
 	contextGetter middleware.ContextGetter,
+	passwordHasher hasher.Hasher,
 	dbAuthMain,
 	dbAuthRead,
 	dbBlade *sql.DB) *repository {
 	return &repository{
-		config:        config,
-		contextGetter: contextGetter,
-		dbAuthMain:    dbAuthMain,
-		dbAuthRead:    dbAuthRead,
-		dbBlade:       dbBlade,
+		config:         config,
+		contextGetter:  contextGetter,
+		passwordHasher: passwordHasher,
+		dbAuthMain:     dbAuthMain,
+		dbAuthRead:     dbAuthRead,
+		dbBlade:        dbBlade,
 	}
 }
 
@@ -406,6 +419,67 @@ func (r *repository) SignUpStep1(ctx context.Context, logger *zap.Logger, param
 
 func (r *repository) SignUpStep2(ctx context.Context, logger *zap.Logger, confirmationKey string) (model.User, error) {
 
+	var (
+		confirmationID int64
+		user           model.User
+	)
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.User{}, err
+	}
+
+	propsValueRegexp := regexp.MustCompile(`^[abcefghijkmnopqrtuvwxyz23479]{16}$`)
+	if !propsValueRegexp.MatchString(confirmationKey) {
+		logger.Error("the param is not valid", zap.String("confirmationKey", confirmationKey))
+		return model.User{}, authorization.ErrorBadParamConfirmationKey
+	}
+
+	// Check the confirmationKey in Database, the key stays valid until the user has chosen a password
+
+	loadConfirmationKeyInfo, err := r.dbBlade.Query("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    confirmation_create_new_user.\"id\",\n"+
+		"    confirmation_create_new_user.email,\n"+
+		"    confirmation_create_new_user.\"language\"\n"+
+		"FROM\n"+
+		"    confirmation_create_new_user\n"+
+		"WHERE\n"+
+		"    confirmation_create_new_user.confirmation_key = $1\n"+
+		"    AND confirmation_create_new_user.deleted_at IS NULL\n"+
+		"    AND confirmation_create_new_user.expires_at > NOW( )\n"+
+		"ORDER BY\n"+
+		"    confirmation_create_new_user.\"id\" DESC\n"+
+		"LIMIT 1\n",
+		confirmationKey)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+	defer func(loadConfirmationKeyInfo *sql.Rows) {
+		if err := loadConfirmationKeyInfo.Close(); err != nil {
+			logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(loadConfirmationKeyInfo)
+
+	for loadConfirmationKeyInfo.Next() {
+		err = loadConfirmationKeyInfo.Scan(&confirmationID, &user.Email, &user.Language)
+		if err != nil {
+			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+			return model.User{}, err
+		}
+	}
+
+	if confirmationID == 0 {
+		return model.User{}, authorization.ErrorConfirmationKeyNotFound
+	}
+
+	return user, nil
+}
+
+func (r *repository) SignUpStep3(ctx context.Context, logger *zap.Logger, param model.RepoSetPasswordParam) (model.User, error) {
+
 	var (
 		confirmationID     int64
 		inviteCodeIssuedID int64
@@ -420,12 +494,18 @@ func (r *repository) SignUpStep2(ctx context.Context, logger *zap.Logger, confir
 		return model.User{}, err
 	}
 
+	confirmationKey := param.ConfirmationKey
 	propsValueRegexp := regexp.MustCompile(`^[abcefghijkmnopqrtuvwxyz23479]{16}$`)
 	if !propsValueRegexp.MatchString(confirmationKey) {
 		logger.Error("the param is not valid", zap.String("confirmationKey", confirmationKey))
 		return model.User{}, authorization.ErrorBadParamConfirmationKey
 	}
 
+	if !isValidPassword(param.Password) {
+		logger.Error("the password param is not valid", zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorBadParamPassword
+	}
+
 	// Check the confirmationKey in Database
 
 	loadConfirmationKeyInfo, err := r.dbBlade.Query("/* postgreSQL query */\n"+
@@ -634,16 +714,13 @@ func (r *repository) SignUpStep2(ctx context.Context, logger *zap.Logger, confir
 		}
 	}
 
-	// Create the new verified user in the Auth DB
+	// Create the new verified user in the Auth DB with the password chosen by the user
 
-	user.Password = generate.StringRand(16, 16, false)
-	hs := sha256.New()
-	_, err = hs.Write([]byte(user.Password + r.config.CryptoSalt))
+	hashedPassword, err := r.passwordHasher.Hash(param.Password)
 	if err != nil {
-		logger.DPanic("failed to generate password for new user", zap.Error(err), zap.String(requestIDKey, requestID))
+		logger.DPanic("failed to hash the password of the new user", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.User{}, err
 	}
-	hashedPassword := hex.EncodeToString(hs.Sum(nil))
 
 	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
 		"INSERT\n"+
@@ -709,9 +786,24 @@ func (r *repository) SignUpStep2(ctx context.Context, logger *zap.Logger, confir
 	return user, nil
 }
 
+// verifyDummyPassword takes as long as the check of the real password, so the response time
+// doesn't reveal whether the user exists
+func (r *repository) verifyDummyPassword(password string) {
+	r.dummyPasswordHashOnce.Do(func() {
+		r.dummyPasswordHash, _ = r.passwordHasher.Hash(dummyPassword)
+	})
+	if r.dummyPasswordHash != "" {
+		_, _ = r.passwordHasher.Verify(password, r.dummyPasswordHash)
+	}
+}
+
 func (r *repository) GetUserByAuth(ctx context.Context, logger *zap.Logger, param model.RepoGetUserByAuthParam) (model.User, error) {
 
-	var user model.User
+	var (
+		user           model.User
+		hashedPassword string
+		status         string
+	)
 
 	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
 	if err != nil {
@@ -735,26 +827,19 @@ func (r *repository) GetUserByAuth(ctx context.Context, logger *zap.Logger, para
 
 	// Get User
 
-	hs := sha256.New()
-	_, err = hs.Write([]byte(param.Password + r.config.CryptoSalt))
-	if err != nil {
-		logger.DPanic("failed to generate hash", zap.Error(err), zap.String(requestIDKey, requestID))
-		return model.User{}, err
-	}
-	hashedPassword := hex.EncodeToString(hs.Sum(nil))
-
 	loadUser, err := r.dbAuthRead.Query("/* postgreSQL query */\n"+
 		"SELECT\n"+
 		"    \"user\".\"id\",\n"+
 		"    \"user\".email,\n"+
-		"    \"user\".\"language\"\n"+
+		"    \"user\".\"language\",\n"+
+		"    \"user\".\"password\",\n"+
+		userStatusColumn()+"\n"+
 		"FROM\n"+
 		"    \"user\"\n"+
 		"WHERE\n"+
 		"    \"user\".email = $1\n"+
-		"    AND \"user\".PASSWORD = $2\n"+
 		"    AND \"user\".deleted_at IS NULL\n"+
-		"LIMIT 1\n", param.Email, hashedPassword)
+		"LIMIT 1\n", param.Email)
 	if err != nil {
 		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.User{}, err
@@ -766,7 +851,7 @@ func (r *repository) GetUserByAuth(ctx context.Context, logger *zap.Logger, para
 	}(loadUser)
 
 	for loadUser.Next() {
-		err = loadUser.Scan(&user.ID, &user.Email, &user.Language)
+		err = loadUser.Scan(&user.ID, &user.Email, &user.Language, &hashedPassword, &status)
 		if err != nil {
 			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
 			return model.User{}, err
@@ -774,16 +859,66 @@ func (r *repository) GetUserByAuth(ctx context.Context, logger *zap.Logger, para
 	}
 
 	if user.ID == 0 {
-		logger.Error("user not found", zap.Error(err), zap.String(requestIDKey, requestID))
+		r.verifyDummyPassword(param.Password)
+		logger.Error("user not found", zap.String(requestIDKey, requestID))
 		return model.User{}, authorization.ErrorUserNotFound
 	}
 
+	// Check the password
+
+	passwordIsValid, err := r.passwordHasher.Verify(param.Password, hashedPassword)
+	if err != nil {
+		logger.DPanic("failed to verify the password", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+	if !passwordIsValid {
+		logger.Error("user not found", zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorUserNotFound
+	}
+
+	// The status is revealed only to the one who knows the password
+
+	if err = userStatusError(status); err != nil {
+		logger.Error("the user is not active", zap.Int64("userID", user.ID), zap.String("status", status),
+			zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	// Upgrade the legacy or outdated hash, the user has already logged in if it fails
+
+	if r.passwordHasher.NeedsRehash(hashedPassword) {
+		newHashedPassword, err := r.passwordHasher.Hash(param.Password)
+		if err != nil {
+			logger.DPanic("failed to rehash the password", zap.Error(err), zap.String(requestIDKey, requestID))
+			return user, nil
+		}
+		_, err = r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+			"UPDATE\n"+
+			"    \"user\"\n"+
+			"SET\n"+
+			"    updated_at = NOW(),\n"+
+			"    \"password\" = $1\n"+
+			"WHERE\n"+
+			"    \"user\".\"id\" = $2\n"+
+			"    AND \"user\".\"password\" = $3\n",
+			newHashedPassword,
+			user.ID,
+			hashedPassword)
+		if err != nil {
+			logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+			return user, nil
+		}
+		logger.Info("the password hash has been upgraded", zap.Int64("userID", user.ID),
+			zap.String(requestIDKey, requestID))
+	}
+
 	return user, nil
 }
 
 func (r *repository) GetUserByRefreshToken(ctx context.Context, logger *zap.Logger, refreshToken string) (model.User, error) {
 
 	var user model.User
+	var status string
 
 	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
 	if err != nil {
@@ -806,7 +941,8 @@ func (r *repository) GetUserByRefreshToken(ctx context.Context, logger *zap.Logg
 		"SELECT\n"+
 		"    \"user\".\"id\",\n"+
 		"    \"user\".email,\n"+
-		"    \"user\".\"language\"\n"+
+		"    \"user\".\"language\",\n"+
+		userStatusColumn()+"\n"+
 		"FROM\n"+
 		"    \"session\"\n"+
 		"INNER JOIN \"user\" ON\n"+
@@ -814,6 +950,7 @@ func (r *repository) GetUserByRefreshToken(ctx context.Context, logger *zap.Logg
 		"WHERE\n"+
 		"    \"session\".hashed_refresh_token = $1\n"+
 		"    AND \"session\".deleted_at IS NULL\n"+
+		r.activeSessionCondition()+
 		"    AND \"user\".deleted_at IS NULL\n"+
 		"LIMIT 1\n", hashedRefreshToken)
 	if err != nil {
@@ -827,7 +964,7 @@ func (r *repository) GetUserByRefreshToken(ctx context.Context, logger *zap.Logg
 	}(loadUser)
 
 	for loadUser.Next() {
-		err = loadUser.Scan(&user.ID, &user.Email, &user.Language)
+		err = loadUser.Scan(&user.ID, &user.Email, &user.Language, &status)
 		if err != nil {
 			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
 			return user, err
@@ -835,10 +972,17 @@ func (r *repository) GetUserByRefreshToken(ctx context.Context, logger *zap.Logg
 	}
 
 	if user.ID == 0 {
-		logger.DPanic("user not found", zap.Error(err), zap.String("hashedRefreshToken", hashedRefreshToken))
+		logger.Error("user not found", zap.String("hashedRefreshToken", hashedRefreshToken),
+			zap.String(requestIDKey, requestID))
 		return user, authorization.ErrorUserNotFound
 	}
 
+	if err = userStatusError(status); err != nil {
+		logger.Error("the user is not active", zap.Int64("userID", user.ID), zap.String("status", status),
+			zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
 	return user, nil
 }
 
@@ -876,7 +1020,12 @@ func (r *repository) CreateSession(ctx context.Context, logger *zap.Logger, para
 		"        client_id,\n"+
 		"        remote_addr,\n"+
 		"        public_id,\n"+
-		"        hashed_refresh_token\n"+
+		"        hashed_refresh_token,\n"+
+		"        token_family,\n"+
+		"        \"scope\",\n"+
+		"        idle_timeout,\n"+
+		"        expires_at,\n"+
+		"        remember_me\n"+
 		"    )\n"+
 		"VALUES (\n"+
 		"    NOW(),\n"+
@@ -884,13 +1033,23 @@ func (r *repository) CreateSession(ctx context.Context, logger *zap.Logger, para
 		"    $2,\n"+
 		"    $3,\n"+
 		"    $4,\n"+
-		"    $5\n"+
+		"    $5,\n"+
+		"    $6,\n"+
+		"    $7,\n"+
+		"    $8,\n"+
+		"    CASE WHEN $9 > 0 THEN NOW( ) + $9 * INTERVAL '1 second' END,\n"+
+		"    $10\n"+
 		") RETURNING \"id\"\n",
 		param.UserID,
 		param.ClientID,
 		remoteAddr,
 		param.PublicSessionID,
-		hashedRefreshToken).
+		hashedRefreshToken,
+		param.TokenFamily,
+		param.Scope,
+		param.IdleTimeout,
+		param.MaxAge,
+		param.RememberMe).
 		Scan(&sessionID)
 	if err != nil {
 		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
@@ -936,9 +1095,11 @@ func (r *repository) CreateSession(ctx context.Context, logger *zap.Logger, para
 	return nil
 }
 
+// UpdateSession replaces the refresh token of the session. The replaced token is remembered,
+// so presenting it again can be recognized as a reuse by RevokeRefreshTokenFamily.
 func (r *repository) UpdateSession(ctx context.Context, logger *zap.Logger, param model.RepoUpdateSessionParam) error {
 
-	var result string
+	var tokenFamily string
 
 	remoteAddr, _, err := r.contextGetter.GetRemoteAddr(ctx)
 	if err != nil {
@@ -952,15 +1113,32 @@ func (r *repository) UpdateSession(ctx context.Context, logger *zap.Logger, para
 		return err
 	}
 
-	hs := sha256.New()
-	_, err = hs.Write([]byte(param.RefreshToken + r.config.CryptoSalt))
+	hashedRefreshToken, err := r.hashToken(param.RefreshToken)
+	if err != nil {
+		logger.DPanic("failed to generate hash", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	hashedNewRefreshToken, err := r.hashToken(param.NewRefreshToken)
 	if err != nil {
 		logger.DPanic("failed to generate hash", zap.Error(err), zap.String(requestIDKey, requestID))
 		return err
 	}
-	hashedRefreshToken := hex.EncodeToString(hs.Sum(nil))
 
-	err = r.dbAuthMain.QueryRow("/* postgreSQL query */\n"+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
 		"UPDATE\n"+
 		"    \"session\"\n"+
 		"SET\n"+
@@ -970,26 +1148,176 @@ func (r *repository) UpdateSession(ctx context.Context, logger *zap.Logger, para
 		"WHERE\n"+
 		"    \"session\".public_id = $3\n"+
 		"    AND \"session\".hashed_refresh_token = $4\n"+
-		"    AND \"session\".deleted_at IS NULL RETURNING \"session\".public_id\n",
+		"    AND \"session\".deleted_at IS NULL RETURNING \"session\".token_family\n",
 		remoteAddr,
-		hashedRefreshToken,
+		hashedNewRefreshToken,
 		param.PublicSessionID,
-		hashedRefreshToken).Scan(&result)
+		hashedRefreshToken).Scan(&tokenFamily)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the case (the session + hashedRefreshToken) does not exist",
+				zap.String("publicSessionID", param.PublicSessionID), zap.String("hashedRefreshToken", hashedRefreshToken),
+				zap.String(requestIDKey, requestID))
+			return authorization.ErrorSessionNotFound
+		}
 		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
 		return err
 	}
 
-	if len(result) == 0 {
-		logger.Error("the case (the session + hashedRefreshToken) does not exist",
-			zap.String("publicSessionID", param.PublicSessionID), zap.String("hashedRefreshToken", hashedRefreshToken),
-			zap.String(requestIDKey, requestID))
-		return authorization.ErrorSessionNotFound
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    rotated_refresh_token (\n"+
+		"        created_at,\n"+
+		"        token_family,\n"+
+		"        hashed_refresh_token\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW(),\n"+
+		"    $1,\n"+
+		"    $2\n"+
+		")\n",
+		tokenFamily,
+		hashedRefreshToken)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	// The rotated tokens that have expired can't be presented again, there is nothing to remember them for
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n" +
+		"DELETE\n" +
+		"FROM\n" +
+		"    rotated_refresh_token\n" +
+		"    USING \"session\"\n" +
+		"WHERE\n" +
+		"    rotated_refresh_token.token_family = \"session\".token_family\n" +
+		"    AND rotated_refresh_token.created_at < NOW( ) - " + r.sessionIdleTimeout() + " * INTERVAL '1 second'\n")
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
 	}
 
 	return nil
 }
 
+// RevokeRefreshTokenFamily checks whether the refresh token has already been replaced by the rotation.
+// If so, the token has been used twice, one of the holders is not the user, and all the sessions
+// of the token family are revoked. It returns the owner of the family to notify them and the public IDs
+// of the revoked sessions to revoke their access tokens.
+func (r *repository) RevokeRefreshTokenFamily(ctx context.Context, logger *zap.Logger, refreshToken string) (model.User, []string, error) {
+
+	var (
+		user             model.User
+		tokenFamily      string
+		publicSessionIDs []string
+	)
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.User{}, nil, err
+	}
+
+	hashedRefreshToken, err := r.hashToken(refreshToken)
+	if err != nil {
+		logger.DPanic("failed to generate hash", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, nil, err
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, nil, err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    rotated_refresh_token.token_family,\n"+
+		"    \"user\".\"id\",\n"+
+		"    \"user\".email,\n"+
+		"    \"user\".\"language\"\n"+
+		"FROM\n"+
+		"    rotated_refresh_token\n"+
+		"INNER JOIN \"session\" ON\n"+
+		"    rotated_refresh_token.token_family = \"session\".token_family\n"+
+		"INNER JOIN \"user\" ON\n"+
+		"    \"session\".user_id = \"user\".\"id\"\n"+
+		"WHERE\n"+
+		"    rotated_refresh_token.hashed_refresh_token = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n"+
+		"LIMIT 1\n", hashedRefreshToken).
+		Scan(&tokenFamily, &user.ID, &user.Email, &user.Language)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the refresh token has never been rotated", zap.String(requestIDKey, requestID))
+			return model.User{}, nil, authorization.ErrorSessionNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, nil, err
+	}
+
+	loadPublicSessionIDs, err := dbTransactionAuthMain.Query("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    \"session\"\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    \"session\".token_family = $1\n"+
+		"    AND \"session\".deleted_at IS NULL\n"+
+		"RETURNING\n"+
+		"    \"session\".public_id\n",
+		tokenFamily)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, nil, err
+	}
+
+	for loadPublicSessionIDs.Next() {
+		var publicSessionID string
+		err = loadPublicSessionIDs.Scan(&publicSessionID)
+		if err != nil {
+			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+			_ = loadPublicSessionIDs.Close()
+			return model.User{}, nil, err
+		}
+		publicSessionIDs = append(publicSessionIDs, publicSessionID)
+	}
+
+	// The result set must be closed before the commit of the transaction
+	if err := loadPublicSessionIDs.Close(); err != nil {
+		logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, nil, err
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, nil, err
+	}
+
+	logger.Warn("the rotated refresh token has been reused, the token family is revoked",
+		zap.Int64("userID", user.ID), zap.Int("revokedSessions", len(publicSessionIDs)),
+		zap.String(requestIDKey, requestID))
+
+	return user, publicSessionIDs, nil
+}
+
 func (r *repository) GetListActiveSessions(ctx context.Context, logger *zap.Logger, userID int64) ([]model.Session, error) {
 
 	var session model.Session
@@ -1001,34 +1329,24 @@ func (r *repository) GetListActiveSessions(ctx context.Context, logger *zap.Logg
 		return nil, err
 	}
 
-	loadActiveSessionsList, err := r.dbAuthRead.Query(strings.Replace("/* postgreSQL query */\n"+
+	loadActiveSessionsList, err := r.dbAuthRead.Query("/* postgreSQL query */\n"+
 		"SELECT\n"+
 		"    \"session\".public_id,\n"+
 		"    device.platform,\n"+
-		"    CASE\n"+
-		"        WHEN (\n"+
-		"            \"session\".updated_at IS NULL\n"+
-		"        ) THEN \"session\".created_at\n"+
-		"        ELSE \"session\".updated_at\n"+
-		"    END AS updated_at\n"+
+		"    COALESCE( \"session\".updated_at, \"session\".created_at ) AS updated_at,\n"+
+		"    LEAST(\n"+
+		"        COALESCE( \"session\".updated_at, \"session\".created_at ) + "+r.sessionIdleTimeout()+" * INTERVAL '1 second',\n"+
+		"        \"session\".expires_at\n"+
+		"    ) AS expires_at,\n"+
+		"    \"session\".remember_me\n"+
 		"FROM\n"+
 		"    \"session\"\n"+
 		"INNER JOIN device ON\n"+
 		"    \"session\".\"id\" = device.session_id\n"+
 		"WHERE\n"+
-		"    (\n"+
-		"        (\n"+
-		"            \"session\".updated_at IS NULL\n"+
-		"                AND \"session\".created_at > NOW( ) - INTERVAL '$LIFETIME SECOND'\n"+
-		"        )\n"+
-		"            OR (\n"+
-		"                \"session\".updated_at IS NOT NULL\n"+
-		"                    AND \"session\".updated_at > NOW( ) - INTERVAL '$LIFETIME SECOND'\n"+
-		"            )\n"+
-		"    )\n"+
-		"    AND \"session\".user_id = $1\n"+
-		"    AND \"session\".deleted_at IS NULL\n",
-		"$LIFETIME", strconv.Itoa(r.config.JwtRefreshTokenLifetime), 2),
+		"    \"session\".user_id = $1\n"+
+		"    AND \"session\".deleted_at IS NULL\n"+
+		r.activeSessionCondition(),
 		userID)
 	if err != nil {
 		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
@@ -1045,6 +1363,8 @@ func (r *repository) GetListActiveSessions(ctx context.Context, logger *zap.Logg
 			&session.PublicSessionID,
 			&session.Platform,
 			&session.UpdatedAt,
+			&session.ExpiresAt,
+			&session.RememberMe,
 		)
 		if err != nil {
 			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
@@ -1057,6 +1377,20 @@ func (r *repository) GetListActiveSessions(ctx context.Context, logger *zap.Logg
 	return sessions, nil
 }
 
+// activeSessionCondition enforces the policy stored in the session row: the session expires after the idle timeout
+// since the log in or the last refresh and at its expiry time regardless of the activity
+func (r *repository) activeSessionCondition() string {
+	return "    AND COALESCE( \"session\".updated_at, \"session\".created_at ) >\n" +
+		"        NOW( ) - " + r.sessionIdleTimeout() + " * INTERVAL '1 second'\n" +
+		"    AND ( \"session\".expires_at IS NULL OR \"session\".expires_at > NOW( ) )\n"
+}
+
+// sessionIdleTimeout is the idle timeout of the session, the sessions created before the policy have none,
+// they live as long as the refresh tokens
+func (r *repository) sessionIdleTimeout() string {
+	return "COALESCE( NULLIF( \"session\".idle_timeout, 0 ), " + strconv.Itoa(r.config.JwtRefreshTokenLifetime) + " )"
+}
+
 func (r *repository) DeleteSession(ctx context.Context, logger *zap.Logger, param model.RepoDeleteSessionParam) error {
 
 	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
@@ -1129,6 +1463,7 @@ func (r *repository) ResetUserPasswordStep1(ctx context.Context, logger *zap.Log
 		"WHERE\n"+
 		"    \"user\".email = $1\n"+
 		"    AND \"user\".deleted_at IS NULL\n"+
+		activeUserCondition()+
 		"LIMIT 1\n", param.Email)
 	if err != nil {
 		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
@@ -1190,6 +1525,67 @@ func (r *repository) ResetUserPasswordStep1(ctx context.Context, logger *zap.Log
 
 func (r *repository) ResetUserPasswordStep2(ctx context.Context, logger *zap.Logger, confirmationKey string) (model.User, error) {
 
+	var (
+		confirmationKeyID int64
+		user              model.User
+	)
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.User{}, err
+	}
+
+	propsValueRegexp := regexp.MustCompile(`^[abcefghijkmnopqrtuvwxyz23479]{16}$`)
+	if !propsValueRegexp.MatchString(confirmationKey) {
+		logger.Error("the param is not valid", zap.String("confirmationKey", confirmationKey))
+		return model.User{}, authorization.ErrorBadParamConfirmationKey
+	}
+
+	// Check the confirmationKey in Database, the key stays valid until the user has chosen a new password
+
+	loadConfirmationKeyInfo, err := r.dbBlade.Query("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    confirmation_reset_password.\"id\",\n"+
+		"    confirmation_reset_password.email,\n"+
+		"    confirmation_reset_password.\"language\"\n"+
+		"FROM\n"+
+		"    confirmation_reset_password\n"+
+		"WHERE\n"+
+		"    confirmation_reset_password.confirmation_key = $1\n"+
+		"    AND confirmation_reset_password.deleted_at IS NULL\n"+
+		"    AND confirmation_reset_password.expires_at > NOW()\n"+
+		"ORDER BY\n"+
+		"    confirmation_reset_password.\"id\" DESC\n"+
+		"LIMIT 1\n",
+		confirmationKey)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+	defer func(loadConfirmationKeyInfo *sql.Rows) {
+		if err := loadConfirmationKeyInfo.Close(); err != nil {
+			logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(loadConfirmationKeyInfo)
+
+	for loadConfirmationKeyInfo.Next() {
+		err = loadConfirmationKeyInfo.Scan(&confirmationKeyID, &user.Email, &user.Language)
+		if err != nil {
+			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+			return model.User{}, err
+		}
+	}
+
+	if confirmationKeyID == 0 {
+		return model.User{}, authorization.ErrorConfirmationKeyNotFound
+	}
+
+	return user, nil
+}
+
+func (r *repository) ResetUserPasswordStep3(ctx context.Context, logger *zap.Logger, param model.RepoSetPasswordParam) (model.User, error) {
+
 	var (
 		confirmationKeyID int64
 		userID            int64
@@ -1202,12 +1598,18 @@ func (r *repository) ResetUserPasswordStep2(ctx context.Context, logger *zap.Log
 		return model.User{}, err
 	}
 
+	confirmationKey := param.ConfirmationKey
 	propsValueRegexp := regexp.MustCompile(`^[abcefghijkmnopqrtuvwxyz23479]{16}$`)
 	if !propsValueRegexp.MatchString(confirmationKey) {
 		logger.Error("the param is not valid", zap.String("confirmationKey", confirmationKey))
 		return model.User{}, authorization.ErrorBadParamConfirmationKey
 	}
 
+	if !isValidPassword(param.Password) {
+		logger.Error("the password param is not valid", zap.String(requestIDKey, requestID))
+		return model.User{}, authorization.ErrorBadParamPassword
+	}
+
 	// Check the confirmationKey in Database
 
 	loadConfirmationKeyInfo, err := r.dbBlade.Query("/* postgreSQL query */\n"+
@@ -1329,6 +1731,7 @@ func (r *repository) ResetUserPasswordStep2(ctx context.Context, logger *zap.Log
 	if userID == 0 {
 		return model.User{}, authorization.ErrorUserNotFound
 	}
+	user.ID = userID
 
 	// Updating the confirmation key status to "Deleted"
 
@@ -1355,16 +1758,13 @@ func (r *repository) ResetUserPasswordStep2(ctx context.Context, logger *zap.Log
 		return model.User{}, err
 	}
 
-	// Generate and update user password in the Auth DB
+	// Update the user password in the Auth DB with the password chosen by the user
 
-	user.Password = generate.StringRand(16, 16, false)
-	hs := sha256.New()
-	_, err = hs.Write([]byte(user.Password + r.config.CryptoSalt))
+	hashedPassword, err := r.passwordHasher.Hash(param.Password)
 	if err != nil {
-		logger.DPanic("failed to generate a new password", zap.Error(err), zap.String(requestIDKey, requestID))
+		logger.DPanic("failed to hash the new password", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.User{}, err
 	}
-	hashedPassword := hex.EncodeToString(hs.Sum(nil))
 
 	updateUserPassword, err := dbTransactionAuthMain.Prepare("/* postgreSQL query */\n" +
 		"UPDATE\n" +
@@ -1406,3 +1806,96 @@ func (r *repository) ResetUserPasswordStep2(ctx context.Context, logger *zap.Log
 
 	return user, nil
 }
+
+func (r *repository) UpdateUserPassword(ctx context.Context, logger *zap.Logger, param model.RepoUpdateUserPasswordParam) error {
+
+	var hashedCurrentPassword string
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	if !isValidPassword(param.NewPassword) {
+		logger.Error("the newPassword param is not valid", zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParamPassword
+	}
+
+	// Check the current password
+
+	err = r.dbAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    \"user\".\"password\"\n"+
+		"FROM\n"+
+		"    \"user\"\n"+
+		"WHERE\n"+
+		"    \"user\".\"id\" = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n"+
+		activeUserCondition(),
+		param.UserID).
+		Scan(&hashedCurrentPassword)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the user not found", zap.Int64("userID", param.UserID), zap.String(requestIDKey, requestID))
+			return authorization.ErrorUserNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	passwordIsValid, err := r.passwordHasher.Verify(param.CurrentPassword, hashedCurrentPassword)
+	if err != nil {
+		logger.DPanic("failed to verify the current password", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if !passwordIsValid {
+		logger.Error("the current password is wrong", zap.Int64("userID", param.UserID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadCurrentPassword
+	}
+
+	hashedNewPassword, err := r.passwordHasher.Hash(param.NewPassword)
+	if err != nil {
+		logger.DPanic("failed to hash the new password", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	// The password is updated only if it hasn't been changed in the meantime
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    \"user\"\n"+
+		"SET\n"+
+		"    updated_at = NOW(),\n"+
+		"    \"password\" = $1\n"+
+		"WHERE\n"+
+		"    \"user\".\"id\" = $2\n"+
+		"    AND \"user\".\"password\" = $3\n",
+		hashedNewPassword,
+		param.UserID,
+		hashedCurrentPassword)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of rows affected", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	if rowsAffected == 0 {
+		logger.Error("the password has been changed in the meantime", zap.Int64("userID", param.UserID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadCurrentPassword
+	}
+
+	return nil
+}
+
+// isValidPassword checks the length of the password chosen by the user
+func isValidPassword(password string) bool {
+	return len(password) >= passwordMinLength && len(password) <= passwordMaxLength
+}
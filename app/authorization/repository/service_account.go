@@ -0,0 +1,356 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package repository
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"regexp"
+	"strings"
+)
+
+const scopeSeparator = " "
+
+func (r *repository) CreateServiceAccount(ctx context.Context, logger *zap.Logger, param model.RepoCreateServiceAccountParam) error {
+
+	var accountAmount int
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	if !regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`).MatchString(param.ClientID) ||
+		param.Name == "" || len(param.Name) > 255 || param.ClientSecret == "" {
+		logger.Error("the service account params are not valid", zap.String("clientID", param.ClientID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+	if !isValidScope(param.Scope) {
+		logger.Error("the scope is not valid", zap.String("scope", param.Scope), zap.String(requestIDKey, requestID))
+		return authorization.ErrorInvalidScope
+	}
+
+	hashedSecret, err := r.hashToken(param.ClientSecret)
+	if err != nil {
+		logger.DPanic("failed to generate hash for client secret", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n" +
+		"LOCK TABLE service_account IN SHARE ROW EXCLUSIVE MODE\n")
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	// The client ID of a deleted account is not reused, the tokens issued to it must never pass for another account
+
+	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    COUNT( service_account.\"id\" )\n"+
+		"FROM\n"+
+		"    service_account\n"+
+		"WHERE\n"+
+		"    service_account.client_id = $1\n",
+		param.ClientID).
+		Scan(&accountAmount)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if accountAmount > 0 {
+		logger.Error("the service account already exists", zap.String("clientID", param.ClientID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorServiceAccountAlreadyExist
+	}
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    service_account (\n"+
+		"        created_at,\n"+
+		"        client_id,\n"+
+		"        \"name\",\n"+
+		"        hashed_secret,\n"+
+		"        \"scope\"\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW(),\n"+
+		"    $1,\n"+
+		"    $2,\n"+
+		"    $3,\n"+
+		"    $4\n"+
+		")\n",
+		param.ClientID,
+		param.Name,
+		hashedSecret,
+		strings.Join(strings.Fields(param.Scope), scopeSeparator))
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) GetServiceAccount(ctx context.Context, logger *zap.Logger, clientID string) (model.ServiceAccount, error) {
+
+	var account model.ServiceAccount
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccount{}, err
+	}
+
+	err = r.dbAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    service_account.client_id,\n"+
+		"    service_account.\"name\",\n"+
+		"    service_account.hashed_secret,\n"+
+		"    service_account.\"scope\",\n"+
+		"    service_account.created_at\n"+
+		"FROM\n"+
+		"    service_account\n"+
+		"WHERE\n"+
+		"    service_account.client_id = $1\n"+
+		"    AND service_account.deleted_at IS NULL\n"+
+		"LIMIT 1\n", clientID).
+		Scan(&account.ClientID, &account.Name, &account.HashedSecret, &account.Scope, &account.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the service account not found", zap.String("clientID", clientID),
+				zap.String(requestIDKey, requestID))
+			return model.ServiceAccount{}, authorization.ErrorServiceAccountNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccount{}, err
+	}
+
+	return account, nil
+}
+
+func (r *repository) GetListServiceAccounts(ctx context.Context, logger *zap.Logger) ([]model.ServiceAccount, error) {
+
+	var accounts []model.ServiceAccount
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	loadAccounts, err := r.dbAuthMain.Query("/* postgreSQL query */\n" +
+		"SELECT\n" +
+		"    service_account.client_id,\n" +
+		"    service_account.\"name\",\n" +
+		"    service_account.\"scope\",\n" +
+		"    service_account.created_at\n" +
+		"FROM\n" +
+		"    service_account\n" +
+		"WHERE\n" +
+		"    service_account.deleted_at IS NULL\n" +
+		"ORDER BY\n" +
+		"    service_account.client_id\n")
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	defer func(loadAccounts *sql.Rows) {
+		if err := loadAccounts.Close(); err != nil {
+			logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(loadAccounts)
+
+	for loadAccounts.Next() {
+		var account model.ServiceAccount
+		err = loadAccounts.Scan(&account.ClientID, &account.Name, &account.Scope, &account.CreatedAt)
+		if err != nil {
+			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
+// UpdateServiceAccount changes the name and the scope or rotates the secret, the tokens already issued
+// keep their scope until they expire
+func (r *repository) UpdateServiceAccount(ctx context.Context, logger *zap.Logger, param model.RepoUpdateServiceAccountParam) error {
+
+	var hashedSecret string
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	if len(param.Name) > 255 {
+		logger.Error("the service account params are not valid", zap.String("clientID", param.ClientID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+	if param.Scope != "" && !isValidScope(param.Scope) {
+		logger.Error("the scope is not valid", zap.String("scope", param.Scope), zap.String(requestIDKey, requestID))
+		return authorization.ErrorInvalidScope
+	}
+
+	if param.ClientSecret != "" {
+		hashedSecret, err = r.hashToken(param.ClientSecret)
+		if err != nil {
+			logger.DPanic("failed to generate hash for client secret", zap.Error(err), zap.String(requestIDKey, requestID))
+			return err
+		}
+	}
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    service_account\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    \"name\" = COALESCE( NULLIF( $1, '' ), service_account.\"name\" ),\n"+
+		"    \"scope\" = COALESCE( NULLIF( $2, '' ), service_account.\"scope\" ),\n"+
+		"    hashed_secret = COALESCE( NULLIF( $3, '' ), service_account.hashed_secret )\n"+
+		"WHERE\n"+
+		"    service_account.client_id = $4\n"+
+		"    AND service_account.deleted_at IS NULL\n",
+		param.Name,
+		strings.Join(strings.Fields(param.Scope), scopeSeparator),
+		hashedSecret,
+		param.ClientID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the service account not found", zap.String("clientID", param.ClientID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorServiceAccountNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteServiceAccount(ctx context.Context, logger *zap.Logger, clientID string) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    service_account\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    service_account.client_id = $1\n"+
+		"    AND service_account.deleted_at IS NULL\n",
+		clientID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the service account not found", zap.String("clientID", clientID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorServiceAccountNotFound
+	}
+
+	return nil
+}
+
+// AuthenticateServiceAccount checks the secret of the service account, an unknown account is an invalid client
+// as well, so the caller can't tell the accounts from the wrong secrets
+func (r *repository) AuthenticateServiceAccount(ctx context.Context, logger *zap.Logger,
+	param model.RepoAuthenticateOauthClientParam) (model.ServiceAccount, error) {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccount{}, err
+	}
+
+	account, err := r.GetServiceAccount(ctx, logger, param.ClientID)
+	if err != nil {
+		switch err {
+		case authorization.ErrorServiceAccountNotFound:
+			return model.ServiceAccount{}, authorization.ErrorInvalidClient
+		default:
+			return model.ServiceAccount{}, err
+		}
+	}
+
+	hashedSecret, err := r.hashToken(param.ClientSecret)
+	if err != nil {
+		logger.DPanic("failed to generate hash for client secret", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccount{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashedSecret), []byte(account.HashedSecret)) != 1 {
+		logger.Error("the service account secret is wrong", zap.String("clientID", param.ClientID),
+			zap.String(requestIDKey, requestID))
+		return model.ServiceAccount{}, authorization.ErrorInvalidClient
+	}
+
+	return account, nil
+}
+
+// isValidScope accepts the space-separated scope tokens of RFC 6749, section 3.3, which fit the scope column
+func isValidScope(scope string) bool {
+
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 || len(strings.Join(scopes, scopeSeparator)) > 255 {
+		return false
+	}
+
+	for _, value := range scopes {
+		for _, char := range value {
+			if char < 0x21 || char > 0x7e || char == '"' || char == '\\' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
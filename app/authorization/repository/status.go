@@ -0,0 +1,159 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"html"
+	"time"
+)
+
+// userStatusColumn is the current status of the user, the status that has expired is active again
+func userStatusColumn() string {
+	return "    CASE WHEN \"user\".status_expires_at <= NOW( ) THEN '" + model.UserStatusActive + "'\n" +
+		"        ELSE \"user\".status END"
+}
+
+// activeUserCondition excludes the users who can't sign in for their status
+func activeUserCondition() string {
+	return "    AND ( \"user\".status = '" + model.UserStatusActive + "' OR \"user\".status_expires_at <= NOW( ) )\n"
+}
+
+// userStatusError is the error the user who is not active gets instead of the tokens
+func userStatusError(status string) error {
+	switch status {
+	case model.UserStatusActive:
+		return nil
+	case model.UserStatusSuspended:
+		return authorization.ErrorUserSuspended
+	case model.UserStatusLocked:
+		return authorization.ErrorUserLocked
+	case model.UserStatusBanned:
+		return authorization.ErrorUserBanned
+	default:
+		return authorization.ErrorBadParamStatus
+	}
+}
+
+// UpdateUserStatus keeps the reason and the time of the change. The sessions of the user who is not active
+// anymore are deleted, their public IDs are returned to revoke the access tokens.
+func (r *repository) UpdateUserStatus(ctx context.Context, logger *zap.Logger, param model.RepoUpdateUserStatusParam) ([]string, error) {
+
+	var publicSessionIDs []string
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	// Check parameters
+
+	if userStatusError(param.Status) == authorization.ErrorBadParamStatus {
+		logger.Error("the status param is not valid", zap.String("status", param.Status),
+			zap.String(requestIDKey, requestID))
+		return nil, authorization.ErrorBadParamStatus
+	}
+
+	param.Reason = html.EscapeString(param.Reason)
+	if len(param.Reason) > 255 {
+		logger.Error("the reason param is not valid", zap.Int("length", len(param.Reason)),
+			zap.String(requestIDKey, requestID))
+		return nil, authorization.ErrorBadParams
+	}
+
+	if param.Status == model.UserStatusActive || (param.ExpiresAt != nil && !param.ExpiresAt.After(time.Now())) {
+		param.ExpiresAt = nil
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	result, err := dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    \"user\"\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    status = $2,\n"+
+		"    status_reason = $3,\n"+
+		"    status_changed_at = NOW( ),\n"+
+		"    status_expires_at = $4\n"+
+		"WHERE\n"+
+		"    \"user\".\"id\" = $1\n"+
+		"    AND \"user\".deleted_at IS NULL\n",
+		param.UserID, param.Status, param.Reason, param.ExpiresAt)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	if affected == 0 {
+		logger.Error("the user not found", zap.Int64("userID", param.UserID), zap.String(requestIDKey, requestID))
+		return nil, authorization.ErrorUserNotFound
+	}
+
+	if param.Status != model.UserStatusActive {
+
+		loadPublicSessionIDs, err := dbTransactionAuthMain.Query("/* postgreSQL query */\n"+
+			"UPDATE\n"+
+			"    \"session\"\n"+
+			"SET\n"+
+			"    deleted_at = NOW( )\n"+
+			"WHERE\n"+
+			"    \"session\".user_id = $1\n"+
+			"    AND \"session\".deleted_at IS NULL\n"+
+			"RETURNING\n"+
+			"    \"session\".public_id\n",
+			param.UserID)
+		if err != nil {
+			logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+			return nil, err
+		}
+
+		for loadPublicSessionIDs.Next() {
+			var publicSessionID string
+			err = loadPublicSessionIDs.Scan(&publicSessionID)
+			if err != nil {
+				logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+				_ = loadPublicSessionIDs.Close()
+				return nil, err
+			}
+			publicSessionIDs = append(publicSessionIDs, publicSessionID)
+		}
+
+		// The result set must be closed before the commit of the transaction
+		if err := loadPublicSessionIDs.Close(); err != nil {
+			logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+			return nil, err
+		}
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	return publicSessionIDs, nil
+}
@@ -0,0 +1,315 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+)
+
+func (r *repository) CreateWebauthnChallenge(ctx context.Context, logger *zap.Logger, param model.RepoCreateWebauthnChallengeParam) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	hashedChallenge, err := r.hashToken(param.Challenge)
+	if err != nil {
+		logger.DPanic("failed to generate hash for challenge", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	_, err = r.dbBlade.Exec("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    webauthn_challenge (\n"+
+		"        created_at,\n"+
+		"        ceremony,\n"+
+		"        user_id,\n"+
+		"        hashed_challenge,\n"+
+		"        expires_at\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW(),\n"+
+		"    $1,\n"+
+		"    $2,\n"+
+		"    $3,\n"+
+		"    NOW( ) + $4 * INTERVAL '1 second'\n"+
+		")\n",
+		param.Ceremony,
+		param.UserID,
+		hashedChallenge,
+		param.Lifetime)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+// GetWebauthnChallenge consumes the challenge and returns the user the ceremony was started for,
+// so the same authenticator response can not be verified twice
+func (r *repository) GetWebauthnChallenge(ctx context.Context, logger *zap.Logger, param model.RepoGetWebauthnChallengeParam) (int64, error) {
+
+	var userID int64
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return 0, err
+	}
+
+	hashedChallenge, err := r.hashToken(param.Challenge)
+	if err != nil {
+		logger.DPanic("failed to generate hash for challenge", zap.Error(err), zap.String(requestIDKey, requestID))
+		return 0, err
+	}
+
+	err = r.dbBlade.QueryRow("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    webauthn_challenge\n"+
+		"SET\n"+
+		"    deleted_at = NOW( )\n"+
+		"WHERE\n"+
+		"    webauthn_challenge.hashed_challenge = $1\n"+
+		"    AND webauthn_challenge.ceremony = $2\n"+
+		"    AND webauthn_challenge.deleted_at IS NULL\n"+
+		"    AND webauthn_challenge.expires_at > NOW( )\n"+
+		"RETURNING\n"+
+		"    webauthn_challenge.user_id\n",
+		hashedChallenge,
+		param.Ceremony).
+		Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the challenge not found", zap.String(requestIDKey, requestID))
+			return 0, authorization.ErrorWebauthnChallengeNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (r *repository) CreateWebauthnCredential(ctx context.Context, logger *zap.Logger, param model.RepoCreateWebauthnCredentialParam) error {
+
+	var credentialAmount int
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	// Begin the transaction
+
+	dbTransactionAuthMain, err := r.dbAuthMain.Begin()
+	if err != nil {
+		logger.DPanic("failed to begin AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	defer func(dbTransactionAuthMain *sql.Tx) {
+		err := dbTransactionAuthMain.Rollback()
+		if err != nil && err.Error() != messageTransactionHasAlreadyBeenCommittedOrRolledBack {
+			logger.DPanic("failed to rollback AuthMain DB transaction", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(dbTransactionAuthMain)
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n" +
+		"LOCK TABLE user_webauthn_credential IN SHARE ROW EXCLUSIVE MODE\n")
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	// A credential ID belongs to one user only
+
+	err = dbTransactionAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    COUNT( user_webauthn_credential.\"id\" )\n"+
+		"FROM\n"+
+		"    user_webauthn_credential\n"+
+		"WHERE\n"+
+		"    user_webauthn_credential.credential_id = $1\n"+
+		"    AND user_webauthn_credential.deleted_at IS NULL\n",
+		param.CredentialID).
+		Scan(&credentialAmount)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if credentialAmount > 0 {
+		logger.Error("the credential is already registered", zap.Int64("userID", param.UserID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorWebauthnCredentialAlreadyExist
+	}
+
+	_, err = dbTransactionAuthMain.Exec("/* postgreSQL query */\n"+
+		"INSERT\n"+
+		"    INTO\n"+
+		"    user_webauthn_credential (\n"+
+		"        created_at,\n"+
+		"        user_id,\n"+
+		"        credential_id,\n"+
+		"        public_key,\n"+
+		"        sign_count\n"+
+		"    )\n"+
+		"VALUES (\n"+
+		"    NOW(),\n"+
+		"    $1,\n"+
+		"    $2,\n"+
+		"    $3,\n"+
+		"    $4\n"+
+		")\n",
+		param.UserID,
+		param.CredentialID,
+		param.PublicKey,
+		int64(param.SignCount))
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = dbTransactionAuthMain.Commit()
+	if err != nil {
+		logger.DPanic("failed to commit to the AuthMain DB", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) GetListWebauthnCredentials(ctx context.Context, logger *zap.Logger, userID int64) ([]model.WebauthnCredential, error) {
+
+	var credentials []model.WebauthnCredential
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	loadCredentials, err := r.dbAuthMain.Query("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    user_webauthn_credential.user_id,\n"+
+		"    user_webauthn_credential.credential_id,\n"+
+		"    user_webauthn_credential.public_key,\n"+
+		"    user_webauthn_credential.sign_count\n"+
+		"FROM\n"+
+		"    user_webauthn_credential\n"+
+		"WHERE\n"+
+		"    user_webauthn_credential.user_id = $1\n"+
+		"    AND user_webauthn_credential.deleted_at IS NULL\n"+
+		"ORDER BY\n"+
+		"    user_webauthn_credential.\"id\"\n",
+		userID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	defer func(loadCredentials *sql.Rows) {
+		if err := loadCredentials.Close(); err != nil {
+			logger.DPanic("failed to close result set", zap.Error(err), zap.String(requestIDKey, requestID))
+		}
+	}(loadCredentials)
+
+	for loadCredentials.Next() {
+		var credential model.WebauthnCredential
+		var signCount int64
+		err = loadCredentials.Scan(&credential.UserID, &credential.CredentialID, &credential.PublicKey, &signCount)
+		if err != nil {
+			logger.DPanic("failed to scan the data", zap.Error(err), zap.String(requestIDKey, requestID))
+			return nil, err
+		}
+		credential.SignCount = uint32(signCount)
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, nil
+}
+
+func (r *repository) GetWebauthnCredential(ctx context.Context, logger *zap.Logger, credentialID string) (model.WebauthnCredential, error) {
+
+	var credential model.WebauthnCredential
+	var signCount int64
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.WebauthnCredential{}, err
+	}
+
+	err = r.dbAuthMain.QueryRow("/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    user_webauthn_credential.user_id,\n"+
+		"    user_webauthn_credential.credential_id,\n"+
+		"    user_webauthn_credential.public_key,\n"+
+		"    user_webauthn_credential.sign_count\n"+
+		"FROM\n"+
+		"    user_webauthn_credential\n"+
+		"WHERE\n"+
+		"    user_webauthn_credential.credential_id = $1\n"+
+		"    AND user_webauthn_credential.deleted_at IS NULL\n"+
+		"LIMIT 1\n", credentialID).
+		Scan(&credential.UserID, &credential.CredentialID, &credential.PublicKey, &signCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("the credential not found", zap.String(requestIDKey, requestID))
+			return model.WebauthnCredential{}, authorization.ErrorWebauthnCredentialNotFound
+		}
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.WebauthnCredential{}, err
+	}
+	credential.SignCount = uint32(signCount)
+
+	return credential, nil
+}
+
+func (r *repository) UpdateWebauthnSignCount(ctx context.Context, logger *zap.Logger, param model.RepoUpdateWebauthnSignCountParam) error {
+
+	requestID, requestIDKey, err := r.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	// The counter is compared again, two concurrent assertions with the same counter must not both pass
+
+	result, err := r.dbAuthMain.Exec("/* postgreSQL query */\n"+
+		"UPDATE\n"+
+		"    user_webauthn_credential\n"+
+		"SET\n"+
+		"    updated_at = NOW( ),\n"+
+		"    last_used_at = NOW( ),\n"+
+		"    sign_count = $1\n"+
+		"WHERE\n"+
+		"    user_webauthn_credential.credential_id = $2\n"+
+		"    AND user_webauthn_credential.deleted_at IS NULL\n"+
+		"    AND ( user_webauthn_credential.sign_count < $1 OR $1 = 0 )\n",
+		int64(param.SignCount),
+		param.CredentialID)
+	if err != nil {
+		logger.DPanic("failed to exec the query", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.DPanic("failed to get the number of affected rows", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if affected == 0 {
+		logger.Error("the signature counter did not increase", zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadWebauthnResponse
+	}
+
+	return nil
+}
@@ -0,0 +1,408 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+const defaultSearchUsersLimit = 50
+
+// SearchUsers
+// @Summary Search the users by email
+// @Description The disabled users are listed too, the deleted users are not.
+// @ID search_users
+// @Security authorization
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param email query string false "The part of the email"
+// @Param limit query int false "The maximum number of users, 50 by default"
+// @Param offset query int false "The number of users to skip"
+// @Success 200 {object} []model.UserRecord "Successful operation"
+// @Failure 400 {object} model.CommonFailure
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/users [get]
+func (a *rest) SearchUsers(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		query := r.URL.Query()
+		param := model.ServiceSearchUsersParam{
+			Email: query.Get("email"),
+			Limit: defaultSearchUsersLimit}
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		if value := query.Get("limit"); value != "" {
+			param.Limit, err = strconv.Atoi(value)
+			if err != nil {
+				logger.Error("the limit is not valid", zap.Error(err), zap.String(requestIDKey, requestID))
+				http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if value := query.Get("offset"); value != "" {
+			param.Offset, err = strconv.Atoi(value)
+			if err != nil {
+				logger.Error("the offset is not valid", zap.Error(err), zap.String(requestIDKey, requestID))
+				http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		users, err := a.service.SearchUsers(r.Context(), logger, param)
+		if err != nil {
+			logger.Error("failed to search the users", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadParams:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+		if users == nil {
+			users = []model.UserRecord{}
+		}
+
+		a.writeAdminResponse(w, logger, requestIDKey, requestID, http.StatusOK, users)
+		return
+	})
+}
+
+// GetUserDetail
+// @Summary Get the user
+// @Description Get the user with the active sessions, the issued invite codes, the MFA status and the roles.
+// @ID get_user_detail
+// @Security authorization
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param userID path int true "The ID of the user"
+// @Success 200 {object} model.UserDetail "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.AdminUserFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/users/{userID} [get]
+func (a *rest) GetUserDetail(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+		if err != nil {
+			logger.Error("the userID is not valid", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, authorization.ErrorUserNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		detail, err := a.service.GetUserDetail(r.Context(), logger, userID)
+		if err != nil {
+			logger.Error("failed to get the user", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorUserNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		a.writeAdminResponse(w, logger, requestIDKey, requestID, http.StatusOK, detail)
+		return
+	})
+}
+
+// DisableUser
+// @Summary Disable the user
+// @Description The sessions of the user are revoked, the user can't sign in until enabled. Be aware that this query is idempotent.
+// @ID disable_user
+// @Security authorization
+// @Param request-id header string true "RequestID"
+// @Param userID path int true "The ID of the user"
+// @Success 204 "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.AdminUserFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/users/{userID}/disable [put]
+func (a *rest) DisableUser(logger *zap.Logger) http.Handler {
+	return a.handleAdminUser(logger, a.service.DisableUser)
+}
+
+// EnableUser
+// @Summary Enable the user
+// @Description The user can sign in again. Be aware that this query is idempotent.
+// @ID enable_user
+// @Security authorization
+// @Param request-id header string true "RequestID"
+// @Param userID path int true "The ID of the user"
+// @Success 204 "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.AdminUserFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/users/{userID}/enable [put]
+func (a *rest) EnableUser(logger *zap.Logger) http.Handler {
+	return a.handleAdminUser(logger, a.service.EnableUser)
+}
+
+// ForceUserPasswordReset
+// @Summary Force the user to reset the password
+// @Description The current password stops working and the sessions are revoked. The user gets the email with a link to choose a new password.
+// @ID force_user_password_reset
+// @Security authorization
+// @Param request-id header string true "RequestID"
+// @Param userID path int true "The ID of the user"
+// @Success 204 "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.AdminUserFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/users/{userID}/password-reset [put]
+func (a *rest) ForceUserPasswordReset(logger *zap.Logger) http.Handler {
+	return a.handleAdminUser(logger, a.service.ForceUserPasswordReset)
+}
+
+// DeleteUser
+// @Summary Delete the user
+// @Description The user is marked as deleted and the sessions are revoked, the record is kept.
+// @ID delete_user
+// @Security authorization
+// @Param request-id header string true "RequestID"
+// @Param userID path int true "The ID of the user"
+// @Success 204 "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.AdminUserFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/users/{userID} [delete]
+func (a *rest) DeleteUser(logger *zap.Logger) http.Handler {
+	return a.handleAdminUser(logger, a.service.DeleteUser)
+}
+
+// UpdateUserStatus
+// @Summary Update the account status of the user
+// @Description The user who is not active can't sign in or refresh the tokens and gets the error of the status, e.g. USER_SUSPENDED. The sessions are revoked unless the status is active. The user is active again once the status has expired.
+// @ID update_user_status
+// @Security authorization
+// @Accept application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param userID path int true "The ID of the user"
+// @Param model.UpdateUserStatusRequest body model.UpdateUserStatusRequest true "The new status"
+// @Success 204 "Successful operation"
+// @Failure 400 {object} model.UpdateUserStatusFailure400
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.AdminUserFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/users/{userID}/status [put]
+func (a *rest) UpdateUserStatus(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.UpdateUserStatusRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+		if err != nil {
+			logger.Error("the userID is not valid", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, authorization.ErrorUserNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = a.service.UpdateUserStatus(r.Context(), logger, model.ServiceUpdateUserStatusParam{
+			UserID:    userID,
+			Status:    requestInput.Status,
+			Reason:    requestInput.Reason,
+			ExpiresAt: requestInput.ExpiresAt})
+		if err != nil {
+			logger.Error("failed to update the status of the user", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadParams:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorUserNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
+
+// ResendSignUpConfirmation
+// @Summary Resend the sign-up confirmation
+// @Description The user whose sign-up has not been confirmed yet gets the email with a new confirmation link, the previous link stops working.
+// @ID resend_sign_up_confirmation
+// @Security authorization
+// @Accept application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param model.ResendSignUpConfirmationRequest body model.ResendSignUpConfirmationRequest true "Data for resending the confirmation"
+// @Success 204 "Successful operation"
+// @Failure 400 {object} model.ResendSignUpConfirmationFailure400
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.AdminUserFailure404
+// @Failure 409 {object} model.ResendSignUpConfirmationFailure409
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/confirmations [post]
+func (a *rest) ResendSignUpConfirmation(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.ResendSignUpConfirmationRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = a.service.ResendSignUpConfirmation(r.Context(), logger, requestInput.Email)
+		if err != nil {
+			logger.Error("failed to resend the sign-up confirmation", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadParams:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorUserNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			case authorization.ErrorUserAlreadyExist:
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
+
+// handleAdminUser reads the user of the path for the actions of the administrators
+func (a *rest) handleAdminUser(logger *zap.Logger,
+	action func(ctx context.Context, logger *zap.Logger, userID int64) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+		if err != nil {
+			logger.Error("the userID is not valid", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, authorization.ErrorUserNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		err = action(r.Context(), logger, userID)
+		if err != nil {
+			logger.Error("failed to manage the user", zap.Error(err), zap.Int64("userID", userID),
+				zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorUserNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
+
+func (a *rest) writeAdminResponse(w http.ResponseWriter, logger *zap.Logger, requestIDKey, requestID string,
+	status int, response interface{}) {
+
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		logger.DPanic("failed to marshal the response", zap.Error(err), zap.String(requestIDKey, requestID))
+		http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+	w.WriteHeader(status)
+	if code, err := w.Write(responseBody); err != nil {
+		logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return
+	}
+}
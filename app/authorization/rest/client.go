@@ -0,0 +1,248 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+)
+
+// GetListOauthClients
+// @Summary Get a list of the OAuth 2.0 clients
+// @Description Get the registered clients, the disabled ones too. The secrets are never returned.
+// @ID get_list_oauth_clients
+// @Security authorization
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Success 200 {object} []model.OauthClient "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/clients [get]
+func (a *rest) GetListOauthClients(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		clients, err := a.service.GetListOauthClients(r.Context(), logger)
+		if err != nil {
+			logger.DPanic("failed to get the list of the clients", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		if clients == nil {
+			clients = []model.OauthClient{}
+		}
+
+		a.writeAdminResponse(w, logger, requestIDKey, requestID, http.StatusOK, clients)
+		return
+	})
+}
+
+// CreateOauthClient
+// @Summary Register the OAuth 2.0 client
+// @Description Register the client with its grant types, scopes and token lifetimes. The secret of the confidential client is returned once, only its hash is stored.
+// @ID create_oauth_client
+// @Security authorization
+// @Accept application/json;charset=utf-8
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param model.CreateOauthClientRequest body model.CreateOauthClientRequest true "Data for registering the client"
+// @Success 201 {object} model.ClientCredentialsResponse "Successful operation"
+// @Failure 400 {object} model.OauthClientFailure400
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 409 {object} model.OauthClientFailure409
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/clients [post]
+func (a *rest) CreateOauthClient(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.CreateOauthClientRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		credentials, err := a.service.CreateOauthClient(r.Context(), logger, model.ServiceCreateOauthClientParam{
+			ClientID:             requestInput.ClientID,
+			Name:                 requestInput.Name,
+			GrantTypes:           requestInput.GrantTypes,
+			RedirectURIs:         requestInput.RedirectURIs,
+			Scope:                requestInput.Scope,
+			Audience:             requestInput.Audience,
+			AccessTokenLifetime:  requestInput.AccessTokenLifetime,
+			RefreshTokenLifetime: requestInput.RefreshTokenLifetime,
+			Confidential:         requestInput.Confidential})
+		if err != nil {
+			logger.Error("failed to create the client", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadParams, authorization.ErrorInvalidScope, authorization.ErrorInvalidRedirectURI:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorOauthClientAlreadyExist:
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		a.writeAdminResponse(w, logger, requestIDKey, requestID, http.StatusCreated, model.ClientCredentialsResponse{
+			ClientID:     credentials.ClientID,
+			ClientSecret: credentials.ClientSecret})
+		return
+	})
+}
+
+// UpdateOauthClient
+// @Summary Update the OAuth 2.0 client
+// @Description Change the registration of the client, the omitted params are not changed. The tokens already issued keep their scope and lifetime until they expire.
+// @ID update_oauth_client
+// @Security authorization
+// @Accept application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param clientID path string true "The client ID"
+// @Param model.UpdateOauthClientRequest body model.UpdateOauthClientRequest true "Data for updating the client"
+// @Success 204 "Successful operation"
+// @Failure 400 {object} model.OauthClientFailure400
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.OauthClientFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/clients/{clientID} [put]
+func (a *rest) UpdateOauthClient(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.UpdateOauthClientRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = a.service.UpdateOauthClient(r.Context(), logger, model.ServiceUpdateOauthClientParam{
+			ClientID:             mux.Vars(r)["clientID"],
+			Name:                 requestInput.Name,
+			GrantTypes:           requestInput.GrantTypes,
+			RedirectURIs:         requestInput.RedirectURIs,
+			Scope:                requestInput.Scope,
+			Audience:             requestInput.Audience,
+			AccessTokenLifetime:  requestInput.AccessTokenLifetime,
+			RefreshTokenLifetime: requestInput.RefreshTokenLifetime})
+		if err != nil {
+			logger.Error("failed to update the client", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadParams, authorization.ErrorInvalidScope, authorization.ErrorInvalidRedirectURI:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorOauthClientNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
+
+// DisableOauthClient
+// @Summary Disable the OAuth 2.0 client
+// @Description The sessions of the client are closed and the client is rejected as an unknown one, the issued access tokens expire on their own. The client is enabled again with the CLI.
+// @ID disable_oauth_client
+// @Security authorization
+// @Param request-id header string true "RequestID"
+// @Param clientID path string true "The client ID"
+// @Success 204 "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.OauthClientFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/clients/{clientID} [delete]
+func (a *rest) DisableOauthClient(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = a.service.DisableOauthClient(r.Context(), logger, mux.Vars(r)["clientID"])
+		if err != nil {
+			logger.Error("failed to disable the client", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorOauthClientNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
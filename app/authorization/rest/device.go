@@ -0,0 +1,227 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+)
+
+// CreateDeviceAuthorization
+// @Summary OAuth 2.0 device authorization endpoint
+// @Description Start the authorization of a device without a browser, such as the CLI (RFC 8628). The device shows the user code and the verification URI, the user approves the code on the verification page of the PWA. Meanwhile, the device polls the token endpoint with the urn:ietf:params:oauth:grant-type:device_code grant and the device code, not more often than the interval.
+// @ID oauth_device_authorization
+// @Accept application/x-www-form-urlencoded
+// @Produce application/json;charset=utf-8
+// @Param client_id formData string false "The client ID, if HTTP Basic is not used"
+// @Param client_secret formData string false "The secret of a confidential client, if HTTP Basic is not used"
+// @Param scope formData string false "openid to get the ID token from the token endpoint"
+// @Success 200 {object} model.DeviceAuthorizationResponse "Successful operation"
+// @Failure 400 {object} model.TokenFailure
+// @Failure 401 {object} model.TokenFailure
+// @Failure 500 {object} model.CommonFailure
+// @Router /oauth/device_authorization [post]
+func (a *rest) CreateDeviceAuthorization(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, oauthTokenRequestMaxBytes)
+		err = r.ParseForm()
+		if err != nil {
+			logger.Error("failed to parse the form", zap.Error(err), zap.String(requestIDKey, requestID))
+			a.oauthError(w, logger, requestID, requestIDKey, authorization.ErrorInvalidRequest, false)
+			return
+		}
+
+		clientID, clientSecret, basicAuth, err := oauthClientCredentials(r)
+		if err != nil {
+			logger.Error("failed to get the client credentials", zap.Error(err), zap.String(requestIDKey, requestID))
+			a.oauthError(w, logger, requestID, requestIDKey, err, basicAuth)
+			return
+		}
+
+		deviceAuthorization, err := a.service.CreateDeviceAuthorization(r.Context(), logger,
+			model.ServiceDeviceAuthorizationParam{
+				ClientID:     clientID,
+				ClientSecret: clientSecret,
+				Scope:        r.PostForm.Get("scope")})
+		if err != nil {
+			logger.Error("failed to create the device authorization", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorInvalidRequest, authorization.ErrorInvalidClient, authorization.ErrorUnauthorizedClient:
+				a.oauthError(w, logger, requestID, requestIDKey, err, basicAuth)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseBody, err := json.Marshal(model.DeviceAuthorizationResponse{
+			DeviceCode:              deviceAuthorization.DeviceCode,
+			UserCode:                deviceAuthorization.UserCode,
+			VerificationURI:         deviceAuthorization.VerificationURI,
+			VerificationURIComplete: deviceAuthorization.VerificationURIComplete,
+			ExpiresIn:               deviceAuthorization.ExpiresIn,
+			Interval:                deviceAuthorization.Interval,
+		})
+		if err != nil {
+			logger.DPanic("failed to marshal model.DeviceAuthorizationResponse", zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+		return
+	})
+}
+
+// GetDeviceAuthorization
+// @Summary Get the device authorization request
+// @Description The verification page of the PWA shows the client that asks for the access, so the signed-in user can check the request before the approval.
+// @ID get_device_authorization
+// @Security authorization
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param user_code query string true "The user code shown by the device"
+// @Success 200 {object} model.DeviceVerificationResponse "Successful operation"
+// @Failure 404 {object} model.DeviceAuthorizationFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /oauth/device [get]
+func (a *rest) GetDeviceAuthorization(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		verification, err := a.service.GetDeviceAuthorization(r.Context(), logger, r.URL.Query().Get("user_code"))
+		if err != nil {
+			logger.Error("failed to get the device authorization", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorUserCodeNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseBody, err := json.Marshal(model.DeviceVerificationResponse{
+			ClientID:   verification.ClientID,
+			ClientName: verification.ClientName,
+			Scope:      verification.Scope,
+		})
+		if err != nil {
+			logger.DPanic("failed to marshal model.DeviceVerificationResponse", zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+		return
+	})
+}
+
+// ApproveDeviceAuthorization
+// @Summary Approve or deny the device authorization request
+// @Description The signed-in user approves the user code shown by the device, the device gets the tokens of the user on the next poll. A denied request can't be approved later, the device has to start again.
+// @ID approve_device_authorization
+// @Security authorization
+// @Accept application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param model.ApproveDeviceAuthorizationRequest body model.ApproveDeviceAuthorizationRequest true "The user code and the decision"
+// @Success 204 "Successful operation"
+// @Failure 400 {object} model.CommonFailure
+// @Failure 404 {object} model.DeviceAuthorizationFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /oauth/device [put]
+func (a *rest) ApproveDeviceAuthorization(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.ApproveDeviceAuthorizationRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		accessTokenData, err := a.contextGetter.GetJwtData(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = a.service.ApproveDeviceAuthorization(r.Context(), logger, model.ServiceApproveDeviceAuthorizationParam{
+			AccessTokenData: accessTokenData,
+			UserCode:        requestInput.UserCode,
+			Approved:        requestInput.Approved})
+		if err != nil {
+			logger.Error("failed to approve the device authorization", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorUserCodeNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
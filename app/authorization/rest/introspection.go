@@ -0,0 +1,89 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// IntrospectToken
+// @Summary OAuth 2.0 token introspection endpoint
+// @Description Check whether the access or refresh token is active and get what it has been issued for (RFC 7662), so the API gateway doesn't have to decrypt the token data. A confidential client authenticates with HTTP Basic or the client_id and client_secret params. A token that is invalid, expired, revoked or of a deleted session is returned as inactive.
+// @ID oauth_introspect
+// @Accept application/x-www-form-urlencoded
+// @Produce application/json;charset=utf-8
+// @Param client_id formData string false "The client ID, if HTTP Basic is not used"
+// @Param client_secret formData string false "The client secret, if HTTP Basic is not used"
+// @Param token formData string true "The access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200 {object} model.TokenIntrospection "Successful operation"
+// @Failure 400 {object} model.TokenFailure
+// @Failure 401 {object} model.TokenFailure
+// @Failure 500 {object} model.CommonFailure
+// @Router /oauth/introspect [post]
+func (a *rest) IntrospectToken(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, oauthTokenRequestMaxBytes)
+		err = r.ParseForm()
+		if err != nil {
+			logger.Error("failed to parse the form", zap.Error(err), zap.String(requestIDKey, requestID))
+			a.oauthError(w, logger, requestID, requestIDKey, authorization.ErrorInvalidRequest, false)
+			return
+		}
+
+		clientID, clientSecret, basicAuth, err := oauthClientCredentials(r)
+		if err != nil {
+			logger.Error("failed to get the client credentials", zap.Error(err), zap.String(requestIDKey, requestID))
+			a.oauthError(w, logger, requestID, requestIDKey, err, basicAuth)
+			return
+		}
+
+		introspection, err := a.service.IntrospectToken(r.Context(), logger, model.ServiceIntrospectTokenParam{
+			ClientID:      clientID,
+			ClientSecret:  clientSecret,
+			Token:         r.PostForm.Get("token"),
+			TokenTypeHint: r.PostForm.Get("token_type_hint")})
+		if err != nil {
+			logger.Error("failed to introspect the token", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorInvalidRequest, authorization.ErrorInvalidClient:
+				a.oauthError(w, logger, requestID, requestIDKey, err, basicAuth)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseBody, err := json.Marshal(introspection)
+		if err != nil {
+			logger.DPanic("failed to marshal model.TokenIntrospection", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+		return
+	})
+}
@@ -0,0 +1,320 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+)
+
+// VerifyMfaChallenge
+// @Summary Pass the second factor (Domain Action: Log In)
+// @Description Exchange the challenge token returned by /v1/oauth/ and the one-time code from the authenticator app for the tokens. A recovery code can be passed in place of the one-time code, the user gets a notification email after that. A challenge token can be tried 5 times.
+// @ID verify_mfa_challenge
+// @Accept application/json;charset=utf-8
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param model.VerifyMfaChallengeRequest body model.VerifyMfaChallengeRequest true "The challenge token and the one-time code or the recovery code"
+// @Success 200 {object} model.AccessTokenResponse "Successful operation"
+// @Failure 400 {object} model.VerifyMfaChallengeFailure400
+// @Failure 403 {object} model.VerifyMfaChallengeFailure403
+// @Failure 404 {object} model.VerifyMfaChallengeFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/oauth/mfa [post]
+func (a *rest) VerifyMfaChallenge(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.VerifyMfaChallengeRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		serviceAccessTokenReturn, err := a.service.VerifyMfaChallenge(r.Context(), logger, model.ServiceVerifyMfaChallengeParam{
+			ChallengeToken: requestInput.ChallengeToken,
+			Code:           requestInput.Code,
+			RecoveryCode:   requestInput.RecoveryCode})
+		if err != nil {
+			logger.Error("failed to verify the challenge", zap.String(requestIDKey, requestID), zap.Error(err))
+			switch err {
+			case authorization.ErrorBadParams, authorization.ErrorInvalidClient, authorization.ErrorUnauthorizedClient:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorBadMfaCode,
+				authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			case authorization.ErrorMfaChallengeNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseBody, err := json.Marshal(model.AccessTokenResponse{
+			PublicSessionID: serviceAccessTokenReturn.PublicSessionID,
+			AccessJWT:       serviceAccessTokenReturn.AccessJWT,
+			RefreshJWT:      serviceAccessTokenReturn.RefreshJWT,
+			Scope:           serviceAccessTokenReturn.Scope,
+		})
+		if err != nil {
+			logger.DPanic("failed to marshal model.AccessTokenResponse", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+
+		return
+	})
+}
+
+// CreateTotp
+// @Summary Start the two-factor authentication enrollment
+// @Description Generate a new TOTP secret. The two-factor authentication is enabled after the user confirms the first one-time code. Calling it again before the confirmation replaces the secret.
+// @ID create_totp
+// @Security authorization
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Success 200 {object} model.CreateTotpResponse "Successful operation"
+// @Failure 409 {object} model.CreateTotpFailure409
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/user/mfa/totp [post]
+func (a *rest) CreateTotp(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		accessTokenData, err := a.contextGetter.GetJwtData(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		serviceCreateTotpReturn, err := a.service.CreateTotp(r.Context(), logger, accessTokenData)
+		if err != nil {
+			logger.Error("failed to create the TOTP secret", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorMfaAlreadyEnabled:
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseBody, err := json.Marshal(model.CreateTotpResponse{
+			Secret: serviceCreateTotpReturn.Secret,
+			URI:    serviceCreateTotpReturn.URI,
+		})
+		if err != nil {
+			logger.DPanic("failed to marshal model.CreateTotpResponse", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+
+		return
+	})
+}
+
+// ConfirmTotp
+// @Summary Finish the two-factor authentication enrollment
+// @Description Confirm the TOTP secret with the first one-time code from the authenticator app. After that, the log in requires the second factor. The response contains the recovery codes, they are shown only once.
+// @ID confirm_totp
+// @Security authorization
+// @Accept application/json;charset=utf-8
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param model.ConfirmTotpRequest body model.ConfirmTotpRequest true "The one-time code"
+// @Success 200 {object} model.RecoveryCodesResponse "Successful operation"
+// @Failure 400 {object} model.ConfirmTotpFailure400
+// @Failure 403 {object} model.ConfirmTotpFailure403
+// @Failure 404 {object} model.ConfirmTotpFailure404
+// @Failure 409 {object} model.ConfirmTotpFailure409
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/user/mfa/totp [put]
+func (a *rest) ConfirmTotp(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.ConfirmTotpRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		accessTokenData, err := a.contextGetter.GetJwtData(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		recoveryCodes, err := a.service.ConfirmTotp(r.Context(), logger, model.ServiceConfirmTotpParam{
+			AccessTokenData: accessTokenData,
+			Code:            requestInput.Code})
+		if err != nil {
+			logger.Error("failed to confirm the TOTP secret", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadParams:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorBadMfaCode:
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			case authorization.ErrorMfaNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			case authorization.ErrorMfaAlreadyEnabled:
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		a.writeRecoveryCodes(logger, w, requestID, requestIDKey, recoveryCodes)
+		return
+	})
+}
+
+// RegenerateRecoveryCodes
+// @Summary Regenerate the recovery codes
+// @Description Generate a new set of the single-use recovery codes. The codes of the old set stop working, including the unused ones.
+// @ID regenerate_recovery_codes
+// @Security authorization
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Success 200 {object} model.RecoveryCodesResponse "Successful operation"
+// @Failure 404 {object} model.RegenerateRecoveryCodesFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/user/mfa/recovery-codes [post]
+func (a *rest) RegenerateRecoveryCodes(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		accessTokenData, err := a.contextGetter.GetJwtData(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		recoveryCodes, err := a.service.RegenerateRecoveryCodes(r.Context(), logger, accessTokenData)
+		if err != nil {
+			logger.Error("failed to regenerate the recovery codes", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorMfaNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		a.writeRecoveryCodes(logger, w, requestID, requestIDKey, recoveryCodes)
+		return
+	})
+}
+
+func (a *rest) writeRecoveryCodes(logger *zap.Logger, w http.ResponseWriter, requestID, requestIDKey string,
+	recoveryCodes []string) {
+
+	responseBody, err := json.Marshal(model.RecoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	})
+	if err != nil {
+		logger.DPanic("failed to marshal model.RecoveryCodesResponse", zap.Error(err), zap.String(requestIDKey, requestID))
+		http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	// The recovery codes are as sensitive as the passwords
+	w.Header().Set("cache-control", "no-store")
+	w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+	w.WriteHeader(http.StatusOK)
+	if code, err := w.Write(responseBody); err != nil {
+		logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+			zap.String(requestIDKey, requestID))
+	}
+}
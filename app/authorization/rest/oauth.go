@@ -0,0 +1,270 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	oauthTokenTypeBearer = "Bearer"
+	// The body of the token request is a few short params
+	oauthTokenRequestMaxBytes = 1 << 16
+)
+
+// Authorize
+// @Summary OAuth 2.0 authorization endpoint (Domain Action: Grant access to a third-party client)
+// @Description The consent page of the PWA forwards the query of the authorization request (RFC 6749, section 4.1.1) on behalf of the signed-in user. Only the code response type with PKCE S256 is supported. The user agent has to be redirected to the returned URI, it contains either the authorization code or the error.
+// @ID oauth_authorize
+// @Security authorization
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param response_type query string true "code"
+// @Param client_id query string true "The registered client ID"
+// @Param redirect_uri query string true "One of the registered redirect URIs"
+// @Param code_challenge query string true "BASE64URL(SHA256(code_verifier))"
+// @Param code_challenge_method query string true "S256"
+// @Param state query string false "An opaque value returned to the client"
+// @Param scope query string false "openid to get the ID token from the token endpoint"
+// @Param nonce query string false "The OpenID Connect nonce, it is copied to the ID token"
+// @Success 200 {object} model.AuthorizeResponse "Successful operation"
+// @Failure 400 {object} model.AuthorizeFailure400
+// @Failure 500 {object} model.CommonFailure
+// @Router /oauth/authorize [get]
+func (a *rest) Authorize(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		accessTokenData, err := a.contextGetter.GetJwtData(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+
+		redirectURI, err := a.service.Authorize(r.Context(), logger, model.ServiceAuthorizeParam{
+			AccessTokenData:     accessTokenData,
+			ResponseType:        query.Get("response_type"),
+			ClientID:            query.Get("client_id"),
+			RedirectURI:         query.Get("redirect_uri"),
+			CodeChallenge:       query.Get("code_challenge"),
+			CodeChallengeMethod: query.Get("code_challenge_method"),
+			State:               query.Get("state"),
+			Scope:               query.Get("scope"),
+			Nonce:               query.Get("nonce")})
+		if err != nil {
+			logger.Error("failed to authorize the client", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorInvalidClient:
+				http.Error(w, authorization.ErrorInvalidClient.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorInvalidRedirectURI:
+				http.Error(w, authorization.ErrorInvalidRedirectURI.Error(), http.StatusBadRequest)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseBody, err := json.Marshal(model.AuthorizeResponse{
+			RedirectURI: redirectURI,
+		})
+		if err != nil {
+			logger.DPanic("failed to marshal model.AuthorizeResponse", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+		return
+	})
+}
+
+// ExchangeToken
+// @Summary OAuth 2.0 token endpoint
+// @Description Exchange the authorization code (with the PKCE code verifier) or the refresh token for the tokens (RFC 6749, section 3.2). A confidential client authenticates with HTTP Basic or the client_secret param, a public client sends the client_id param only. A service account gets the access token with the client_credentials grant, there is no refresh token then. A device polls with the urn:ietf:params:oauth:grant-type:device_code grant until the user approves the user code (RFC 8628). A confidential client that calls another service on behalf of the user exchanges the access token of the user for a down-scoped token of the audience with the act claim (RFC 8693), the audience introspects it.
+// @ID oauth_token
+// @Accept application/x-www-form-urlencoded
+// @Produce application/json;charset=utf-8
+// @Param grant_type formData string true "authorization_code, refresh_token, client_credentials, urn:ietf:params:oauth:grant-type:device_code or urn:ietf:params:oauth:grant-type:token-exchange"
+// @Param client_id formData string false "The client ID, if HTTP Basic is not used"
+// @Param client_secret formData string false "The secret of a confidential client, if HTTP Basic is not used"
+// @Param code formData string false "The authorization code"
+// @Param redirect_uri formData string false "The redirect URI of the authorization request"
+// @Param code_verifier formData string false "The PKCE code verifier"
+// @Param refresh_token formData string false "The refresh token"
+// @Param device_code formData string false "The device code of the device authorization"
+// @Param scope formData string false "The space-separated scopes of the service account or of the exchanged token, all of them if empty"
+// @Param subject_token formData string false "The access token of the user to exchange"
+// @Param subject_token_type formData string false "urn:ietf:params:oauth:token-type:access_token"
+// @Param requested_token_type formData string false "urn:ietf:params:oauth:token-type:access_token"
+// @Param audience formData string false "The client ID of the service the exchanged token is issued for"
+// @Success 200 {object} model.TokenResponse "Successful operation"
+// @Failure 400 {object} model.TokenFailure
+// @Failure 401 {object} model.TokenFailure
+// @Failure 500 {object} model.CommonFailure
+// @Router /oauth/token [post]
+func (a *rest) ExchangeToken(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, oauthTokenRequestMaxBytes)
+		err = r.ParseForm()
+		if err != nil {
+			logger.Error("failed to parse the form", zap.Error(err), zap.String(requestIDKey, requestID))
+			a.oauthError(w, logger, requestID, requestIDKey, authorization.ErrorInvalidRequest, false)
+			return
+		}
+
+		clientID, clientSecret, basicAuth, err := oauthClientCredentials(r)
+		if err != nil {
+			logger.Error("failed to get the client credentials", zap.Error(err), zap.String(requestIDKey, requestID))
+			a.oauthError(w, logger, requestID, requestIDKey, err, basicAuth)
+			return
+		}
+
+		tokens, err := a.service.ExchangeToken(r.Context(), logger, model.ServiceExchangeTokenParam{
+			GrantType:          r.PostForm.Get("grant_type"),
+			ClientID:           clientID,
+			ClientSecret:       clientSecret,
+			Code:               r.PostForm.Get("code"),
+			RedirectURI:        r.PostForm.Get("redirect_uri"),
+			CodeVerifier:       r.PostForm.Get("code_verifier"),
+			RefreshToken:       r.PostForm.Get("refresh_token"),
+			DeviceCode:         r.PostForm.Get("device_code"),
+			Scope:              r.PostForm.Get("scope"),
+			SubjectToken:       r.PostForm.Get("subject_token"),
+			SubjectTokenType:   r.PostForm.Get("subject_token_type"),
+			RequestedTokenType: r.PostForm.Get("requested_token_type"),
+			Audience:           r.PostForm.Get("audience"),
+			UserAgent:          r.UserAgent()})
+		if err != nil {
+			logger.Error("failed to exchange the token", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorInvalidRequest, authorization.ErrorInvalidClient, authorization.ErrorInvalidGrant,
+				authorization.ErrorUnsupportedGrantType, authorization.ErrorInvalidScope,
+				authorization.ErrorAuthorizationPending, authorization.ErrorSlowDown, authorization.ErrorAccessDenied,
+				authorization.ErrorExpiredToken, authorization.ErrorInvalidTarget, authorization.ErrorUnauthorizedClient:
+				a.oauthError(w, logger, requestID, requestIDKey, err, basicAuth)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseBody, err := json.Marshal(model.TokenResponse{
+			AccessToken:     tokens.AccessJWT,
+			TokenType:       oauthTokenTypeBearer,
+			ExpiresIn:       tokens.ExpiresIn,
+			RefreshToken:    tokens.RefreshJWT,
+			IDToken:         tokens.IDToken,
+			Scope:           tokens.Scope,
+			IssuedTokenType: tokens.IssuedTokenType,
+		})
+		if err != nil {
+			logger.DPanic("failed to marshal model.TokenResponse", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+		return
+	})
+}
+
+// oauthClientCredentials returns the credentials of the client either from HTTP Basic or from the form,
+// the form must be parsed. The error is ErrorInvalidRequest or ErrorInvalidClient.
+func oauthClientCredentials(r *http.Request) (string, string, bool, error) {
+
+	clientID := r.PostForm.Get("client_id")
+	clientSecret := r.PostForm.Get("client_secret")
+
+	// The credentials of HTTP Basic are form-urlencoded (RFC 6749, section 2.3.1)
+
+	basicClientID, basicClientSecret, basicAuth := r.BasicAuth()
+	if !basicAuth {
+		return clientID, clientSecret, false, nil
+	}
+
+	if clientSecret != "" {
+		// The client has used more than one authentication method
+		return "", "", false, authorization.ErrorInvalidRequest
+	}
+	clientID, err := url.QueryUnescape(basicClientID)
+	if err == nil {
+		clientSecret, err = url.QueryUnescape(basicClientSecret)
+	}
+	if err != nil {
+		return "", "", true, authorization.ErrorInvalidClient
+	}
+
+	return clientID, clientSecret, true, nil
+}
+
+// oauthError writes the error response of the token endpoint (RFC 6749, section 5.2)
+func (a *rest) oauthError(w http.ResponseWriter, logger *zap.Logger, requestID string, requestIDKey string,
+	err error, basicAuth bool) {
+
+	status := http.StatusBadRequest
+	if err == authorization.ErrorInvalidClient {
+		status = http.StatusUnauthorized
+		if basicAuth {
+			w.Header().Set("WWW-Authenticate", "Basic")
+		}
+	}
+
+	responseBody, err := json.Marshal(model.TokenFailure{
+		Error: strings.ToLower(err.Error()),
+	})
+	if err != nil {
+		logger.DPanic("failed to marshal model.TokenFailure", zap.Error(err), zap.String(requestIDKey, requestID))
+		http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if code, err := w.Write(responseBody); err != nil {
+		logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+			zap.String(requestIDKey, requestID))
+	}
+}
@@ -0,0 +1,150 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// GetOpenIDConfiguration
+// @Summary OpenID Connect discovery
+// @Description The OpenID Provider Metadata (OpenID Connect Discovery 1.0, section 4)
+// @ID get_openid_configuration
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Success 200 {object} model.OpenIDConfiguration "Successful operation"
+// @Failure 500 {object} model.CommonFailure
+// @Router /.well-known/openid-configuration [get]
+func (a *rest) GetOpenIDConfiguration(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		responseBody, err := json.Marshal(a.service.GetOpenIDConfiguration())
+		if err != nil {
+			logger.DPanic("failed to marshal model.OpenIDConfiguration", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+		return
+	})
+}
+
+// GetJwks
+// @Summary The public keys of the ID tokens
+// @Description The JSON Web Key Set (RFC 7517, section 5), the relying parties verify the ID tokens with these keys
+// @ID get_jwks
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Success 200 {object} jose.JSONWebKeySet "Successful operation"
+// @Failure 500 {object} model.CommonFailure
+// @Router /.well-known/jwks.json [get]
+func (a *rest) GetJwks(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		responseBody, err := json.Marshal(a.service.GetJwks())
+		if err != nil {
+			logger.DPanic("failed to marshal jose.JSONWebKeySet", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+		return
+	})
+}
+
+// GetUserInfo
+// @Summary OpenID Connect UserInfo endpoint
+// @Description Get the claims about the user of the access token (OpenID Connect Core 1.0, section 5.3)
+// @ID get_user_info
+// @Security authorization
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Success 200 {object} model.UserInfo "Successful operation"
+// @Failure 401 {object} model.CommonFailure
+// @Failure 403 {object} model.UserStatusFailure403
+// @Failure 500 {object} model.CommonFailure
+// @Router /oauth/userinfo [get]
+func (a *rest) GetUserInfo(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		accessTokenData, err := a.contextGetter.GetJwtData(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		userInfo, err := a.service.GetUserInfo(r.Context(), logger, accessTokenData)
+		if err != nil {
+			logger.Error("failed to get the user info", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorUserNotFound:
+				http.Error(w, authorization.ErrorUserNotFound.Error(), http.StatusUnauthorized)
+				return
+			case authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseBody, err := json.Marshal(userInfo)
+		if err != nil {
+			logger.DPanic("failed to marshal model.UserInfo", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+		return
+	})
+}
@@ -0,0 +1,144 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/financelime-authorization/rbac"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// RequirePermission rejects the access token that has not been granted all the permissions of the route,
+// the downstream services use the same check of the rbac package
+func (a *rest) RequirePermission(logger *zap.Logger, permissions ...string) func(http.Handler) http.Handler {
+	return rbac.RequirePermission(logger, a.contextGetter, permissions...)
+}
+
+// GetListRoles
+// @Summary Get a list of the roles
+// @Description Get the roles with their permissions. The roles are created with the CLI.
+// @ID get_list_roles
+// @Security authorization
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Success 200 {object} []model.Role "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/roles [get]
+func (a *rest) GetListRoles(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		roles, err := a.service.GetListRoles(r.Context(), logger)
+		if err != nil {
+			logger.DPanic("failed to get the list of the roles", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		responseBody, err := json.Marshal(roles)
+		if err != nil {
+			logger.DPanic("failed to marshal the list of the roles", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+		return
+	})
+}
+
+// AssignUserRole
+// @Summary Assign the role to the user
+// @Description The access token of the user gets the role and its permissions on the next refresh. Be aware that this query is idempotent.
+// @ID assign_user_role
+// @Security authorization
+// @Param request-id header string true "RequestID"
+// @Param userID path int true "The ID of the user"
+// @Param role path string true "The name of the role"
+// @Success 204 "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.UserRoleFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/users/{userID}/roles/{role} [put]
+func (a *rest) AssignUserRole(logger *zap.Logger) http.Handler {
+	return a.handleUserRole(logger, a.service.AssignUserRole)
+}
+
+// RevokeUserRole
+// @Summary Revoke the role of the user
+// @Description The access tokens already issued keep the permissions of the role until they expire.
+// @ID revoke_user_role
+// @Security authorization
+// @Param request-id header string true "RequestID"
+// @Param userID path int true "The ID of the user"
+// @Param role path string true "The name of the role"
+// @Success 204 "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.UserRoleFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/users/{userID}/roles/{role} [delete]
+func (a *rest) RevokeUserRole(logger *zap.Logger) http.Handler {
+	return a.handleUserRole(logger, a.service.RevokeUserRole)
+}
+
+// handleUserRole reads the user and the role of the path for the assignment and the revocation
+func (a *rest) handleUserRole(logger *zap.Logger,
+	action func(ctx context.Context, logger *zap.Logger, param model.ServiceUserRoleParam) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		userID, err := strconv.ParseInt(vars["userID"], 10, 64)
+		if err != nil {
+			logger.Error("the userID is not valid", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, authorization.ErrorUserNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		err = action(r.Context(), logger, model.ServiceUserRoleParam{
+			UserID: userID,
+			Role:   vars["role"]})
+		if err != nil {
+			logger.Error("failed to change the roles of the user", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorUserNotFound, authorization.ErrorRoleNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
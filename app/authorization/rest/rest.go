@@ -31,7 +31,7 @@ func NewREST(
 
 // SignUpStep1
 // @Summary Create new user
-// @Description The service sends a confirmation link to the specified email. After confirmation, the service will send a password for authorization.
+// @Description The service sends a confirmation link to the specified email. After confirmation, the user chooses a password for authorization.
 // @ID signup_step1
 // @Accept application/json;charset=utf-8
 // @Param request-id header string true "RequestID"
@@ -99,7 +99,7 @@ func (a *rest) SignUpStep1(logger *zap.Logger) http.Handler {
 
 // SignUpStep2
 // @Summary Confirm User Email
-// @Description API returns HTML-page with a message (success or error).
+// @Description API returns HTML-page with a message (success or error). The message contains a link to choose the user password.
 // @ID signup_step2
 // @Produce text/plain;charset=utf-8
 // @Param rid query string true "RequestID"
@@ -146,6 +146,75 @@ func (a *rest) SignUpStep2(logger *zap.Logger) http.Handler {
 	})
 }
 
+// SignUpStep3
+// @Summary Complete the sign up with a password chosen by the user
+// @Description The confirmation key from the sign up email protects this step. After success, the service creates the user and sends a welcome email.
+// @ID signup_step3
+// @Accept application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param confirmationKey path string true "Confirmation Key"
+// @Param model.SetPasswordRequest body model.SetPasswordRequest true "The password chosen by the user"
+// @Success 204 "Successful operation"
+// @Failure 400 {object} model.SetPasswordFailure400
+// @Failure 404 {object} model.CommonFailure
+// @Failure 500 {object} model.CommonFailure
+// @Router /u/{confirmationKey} [post]
+func (a *rest) SignUpStep3(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.SetPasswordRequest
+
+		vars := mux.Vars(r)
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = a.service.SignUpStep3(r.Context(), logger, model.ServiceSetPasswordParam{
+			ConfirmationKey: vars["confirmationKey"],
+			Password:        requestInput.Password})
+		if err != nil {
+			logger.Error("failed to complete the sign up", zap.String(requestIDKey, requestID), zap.Error(err))
+			switch err {
+			case authorization.ErrorBadParamPassword:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorBadParamConfirmationKey, authorization.ErrorBadConfirmationKey:
+				http.Error(w, statusMessageNotFound, http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
+
 // CreateAccessToken
 // @Summary Create Access Token (Domain Action: Log In)
 // @Description Create Access Token
@@ -156,6 +225,8 @@ func (a *rest) SignUpStep2(logger *zap.Logger) http.Handler {
 // @Param model.CreateAccessTokenRequest body model.CreateAccessTokenRequest true "Data for creating a new token"
 // @Success 200 {object} model.AccessTokenResponse "Successful operation"
 // @Failure 400 {object} model.CreateAccessTokenFailure400
+// @Failure 401 {object} model.MfaRequiredResponse "The user has to pass the second factor, see /v1/oauth/mfa"
+// @Failure 403 {object} model.UserStatusFailure403
 // @Failure 404 {object} model.CreateAccessTokenFailure404
 // @Failure 500 {object} model.CommonFailure
 // @Router /v1/oauth/ [post]
@@ -195,31 +266,58 @@ func (a *rest) CreateAccessToken(logger *zap.Logger) http.Handler {
 
 		serviceAccessTokenReturn, err =
 			a.service.CreateAccessToken(r.Context(), logger, model.ServiceCreateAccessTokenParam{
-				Email:     requestInput.Email,
-				Password:  requestInput.Password,
-				ClientID:  requestInput.ClientID,
-				UserAgent: r.UserAgent(),
-				Device:    requestInput.Device})
+				Email:      requestInput.Email,
+				Password:   requestInput.Password,
+				ClientID:   requestInput.ClientID,
+				UserAgent:  r.UserAgent(),
+				Device:     requestInput.Device,
+				Scope:      requestInput.Scope,
+				RememberMe: requestInput.RememberMe})
 
 		if err != nil {
 			logger.Error("failed to create an access token", zap.String(requestIDKey, requestID), zap.Error(err))
 			switch err {
-			case authorization.ErrorBadParams:
+			case authorization.ErrorBadParams, authorization.ErrorInvalidScope, authorization.ErrorInvalidClient,
+				authorization.ErrorUnauthorizedClient:
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			case authorization.ErrorUserNotFound:
 				http.Error(w, authorization.ErrorUserNotFound.Error(), http.StatusNotFound)
 				return
+			case authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
 			default:
 				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
 				return
 			}
 		}
 
+		if serviceAccessTokenReturn.MfaChallengeToken != "" {
+			responseBody, err := json.Marshal(model.MfaRequiredResponse{
+				Message:        authorization.ErrorMfaRequired.Error(),
+				ChallengeToken: serviceAccessTokenReturn.MfaChallengeToken,
+				ExpiresIn:      serviceAccessTokenReturn.MfaChallengeExpiresIn,
+			})
+			if err != nil {
+				logger.DPanic("failed to marshal model.MfaRequiredResponse", zap.Error(err))
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+			w.WriteHeader(http.StatusUnauthorized)
+			if code, err := w.Write(responseBody); err != nil {
+				logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+					zap.String(requestIDKey, requestID))
+			}
+			return
+		}
+
 		responseBody, err := json.Marshal(model.AccessTokenResponse{
 			PublicSessionID: serviceAccessTokenReturn.PublicSessionID,
 			AccessJWT:       serviceAccessTokenReturn.AccessJWT,
 			RefreshJWT:      serviceAccessTokenReturn.RefreshJWT,
+			Scope:           serviceAccessTokenReturn.Scope,
 		})
 		if err != nil {
 			logger.DPanic("failed to marshal model.AccessTokenResponse", zap.Error(err))
@@ -249,6 +347,8 @@ func (a *rest) CreateAccessToken(logger *zap.Logger) http.Handler {
 // @Param model.RefreshAccessTokenRequest body model.RefreshAccessTokenRequest true "Data for refreshing the access token"
 // @Success 200 {object} model.AccessTokenResponse "Successful operation"
 // @Failure 400 {object} model.RefreshAccessTokenFailure400
+// @Failure 401 {object} model.RefreshAccessTokenFailure401
+// @Failure 403 {object} model.UserStatusFailure403
 // @Failure 404 {object} model.RefreshAccessTokenFailure404
 // @Failure 500 {object} model.CommonFailure
 // @Router /v1/oauth/ [put]
@@ -284,15 +384,26 @@ func (a *rest) RefreshAccessToken(logger *zap.Logger) http.Handler {
 			return
 		}
 
-		serviceAccessTokenReturn, err = a.service.RefreshAccessToken(r.Context(), logger, requestInput.RefreshToken)
+		serviceAccessTokenReturn, err = a.service.RefreshAccessToken(r.Context(), logger,
+			model.ServiceRefreshAccessTokenParam{
+				RefreshToken: requestInput.RefreshToken,
+				Scope:        requestInput.Scope})
 		if err != nil {
 			logger.Error("failed to refresh an access token", zap.Error(err), zap.String(requestIDKey, requestID))
 			switch err {
-			case authorization.ErrorBadRefreshToken:
-				http.Error(w, authorization.ErrorBadRefreshToken.Error(), http.StatusBadRequest)
+			case authorization.ErrorBadRefreshToken, authorization.ErrorInvalidScope, authorization.ErrorInvalidClient,
+				authorization.ErrorUnauthorizedClient:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorRefreshTokenReused:
+				http.Error(w, authorization.ErrorRefreshTokenReused.Error(), http.StatusUnauthorized)
+				return
 			case authorization.ErrorUserNotFound:
 				http.Error(w, authorization.ErrorUserNotFound.Error(), http.StatusNotFound)
 				return
+			case authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
 			default:
 				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
 				return
@@ -303,6 +414,7 @@ func (a *rest) RefreshAccessToken(logger *zap.Logger) http.Handler {
 			PublicSessionID: serviceAccessTokenReturn.PublicSessionID,
 			AccessJWT:       serviceAccessTokenReturn.AccessJWT,
 			RefreshJWT:      serviceAccessTokenReturn.RefreshJWT,
+			Scope:           serviceAccessTokenReturn.Scope,
 		})
 		if err != nil {
 			logger.DPanic("failed to marshal the access token", zap.Error(err), zap.String(requestIDKey, requestID))
@@ -452,9 +564,78 @@ func (a *rest) RevokeRefreshToken(logger *zap.Logger) http.Handler {
 	})
 }
 
+// RevokeAllSessions
+// @Summary Revoke all sessions (Domain Action: Sign out everywhere)
+// @Description This request revokes all the sessions of the user including the current one. The access tokens of the sessions are rejected at once.
+// @ID revoke_all_sessions
+// @Security authorization
+// @Param request-id header string true "RequestID"
+// @Success 204 "Successful operation"
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/sessions/ [delete]
+func (a *rest) RevokeAllSessions(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.revokeAllSessions(w, r, logger, false)
+	})
+}
+
+// RevokeOtherSessions
+// @Summary Revoke the other sessions (Domain Action: Sign out on the other devices)
+// @Description This request revokes all the sessions of the user except the current one.
+// @ID revoke_other_sessions
+// @Security authorization
+// @Param request-id header string true "RequestID"
+// @Success 204 "Successful operation"
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/sessions/others [delete]
+func (a *rest) RevokeOtherSessions(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.revokeAllSessions(w, r, logger, true)
+	})
+}
+
+func (a *rest) revokeAllSessions(w http.ResponseWriter, r *http.Request, logger *zap.Logger, keepCurrentSession bool) {
+
+	var exceptPublicSessionID string
+
+	requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	accessTokenData, err := a.contextGetter.GetJwtData(r.Context())
+	if err != nil {
+		logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+		http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	if keepCurrentSession {
+		exceptPublicSessionID, err = a.contextGetter.GetJwtID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get publicSessionID", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = a.service.RevokeAllSessions(r.Context(), logger, model.ServiceRevokeAllSessionsParam{
+		AccessTokenData:       accessTokenData,
+		ExceptPublicSessionID: exceptPublicSessionID})
+	if err != nil {
+		logger.DPanic("failed to revoke the sessions", zap.Error(err), zap.String(requestIDKey, requestID))
+		http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // ResetUserPasswordStep1
 // @Summary Request to user password reset
-// @Description The service sends a confirmation link to the specified email. After confirmation, the service will send a new password for authorization.
+// @Description The service sends a confirmation link to the specified email. After confirmation, the user chooses a new password for authorization.
 // @ID reset_user_password_step1
 // @Accept application/json;charset=utf-8
 // @Param request-id header string true "RequestID"
@@ -520,7 +701,7 @@ func (a *rest) ResetUserPasswordStep1(logger *zap.Logger) http.Handler {
 
 // ResetUserPasswordStep2
 // @Summary Confirm to user password reset
-// @Description API returns HTML-page with a message (success or error).
+// @Description API returns HTML-page with a message (success or error). The message contains a link to choose a new user password.
 // @ID reset_user_password_step2
 // @Produce text/plain;charset=utf-8
 // @Param rid query string true "RequestID"
@@ -566,3 +747,147 @@ func (a *rest) ResetUserPasswordStep2(logger *zap.Logger) http.Handler {
 		return
 	})
 }
+
+// ResetUserPasswordStep3
+// @Summary Complete the user password reset with a new password chosen by the user
+// @Description The confirmation key from the password reset email protects this step. After success, the service sends a notification email.
+// @ID reset_user_password_step3
+// @Accept application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param confirmationKey path string true "Confirmation Key"
+// @Param model.SetPasswordRequest body model.SetPasswordRequest true "The password chosen by the user"
+// @Success 204 "Successful operation"
+// @Failure 400 {object} model.SetPasswordFailure400
+// @Failure 404 {object} model.CommonFailure
+// @Failure 500 {object} model.CommonFailure
+// @Router /p/{confirmationKey} [post]
+func (a *rest) ResetUserPasswordStep3(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.SetPasswordRequest
+
+		vars := mux.Vars(r)
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = a.service.ResetUserPasswordStep3(r.Context(), logger, model.ServiceSetPasswordParam{
+			ConfirmationKey: vars["confirmationKey"],
+			Password:        requestInput.Password})
+		if err != nil {
+			logger.Error("failed to complete the user password reset", zap.String(requestIDKey, requestID), zap.Error(err))
+			switch err {
+			case authorization.ErrorBadParamPassword:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorBadParamConfirmationKey, authorization.ErrorBadConfirmationKey:
+				http.Error(w, statusMessageNotFound, http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
+
+// UpdateUserPassword
+// @Summary Change the user password
+// @Description The user changes the password by providing the current one. After success, the service sends a notification email.
+// @ID update_user_password
+// @Security authorization
+// @Accept application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param model.UpdateUserPasswordRequest body model.UpdateUserPasswordRequest true "The current and the new password"
+// @Success 204 "Successful operation"
+// @Failure 400 {object} model.UpdateUserPasswordFailure400
+// @Failure 403 {object} model.UpdateUserPasswordFailure403
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/user/password [put]
+func (a *rest) UpdateUserPassword(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.UpdateUserPasswordRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		accessTokenData, err := a.contextGetter.GetJwtData(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = a.service.UpdateUserPassword(r.Context(), logger, model.ServiceUpdateUserPasswordParam{
+			AccessTokenData: accessTokenData,
+			CurrentPassword: requestInput.CurrentPassword,
+			NewPassword:     requestInput.NewPassword})
+		if err != nil {
+			logger.Error("failed to update the user password", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadParamPassword:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorBadCurrentPassword:
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
@@ -8,12 +8,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
 	"github.com/dmalix/financelime-authorization/app/authorization/service"
 	"github.com/dmalix/middleware"
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -97,6 +103,43 @@ func TestAPISignUp2(t *testing.T) {
 	}
 }
 
+func TestAPISignUp3(t *testing.T) {
+
+	authService := new(service.Mock)
+
+	authService.Expected.Error = nil
+
+	props := map[string]interface{}{
+		"password": "qmhVXVC1%hVNa0Hcq",
+	}
+
+	bytesRepresentation, err := json.Marshal(props)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	request, err := http.NewRequest("", "", bytes.NewBuffer(bytesRepresentation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Add(headerKeyContentType, headerValueApplicationJson)
+
+	responseRecorder := httptest.NewRecorder()
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	authREST := NewREST(contextGetter, authService)
+	handler := authREST.SignUpStep3(logger)
+
+	handler.ServeHTTP(responseRecorder, request)
+
+	if status := responseRecorder.Code; status != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusNoContent)
+	}
+}
+
 func TestAPICreateAccessToken(t *testing.T) {
 
 	authService := new(service.Mock)
@@ -165,6 +208,25 @@ func TestAPIRefreshAccessToken(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v",
 			status, http.StatusOK)
 	}
+
+	// The refresh token has already been rotated
+
+	authService.Expected.Error = authorization.ErrorRefreshTokenReused
+
+	request, err = http.NewRequest("", "", bytes.NewBuffer(bytesRepresentation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Add(headerKeyContentType, headerValueApplicationJson)
+
+	responseRecorder = httptest.NewRecorder()
+
+	handler.ServeHTTP(responseRecorder, request)
+
+	if status := responseRecorder.Code; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusUnauthorized)
+	}
 }
 
 func TestAPIRevokeRefreshToken(t *testing.T) {
@@ -211,6 +273,641 @@ func TestAPIRevokeRefreshToken(t *testing.T) {
 	}
 }
 
+func TestAPIAccessTokenRevocation(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		expectedError  error
+		expectedStatus int
+	}{
+		{"valid token", nil, http.StatusNoContent},
+		{"revoked token", authorization.ErrorAccessTokenRevoked, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.expectedError
+
+		request, err := http.NewRequest("", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request = request.WithContext(context.WithValue(request.Context(), middleware.ContextKeyJwtID, "PublicSessionID"))
+
+		responseRecorder := httptest.NewRecorder()
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+		handler := authREST.AccessTokenRevocation(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+	}
+}
+
+func TestAPIRequireUserAccessToken(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		expectedError  error
+		expectedStatus int
+	}{
+		{"token of the user", nil, http.StatusNoContent},
+		{"delegated token", authorization.ErrorAccessTokenNotAccepted, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.expectedError
+
+		request, err := http.NewRequest("", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request = request.WithContext(context.WithValue(request.Context(), middleware.ContextKeyJwtData,
+			[]byte(`{"ID":2,"Audience":"finance-api","Act":{"sub":"reporting-api"}}`)))
+
+		responseRecorder := httptest.NewRecorder()
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+		handler := authREST.RequireUserAccessToken(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+	}
+}
+
+func TestAPIRequireScope(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		accessToken    string
+		expectedStatus int
+	}{
+		{"all the scopes are granted", `{"ID":2,"Scope":"read:reports write:reports"}`, http.StatusNoContent},
+		{"the scope is not granted", `{"ID":2,"Scope":"read:reports"}`, http.StatusForbidden},
+		{"the first-party session has the full access", `{"ID":2}`, http.StatusNoContent},
+		{"the service account without the scope", `{"ServiceAccount":"reporting-api"}`, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+
+		request, err := http.NewRequest("", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request = request.WithContext(context.WithValue(request.Context(), middleware.ContextKeyJwtData,
+			[]byte(test.accessToken)))
+
+		responseRecorder := httptest.NewRecorder()
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, new(service.Mock))
+		handler := authREST.RequireScope(logger, "read:reports", "write:reports")(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+		if test.expectedStatus == http.StatusForbidden && responseRecorder.Header().Get("WWW-Authenticate") !=
+			`Bearer error="insufficient_scope", scope="read:reports write:reports"` {
+			t.Errorf("%s: handler returned wrong WWW-Authenticate header: got %v",
+				test.name, responseRecorder.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestAPIRequirePermission(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		accessToken    string
+		expectedStatus int
+	}{
+		{"the permission is granted", `{"ID":2,"Roles":["admin"],"Permissions":["admin"]}`, http.StatusNoContent},
+		{"another permission", `{"ID":2,"Roles":["support"],"Permissions":["reports:write"]}`, http.StatusForbidden},
+		{"the user without the roles", `{"ID":2}`, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+
+		request, err := http.NewRequest("", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request = request.WithContext(context.WithValue(request.Context(), middleware.ContextKeyJwtData,
+			[]byte(test.accessToken)))
+
+		responseRecorder := httptest.NewRecorder()
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, new(service.Mock))
+		handler := authREST.RequirePermission(logger, model.PermissionAdmin)(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+		if test.expectedStatus == http.StatusForbidden &&
+			strings.TrimSpace(responseRecorder.Body.String()) != authorization.ErrorInsufficientPermission.Error() {
+			t.Errorf("%s: handler returned wrong body: got %v", test.name, responseRecorder.Body.String())
+		}
+	}
+}
+
+func TestAPIAdminAccess(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		accessToken    string
+		expectedStatus int
+	}{
+		{"the first-party session of the admin", `{"ID":2,"Roles":["admin"],"Permissions":["admin"]}`,
+			http.StatusNoContent},
+		{"the authorization code token of the admin", `{"ID":2,"Scope":"openid user"}`, http.StatusForbidden},
+		{"the admin scope of the user", `{"ID":3,"Scope":"openid admin"}`, http.StatusForbidden},
+		{"the admin scope of the admin", `{"ID":2,"Scope":"openid admin","Roles":["admin"],"Permissions":["admin"]}`,
+			http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+
+		request, err := http.NewRequest("", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request = request.WithContext(context.WithValue(request.Context(), middleware.ContextKeyJwtData,
+			[]byte(test.accessToken)))
+
+		responseRecorder := httptest.NewRecorder()
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		// The middlewares of the admin routes
+
+		authREST := NewREST(contextGetter, new(service.Mock))
+		handler := authREST.RequireScope(logger, model.ScopeAdmin)(
+			authREST.RequirePermission(logger, model.PermissionAdmin)(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusNoContent)
+				})))
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+	}
+}
+
+func TestAPIUserRole(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		userID         string
+		serviceError   error
+		expectedStatus int
+	}{
+		{"the role is assigned", "2", nil, http.StatusNoContent},
+		{"the role does not exist", "2", authorization.ErrorRoleNotFound, http.StatusNotFound},
+		{"the user does not exist", "3", authorization.ErrorUserNotFound, http.StatusNotFound},
+		{"the userID is out of range", "99999999999999999999", nil, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+
+		for _, handler := range []http.Handler{authREST.AssignUserRole(logger), authREST.RevokeUserRole(logger)} {
+
+			request, err := http.NewRequest("", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request = mux.SetURLVars(request, map[string]string{"userID": test.userID, "role": "admin"})
+
+			responseRecorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(responseRecorder, request)
+
+			if status := responseRecorder.Code; status != test.expectedStatus {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v",
+					test.name, status, test.expectedStatus)
+			}
+		}
+	}
+}
+
+func TestAPIAdminUser(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		userID         string
+		serviceError   error
+		expectedStatus int
+	}{
+		{"the user is managed", "2", nil, http.StatusNoContent},
+		{"the user does not exist", "3", authorization.ErrorUserNotFound, http.StatusNotFound},
+		{"the userID is out of range", "99999999999999999999", nil, http.StatusNotFound},
+		{"the service failed", "2", errors.New("failed"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+
+		for _, handler := range []http.Handler{authREST.DisableUser(logger), authREST.EnableUser(logger),
+			authREST.ForceUserPasswordReset(logger), authREST.DeleteUser(logger)} {
+
+			request, err := http.NewRequest("", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request = mux.SetURLVars(request, map[string]string{"userID": test.userID})
+
+			responseRecorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(responseRecorder, request)
+
+			if status := responseRecorder.Code; status != test.expectedStatus {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v",
+					test.name, status, test.expectedStatus)
+			}
+		}
+	}
+}
+
+func TestAPISearchUsers(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		query          string
+		serviceError   error
+		expectedStatus int
+	}{
+		{"the users are found", "?email=test&limit=10&offset=0", nil, http.StatusOK},
+		{"the limit is not a number", "?limit=ten", nil, http.StatusBadRequest},
+		{"the limit is not valid", "?limit=0", authorization.ErrorBadParams, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+
+		var users []model.UserRecord
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+
+		request, err := http.NewRequest(http.MethodGet, "/v1/admin/users"+test.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		responseRecorder := httptest.NewRecorder()
+
+		authREST.SearchUsers(logger).ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+			continue
+		}
+		if test.expectedStatus != http.StatusOK {
+			continue
+		}
+		if err = json.Unmarshal(responseRecorder.Body.Bytes(), &users); err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || users[0].Email != "test" {
+			t.Errorf("%s: handler returned wrong users: %+v", test.name, users)
+		}
+	}
+}
+
+func TestAPIResendSignUpConfirmation(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		body           string
+		serviceError   error
+		expectedStatus int
+	}{
+		{"the confirmation is sent", `{"email":"test.user@financelime.com"}`, nil, http.StatusNoContent},
+		{"the body is not valid", `email`, nil, http.StatusBadRequest},
+		{"the sign-up does not exist", `{"email":"test.user@financelime.com"}`, authorization.ErrorUserNotFound,
+			http.StatusNotFound},
+		{"the sign-up is confirmed", `{"email":"test.user@financelime.com"}`, authorization.ErrorUserAlreadyExist,
+			http.StatusConflict},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+
+		request, err := http.NewRequest(http.MethodPost, "/v1/admin/confirmations", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		responseRecorder := httptest.NewRecorder()
+
+		authREST.ResendSignUpConfirmation(logger).ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+	}
+}
+
+func TestAPIUserStatus(t *testing.T) {
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	// The user who is not active gets the error of the status instead of the tokens
+
+	for _, serviceError := range []error{authorization.ErrorUserSuspended, authorization.ErrorUserLocked,
+		authorization.ErrorUserBanned} {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = serviceError
+
+		authREST := NewREST(contextGetter, authService)
+
+		for _, handler := range []http.Handler{authREST.CreateAccessToken(logger), authREST.RefreshAccessToken(logger)} {
+
+			request, err := http.NewRequest("", "", strings.NewReader(`{}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			responseRecorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(responseRecorder, request)
+
+			if status := responseRecorder.Code; status != http.StatusForbidden {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v",
+					serviceError, status, http.StatusForbidden)
+			}
+			if body := strings.TrimSpace(responseRecorder.Body.String()); body != serviceError.Error() {
+				t.Errorf("handler returned wrong body: got %v want %v", body, serviceError.Error())
+			}
+		}
+	}
+
+	tests := []struct {
+		name           string
+		userID         string
+		body           string
+		serviceError   error
+		expectedStatus int
+	}{
+		{"the user is suspended", "2", `{"status":"suspended","reason":"chargeback","expiresAt":"2021-06-01T00:00:00Z"}`,
+			nil, http.StatusNoContent},
+		{"the status is unknown", "2", `{"status":"frozen"}`, authorization.ErrorBadParams, http.StatusBadRequest},
+		{"the body is not valid", "2", `status`, nil, http.StatusBadRequest},
+		{"the user does not exist", "3", `{"status":"banned"}`, authorization.ErrorUserNotFound, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+
+		authREST := NewREST(contextGetter, authService)
+
+		request, err := http.NewRequest(http.MethodPut, "", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request = mux.SetURLVars(request, map[string]string{"userID": test.userID})
+
+		responseRecorder := httptest.NewRecorder()
+
+		authREST.UpdateUserStatus(logger).ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+	}
+}
+
+func TestAPIOauthClient(t *testing.T) {
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	tests := []struct {
+		name           string
+		handler        func(*rest) http.Handler
+		body           string
+		serviceError   error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"list", func(a *rest) http.Handler { return a.GetListOauthClients(logger) }, ``,
+			nil, http.StatusOK, `"grantTypes":["password","refresh_token"]`},
+		{"create the public client", func(a *rest) http.Handler { return a.CreateOauthClient(logger) },
+			`{"clientID":"iOS_v1.0.0","name":"Financelime iOS","grantTypes":["password","refresh_token"]}`,
+			nil, http.StatusCreated, `{"clientID":"iOS_v1.0.0"}`},
+		{"create the confidential client", func(a *rest) http.Handler { return a.CreateOauthClient(logger) },
+			`{"clientID":"finance-api","name":"Finance API","grantTypes":["client_credentials"],"confidential":true}`,
+			nil, http.StatusCreated, `"clientSecret":"clientSecret"`},
+		{"create without the redirect URI", func(a *rest) http.Handler { return a.CreateOauthClient(logger) },
+			`{"name":"Reports","grantTypes":["authorization_code"]}`, authorization.ErrorInvalidRedirectURI,
+			http.StatusBadRequest, ``},
+		{"create an existing client", func(a *rest) http.Handler { return a.CreateOauthClient(logger) },
+			`{"clientID":"PWA_v0.0.1","name":"PWA","grantTypes":["password"]}`, authorization.ErrorOauthClientAlreadyExist,
+			http.StatusConflict, ``},
+		{"create with a body not valid", func(a *rest) http.Handler { return a.CreateOauthClient(logger) },
+			`clientID`, nil, http.StatusBadRequest, ``},
+		{"update", func(a *rest) http.Handler { return a.UpdateOauthClient(logger) },
+			`{"accessTokenLifetime":0}`, nil, http.StatusNoContent, ``},
+		{"update an unknown client", func(a *rest) http.Handler { return a.UpdateOauthClient(logger) },
+			`{"name":"PWA"}`, authorization.ErrorOauthClientNotFound, http.StatusNotFound, ``},
+		{"disable", func(a *rest) http.Handler { return a.DisableOauthClient(logger) }, ``,
+			nil, http.StatusNoContent, ``},
+		{"disable an unknown client", func(a *rest) http.Handler { return a.DisableOauthClient(logger) }, ``,
+			authorization.ErrorOauthClientNotFound, http.StatusNotFound, ``},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+
+		authREST := NewREST(contextGetter, authService)
+
+		request, err := http.NewRequest("", "", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request = mux.SetURLVars(request, map[string]string{"clientID": "PWA_v0.0.1"})
+
+		responseRecorder := httptest.NewRecorder()
+
+		test.handler(authREST).ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+		if body := responseRecorder.Body.String(); !strings.Contains(body, test.expectedBody) {
+			t.Errorf("%s: handler returned wrong body: got %v want %v", test.name, body, test.expectedBody)
+		}
+	}
+}
+
+func TestAPIServiceAccount(t *testing.T) {
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	tests := []struct {
+		name           string
+		handler        func(*rest) http.Handler
+		body           string
+		serviceError   error
+		expectedStatus int
+	}{
+		{"list", func(a *rest) http.Handler { return a.GetListServiceAccounts(logger) }, ``,
+			nil, http.StatusOK},
+		{"create", func(a *rest) http.Handler { return a.CreateServiceAccount(logger) },
+			`{"name":"Reports","scope":"read:users"}`, nil, http.StatusCreated},
+		{"create with a scope not allowed", func(a *rest) http.Handler { return a.CreateServiceAccount(logger) },
+			`{"scope":"admin"}`, authorization.ErrorInvalidScope, http.StatusBadRequest},
+		{"create an existing account", func(a *rest) http.Handler { return a.CreateServiceAccount(logger) },
+			`{"clientID":"reports-job"}`, authorization.ErrorServiceAccountAlreadyExist, http.StatusConflict},
+		{"create with a body not valid", func(a *rest) http.Handler { return a.CreateServiceAccount(logger) },
+			`clientID`, nil, http.StatusBadRequest},
+		{"rotate the secret", func(a *rest) http.Handler { return a.UpdateServiceAccount(logger) },
+			`{"rotateSecret":true}`, nil, http.StatusOK},
+		{"update an unknown account", func(a *rest) http.Handler { return a.UpdateServiceAccount(logger) },
+			`{"name":"Reports"}`, authorization.ErrorServiceAccountNotFound, http.StatusNotFound},
+		{"delete", func(a *rest) http.Handler { return a.DeleteServiceAccount(logger) }, ``,
+			nil, http.StatusNoContent},
+		{"delete an unknown account", func(a *rest) http.Handler { return a.DeleteServiceAccount(logger) }, ``,
+			authorization.ErrorServiceAccountNotFound, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+
+		authREST := NewREST(contextGetter, authService)
+
+		request, err := http.NewRequest("", "", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request = mux.SetURLVars(request, map[string]string{"clientID": "reports-job"})
+
+		responseRecorder := httptest.NewRecorder()
+
+		test.handler(authREST).ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+	}
+}
+
+func TestAPIRevokeAllSessions(t *testing.T) {
+
+	authService := new(service.Mock)
+
+	authService.Expected.Error = nil
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	authREST := NewREST(contextGetter, authService)
+
+	for _, handler := range []http.Handler{authREST.RevokeAllSessions(logger), authREST.RevokeOtherSessions(logger)} {
+
+		request, err := http.NewRequest("", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rctx := request.Context()
+		rctx = context.WithValue(rctx, middleware.ContextKeyJwtID, "PublicSessionID")
+		rctx = context.WithValue(rctx, middleware.ContextKeyJwtData, []byte("EncryptedJWTData"))
+
+		request = request.WithContext(rctx)
+
+		responseRecorder := httptest.NewRecorder()
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != http.StatusNoContent {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, http.StatusNoContent)
+		}
+	}
+}
+
 func TestAPIGetListActiveSessions(t *testing.T) {
 
 	authService := new(service.Mock)
@@ -277,3 +974,749 @@ func TestAPIResetUserPassword1(t *testing.T) {
 			status, http.StatusNoContent)
 	}
 }
+
+func TestAPIUpdateUserPassword(t *testing.T) {
+
+	tests := []struct {
+		serviceError error
+		want         int
+	}{
+		{nil, http.StatusNoContent},
+		{authorization.ErrorBadParamPassword, http.StatusBadRequest},
+		{authorization.ErrorBadCurrentPassword, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+
+		authService.Expected.Error = test.serviceError
+
+		props := map[string]interface{}{
+			"currentPassword": "qmhVXVC1%hVNa0Hcq",
+			"newPassword":     "Wg7%bZr0Lk2qNv5s",
+		}
+
+		bytesRepresentation, err := json.Marshal(props)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		request, err := http.NewRequest("", "", bytes.NewBuffer(bytesRepresentation))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Add(headerKeyContentType, headerValueApplicationJson)
+
+		responseRecorder := httptest.NewRecorder()
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+		handler := authREST.UpdateUserPassword(logger)
+
+		rctx := request.Context()
+		rctx = context.WithValue(rctx, middleware.ContextKeyJwtData, []byte("test_data"))
+
+		request = request.WithContext(rctx)
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.want {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, test.want)
+		}
+	}
+}
+
+func TestAPICreateAccessToken_MfaRequired(t *testing.T) {
+
+	var response model.MfaRequiredResponse
+
+	authService := new(service.Mock)
+
+	authService.Props.MfaChallengeToken = "challengeToken"
+	authService.Expected.Error = nil
+
+	bytesRepresentation, err := json.Marshal(map[string]interface{}{})
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	request, err := http.NewRequest("", "", bytes.NewBuffer(bytesRepresentation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Add(headerKeyContentType, headerValueApplicationJson)
+
+	responseRecorder := httptest.NewRecorder()
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	authREST := NewREST(contextGetter, authService)
+	handler := authREST.CreateAccessToken(logger)
+
+	handler.ServeHTTP(responseRecorder, request)
+
+	if status := responseRecorder.Code; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusUnauthorized)
+	}
+
+	err = json.Unmarshal(responseRecorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Message != authorization.ErrorMfaRequired.Error() || response.ChallengeToken != "challengeToken" {
+		t.Errorf("handler returned unexpected body: got %+v", response)
+	}
+}
+
+func TestAPIVerifyMfaChallenge(t *testing.T) {
+
+	tests := []struct {
+		serviceError error
+		want         int
+	}{
+		{nil, http.StatusOK},
+		{authorization.ErrorBadParams, http.StatusBadRequest},
+		{authorization.ErrorBadMfaCode, http.StatusForbidden},
+		{authorization.ErrorMfaChallengeNotFound, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+
+		authService.Expected.Error = test.serviceError
+
+		props := map[string]interface{}{
+			"challengeToken": "challengeToken",
+			"code":           "287082",
+		}
+
+		bytesRepresentation, err := json.Marshal(props)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		request, err := http.NewRequest("", "", bytes.NewBuffer(bytesRepresentation))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Add(headerKeyContentType, headerValueApplicationJson)
+
+		responseRecorder := httptest.NewRecorder()
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+		handler := authREST.VerifyMfaChallenge(logger)
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.want {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, test.want)
+		}
+	}
+}
+
+func TestAPIConfirmTotp(t *testing.T) {
+
+	tests := []struct {
+		serviceError error
+		want         int
+	}{
+		{nil, http.StatusOK},
+		{authorization.ErrorBadMfaCode, http.StatusForbidden},
+		{authorization.ErrorMfaNotFound, http.StatusNotFound},
+		{authorization.ErrorMfaAlreadyEnabled, http.StatusConflict},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+
+		authService.Expected.Error = test.serviceError
+
+		bytesRepresentation, err := json.Marshal(map[string]interface{}{"code": "287082"})
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		request, err := http.NewRequest("", "", bytes.NewBuffer(bytesRepresentation))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Add(headerKeyContentType, headerValueApplicationJson)
+
+		responseRecorder := httptest.NewRecorder()
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+		handler := authREST.ConfirmTotp(logger)
+
+		rctx := request.Context()
+		rctx = context.WithValue(rctx, middleware.ContextKeyJwtData, []byte("test_data"))
+
+		request = request.WithContext(rctx)
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.want {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, test.want)
+		}
+	}
+}
+
+func TestAPIRegenerateRecoveryCodes(t *testing.T) {
+
+	tests := []struct {
+		serviceError error
+		want         int
+	}{
+		{nil, http.StatusOK},
+		{authorization.ErrorMfaNotFound, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+
+		authService.Expected.Error = test.serviceError
+
+		request, err := http.NewRequest("", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		responseRecorder := httptest.NewRecorder()
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+		handler := authREST.RegenerateRecoveryCodes(logger)
+
+		rctx := request.Context()
+		rctx = context.WithValue(rctx, middleware.ContextKeyJwtData, []byte("test_data"))
+
+		request = request.WithContext(rctx)
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.want {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, test.want)
+		}
+	}
+}
+
+func TestAPIFinishWebauthnRegistration(t *testing.T) {
+
+	tests := []struct {
+		serviceError error
+		want         int
+	}{
+		{nil, http.StatusNoContent},
+		{authorization.ErrorBadWebauthnResponse, http.StatusBadRequest},
+		{authorization.ErrorWebauthnChallengeNotFound, http.StatusNotFound},
+		{authorization.ErrorWebauthnCredentialAlreadyExist, http.StatusConflict},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+
+		authService.Expected.Error = test.serviceError
+
+		bytesRepresentation, err := json.Marshal(map[string]interface{}{
+			"credential": map[string]interface{}{
+				"id":   "credentialID",
+				"type": "public-key",
+				"response": map[string]interface{}{
+					"clientDataJSON":    "clientDataJSON",
+					"attestationObject": "attestationObject",
+				},
+			},
+		})
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		request, err := http.NewRequest("", "", bytes.NewBuffer(bytesRepresentation))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Add(headerKeyContentType, headerValueApplicationJson)
+
+		responseRecorder := httptest.NewRecorder()
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+		handler := authREST.FinishWebauthnRegistration(logger)
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.want {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, test.want)
+		}
+	}
+}
+
+func TestAPIFinishWebauthnLogin(t *testing.T) {
+
+	tests := []struct {
+		serviceError error
+		want         int
+	}{
+		{nil, http.StatusOK},
+		{authorization.ErrorBadParams, http.StatusBadRequest},
+		{authorization.ErrorBadWebauthnResponse, http.StatusForbidden},
+		{authorization.ErrorWebauthnChallengeNotFound, http.StatusNotFound},
+		{authorization.ErrorWebauthnCredentialNotFound, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+
+		authService.Expected.Error = test.serviceError
+
+		bytesRepresentation, err := json.Marshal(map[string]interface{}{
+			"credential": map[string]interface{}{
+				"id":   "credentialID",
+				"type": "public-key",
+				"response": map[string]interface{}{
+					"clientDataJSON":    "clientDataJSON",
+					"authenticatorData": "authenticatorData",
+					"signature":         "signature",
+					"userHandle":        "AAAAAAAAAAE",
+				},
+			},
+			"clientID": "PWA_v0.0.1",
+		})
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		request, err := http.NewRequest("", "", bytes.NewBuffer(bytesRepresentation))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Add(headerKeyContentType, headerValueApplicationJson)
+
+		responseRecorder := httptest.NewRecorder()
+
+		logger, _ := zap.NewProduction()
+		contextGetter := new(middleware.MockDescription)
+
+		authREST := NewREST(contextGetter, authService)
+		handler := authREST.FinishWebauthnLogin(logger)
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.want {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, test.want)
+		}
+	}
+}
+
+func TestAPIAuthorize(t *testing.T) {
+
+	authService := new(service.Mock)
+
+	authService.Expected.Error = nil
+
+	request, err := http.NewRequest(http.MethodGet,
+		"/oauth/authorize?response_type=code&client_id=client&state=state&redirect_uri=https%3A%2F%2Fclient.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRecorder := httptest.NewRecorder()
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	authREST := NewREST(contextGetter, authService)
+	handler := authREST.Authorize(logger)
+
+	rctx := request.Context()
+	rctx = context.WithValue(rctx, middleware.ContextKeyJwtData, []byte("test_data"))
+
+	request = request.WithContext(rctx)
+
+	handler.ServeHTTP(responseRecorder, request)
+
+	if status := responseRecorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	var response model.AuthorizeResponse
+	err = json.Unmarshal(responseRecorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.RedirectURI != "https://client.com?code=code&state=state" {
+		t.Errorf("handler returned wrong the redirect URI: %s", response.RedirectURI)
+	}
+}
+
+func TestAPIExchangeToken(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		serviceError   error
+		basicAuth      bool
+		form           url.Values
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"success", nil, false,
+			url.Values{"grant_type": {"authorization_code"}, "client_id": {"client"}, "code": {"code"}},
+			http.StatusOK, `"access_token":"accessToken"`},
+		{"basic authentication", nil, true,
+			url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"refreshToken"}},
+			http.StatusOK, `"token_type":"Bearer"`},
+		{"two authentication methods", nil, true,
+			url.Values{"grant_type": {"refresh_token"}, "client_secret": {"secret"}},
+			http.StatusBadRequest, `{"error":"invalid_request"}`},
+		{"invalid grant", authorization.ErrorInvalidGrant, false,
+			url.Values{"grant_type": {"authorization_code"}, "client_id": {"client"}},
+			http.StatusBadRequest, `{"error":"invalid_grant"}`},
+		{"invalid client", authorization.ErrorInvalidClient, true,
+			url.Values{"grant_type": {"authorization_code"}},
+			http.StatusUnauthorized, `{"error":"invalid_client"}`},
+		{"invalid scope", authorization.ErrorInvalidScope, true,
+			url.Values{"grant_type": {"client_credentials"}, "scope": {"delete:users"}},
+			http.StatusBadRequest, `{"error":"invalid_scope"}`},
+		{"authorization pending", authorization.ErrorAuthorizationPending, false,
+			url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:device_code"}, "client_id": {"client"},
+				"device_code": {"deviceCode"}},
+			http.StatusBadRequest, `{"error":"authorization_pending"}`},
+		{"invalid target", authorization.ErrorInvalidTarget, true,
+			url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:token-exchange"}, "subject_token": {"accessToken"},
+				"subject_token_type": {"urn:ietf:params:oauth:token-type:access_token"}, "audience": {"unknown"}},
+			http.StatusBadRequest, `{"error":"invalid_target"}`},
+		{"slow down", authorization.ErrorSlowDown, false,
+			url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:device_code"}, "client_id": {"client"},
+				"device_code": {"deviceCode"}},
+			http.StatusBadRequest, `{"error":"slow_down"}`},
+	}
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+
+		request, err := http.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(test.form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set(headerKeyContentType, "application/x-www-form-urlencoded")
+		if test.basicAuth {
+			request.SetBasicAuth("client", "secret")
+		}
+
+		responseRecorder := httptest.NewRecorder()
+
+		authREST := NewREST(contextGetter, authService)
+		authREST.ExchangeToken(logger).ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+		if !strings.Contains(responseRecorder.Body.String(), test.expectedBody) {
+			t.Errorf("%s: handler returned wrong body: got %s want %s",
+				test.name, responseRecorder.Body.String(), test.expectedBody)
+		}
+		if responseRecorder.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: the response must not be cached", test.name)
+		}
+	}
+}
+
+func TestAPIOidc(t *testing.T) {
+
+	authService := new(service.Mock)
+
+	authService.Expected.Error = nil
+	authService.Props.Email = "user@domain.com"
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	authREST := NewREST(contextGetter, authService)
+
+	tests := []struct {
+		name         string
+		handler      http.Handler
+		expectedBody string
+	}{
+		{"discovery", authREST.GetOpenIDConfiguration(logger), `"issuer":"https://domain.com"`},
+		{"jwks", authREST.GetJwks(logger), `"kid":"keyID"`},
+		{"userinfo", authREST.GetUserInfo(logger), `{"sub":"2","email":"user@domain.com","email_verified":true}`},
+	}
+
+	for _, test := range tests {
+
+		request, err := http.NewRequest(http.MethodGet, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rctx := request.Context()
+		rctx = context.WithValue(rctx, middleware.ContextKeyJwtData, []byte("test_data"))
+
+		request = request.WithContext(rctx)
+
+		responseRecorder := httptest.NewRecorder()
+
+		test.handler.ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != http.StatusOK {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, http.StatusOK)
+		}
+		if !strings.Contains(responseRecorder.Body.String(), test.expectedBody) {
+			t.Errorf("%s: handler returned wrong body: got %s want %s",
+				test.name, responseRecorder.Body.String(), test.expectedBody)
+		}
+	}
+}
+
+func TestAPIIntrospectToken(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		serviceError   error
+		basicAuth      bool
+		form           url.Values
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"active token", nil, true,
+			url.Values{"token": {"accessToken"}, "token_type_hint": {"access_token"}},
+			http.StatusOK, `"active":true`},
+		{"inactive token", nil, false,
+			url.Values{"client_id": {"client"}, "client_secret": {"secret"}, "token": {"unknown"}},
+			http.StatusOK, `{"active":false}`},
+		{"two authentication methods", nil, true,
+			url.Values{"client_secret": {"secret"}, "token": {"accessToken"}},
+			http.StatusBadRequest, `{"error":"invalid_request"}`},
+		{"invalid client", authorization.ErrorInvalidClient, true,
+			url.Values{"token": {"accessToken"}},
+			http.StatusUnauthorized, `{"error":"invalid_client"}`},
+	}
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+
+		request, err := http.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(test.form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set(headerKeyContentType, "application/x-www-form-urlencoded")
+		if test.basicAuth {
+			request.SetBasicAuth("client", "secret")
+		}
+
+		responseRecorder := httptest.NewRecorder()
+
+		authREST := NewREST(contextGetter, authService)
+		authREST.IntrospectToken(logger).ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+		if !strings.Contains(responseRecorder.Body.String(), test.expectedBody) {
+			t.Errorf("%s: handler returned wrong body: got %s want %s",
+				test.name, responseRecorder.Body.String(), test.expectedBody)
+		}
+	}
+}
+
+func TestAPIRevokeToken(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		serviceError   error
+		basicAuth      bool
+		form           url.Values
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"success", nil, false,
+			url.Values{"client_id": {"client"}, "token": {"refreshToken"}, "token_type_hint": {"refresh_token"}},
+			http.StatusOK, ""},
+		{"token of another client", authorization.ErrorUnauthorizedClient, true,
+			url.Values{"token": {"refreshToken"}},
+			http.StatusBadRequest, `{"error":"unauthorized_client"}`},
+		{"invalid client", authorization.ErrorInvalidClient, true,
+			url.Values{"token": {"refreshToken"}},
+			http.StatusUnauthorized, `{"error":"invalid_client"}`},
+	}
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+
+		request, err := http.NewRequest(http.MethodPost, "/oauth/revoke", strings.NewReader(test.form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set(headerKeyContentType, "application/x-www-form-urlencoded")
+		if test.basicAuth {
+			request.SetBasicAuth("client", "secret")
+		}
+
+		responseRecorder := httptest.NewRecorder()
+
+		authREST := NewREST(contextGetter, authService)
+		authREST.RevokeToken(logger).ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+		if !strings.Contains(responseRecorder.Body.String(), test.expectedBody) {
+			t.Errorf("%s: handler returned wrong body: got %s want %s",
+				test.name, responseRecorder.Body.String(), test.expectedBody)
+		}
+	}
+}
+
+func TestAPIDeviceAuthorization(t *testing.T) {
+
+	logger, _ := zap.NewProduction()
+	contextGetter := new(middleware.MockDescription)
+
+	// The device authorization endpoint
+
+	createTests := []struct {
+		name           string
+		serviceError   error
+		form           url.Values
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"success", nil, url.Values{"client_id": {"client"}, "scope": {"openid"}},
+			http.StatusOK, `"user_code":"wdjb-mjht"`},
+		{"invalid client", authorization.ErrorInvalidClient, url.Values{"client_id": {"unknown"}},
+			http.StatusUnauthorized, `{"error":"invalid_client"}`},
+	}
+
+	for _, test := range createTests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+
+		request, err := http.NewRequest(http.MethodPost, "/oauth/device_authorization",
+			strings.NewReader(test.form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set(headerKeyContentType, "application/x-www-form-urlencoded")
+
+		responseRecorder := httptest.NewRecorder()
+
+		authREST := NewREST(contextGetter, authService)
+		authREST.CreateDeviceAuthorization(logger).ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+		if !strings.Contains(responseRecorder.Body.String(), test.expectedBody) {
+			t.Errorf("%s: handler returned wrong body: got %s want %s",
+				test.name, responseRecorder.Body.String(), test.expectedBody)
+		}
+		if responseRecorder.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: the response must not be cached", test.name)
+		}
+	}
+
+	// The verification page
+
+	tests := []struct {
+		name           string
+		serviceError   error
+		expectedStatus int
+	}{
+		{"success", nil, http.StatusOK},
+		{"user code not found", authorization.ErrorUserCodeNotFound, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+
+		authService := new(service.Mock)
+		authService.Expected.Error = test.serviceError
+		authREST := NewREST(contextGetter, authService)
+
+		request, err := http.NewRequest(http.MethodGet, "/oauth/device?user_code=wdjb-mjht", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request = request.WithContext(context.WithValue(request.Context(), middleware.ContextKeyJwtData,
+			[]byte("test_data")))
+
+		responseRecorder := httptest.NewRecorder()
+		authREST.GetDeviceAuthorization(logger).ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, test.expectedStatus)
+		}
+		if test.serviceError == nil && !strings.Contains(responseRecorder.Body.String(), `"clientName":"Client"`) {
+			t.Errorf("%s: handler returned wrong body: got %s", test.name, responseRecorder.Body.String())
+		}
+
+		request, err = http.NewRequest(http.MethodPut, "/oauth/device",
+			strings.NewReader(`{"userCode":"wdjb-mjht","approved":true}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Add(headerKeyContentType, headerValueApplicationJson)
+		request = request.WithContext(context.WithValue(request.Context(), middleware.ContextKeyJwtData,
+			[]byte("test_data")))
+
+		expectedStatus := test.expectedStatus
+		if expectedStatus == http.StatusOK {
+			expectedStatus = http.StatusNoContent
+		}
+
+		responseRecorder = httptest.NewRecorder()
+		authREST.ApproveDeviceAuthorization(logger).ServeHTTP(responseRecorder, request)
+
+		if status := responseRecorder.Code; status != expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				test.name, status, expectedStatus)
+		}
+	}
+}
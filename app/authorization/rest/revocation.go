@@ -0,0 +1,151 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// AccessTokenRevocation rejects the access tokens of the revoked sessions.
+// It follows the Authorization middleware, which has verified the token and put its JwtID to the context.
+func (a *rest) AccessTokenRevocation(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+			if err != nil {
+				logger.DPanic("failed to get requestID", zap.Error(err))
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+
+			publicSessionID, err := a.contextGetter.GetJwtID(r.Context())
+			if err != nil {
+				logger.DPanic("failed to get publicSessionID", zap.Error(err), zap.String(requestIDKey, requestID))
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+
+			err = a.service.CheckAccessTokenRevocation(r.Context(), logger, publicSessionID)
+			if err != nil {
+				switch err {
+				case authorization.ErrorAccessTokenRevoked:
+					http.Error(w, authorization.ErrorAccessTokenRevoked.Error(), http.StatusUnauthorized)
+					return
+				default:
+					logger.DPanic("failed to check the access token", zap.Error(err), zap.String(requestIDKey, requestID))
+					http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUserAccessToken rejects the access tokens that are not issued to the user for this API: the tokens of
+// the service accounts, the delegated tokens of the token exchange and the tokens of another audience.
+// It follows the Authorization middleware, which has verified the token and put its data to the context.
+func (a *rest) RequireUserAccessToken(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+			if err != nil {
+				logger.DPanic("failed to get requestID", zap.Error(err))
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+
+			accessTokenData, err := a.contextGetter.GetJwtData(r.Context())
+			if err != nil {
+				logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+
+			err = a.service.CheckUserAccessToken(r.Context(), logger, accessTokenData)
+			if err != nil {
+				switch err {
+				case authorization.ErrorAccessTokenNotAccepted:
+					http.Error(w, authorization.ErrorAccessTokenNotAccepted.Error(), http.StatusUnauthorized)
+					return
+				default:
+					logger.DPanic("failed to check the access token", zap.Error(err), zap.String(requestIDKey, requestID))
+					http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RevokeToken
+// @Summary OAuth 2.0 token revocation endpoint
+// @Description Revoke the session of the access or refresh token (RFC 7009), both tokens of the session become invalid. A confidential client authenticates with HTTP Basic or the client_secret param, a public client sends the client_id param only. The request is idempotent: the response is the same for an invalid token or a token of an already revoked session. The access tokens of the service accounts are not revoked, they expire.
+// @ID oauth_revoke
+// @Accept application/x-www-form-urlencoded
+// @Param client_id formData string false "The client ID, if HTTP Basic is not used"
+// @Param client_secret formData string false "The secret of a confidential client, if HTTP Basic is not used"
+// @Param token formData string true "The access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200 "Successful operation"
+// @Failure 400 {object} model.TokenFailure
+// @Failure 401 {object} model.TokenFailure
+// @Failure 500 {object} model.CommonFailure
+// @Router /oauth/revoke [post]
+func (a *rest) RevokeToken(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, oauthTokenRequestMaxBytes)
+		err = r.ParseForm()
+		if err != nil {
+			logger.Error("failed to parse the form", zap.Error(err), zap.String(requestIDKey, requestID))
+			a.oauthError(w, logger, requestID, requestIDKey, authorization.ErrorInvalidRequest, false)
+			return
+		}
+
+		clientID, clientSecret, basicAuth, err := oauthClientCredentials(r)
+		if err != nil {
+			logger.Error("failed to get the client credentials", zap.Error(err), zap.String(requestIDKey, requestID))
+			a.oauthError(w, logger, requestID, requestIDKey, err, basicAuth)
+			return
+		}
+
+		err = a.service.RevokeToken(r.Context(), logger, model.ServiceRevokeTokenParam{
+			ClientID:      clientID,
+			ClientSecret:  clientSecret,
+			Token:         r.PostForm.Get("token"),
+			TokenTypeHint: r.PostForm.Get("token_type_hint")})
+		if err != nil {
+			logger.Error("failed to revoke the token", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorInvalidRequest, authorization.ErrorInvalidClient, authorization.ErrorUnauthorizedClient,
+				authorization.ErrorUnsupportedTokenType:
+				a.oauthError(w, logger, requestID, requestIDKey, err, basicAuth)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		return
+	})
+}
@@ -6,6 +6,7 @@ package rest
 
 import (
 	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
 	"github.com/dmalix/middleware"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
@@ -21,6 +22,10 @@ func Router(logger *zap.Logger, router *mux.Router, routerV1 *mux.Router, handle
 	router.Handle("/u/{confirmationKey:[abcefghijkmnopqrtuvwxyz23479]{16}}",
 		handler.SignUpStep2(logger)).
 		Methods(http.MethodGet)
+	router.Handle("/u/{confirmationKey:[abcefghijkmnopqrtuvwxyz23479]{16}}",
+		handler.SignUpStep3(logger)).
+		Methods(http.MethodPost).
+		Headers(headerKeyContentType, headerValueApplicationJson)
 
 	routerV1.Handle("/oauth/",
 		handler.CreateAccessToken(logger)).
@@ -29,15 +34,86 @@ func Router(logger *zap.Logger, router *mux.Router, routerV1 *mux.Router, handle
 	routerV1.Handle("/oauth/", handler.RefreshAccessToken(logger)).
 		Methods(http.MethodPut).
 		Headers(headerKeyContentType, headerValueApplicationJson)
+	routerV1.Handle("/oauth/mfa",
+		handler.VerifyMfaChallenge(logger)).
+		Methods(http.MethodPost).
+		Headers(headerKeyContentType, headerValueApplicationJson)
+
+	router.Handle("/oauth/token",
+		handler.ExchangeToken(logger)).
+		Methods(http.MethodPost)
+	router.Handle("/oauth/introspect",
+		handler.IntrospectToken(logger)).
+		Methods(http.MethodPost)
+	router.Handle("/oauth/revoke",
+		handler.RevokeToken(logger)).
+		Methods(http.MethodPost)
+	// The device authorization endpoint goes before the verification page, the prefix /oauth/device matches it too
+	router.Handle("/oauth/device_authorization",
+		handler.CreateDeviceAuthorization(logger)).
+		Methods(http.MethodPost)
+	routerOauthDevice := router.PathPrefix("/oauth/device").Subrouter()
+	routerOauthDevice.Use(middleware.Authorization(logger.Named("middlewareAuthorization")))
+	routerOauthDevice.Use(handler.AccessTokenRevocation(logger.Named("middlewareAccessTokenRevocation")))
+	routerOauthDevice.Use(handler.RequireUserAccessToken(logger.Named("middlewareRequireUserAccessToken")))
+	routerOauthDevice.Use(handler.RequireScope(logger.Named("middlewareRequireScope"), model.ScopeUser))
+	routerOauthDevice.Handle("",
+		handler.GetDeviceAuthorization(logger)).
+		Methods(http.MethodGet)
+	routerOauthDevice.Handle("",
+		handler.ApproveDeviceAuthorization(logger)).
+		Methods(http.MethodPut).
+		Headers(headerKeyContentType, headerValueApplicationJson)
+	routerOauthAuthorize := router.PathPrefix("/oauth/authorize").Subrouter()
+	routerOauthAuthorize.Use(middleware.Authorization(logger.Named("middlewareAuthorization")))
+	routerOauthAuthorize.Use(handler.AccessTokenRevocation(logger.Named("middlewareAccessTokenRevocation")))
+	routerOauthAuthorize.Use(handler.RequireUserAccessToken(logger.Named("middlewareRequireUserAccessToken")))
+	routerOauthAuthorize.Use(handler.RequireScope(logger.Named("middlewareRequireScope"), model.ScopeUser))
+	routerOauthAuthorize.Handle("",
+		handler.Authorize(logger)).
+		Methods(http.MethodGet)
+
+	router.Handle("/.well-known/openid-configuration",
+		handler.GetOpenIDConfiguration(logger)).
+		Methods(http.MethodGet)
+	router.Handle("/.well-known/jwks.json",
+		handler.GetJwks(logger)).
+		Methods(http.MethodGet)
+	routerOauthUserInfo := router.PathPrefix("/oauth/userinfo").Subrouter()
+	routerOauthUserInfo.Use(middleware.Authorization(logger.Named("middlewareAuthorization")))
+	routerOauthUserInfo.Use(handler.AccessTokenRevocation(logger.Named("middlewareAccessTokenRevocation")))
+	routerOauthUserInfo.Handle("",
+		handler.GetUserInfo(logger)).
+		Methods(http.MethodGet, http.MethodPost)
+
+	routerV1.Handle("/oauth/webauthn",
+		handler.BeginWebauthnLogin(logger)).
+		Methods(http.MethodPost)
+	routerV1.Handle("/oauth/webauthn",
+		handler.FinishWebauthnLogin(logger)).
+		Methods(http.MethodPut).
+		Headers(headerKeyContentType, headerValueApplicationJson)
 
 	routerSessions := routerV1.PathPrefix("/sessions").Subrouter()
 	routerSessions.Use(middleware.Authorization(logger.Named("middlewareAuthorization")))
+	routerSessions.Use(handler.AccessTokenRevocation(logger.Named("middlewareAccessTokenRevocation")))
+	routerSessions.Use(handler.RequireUserAccessToken(logger.Named("middlewareRequireUserAccessToken")))
+	routerSessions.Use(handler.RequireScope(logger.Named("middlewareRequireScope"), model.ScopeUser))
 	routerSessions.Handle("/",
 		handler.GetListActiveSessions(logger)).
 		Methods(http.MethodGet)
+	routerSessions.Handle("/",
+		handler.RevokeAllSessions(logger)).
+		Methods(http.MethodDelete)
+	routerSessions.Handle("/others",
+		handler.RevokeOtherSessions(logger)).
+		Methods(http.MethodDelete)
 
 	routerSession := routerV1.PathPrefix("/session/").Subrouter()
 	routerSession.Use(middleware.Authorization(logger.Named("middlewareAuthorization")))
+	routerSession.Use(handler.AccessTokenRevocation(logger.Named("middlewareAccessTokenRevocation")))
+	routerSession.Use(handler.RequireUserAccessToken(logger.Named("middlewareRequireUserAccessToken")))
+	routerSession.Use(handler.RequireScope(logger.Named("middlewareRequireScope"), model.ScopeUser))
 	routerSession.Handle("",
 		handler.RevokeRefreshToken(logger)).
 		Methods(http.MethodDelete).
@@ -50,5 +126,116 @@ func Router(logger *zap.Logger, router *mux.Router, routerV1 *mux.Router, handle
 	router.Handle("/p/{confirmationKey:[abcefghijkmnopqrtuvwxyz23479]{16}}",
 		handler.ResetUserPasswordStep2(logger)).
 		Methods(http.MethodGet)
+	router.Handle("/p/{confirmationKey:[abcefghijkmnopqrtuvwxyz23479]{16}}",
+		handler.ResetUserPasswordStep3(logger)).
+		Methods(http.MethodPost).
+		Headers(headerKeyContentType, headerValueApplicationJson)
+
+	routerUserPassword := routerV1.PathPrefix("/user/password").Subrouter()
+	routerUserPassword.Use(middleware.Authorization(logger.Named("middlewareAuthorization")))
+	routerUserPassword.Use(handler.AccessTokenRevocation(logger.Named("middlewareAccessTokenRevocation")))
+	routerUserPassword.Use(handler.RequireUserAccessToken(logger.Named("middlewareRequireUserAccessToken")))
+	routerUserPassword.Use(handler.RequireScope(logger.Named("middlewareRequireScope"), model.ScopeUser))
+	routerUserPassword.Handle("",
+		handler.UpdateUserPassword(logger)).
+		Methods(http.MethodPut).
+		Headers(headerKeyContentType, headerValueApplicationJson)
+
+	routerUserMfa := routerV1.PathPrefix("/user/mfa").Subrouter()
+	routerUserMfa.Use(middleware.Authorization(logger.Named("middlewareAuthorization")))
+	routerUserMfa.Use(handler.AccessTokenRevocation(logger.Named("middlewareAccessTokenRevocation")))
+	routerUserMfa.Use(handler.RequireUserAccessToken(logger.Named("middlewareRequireUserAccessToken")))
+	routerUserMfa.Use(handler.RequireScope(logger.Named("middlewareRequireScope"), model.ScopeUser))
+	routerUserMfa.Handle("/totp",
+		handler.CreateTotp(logger)).
+		Methods(http.MethodPost)
+	routerUserMfa.Handle("/totp",
+		handler.ConfirmTotp(logger)).
+		Methods(http.MethodPut).
+		Headers(headerKeyContentType, headerValueApplicationJson)
+	routerUserMfa.Handle("/recovery-codes",
+		handler.RegenerateRecoveryCodes(logger)).
+		Methods(http.MethodPost)
+
+	routerUserWebauthn := routerV1.PathPrefix("/user/webauthn").Subrouter()
+	routerUserWebauthn.Use(middleware.Authorization(logger.Named("middlewareAuthorization")))
+	routerUserWebauthn.Use(handler.AccessTokenRevocation(logger.Named("middlewareAccessTokenRevocation")))
+	routerUserWebauthn.Use(handler.RequireUserAccessToken(logger.Named("middlewareRequireUserAccessToken")))
+	routerUserWebauthn.Use(handler.RequireScope(logger.Named("middlewareRequireScope"), model.ScopeUser))
+	routerUserWebauthn.Handle("",
+		handler.BeginWebauthnRegistration(logger)).
+		Methods(http.MethodPost)
+	routerUserWebauthn.Handle("",
+		handler.FinishWebauthnRegistration(logger)).
+		Methods(http.MethodPut).
+		Headers(headerKeyContentType, headerValueApplicationJson)
+
+	routerAdmin := routerV1.PathPrefix("/admin").Subrouter()
+	routerAdmin.Use(middleware.Authorization(logger.Named("middlewareAuthorization")))
+	routerAdmin.Use(handler.AccessTokenRevocation(logger.Named("middlewareAccessTokenRevocation")))
+	routerAdmin.Use(handler.RequireUserAccessToken(logger.Named("middlewareRequireUserAccessToken")))
+	routerAdmin.Use(handler.RequireScope(logger.Named("middlewareRequireScope"), model.ScopeAdmin))
+	routerAdmin.Use(handler.RequirePermission(logger.Named("middlewareRequirePermission"), model.PermissionAdmin))
+	routerAdmin.Handle("/roles",
+		handler.GetListRoles(logger)).
+		Methods(http.MethodGet)
+	routerAdmin.Handle("/users/{userID:[0-9]+}/roles/{role}",
+		handler.AssignUserRole(logger)).
+		Methods(http.MethodPut)
+	routerAdmin.Handle("/users/{userID:[0-9]+}/roles/{role}",
+		handler.RevokeUserRole(logger)).
+		Methods(http.MethodDelete)
+	routerAdmin.Handle("/users",
+		handler.SearchUsers(logger)).
+		Methods(http.MethodGet)
+	routerAdmin.Handle("/users/{userID:[0-9]+}",
+		handler.GetUserDetail(logger)).
+		Methods(http.MethodGet)
+	routerAdmin.Handle("/users/{userID:[0-9]+}",
+		handler.DeleteUser(logger)).
+		Methods(http.MethodDelete)
+	routerAdmin.Handle("/users/{userID:[0-9]+}/disable",
+		handler.DisableUser(logger)).
+		Methods(http.MethodPut)
+	routerAdmin.Handle("/users/{userID:[0-9]+}/enable",
+		handler.EnableUser(logger)).
+		Methods(http.MethodPut)
+	routerAdmin.Handle("/users/{userID:[0-9]+}/password-reset",
+		handler.ForceUserPasswordReset(logger)).
+		Methods(http.MethodPut)
+	routerAdmin.Handle("/confirmations",
+		handler.ResendSignUpConfirmation(logger)).
+		Methods(http.MethodPost)
+	routerAdmin.Handle("/users/{userID:[0-9]+}/status",
+		handler.UpdateUserStatus(logger)).
+		Methods(http.MethodPut)
+	routerAdmin.Handle("/clients",
+		handler.GetListOauthClients(logger)).
+		Methods(http.MethodGet)
+	routerAdmin.Handle("/clients",
+		handler.CreateOauthClient(logger)).
+		Methods(http.MethodPost).
+		Headers(headerKeyContentType, headerValueApplicationJson)
+	routerAdmin.Handle("/clients/{clientID:[A-Za-z0-9_.-]{1,32}}",
+		handler.UpdateOauthClient(logger)).
+		Methods(http.MethodPut).
+		Headers(headerKeyContentType, headerValueApplicationJson)
+	routerAdmin.Handle("/clients/{clientID:[A-Za-z0-9_.-]{1,32}}",
+		handler.DisableOauthClient(logger)).
+		Methods(http.MethodDelete)
+	routerAdmin.Handle("/service-accounts",
+		handler.GetListServiceAccounts(logger)).
+		Methods(http.MethodGet)
+	routerAdmin.Handle("/service-accounts",
+		handler.CreateServiceAccount(logger)).
+		Methods(http.MethodPost).
+		Headers(headerKeyContentType, headerValueApplicationJson)
+	routerAdmin.Handle("/service-accounts/{clientID:[A-Za-z0-9_.-]{1,32}}",
+		handler.UpdateServiceAccount(logger)).
+		Methods(http.MethodPut).
+		Headers(headerKeyContentType, headerValueApplicationJson)
+	routerAdmin.Handle("/service-accounts/{clientID:[A-Za-z0-9_.-]{1,32}}",
+		handler.DeleteServiceAccount(logger)).
+		Methods(http.MethodDelete)
 
 }
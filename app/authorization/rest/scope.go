@@ -0,0 +1,17 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"github.com/dmalix/financelime-authorization/scope"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// RequireScope rejects the access token that has not been granted all the scopes of the route,
+// the downstream services use the same check of the scope package
+func (a *rest) RequireScope(logger *zap.Logger, scopes ...string) func(http.Handler) http.Handler {
+	return scope.RequireScope(logger, a.contextGetter, scopes...)
+}
@@ -0,0 +1,242 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+)
+
+// GetListServiceAccounts
+// @Summary Get a list of the service accounts
+// @Description Get the service accounts of the client_credentials grant, the secrets are never returned.
+// @ID get_list_service_accounts
+// @Security authorization
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Success 200 {object} []model.ServiceAccount "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/service-accounts [get]
+func (a *rest) GetListServiceAccounts(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		accounts, err := a.service.GetListServiceAccounts(r.Context(), logger)
+		if err != nil {
+			logger.DPanic("failed to get the list of the service accounts", zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		if accounts == nil {
+			accounts = []model.ServiceAccount{}
+		}
+
+		a.writeAdminResponse(w, logger, requestIDKey, requestID, http.StatusOK, accounts)
+		return
+	})
+}
+
+// CreateServiceAccount
+// @Summary Create the service account
+// @Description Create the service account of the client_credentials grant. The client secret is returned once, only its hash is stored.
+// @ID create_service_account
+// @Security authorization
+// @Accept application/json;charset=utf-8
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param model.CreateServiceAccountRequest body model.CreateServiceAccountRequest true "Data for creating the service account"
+// @Success 201 {object} model.ClientCredentialsResponse "Successful operation"
+// @Failure 400 {object} model.ServiceAccountFailure400
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 409 {object} model.ServiceAccountFailure409
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/service-accounts [post]
+func (a *rest) CreateServiceAccount(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.CreateServiceAccountRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		credentials, err := a.service.CreateServiceAccount(r.Context(), logger, model.ServiceCreateServiceAccountParam{
+			ClientID: requestInput.ClientID,
+			Name:     requestInput.Name,
+			Scope:    requestInput.Scope})
+		if err != nil {
+			logger.Error("failed to create the service account", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadParams, authorization.ErrorInvalidScope:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorServiceAccountAlreadyExist:
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		a.writeAdminResponse(w, logger, requestIDKey, requestID, http.StatusCreated, model.ClientCredentialsResponse{
+			ClientID:     credentials.ClientID,
+			ClientSecret: credentials.ClientSecret})
+		return
+	})
+}
+
+// UpdateServiceAccount
+// @Summary Update the service account
+// @Description Change the name and the scope or rotate the secret. The new client secret is returned once if it has been rotated. The tokens already issued keep their scope until they expire.
+// @ID update_service_account
+// @Security authorization
+// @Accept application/json;charset=utf-8
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param clientID path string true "The client ID of the service account"
+// @Param model.UpdateServiceAccountRequest body model.UpdateServiceAccountRequest true "Data for updating the service account"
+// @Success 200 {object} model.ClientCredentialsResponse "Successful operation"
+// @Failure 400 {object} model.ServiceAccountFailure400
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.ServiceAccountFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/service-accounts/{clientID} [put]
+func (a *rest) UpdateServiceAccount(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.UpdateServiceAccountRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		credentials, err := a.service.UpdateServiceAccount(r.Context(), logger, model.ServiceUpdateServiceAccountParam{
+			ClientID:     mux.Vars(r)["clientID"],
+			Name:         requestInput.Name,
+			Scope:        requestInput.Scope,
+			RotateSecret: requestInput.RotateSecret})
+		if err != nil {
+			logger.Error("failed to update the service account", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadParams, authorization.ErrorInvalidScope:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorServiceAccountNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		a.writeAdminResponse(w, logger, requestIDKey, requestID, http.StatusOK, model.ClientCredentialsResponse{
+			ClientID:     credentials.ClientID,
+			ClientSecret: credentials.ClientSecret})
+		return
+	})
+}
+
+// DeleteServiceAccount
+// @Summary Delete the service account
+// @Description The issued access tokens are inactive for the introspection at once and expire on their own. The client ID is not reused.
+// @ID delete_service_account
+// @Security authorization
+// @Param request-id header string true "RequestID"
+// @Param clientID path string true "The client ID of the service account"
+// @Success 204 "Successful operation"
+// @Failure 403 {object} model.AdminFailure403
+// @Failure 404 {object} model.ServiceAccountFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/admin/service-accounts/{clientID} [delete]
+func (a *rest) DeleteServiceAccount(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = a.service.DeleteServiceAccount(r.Context(), logger, mux.Vars(r)["clientID"])
+		if err != nil {
+			logger.Error("failed to delete the service account", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorServiceAccountNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
@@ -0,0 +1,292 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rest
+
+import (
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+)
+
+// BeginWebauthnRegistration
+// @Summary Start the passkey registration
+// @Description Create the options of the WebAuthn registration ceremony. The client passes them to navigator.credentials.create() and sends the result to PUT /v1/user/webauthn within 5 minutes.
+// @ID begin_webauthn_registration
+// @Security authorization
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Success 200 {object} model.WebauthnCreationOptionsResponse "Successful operation"
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/user/webauthn [post]
+func (a *rest) BeginWebauthnRegistration(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		accessTokenData, err := a.contextGetter.GetJwtData(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		creationOptions, err := a.service.BeginWebauthnRegistration(r.Context(), logger, accessTokenData)
+		if err != nil {
+			logger.Error("failed to begin the registration", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		responseBody, err := json.Marshal(model.WebauthnCreationOptionsResponse{
+			PublicKey: creationOptions,
+		})
+		if err != nil {
+			logger.DPanic("failed to marshal model.WebauthnCreationOptionsResponse", zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+
+		return
+	})
+}
+
+// FinishWebauthnRegistration
+// @Summary Finish the passkey registration
+// @Description Verify the result of navigator.credentials.create() and save the passkey. After that, the user can log in with it at /v1/oauth/webauthn.
+// @ID finish_webauthn_registration
+// @Security authorization
+// @Accept application/json;charset=utf-8
+// @Produce text/plain;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param model.FinishWebauthnRegistrationRequest body model.FinishWebauthnRegistrationRequest true "The new credential"
+// @Success 204 "Successful operation"
+// @Failure 400 {object} model.FinishWebauthnRegistrationFailure400
+// @Failure 404 {object} model.FinishWebauthnRegistrationFailure404
+// @Failure 409 {object} model.FinishWebauthnRegistrationFailure409
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/user/webauthn [put]
+func (a *rest) FinishWebauthnRegistration(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.FinishWebauthnRegistrationRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		accessTokenData, err := a.contextGetter.GetJwtData(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		err = a.service.FinishWebauthnRegistration(r.Context(), logger, model.ServiceFinishWebauthnRegistrationParam{
+			AccessTokenData: accessTokenData,
+			Credential:      requestInput.Credential})
+		if err != nil {
+			logger.Error("failed to finish the registration", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadParams, authorization.ErrorBadWebauthnResponse:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorWebauthnChallengeNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			case authorization.ErrorWebauthnCredentialAlreadyExist:
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	})
+}
+
+// BeginWebauthnLogin
+// @Summary Start the log in with a passkey (Domain Action: Log In)
+// @Description Create the options of the WebAuthn assertion ceremony. The client passes them to navigator.credentials.get() and sends the result to PUT /v1/oauth/webauthn within 5 minutes.
+// @ID begin_webauthn_login
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Success 200 {object} model.WebauthnRequestOptionsResponse "Successful operation"
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/oauth/webauthn [post]
+func (a *rest) BeginWebauthnLogin(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestOptions, err := a.service.BeginWebauthnLogin(r.Context(), logger)
+		if err != nil {
+			logger.Error("failed to begin the log in", zap.Error(err), zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		responseBody, err := json.Marshal(model.WebauthnRequestOptionsResponse{
+			PublicKey: requestOptions,
+		})
+		if err != nil {
+			logger.DPanic("failed to marshal model.WebauthnRequestOptionsResponse", zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+
+		return
+	})
+}
+
+// FinishWebauthnLogin
+// @Summary Log in with a passkey (Domain Action: Log In)
+// @Description Verify the result of navigator.credentials.get() and issue the same tokens as /v1/oauth/. The second factor is not asked, the authenticator has already verified the user.
+// @ID finish_webauthn_login
+// @Accept application/json;charset=utf-8
+// @Produce application/json;charset=utf-8
+// @Param request-id header string true "RequestID"
+// @Param model.FinishWebauthnLoginRequest body model.FinishWebauthnLoginRequest true "The assertion and the client data"
+// @Success 200 {object} model.AccessTokenResponse "Successful operation"
+// @Failure 400 {object} model.FinishWebauthnLoginFailure400
+// @Failure 403 {object} model.FinishWebauthnLoginFailure403
+// @Failure 404 {object} model.FinishWebauthnLoginFailure404
+// @Failure 500 {object} model.CommonFailure
+// @Router /v1/oauth/webauthn [put]
+func (a *rest) FinishWebauthnLogin(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var requestInput model.FinishWebauthnLoginRequest
+
+		requestID, requestIDKey, err := a.contextGetter.GetRequestID(r.Context())
+		if err != nil {
+			logger.DPanic("failed to get requestID", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.DPanic("failed to read the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = r.Body.Close()
+		if err != nil {
+			logger.DPanic("failed to close a requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		err = json.Unmarshal(requestBody, &requestInput)
+		if err != nil {
+			logger.Error("failed to unmarshal the requestBody", zap.String(requestIDKey, requestID), zap.Error(err))
+			http.Error(w, authorization.ErrorBadParams.Error(), http.StatusBadRequest)
+			return
+		}
+
+		serviceAccessTokenReturn, err := a.service.FinishWebauthnLogin(r.Context(), logger, model.ServiceFinishWebauthnLoginParam{
+			Credential: requestInput.Credential,
+			ClientID:   requestInput.ClientID,
+			UserAgent:  r.UserAgent(),
+			Device:     requestInput.Device,
+			RememberMe: requestInput.RememberMe})
+		if err != nil {
+			logger.Error("failed to log in with the passkey", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadParams, authorization.ErrorInvalidClient, authorization.ErrorUnauthorizedClient:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case authorization.ErrorBadWebauthnResponse,
+				authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			case authorization.ErrorWebauthnChallengeNotFound, authorization.ErrorWebauthnCredentialNotFound,
+				authorization.ErrorUserNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseBody, err := json.Marshal(model.AccessTokenResponse{
+			PublicSessionID: serviceAccessTokenReturn.PublicSessionID,
+			AccessJWT:       serviceAccessTokenReturn.AccessJWT,
+			RefreshJWT:      serviceAccessTokenReturn.RefreshJWT,
+			Scope:           serviceAccessTokenReturn.Scope,
+		})
+		if err != nil {
+			logger.DPanic("failed to marshal model.AccessTokenResponse", zap.Error(err))
+			http.Error(w, statusMessageInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerKeyContentType, headerValueApplicationJson)
+		w.WriteHeader(http.StatusOK)
+		if code, err := w.Write(responseBody); err != nil {
+			logger.DPanic("failed response", zap.Int("code", code), zap.Error(err),
+				zap.String(requestIDKey, requestID))
+			return
+		}
+
+		return
+	})
+}
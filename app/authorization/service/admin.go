@@ -0,0 +1,286 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/utils/generate"
+	"go.uber.org/zap"
+)
+
+func (s *service) SearchUsers(ctx context.Context, logger *zap.Logger, param model.ServiceSearchUsersParam) ([]model.UserRecord, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	users, err := s.repository.GetListUsers(ctx, logger, model.RepoGetListUsersParam{
+		Email:  param.Email,
+		Limit:  param.Limit,
+		Offset: param.Offset})
+	if err != nil {
+		logger.Error("failed to search the users", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetUserDetail collects the sessions, the invite codes, the MFA status and the roles of the user
+func (s *service) GetUserDetail(ctx context.Context, logger *zap.Logger, userID int64) (model.UserDetail, error) {
+
+	var detail model.UserDetail
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.UserDetail{}, err
+	}
+
+	detail.User, err = s.repository.GetUserRecord(ctx, logger, userID)
+	if err != nil {
+		logger.Error("failed to get the user", zap.Error(err), zap.Int64("userID", userID),
+			zap.String(requestIDKey, requestID))
+		return model.UserDetail{}, err
+	}
+
+	access, err := s.repository.GetUserAccess(ctx, logger, userID)
+	if err != nil {
+		logger.DPanic("failed to get the roles of the user", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.UserDetail{}, err
+	}
+	detail.Roles = access.Roles
+
+	totp, err := s.repository.GetTotp(ctx, logger, userID)
+	switch err {
+	case nil:
+		detail.Mfa.Totp = totp.ConfirmedAt != nil
+	case authorization.ErrorMfaNotFound:
+	default:
+		logger.DPanic("failed to get the TOTP of the user", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.UserDetail{}, err
+	}
+
+	credentials, err := s.repository.GetListWebauthnCredentials(ctx, logger, userID)
+	if err != nil {
+		logger.DPanic("failed to get the WebAuthn credentials of the user", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return model.UserDetail{}, err
+	}
+	detail.Mfa.WebauthnCredentials = len(credentials)
+
+	detail.Sessions, err = s.repository.GetListActiveSessions(ctx, logger, userID)
+	if err != nil {
+		logger.DPanic("failed to get the sessions of the user", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.UserDetail{}, err
+	}
+
+	detail.InviteCodes, err = s.repository.GetListInviteCodes(ctx, logger, userID)
+	if err != nil {
+		logger.DPanic("failed to get the invite codes of the user", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.UserDetail{}, err
+	}
+
+	return detail, nil
+}
+
+// DisableUser revokes the sessions of the user deleted with the disabling, it's idempotent
+func (s *service) DisableUser(ctx context.Context, logger *zap.Logger, userID int64) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	user, err := s.repository.GetUserRecord(ctx, logger, userID)
+	if err != nil {
+		logger.Error("failed to get the user", zap.Error(err), zap.Int64("userID", userID),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+	if user.Status == model.UserStatusBanned ||
+		(user.Status == model.UserStatusLocked && user.StatusExpiresAt == nil) {
+		return nil
+	}
+
+	publicSessionIDs, err := s.repository.DisableUser(ctx, logger, userID)
+	if err != nil {
+		logger.Error("failed to disable the user", zap.Error(err), zap.Int64("userID", userID),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = s.revokeAccessTokens(ctx, logger, publicSessionIDs)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("the user has been disabled", zap.Int64("userID", userID),
+		zap.Int("revokedSessions", len(publicSessionIDs)), zap.String(requestIDKey, requestID))
+
+	return nil
+}
+
+func (s *service) EnableUser(ctx context.Context, logger *zap.Logger, userID int64) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	err = s.repository.EnableUser(ctx, logger, userID)
+	if err != nil {
+		logger.Error("failed to enable the user", zap.Error(err), zap.Int64("userID", userID),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	logger.Info("the user has been enabled", zap.Int64("userID", userID), zap.String(requestIDKey, requestID))
+
+	return nil
+}
+
+// ForceUserPasswordReset replaces the password with a random one nobody knows, revokes the sessions
+// and sends the reset link, so the user has to choose a new password to sign in again
+func (s *service) ForceUserPasswordReset(ctx context.Context, logger *zap.Logger, userID int64) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	user, err := s.repository.ExpireUserPassword(ctx, logger, model.RepoExpireUserPasswordParam{
+		UserID:   userID,
+		Password: generate.StringRand(64, 64, false)})
+	if err != nil {
+		logger.Error("failed to expire the password", zap.Error(err), zap.Int64("userID", userID),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	_, err = s.deleteUserSessions(ctx, logger, userID, "")
+	if err != nil {
+		logger.DPanic("failed to revoke the sessions", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = s.ResetUserPasswordStep1(ctx, logger, user.Email)
+	if err != nil {
+		logger.Error("failed to request a reset of the user's password", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	logger.Info("the password reset has been forced", zap.Int64("userID", userID),
+		zap.String(requestIDKey, requestID))
+
+	return nil
+}
+
+// ResendSignUpConfirmation sends the new confirmation link to the user whose sign-up has not been confirmed yet
+func (s *service) ResendSignUpConfirmation(ctx context.Context, logger *zap.Logger, email string) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	confirmationKey := generate.StringRand(16, 16, true)
+
+	user, err := s.repository.RenewSignUpConfirmation(ctx, logger, model.RepoRenewSignUpConfirmationParam{
+		Email:           email,
+		ConfirmationKey: confirmationKey})
+	if err != nil {
+		logger.Error("failed to renew the sign-up confirmation", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorBadParamEmail, authorization.ErrorBadParamConfirmationKey:
+			return authorization.ErrorBadParams
+		default:
+			return err
+		}
+	}
+
+	return s.sendSignUpConfirmation(ctx, logger, user, confirmationKey)
+}
+
+// DeleteUser soft-deletes the user and revokes the sessions
+func (s *service) DeleteUser(ctx context.Context, logger *zap.Logger, userID int64) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	_, err = s.repository.GetUserRecord(ctx, logger, userID)
+	if err != nil {
+		logger.Error("failed to get the user", zap.Error(err), zap.Int64("userID", userID),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	_, err = s.deleteUserSessions(ctx, logger, userID, "")
+	if err != nil {
+		logger.DPanic("failed to revoke the sessions", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = s.repository.DeleteUser(ctx, logger, userID)
+	if err != nil {
+		logger.Error("failed to delete the user", zap.Error(err), zap.Int64("userID", userID),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	logger.Info("the user has been deleted", zap.Int64("userID", userID), zap.String(requestIDKey, requestID))
+
+	return nil
+}
+
+// UpdateUserStatus revokes the sessions of the user who is not active anymore, the user is active again
+// once the status has expired
+func (s *service) UpdateUserStatus(ctx context.Context, logger *zap.Logger, param model.ServiceUpdateUserStatusParam) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	publicSessionIDs, err := s.repository.UpdateUserStatus(ctx, logger, model.RepoUpdateUserStatusParam{
+		UserID:    param.UserID,
+		Status:    param.Status,
+		Reason:    param.Reason,
+		ExpiresAt: param.ExpiresAt})
+	if err != nil {
+		logger.Error("failed to update the status of the user", zap.Error(err), zap.Int64("userID", param.UserID),
+			zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorBadParamStatus:
+			return authorization.ErrorBadParams
+		default:
+			return err
+		}
+	}
+
+	err = s.revokeAccessTokens(ctx, logger, publicSessionIDs)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("the status of the user has been updated", zap.Int64("userID", param.UserID),
+		zap.String("status", param.Status), zap.Int("revokedSessions", len(publicSessionIDs)),
+		zap.String(requestIDKey, requestID))
+
+	return nil
+}
@@ -0,0 +1,182 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/utils/generate"
+	"go.uber.org/zap"
+)
+
+// getClientForGrant returns the registered client that may use the grant type. The unknown and the disabled clients
+// are the invalid client, the repository doesn't return the disabled ones.
+func (s *service) getClientForGrant(ctx context.Context, logger *zap.Logger, clientID string,
+	grantType string) (model.OauthClient, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.OauthClient{}, err
+	}
+
+	client, err := s.repository.GetOauthClient(ctx, logger, clientID)
+	if err != nil {
+		logger.Error("failed to get the client", zap.Error(err), zap.String("clientID", clientID),
+			zap.String(requestIDKey, requestID))
+		return model.OauthClient{}, err
+	}
+
+	err = s.checkClientGrant(ctx, logger, client, grantType)
+	if err != nil {
+		return model.OauthClient{}, err
+	}
+
+	return client, nil
+}
+
+// checkClientGrant rejects the grant type that is not registered for the client (RFC 6749, section 5.2)
+func (s *service) checkClientGrant(ctx context.Context, logger *zap.Logger, client model.OauthClient,
+	grantType string) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	for _, value := range client.GrantTypes {
+		if value == grantType {
+			return nil
+		}
+	}
+
+	logger.Error("the grant type is not registered for the client", zap.String("clientID", client.ClientID),
+		zap.String("grantType", grantType), zap.String(requestIDKey, requestID))
+
+	return authorization.ErrorUnauthorizedClient
+}
+
+func (s *service) GetListOauthClients(ctx context.Context, logger *zap.Logger) ([]model.OauthClient, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	clients, err := s.repository.GetListOauthClients(ctx, logger)
+	if err != nil {
+		logger.Error("failed to get the list of the clients", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// CreateOauthClient registers the client, the secret of the confidential client is returned once
+func (s *service) CreateOauthClient(ctx context.Context, logger *zap.Logger,
+	param model.ServiceCreateOauthClientParam) (model.ServiceClientCredentialsReturn, error) {
+
+	var clientSecret string
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceClientCredentialsReturn{}, err
+	}
+
+	if param.ClientID == "" {
+		param.ClientID = generate.StringRand(16, 16, true)
+	}
+
+	if param.Confidential {
+		clientSecret, err = newClientSecret()
+		if err != nil {
+			logger.DPanic("failed to generate the client secret", zap.Error(err), zap.String(requestIDKey, requestID))
+			return model.ServiceClientCredentialsReturn{}, err
+		}
+	}
+
+	err = s.repository.CreateOauthClient(ctx, logger, model.RepoCreateOauthClientParam{
+		ClientID:             param.ClientID,
+		Name:                 param.Name,
+		ClientSecret:         clientSecret,
+		RedirectURIs:         param.RedirectURIs,
+		Scope:                param.Scope,
+		Audience:             param.Audience,
+		GrantTypes:           param.GrantTypes,
+		AccessTokenLifetime:  param.AccessTokenLifetime,
+		RefreshTokenLifetime: param.RefreshTokenLifetime})
+	if err != nil {
+		logger.Error("failed to create the client", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceClientCredentialsReturn{}, err
+	}
+
+	logger.Info("the client has been created", zap.String("clientID", param.ClientID),
+		zap.Strings("grantTypes", param.GrantTypes), zap.String(requestIDKey, requestID))
+
+	return model.ServiceClientCredentialsReturn{
+		ClientID:     param.ClientID,
+		ClientSecret: clientSecret}, nil
+}
+
+// UpdateOauthClient changes the registration, the tokens already issued keep their scope and lifetime until they expire
+func (s *service) UpdateOauthClient(ctx context.Context, logger *zap.Logger, param model.ServiceUpdateOauthClientParam) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	if param.Name == "" && len(param.GrantTypes) == 0 && len(param.RedirectURIs) == 0 && param.Scope == "" &&
+		param.Audience == "" && param.AccessTokenLifetime == nil && param.RefreshTokenLifetime == nil {
+		logger.Error("nothing to update", zap.String("clientID", param.ClientID), zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+
+	err = s.repository.UpdateOauthClient(ctx, logger, model.RepoUpdateOauthClientParam{
+		ClientID:             param.ClientID,
+		Name:                 param.Name,
+		RedirectURIs:         param.RedirectURIs,
+		Scope:                param.Scope,
+		Audience:             param.Audience,
+		GrantTypes:           param.GrantTypes,
+		AccessTokenLifetime:  param.AccessTokenLifetime,
+		RefreshTokenLifetime: param.RefreshTokenLifetime})
+	if err != nil {
+		logger.Error("failed to update the client", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	logger.Info("the client has been updated", zap.String("clientID", param.ClientID),
+		zap.String(requestIDKey, requestID))
+
+	return nil
+}
+
+// DisableOauthClient closes the sessions of the client and rejects it as an unknown one, the issued access tokens
+// expire on their own
+func (s *service) DisableOauthClient(ctx context.Context, logger *zap.Logger, clientID string) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	err = s.repository.DisableOauthClient(ctx, logger, clientID)
+	if err != nil {
+		logger.Error("failed to disable the client", zap.Error(err), zap.String("clientID", clientID),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	logger.Info("the client has been disabled", zap.String("clientID", clientID), zap.String(requestIDKey, requestID))
+
+	return nil
+}
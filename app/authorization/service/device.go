@@ -0,0 +1,328 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	oauthGrantTypeDeviceCode = model.OauthGrantTypeDeviceCode
+	deviceCodeByteLength     = 32
+	deviceCodeLifetime       = 600 // seconds
+	devicePollingInterval    = 5   // seconds, the default of RFC 8628, section 3.2
+	deviceSlowDownIncrement  = 5   // seconds added to the interval on every slow_down, RFC 8628, section 3.5
+	// The user code is typed by the user, so it's short and uses the unambiguous alphabet of the confirmation keys.
+	// 28^8 codes are enough for the pending requests of 10 minutes, the brute force is stopped by the rate limit.
+	deviceUserCodeAlphabet = "abcefghijkmnopqrtuvwxyz23479"
+	deviceUserCodeLength   = 8
+	// The attempts to generate a user code that is not used by another pending request
+	deviceUserCodeAttempts = 3
+)
+
+var deviceUserCodeRegexp = regexp.MustCompile(`^[abcefghijkmnopqrtuvwxyz23479]{8}$`)
+
+// CreateDeviceAuthorization is the device authorization endpoint (RFC 8628, section 3.1). The device shows
+// the user code and the verification URI, then polls the token endpoint with the device code.
+func (s *service) CreateDeviceAuthorization(ctx context.Context, logger *zap.Logger,
+	param model.ServiceDeviceAuthorizationParam) (model.ServiceDeviceAuthorizationReturn, error) {
+
+	var userCode string
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceDeviceAuthorizationReturn{}, err
+	}
+
+	if param.ClientID == "" {
+		logger.Error("the client is not specified", zap.String(requestIDKey, requestID))
+		return model.ServiceDeviceAuthorizationReturn{}, authorization.ErrorInvalidClient
+	}
+
+	client, err := s.repository.AuthenticateOauthClient(ctx, logger, model.RepoAuthenticateOauthClientParam{
+		ClientID:     param.ClientID,
+		ClientSecret: param.ClientSecret})
+	if err != nil {
+		logger.Error("failed to authenticate the client", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorInvalidClient:
+			return model.ServiceDeviceAuthorizationReturn{}, err
+		default:
+			return model.ServiceDeviceAuthorizationReturn{}, err
+		}
+	}
+
+	err = s.checkClientGrant(ctx, logger, client, oauthGrantTypeDeviceCode)
+	if err != nil {
+		return model.ServiceDeviceAuthorizationReturn{}, err
+	}
+
+	deviceCodeBytes := make([]byte, deviceCodeByteLength)
+	_, err = rand.Read(deviceCodeBytes)
+	if err != nil {
+		logger.DPanic("failed to generate the device code", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceDeviceAuthorizationReturn{}, err
+	}
+	deviceCode := base64.RawURLEncoding.EncodeToString(deviceCodeBytes)
+
+	// The client gets openid and the scopes registered for it only
+	scope := filterClientScope(param.Scope, client)
+
+	for attempt := 1; ; attempt++ {
+		userCode, err = generateDeviceUserCode()
+		if err != nil {
+			logger.DPanic("failed to generate the user code", zap.Error(err), zap.String(requestIDKey, requestID))
+			return model.ServiceDeviceAuthorizationReturn{}, err
+		}
+		err = s.repository.CreateDeviceAuthorization(ctx, logger, model.RepoCreateDeviceAuthorizationParam{
+			DeviceCode: deviceCode,
+			UserCode:   userCode,
+			ClientID:   client.ClientID,
+			Scope:      scope,
+			Lifetime:   deviceCodeLifetime,
+			Interval:   devicePollingInterval})
+		if err == authorization.ErrorUserCodeAlreadyExist && attempt < deviceUserCodeAttempts {
+			continue
+		}
+		if err != nil {
+			logger.DPanic("failed to create the device authorization", zap.Error(err), zap.String(requestIDKey, requestID))
+			return model.ServiceDeviceAuthorizationReturn{}, err
+		}
+		break
+	}
+
+	verificationURI := "https://" + s.config.DomainAPP + "/device"
+
+	return model.ServiceDeviceAuthorizationReturn{
+		DeviceCode:              deviceCode,
+		UserCode:                formatDeviceUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {userCode}}.Encode(),
+		ExpiresIn:               deviceCodeLifetime,
+		Interval:                devicePollingInterval}, nil
+}
+
+// GetDeviceAuthorization tells the verification page which client asks for the access, so the user
+// can check it's the request of the own device
+func (s *service) GetDeviceAuthorization(ctx context.Context, logger *zap.Logger,
+	userCode string) (model.ServiceDeviceVerificationReturn, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceDeviceVerificationReturn{}, err
+	}
+
+	userCode = normalizeDeviceUserCode(userCode)
+	if !deviceUserCodeRegexp.MatchString(userCode) {
+		logger.Error("the user code is not valid", zap.String(requestIDKey, requestID))
+		return model.ServiceDeviceVerificationReturn{}, authorization.ErrorUserCodeNotFound
+	}
+
+	deviceAuthorization, err := s.repository.GetDeviceAuthorization(ctx, logger, userCode)
+	if err != nil {
+		logger.Error("failed to get the device authorization", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorUserCodeNotFound:
+			return model.ServiceDeviceVerificationReturn{}, err
+		default:
+			return model.ServiceDeviceVerificationReturn{}, err
+		}
+	}
+
+	client, err := s.repository.GetOauthClient(ctx, logger, deviceAuthorization.ClientID)
+	if err != nil {
+		logger.Error("failed to get the client", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorInvalidClient:
+			// The client has been deleted after the request
+			return model.ServiceDeviceVerificationReturn{}, authorization.ErrorUserCodeNotFound
+		default:
+			return model.ServiceDeviceVerificationReturn{}, err
+		}
+	}
+
+	return model.ServiceDeviceVerificationReturn{
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		Scope:      deviceAuthorization.Scope}, nil
+}
+
+// ApproveDeviceAuthorization records the decision of the signed-in user, the device gets the tokens
+// of this user on the next poll
+func (s *service) ApproveDeviceAuthorization(ctx context.Context, logger *zap.Logger,
+	param model.ServiceApproveDeviceAuthorizationParam) error {
+
+	var user model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	err = json.Unmarshal(param.AccessTokenData, &user)
+	if err != nil {
+		logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	userCode := normalizeDeviceUserCode(param.UserCode)
+	if !deviceUserCodeRegexp.MatchString(userCode) {
+		logger.Error("the user code is not valid", zap.String(requestIDKey, requestID))
+		return authorization.ErrorUserCodeNotFound
+	}
+
+	err = s.repository.UpdateDeviceAuthorization(ctx, logger, model.RepoUpdateDeviceAuthorizationParam{
+		UserCode: userCode,
+		UserID:   user.ID,
+		Approved: param.Approved})
+	if err != nil {
+		logger.Error("failed to update the device authorization", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorUserCodeNotFound:
+			return err
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exchangeDeviceCode answers the poll of the device (RFC 8628, section 3.5)
+func (s *service) exchangeDeviceCode(ctx context.Context, logger *zap.Logger, client model.OauthClient,
+	param model.ServiceExchangeTokenParam) (model.ServiceAccessTokenReturn, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	if param.DeviceCode == "" {
+		logger.Error("the device code is empty", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidRequest
+	}
+
+	deviceAuthorization, err := s.repository.PollDeviceAuthorization(ctx, logger, model.RepoPollDeviceAuthorizationParam{
+		DeviceCode:        param.DeviceCode,
+		SlowDownIncrement: deviceSlowDownIncrement})
+	if err != nil {
+		logger.Error("failed to poll the device authorization", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorDeviceCodeNotFound:
+			return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	if deviceAuthorization.ClientID != client.ClientID {
+		logger.Error("the device code was issued to another client", zap.String("clientID", client.ClientID),
+			zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+	}
+
+	switch {
+	case deviceAuthorization.Expired:
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorExpiredToken
+	case deviceAuthorization.SlowDown:
+		logger.Info("the device polls too often", zap.String("clientID", client.ClientID),
+			zap.Int("interval", deviceAuthorization.Interval), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorSlowDown
+	case deviceAuthorization.Status == model.DeviceAuthorizationStatusPending:
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorAuthorizationPending
+	case deviceAuthorization.Status == model.DeviceAuthorizationStatusDenied:
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorAccessDenied
+	}
+
+	// Only one of the concurrent polls gets the tokens
+
+	err = s.repository.DeleteDeviceAuthorization(ctx, logger, param.DeviceCode)
+	if err != nil {
+		logger.Error("failed to delete the device authorization", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorDeviceCodeNotFound:
+			return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	user, err := s.repository.GetUserByID(ctx, logger, deviceAuthorization.UserID)
+	if err != nil {
+		logger.Error("failed to get the user", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorUserNotFound,
+			authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
+			return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	tokens, err := s.createSession(ctx, logger, user, client, model.ServiceCreateAccessTokenParam{
+		ClientID:  client.ClientID,
+		UserAgent: param.UserAgent,
+		Device:    model.Device{Platform: client.Name},
+		Scope:     deviceAuthorization.Scope})
+	if err != nil {
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	if hasScope(deviceAuthorization.Scope, oidcScopeOpenID) {
+		tokens.IDToken, err = s.createIDToken(ctx, logger, user, client.ClientID, "")
+		if err != nil {
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	return tokens, nil
+}
+
+// generateDeviceUserCode picks the characters without the modulo bias
+func generateDeviceUserCode() (string, error) {
+
+	var userCode []byte
+
+	// The largest multiple of the alphabet size that fits a byte
+	limit := 256 - 256%len(deviceUserCodeAlphabet)
+	buffer := make([]byte, deviceUserCodeLength)
+
+	for len(userCode) < deviceUserCodeLength {
+		if _, err := rand.Read(buffer); err != nil {
+			return "", err
+		}
+		for _, value := range buffer {
+			if int(value) < limit && len(userCode) < deviceUserCodeLength {
+				userCode = append(userCode, deviceUserCodeAlphabet[int(value)%len(deviceUserCodeAlphabet)])
+			}
+		}
+	}
+
+	return string(userCode), nil
+}
+
+// formatDeviceUserCode splits the code into two halves, it's easier to read from the screen
+func formatDeviceUserCode(userCode string) string {
+	return userCode[:deviceUserCodeLength/2] + "-" + userCode[deviceUserCodeLength/2:]
+}
+
+// normalizeDeviceUserCode ignores the case, the dashes and the spaces typed by the user (RFC 8628, section 6.1)
+func normalizeDeviceUserCode(userCode string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+}
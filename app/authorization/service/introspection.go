@@ -0,0 +1,209 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/jwt"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+)
+
+const (
+	oauthTokenTypeHintAccessToken  = "access_token"
+	oauthTokenTypeHintRefreshToken = "refresh_token"
+)
+
+var errorBadTokenPayload = errors.New("the payload of the verified token is malformed")
+
+// IntrospectToken tells a resource server, such as the API gateway, whether the access or refresh token is active
+// and what it has been issued for (RFC 7662). Only the confidential clients may introspect the tokens.
+// An invalid, expired or revoked token is not an error, the token is just inactive.
+func (s *service) IntrospectToken(ctx context.Context, logger *zap.Logger,
+	param model.ServiceIntrospectTokenParam) (model.TokenIntrospection, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.TokenIntrospection{}, err
+	}
+
+	if param.ClientID == "" {
+		logger.Error("the client is not specified", zap.String(requestIDKey, requestID))
+		return model.TokenIntrospection{}, authorization.ErrorInvalidClient
+	}
+
+	client, err := s.repository.AuthenticateOauthClient(ctx, logger, model.RepoAuthenticateOauthClientParam{
+		ClientID:     param.ClientID,
+		ClientSecret: param.ClientSecret})
+	if err != nil {
+		logger.Error("failed to authenticate the client", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorInvalidClient:
+			return model.TokenIntrospection{}, err
+		default:
+			return model.TokenIntrospection{}, err
+		}
+	}
+	if client.HashedSecret == "" {
+		logger.Error("the public client is not allowed to introspect the tokens", zap.String("clientID", client.ClientID),
+			zap.String(requestIDKey, requestID))
+		return model.TokenIntrospection{}, authorization.ErrorInvalidClient
+	}
+
+	if param.Token == "" {
+		logger.Error("the token is empty", zap.String(requestIDKey, requestID))
+		return model.TokenIntrospection{}, authorization.ErrorInvalidRequest
+	}
+
+	introspection, err := s.introspectToken(ctx, logger, param.Token, param.TokenTypeHint)
+	if err != nil {
+		return model.TokenIntrospection{}, err
+	}
+	if !introspection.Active {
+		logger.Info("the introspected token is not active", zap.String("clientID", client.ClientID),
+			zap.String(requestIDKey, requestID))
+	}
+
+	return introspection, nil
+}
+
+// introspectToken returns the inactive token if it's not a valid access or refresh token
+func (s *service) introspectToken(ctx context.Context, logger *zap.Logger, token string,
+	tokenTypeHint string) (model.TokenIntrospection, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.TokenIntrospection{}, err
+	}
+
+	jwtData, tokenType, ok := s.parseOauthToken(token, tokenTypeHint)
+	if !ok {
+		return model.TokenIntrospection{Active: false}, nil
+	}
+	publicSessionID := jwtData.Claims.JwtID
+
+	if tokenType == oauthTokenTypeHintAccessToken && isServiceAccountJwtID(publicSessionID) {
+		return s.introspectServiceAccountToken(ctx, logger, token, jwtData)
+	}
+	if tokenType == oauthTokenTypeHintAccessToken && isExchangedJwtID(publicSessionID) {
+		return s.introspectExchangedToken(ctx, logger, token, jwtData)
+	}
+
+	switch tokenType {
+	case oauthTokenTypeHintAccessToken:
+		revoked, err := s.revocationStore.IsRevoked(ctx, publicSessionID)
+		if err != nil {
+			logger.DPanic("failed to check the access token revocation", zap.Error(err), zap.String(requestIDKey, requestID))
+			return model.TokenIntrospection{}, err
+		}
+		if revoked {
+			return model.TokenIntrospection{Active: false}, nil
+		}
+	case oauthTokenTypeHintRefreshToken:
+		// A rotated refresh token is still signed, but it's no longer the token of the session
+		_, err = s.repository.GetUserByRefreshToken(ctx, logger, token)
+		if err != nil {
+			switch err {
+			case authorization.ErrorUserNotFound:
+				return model.TokenIntrospection{Active: false}, nil
+			default:
+				return model.TokenIntrospection{}, err
+			}
+		}
+	}
+
+	session, err := s.repository.GetActiveSession(ctx, logger, publicSessionID)
+	if err != nil {
+		switch err {
+		case authorization.ErrorSessionNotFound:
+			return model.TokenIntrospection{Active: false}, nil
+		default:
+			return model.TokenIntrospection{}, err
+		}
+	}
+
+	claims, err := readTokenClaims(token)
+	if err != nil {
+		logger.DPanic("failed to read the claims of the token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.TokenIntrospection{}, err
+	}
+
+	// The refreshed access token may have fewer scopes than the session
+
+	scope := session.Scope
+	if tokenType == oauthTokenTypeHintAccessToken && claims.Scope != "" {
+		scope = claims.Scope
+	}
+
+	return model.TokenIntrospection{
+		Active:          true,
+		Subject:         strconv.FormatInt(session.UserID, 10),
+		ExpiresAt:       claims.ExpiresAt,
+		IssuedAt:        claims.IssuedAt,
+		ClientID:        session.ClientID,
+		Scope:           scope,
+		PublicSessionID: publicSessionID,
+		Audience:        claims.Audience}, nil
+}
+
+// parseOauthToken verifies the token as an access or a refresh token and returns its type. The hint only sets
+// the order of the attempts, a token of the other type is found as well (RFC 7662, section 2.1; RFC 7009, section 2.1).
+func (s *service) parseOauthToken(token string, tokenTypeHint string) (jwt.Token, string, bool) {
+
+	tokenTypes := []string{oauthTokenTypeHintAccessToken, oauthTokenTypeHintRefreshToken}
+	if tokenTypeHint == oauthTokenTypeHintRefreshToken {
+		tokenTypes = []string{oauthTokenTypeHintRefreshToken, oauthTokenTypeHintAccessToken}
+	}
+
+	for _, tokenType := range tokenTypes {
+		jwtToken := s.jwtAccess
+		if tokenType == oauthTokenTypeHintRefreshToken {
+			jwtToken = s.jwtRefresh
+		}
+		jwtData, _, err := jwtToken.Parse(token)
+		if err == nil {
+			return jwtData, tokenType, true
+		}
+	}
+
+	return jwt.Token{}, "", false
+}
+
+// tokenClaims are the claims of the verified token that jwt.Token doesn't return
+type tokenClaims struct {
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	Audience  string `json:"aud"`
+	Scope     string `json:"scope"`
+}
+
+// readTokenClaims reads the payload of the verified token, the HMAC tokens have no aud and scope claims
+func readTokenClaims(token string) (tokenClaims, error) {
+
+	var claims tokenClaims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return tokenClaims{}, errorBadTokenPayload
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return tokenClaims{}, errorBadTokenPayload
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil || claims.ExpiresAt == 0 {
+		return tokenClaims{}, errorBadTokenPayload
+	}
+
+	return claims, nil
+}
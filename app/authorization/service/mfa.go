@@ -0,0 +1,450 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/financelime-authorization/totp"
+	"github.com/dmalix/requestid"
+	"github.com/dmalix/sendmail"
+	"go.uber.org/zap"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	// The challenge token lifetime in seconds
+	mfaChallengeLifetime = 300
+
+	recoveryCodesAmount = 10
+	// A recovery code is shown as two groups of characters, e.g. kq7mz-w3tcp
+	recoveryCodeGroupLength = 5
+	// The characters which can't be confused with each other, the same as in the confirmation keys
+	recoveryCodeAlphabet = "abcefghijkmnopqrtuvwxyz23479"
+)
+
+func (s *service) CreateTotp(ctx context.Context, logger *zap.Logger, accessTokenData []byte) (model.ServiceCreateTotpReturn, error) {
+
+	var user model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceCreateTotpReturn{}, err
+	}
+
+	err = json.Unmarshal(accessTokenData, &user)
+	if err != nil {
+		logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return model.ServiceCreateTotpReturn{}, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.DPanic("failed to generate the TOTP secret", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceCreateTotpReturn{}, err
+	}
+
+	encryptedSecret, err := s.dataMfa.Encrypt([]byte(secret))
+	if err != nil {
+		logger.DPanic("failed to encrypt the TOTP secret", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceCreateTotpReturn{}, err
+	}
+
+	err = s.repository.CreateTotp(ctx, logger, model.RepoCreateTotpParam{
+		UserID:          user.ID,
+		EncryptedSecret: encryptedSecret})
+	if err != nil {
+		logger.Error("failed to create the TOTP secret", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorMfaAlreadyEnabled:
+			return model.ServiceCreateTotpReturn{}, err
+		default:
+			return model.ServiceCreateTotpReturn{}, err
+		}
+	}
+
+	return model.ServiceCreateTotpReturn{
+		Secret: secret,
+		URI:    totp.URI(s.config.DomainAPP, user.Email, secret)}, nil
+}
+
+func (s *service) ConfirmTotp(ctx context.Context, logger *zap.Logger, param model.ServiceConfirmTotpParam) ([]string, error) {
+
+	var user model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	if param.Code == "" {
+		logger.Error("the code is empty", zap.String(requestIDKey, requestID))
+		return nil, authorization.ErrorBadParams
+	}
+
+	err = json.Unmarshal(param.AccessTokenData, &user)
+	if err != nil {
+		logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	userTotp, err := s.repository.GetTotp(ctx, logger, user.ID)
+	if err != nil {
+		logger.Error("failed to get the TOTP secret", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorMfaNotFound:
+			return nil, err
+		default:
+			return nil, err
+		}
+	}
+	if userTotp.ConfirmedAt != nil {
+		logger.Error("the two-factor authentication is already enabled", zap.String(requestIDKey, requestID))
+		return nil, authorization.ErrorMfaAlreadyEnabled
+	}
+
+	step, err := s.validateTotpCode(userTotp, param.Code)
+	if err != nil {
+		logger.Error("failed to validate the code", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	err = s.repository.ConfirmTotp(ctx, logger, model.RepoTotpStepParam{
+		UserID: user.ID,
+		Step:   step})
+	if err != nil {
+		logger.Error("failed to confirm the TOTP secret", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorMfaAlreadyEnabled:
+			return nil, err
+		default:
+			return nil, err
+		}
+	}
+
+	// The user gets the recovery codes together with the enabled two-factor authentication
+
+	recoveryCodes, err := s.replaceRecoveryCodes(ctx, logger, user.ID)
+	if err != nil {
+		logger.DPanic("failed to create the recovery codes", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+func (s *service) VerifyMfaChallenge(ctx context.Context, logger *zap.Logger,
+	param model.ServiceVerifyMfaChallengeParam) (model.ServiceAccessTokenReturn, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	if param.ChallengeToken == "" || (param.Code == "" && param.RecoveryCode == "") {
+		logger.Error("the challenge token or the code is empty", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorBadParams
+	}
+
+	challenge, err := s.repository.GetMfaChallenge(ctx, logger, param.ChallengeToken)
+	if err != nil {
+		logger.Error("failed to get the challenge", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorMfaChallengeNotFound:
+			return model.ServiceAccessTokenReturn{}, err
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	// The client could have been disabled after the challenge was created
+
+	client, err := s.getClientForGrant(ctx, logger, challenge.ClientID, model.OauthGrantTypePassword)
+	if err != nil {
+		logger.Error("the client is not allowed to log in the users", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	// The user could have disabled the two-factor authentication after the challenge was created
+
+	userTotp, err := s.repository.GetTotp(ctx, logger, challenge.UserID)
+	if err != nil && err != authorization.ErrorMfaNotFound {
+		logger.DPanic("failed to get the TOTP secret", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+	if err == authorization.ErrorMfaNotFound || userTotp.ConfirmedAt == nil {
+		logger.Error("the two-factor authentication is not enabled", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorMfaChallengeNotFound
+	}
+
+	user, err := s.repository.GetUserByID(ctx, logger, challenge.UserID)
+	if err != nil {
+		logger.Error("failed to get the user", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorUserNotFound:
+			return model.ServiceAccessTokenReturn{}, authorization.ErrorMfaChallengeNotFound
+		case authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
+			return model.ServiceAccessTokenReturn{}, err
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	if param.RecoveryCode != "" {
+		err = s.useRecoveryCode(ctx, logger, user, param.RecoveryCode)
+		if err != nil {
+			logger.Error("failed to use the recovery code", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadMfaCode:
+				return model.ServiceAccessTokenReturn{}, err
+			default:
+				return model.ServiceAccessTokenReturn{}, err
+			}
+		}
+	} else {
+		step, err := s.validateTotpCode(userTotp, param.Code)
+		if err != nil {
+			logger.Error("failed to validate the code", zap.Error(err), zap.String(requestIDKey, requestID))
+			return model.ServiceAccessTokenReturn{}, err
+		}
+
+		err = s.repository.UseTotpStep(ctx, logger, model.RepoTotpStepParam{
+			UserID: challenge.UserID,
+			Step:   step})
+		if err != nil {
+			logger.Error("failed to use the code", zap.Error(err), zap.String(requestIDKey, requestID))
+			switch err {
+			case authorization.ErrorBadMfaCode:
+				return model.ServiceAccessTokenReturn{}, err
+			default:
+				return model.ServiceAccessTokenReturn{}, err
+			}
+		}
+	}
+
+	err = s.repository.DeleteMfaChallenge(ctx, logger, param.ChallengeToken)
+	if err != nil {
+		logger.DPanic("failed to delete the challenge", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	return s.createSession(ctx, logger, user, client, model.ServiceCreateAccessTokenParam{
+		ClientID:   challenge.ClientID,
+		UserAgent:  challenge.UserAgent,
+		Device:     challenge.Device,
+		Scope:      challenge.Scope,
+		RememberMe: challenge.RememberMe})
+}
+
+func (s *service) RegenerateRecoveryCodes(ctx context.Context, logger *zap.Logger, accessTokenData []byte) ([]string, error) {
+
+	var user model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	err = json.Unmarshal(accessTokenData, &user)
+	if err != nil {
+		logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	userTotp, err := s.repository.GetTotp(ctx, logger, user.ID)
+	if err != nil && err != authorization.ErrorMfaNotFound {
+		logger.DPanic("failed to get the TOTP secret", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+	if err == authorization.ErrorMfaNotFound || userTotp.ConfirmedAt == nil {
+		logger.Error("the two-factor authentication is not enabled", zap.String(requestIDKey, requestID))
+		return nil, authorization.ErrorMfaNotFound
+	}
+
+	recoveryCodes, err := s.replaceRecoveryCodes(ctx, logger, user.ID)
+	if err != nil {
+		logger.DPanic("failed to replace the recovery codes", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// createMfaChallenge postpones the log in until the user passes the second factor
+func (s *service) createMfaChallenge(ctx context.Context, logger *zap.Logger, user model.User,
+	param model.ServiceCreateAccessTokenParam) (model.ServiceAccessTokenReturn, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	challengeTokenBytes := make([]byte, 32)
+	_, err = rand.Read(challengeTokenBytes)
+	if err != nil {
+		logger.DPanic("failed to generate the challenge token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+	challengeToken := hex.EncodeToString(challengeTokenBytes)
+
+	err = s.repository.CreateMfaChallenge(ctx, logger, model.RepoCreateMfaChallengeParam{
+		UserID:         user.ID,
+		ChallengeToken: challengeToken,
+		Lifetime:       mfaChallengeLifetime,
+		ClientID:       param.ClientID,
+		UserAgent:      param.UserAgent,
+		Device:         param.Device,
+		Scope:          param.Scope,
+		RememberMe:     param.RememberMe})
+	if err != nil {
+		logger.DPanic("failed to create the challenge", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	return model.ServiceAccessTokenReturn{
+		MfaChallengeToken:     challengeToken,
+		MfaChallengeExpiresIn: mfaChallengeLifetime}, nil
+}
+
+// validateTotpCode returns the step of the matched code or ErrorBadMfaCode
+func (s *service) validateTotpCode(userTotp model.Totp, code string) (int64, error) {
+
+	secret, err := s.dataMfa.Decrypt(userTotp.EncryptedSecret)
+	if err != nil {
+		return 0, err
+	}
+
+	step, valid, err := totp.Validate(string(secret), code, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if !valid || step <= userTotp.LastUsedStep {
+		return 0, authorization.ErrorBadMfaCode
+	}
+
+	return step, nil
+}
+
+// replaceRecoveryCodes generates a new set of the recovery codes, the old set stops working
+func (s *service) replaceRecoveryCodes(ctx context.Context, logger *zap.Logger, userID int64) ([]string, error) {
+
+	recoveryCodes := make([]string, recoveryCodesAmount)
+	normalizedRecoveryCodes := make([]string, recoveryCodesAmount)
+
+	for i := range recoveryCodes {
+		firstGroup, err := randomString(recoveryCodeAlphabet, recoveryCodeGroupLength)
+		if err != nil {
+			return nil, err
+		}
+		secondGroup, err := randomString(recoveryCodeAlphabet, recoveryCodeGroupLength)
+		if err != nil {
+			return nil, err
+		}
+		recoveryCodes[i] = firstGroup + "-" + secondGroup
+		normalizedRecoveryCodes[i] = firstGroup + secondGroup
+	}
+
+	err := s.repository.ReplaceRecoveryCodes(ctx, logger, model.RepoReplaceRecoveryCodesParam{
+		UserID:        userID,
+		RecoveryCodes: normalizedRecoveryCodes})
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// useRecoveryCode consumes the code and notifies the user, the code could have been stolen together with the password
+func (s *service) useRecoveryCode(ctx context.Context, logger *zap.Logger, user model.User, recoveryCode string) error {
+
+	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
+	if err != nil {
+		logger.DPanic("failed to get remoteAddr", zap.Error(err))
+		return err
+	}
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	unusedAmount, err := s.repository.UseRecoveryCode(ctx, logger, model.RepoUseRecoveryCodeParam{
+		UserID:       user.ID,
+		RecoveryCode: normalizeRecoveryCode(recoveryCode)})
+	if err != nil {
+		return err
+	}
+
+	newRequestID, err := requestid.Create(false)
+	if err != nil {
+		logger.DPanic("failed to generate requestID", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = s.sendmailManager.AddMessageToQueue(
+		s.sendmailQueue,
+		sendmail.Request{
+			RemoteAddr:    remoteAddr,
+			RemoteAddrKey: remoteAddrKey,
+			RequestID:     requestID,
+			RequestIDKey:  requestIDKey},
+		sendmail.Email{
+			To:      mail.Address{Address: user.Email},
+			Subject: s.languageContent.Data.User.RecoveryCode.Email.Subject[s.languageContent.Language[user.Language]],
+			Body: fmt.Sprintf(
+				s.languageContent.Data.User.RecoveryCode.Email.Body[s.languageContent.Language[user.Language]],
+				remoteAddr, unusedAmount, s.config.DomainAPP),
+			MessageID: fmt.Sprintf(
+				"<%s@%s>",
+				newRequestID,
+				fmt.Sprintf("%s.%s", "use-recovery-code", s.config.DomainAPI))})
+	if err != nil {
+		logger.DPanic("failed to add an email message to the queue", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+func normalizeRecoveryCode(recoveryCode string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(recoveryCode))
+}
+
+// randomString returns the string of the alphabet characters chosen with crypto/rand
+func randomString(alphabet string, length int) (string, error) {
+
+	// The bytes above the largest multiple of the alphabet length are skipped to keep the distribution uniform
+	limit := byte(256 - 256%len(alphabet))
+	result := make([]byte, 0, length)
+	buffer := make([]byte, length)
+
+	for len(result) < length {
+		if _, err := rand.Read(buffer); err != nil {
+			return "", err
+		}
+		for _, b := range buffer {
+			if b < limit && len(result) < length {
+				result = append(result, alphabet[int(b)%len(alphabet)])
+			}
+		}
+	}
+
+	return string(result), nil
+}
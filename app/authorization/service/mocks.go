@@ -5,6 +5,8 @@ import (
 	"errors"
 	"github.com/dmalix/financelime-authorization/app/authorization/model"
 	repository2 "github.com/dmalix/financelime-authorization/app/authorization/repository"
+	"github.com/dmalix/financelime-authorization/jose"
+	"github.com/dmalix/financelime-authorization/webauthn"
 	"go.uber.org/zap"
 )
 
@@ -20,6 +22,8 @@ type Mock struct {
 		InviteCode string
 		Language   string
 		RemoteAddr string
+		// CreateAccessToken returns the MFA challenge instead of the tokens if it's set
+		MfaChallengeToken string
 	}
 	Expected struct {
 		Error error
@@ -45,7 +49,17 @@ func (s *Mock) SignUpStep2(_ context.Context, _ *zap.Logger, _ string) (string,
 	return "", s.Expected.Error
 }
 
+func (s *Mock) SignUpStep3(_ context.Context, _ *zap.Logger, _ model.ServiceSetPasswordParam) error {
+	return s.Expected.Error
+}
+
 func (s *Mock) CreateAccessToken(_ context.Context, _ *zap.Logger, _ model.ServiceCreateAccessTokenParam) (model.ServiceAccessTokenReturn, error) {
+	if s.Props.MfaChallengeToken != "" {
+		return model.ServiceAccessTokenReturn{
+			MfaChallengeToken:     s.Props.MfaChallengeToken,
+			MfaChallengeExpiresIn: 300,
+		}, s.Expected.Error
+	}
 	return model.ServiceAccessTokenReturn{
 		PublicSessionID: "sessionID",
 		AccessJWT:       "accessToken",
@@ -53,12 +67,24 @@ func (s *Mock) CreateAccessToken(_ context.Context, _ *zap.Logger, _ model.Servi
 	}, s.Expected.Error
 }
 
+func (s *Mock) CheckAccessTokenRevocation(_ context.Context, _ *zap.Logger, _ string) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) CheckUserAccessToken(_ context.Context, _ *zap.Logger, _ []byte) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) RevokeAllSessions(_ context.Context, _ *zap.Logger, _ model.ServiceRevokeAllSessionsParam) error {
+	return s.Expected.Error
+}
+
 func (s *Mock) GetListActiveSessions(_ context.Context, _ *zap.Logger, _ []byte) ([]model.Session, error) {
 	var sessions []model.Session
 	return sessions, s.Expected.Error
 }
 
-func (s *Mock) RefreshAccessToken(_ context.Context, _ *zap.Logger, _ string) (model.ServiceAccessTokenReturn, error) {
+func (s *Mock) RefreshAccessToken(_ context.Context, _ *zap.Logger, _ model.ServiceRefreshAccessTokenParam) (model.ServiceAccessTokenReturn, error) {
 	return model.ServiceAccessTokenReturn{
 			PublicSessionID: "sessionID",
 			AccessJWT:       "accessToken",
@@ -77,3 +103,204 @@ func (s *Mock) ResetUserPasswordStep1(_ context.Context, _ *zap.Logger, _ string
 func (s *Mock) ResetUserPasswordStep2(_ context.Context, _ *zap.Logger, _ string) (string, error) {
 	return "", s.Expected.Error
 }
+
+func (s *Mock) ResetUserPasswordStep3(_ context.Context, _ *zap.Logger, _ model.ServiceSetPasswordParam) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) UpdateUserPassword(_ context.Context, _ *zap.Logger, _ model.ServiceUpdateUserPasswordParam) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) CreateTotp(_ context.Context, _ *zap.Logger, _ []byte) (model.ServiceCreateTotpReturn, error) {
+	return model.ServiceCreateTotpReturn{
+		Secret: "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+		URI:    "otpauth://totp/financelime.com:test.user@financelime.com?secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+	}, s.Expected.Error
+}
+
+func (s *Mock) ConfirmTotp(_ context.Context, _ *zap.Logger, _ model.ServiceConfirmTotpParam) ([]string, error) {
+	return []string{"kq7mz-w3tcp", "a2hfx-9rjne"}, s.Expected.Error
+}
+
+func (s *Mock) VerifyMfaChallenge(_ context.Context, _ *zap.Logger, _ model.ServiceVerifyMfaChallengeParam) (model.ServiceAccessTokenReturn, error) {
+	return model.ServiceAccessTokenReturn{
+			PublicSessionID: "sessionID",
+			AccessJWT:       "accessToken",
+			RefreshJWT:      "refreshToken"},
+		s.Expected.Error
+}
+
+func (s *Mock) RegenerateRecoveryCodes(_ context.Context, _ *zap.Logger, _ []byte) ([]string, error) {
+	return []string{"kq7mz-w3tcp", "a2hfx-9rjne"}, s.Expected.Error
+}
+
+func (s *Mock) BeginWebauthnRegistration(_ context.Context, _ *zap.Logger, _ []byte) (webauthn.CreationOptions, error) {
+	return webauthn.Config{RPID: "financelime.com", RPName: "Financelime"}.CreationOptions(
+		"challenge", webauthn.User{ID: "AAAAAAAAAAE", Name: "test.user@financelime.com"}, nil), s.Expected.Error
+}
+
+func (s *Mock) FinishWebauthnRegistration(_ context.Context, _ *zap.Logger, _ model.ServiceFinishWebauthnRegistrationParam) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) BeginWebauthnLogin(_ context.Context, _ *zap.Logger) (webauthn.RequestOptions, error) {
+	return webauthn.Config{RPID: "financelime.com"}.RequestOptions("challenge"), s.Expected.Error
+}
+
+func (s *Mock) FinishWebauthnLogin(_ context.Context, _ *zap.Logger, _ model.ServiceFinishWebauthnLoginParam) (model.ServiceAccessTokenReturn, error) {
+	return model.ServiceAccessTokenReturn{
+			PublicSessionID: "sessionID",
+			AccessJWT:       "accessToken",
+			RefreshJWT:      "refreshToken"},
+		s.Expected.Error
+}
+
+func (s *Mock) Authorize(_ context.Context, _ *zap.Logger, param model.ServiceAuthorizeParam) (string, error) {
+	return param.RedirectURI + "?code=code&state=" + param.State, s.Expected.Error
+}
+
+func (s *Mock) ExchangeToken(_ context.Context, _ *zap.Logger, _ model.ServiceExchangeTokenParam) (model.ServiceAccessTokenReturn, error) {
+	return model.ServiceAccessTokenReturn{
+			PublicSessionID: "sessionID",
+			AccessJWT:       "accessToken",
+			RefreshJWT:      "refreshToken"},
+		s.Expected.Error
+}
+
+func (s *Mock) GetOpenIDConfiguration() model.OpenIDConfiguration {
+	return model.OpenIDConfiguration{Issuer: "https://domain.com"}
+}
+
+func (s *Mock) GetJwks() jose.JSONWebKeySet {
+	return jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyType: "RSA", KeyID: "keyID"}}}
+}
+
+func (s *Mock) GetUserInfo(_ context.Context, _ *zap.Logger, _ []byte) (model.UserInfo, error) {
+	return model.UserInfo{Subject: "2", Email: s.Props.Email, EmailVerified: true}, s.Expected.Error
+}
+
+func (s *Mock) IntrospectToken(_ context.Context, _ *zap.Logger, param model.ServiceIntrospectTokenParam) (model.TokenIntrospection, error) {
+	if param.Token != "accessToken" {
+		return model.TokenIntrospection{Active: false}, s.Expected.Error
+	}
+	return model.TokenIntrospection{
+			Active:          true,
+			Subject:         "2",
+			ClientID:        param.ClientID,
+			PublicSessionID: "sessionID"},
+		s.Expected.Error
+}
+
+func (s *Mock) RevokeToken(_ context.Context, _ *zap.Logger, _ model.ServiceRevokeTokenParam) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) CreateDeviceAuthorization(_ context.Context, _ *zap.Logger,
+	_ model.ServiceDeviceAuthorizationParam) (model.ServiceDeviceAuthorizationReturn, error) {
+	return model.ServiceDeviceAuthorizationReturn{
+			DeviceCode:              "deviceCode",
+			UserCode:                "wdjb-mjht",
+			VerificationURI:         "https://financelime.com/device",
+			VerificationURIComplete: "https://financelime.com/device?user_code=wdjbmjht",
+			ExpiresIn:               600,
+			Interval:                5},
+		s.Expected.Error
+}
+
+func (s *Mock) GetDeviceAuthorization(_ context.Context, _ *zap.Logger, _ string) (model.ServiceDeviceVerificationReturn, error) {
+	return model.ServiceDeviceVerificationReturn{ClientID: "client", ClientName: "Client", Scope: "openid"}, s.Expected.Error
+}
+
+func (s *Mock) ApproveDeviceAuthorization(_ context.Context, _ *zap.Logger, _ model.ServiceApproveDeviceAuthorizationParam) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) GetListRoles(_ context.Context, _ *zap.Logger) ([]model.Role, error) {
+	return []model.Role{{
+			Name:        model.PermissionAdmin,
+			Description: "The administrators of the users",
+			Permissions: []string{model.PermissionAdmin}}},
+		s.Expected.Error
+}
+
+func (s *Mock) AssignUserRole(_ context.Context, _ *zap.Logger, _ model.ServiceUserRoleParam) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) RevokeUserRole(_ context.Context, _ *zap.Logger, _ model.ServiceUserRoleParam) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) SearchUsers(_ context.Context, _ *zap.Logger, param model.ServiceSearchUsersParam) ([]model.UserRecord, error) {
+	return []model.UserRecord{{ID: 2, Email: param.Email, Language: "en"}}, s.Expected.Error
+}
+
+func (s *Mock) GetUserDetail(_ context.Context, _ *zap.Logger, userID int64) (model.UserDetail, error) {
+	return model.UserDetail{User: model.UserRecord{ID: userID, Email: s.Props.Email, Language: s.Props.Language}},
+		s.Expected.Error
+}
+
+func (s *Mock) DisableUser(_ context.Context, _ *zap.Logger, _ int64) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) EnableUser(_ context.Context, _ *zap.Logger, _ int64) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) ForceUserPasswordReset(_ context.Context, _ *zap.Logger, _ int64) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) ResendSignUpConfirmation(_ context.Context, _ *zap.Logger, _ string) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) DeleteUser(_ context.Context, _ *zap.Logger, _ int64) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) UpdateUserStatus(_ context.Context, _ *zap.Logger, _ model.ServiceUpdateUserStatusParam) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) GetListOauthClients(_ context.Context, _ *zap.Logger) ([]model.OauthClient, error) {
+	return []model.OauthClient{{ClientID: "PWA_v0.0.1", Name: "Financelime PWA",
+		GrantTypes: []string{model.OauthGrantTypePassword, model.OauthGrantTypeRefreshToken}}}, s.Expected.Error
+}
+
+func (s *Mock) CreateOauthClient(_ context.Context, _ *zap.Logger,
+	param model.ServiceCreateOauthClientParam) (model.ServiceClientCredentialsReturn, error) {
+	credentials := model.ServiceClientCredentialsReturn{ClientID: param.ClientID}
+	if param.Confidential {
+		credentials.ClientSecret = "clientSecret"
+	}
+	return credentials, s.Expected.Error
+}
+
+func (s *Mock) UpdateOauthClient(_ context.Context, _ *zap.Logger, _ model.ServiceUpdateOauthClientParam) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) DisableOauthClient(_ context.Context, _ *zap.Logger, _ string) error {
+	return s.Expected.Error
+}
+
+func (s *Mock) GetListServiceAccounts(_ context.Context, _ *zap.Logger) ([]model.ServiceAccount, error) {
+	return []model.ServiceAccount{{ClientID: "reports-job", Name: "Reports job", Scope: "read:reports"}}, s.Expected.Error
+}
+
+func (s *Mock) CreateServiceAccount(_ context.Context, _ *zap.Logger,
+	param model.ServiceCreateServiceAccountParam) (model.ServiceClientCredentialsReturn, error) {
+	return model.ServiceClientCredentialsReturn{ClientID: param.ClientID, ClientSecret: "clientSecret"}, s.Expected.Error
+}
+
+func (s *Mock) UpdateServiceAccount(_ context.Context, _ *zap.Logger,
+	param model.ServiceUpdateServiceAccountParam) (model.ServiceClientCredentialsReturn, error) {
+	return model.ServiceClientCredentialsReturn{ClientID: param.ClientID}, s.Expected.Error
+}
+
+func (s *Mock) DeleteServiceAccount(_ context.Context, _ *zap.Logger, _ string) error {
+	return s.Expected.Error
+}
@@ -0,0 +1,351 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	oauthResponseTypeCode            = "code"
+	oauthCodeChallengeMethodS256     = "S256"
+	oauthGrantTypeAuthorizationCode  = model.OauthGrantTypeAuthorizationCode
+	oauthGrantTypeRefreshToken       = model.OauthGrantTypeRefreshToken
+	oauthAuthorizationCodeLifetime   = 60 // seconds, RFC 6749 recommends 10 minutes at most
+	oauthAuthorizationCodeByteLength = 32
+)
+
+// The code verifier and the S256 challenge are 43-128 characters of the unreserved URI set (RFC 7636, section 4.1)
+var oauthPkceRegexp = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// Authorize issues an authorization code to the client on behalf of the signed-in user and returns
+// the redirect URI of the client. The errors with the client or the redirect URI are returned, since the user agent
+// must not be redirected to an unverified URI; the other errors are reported to the client in the redirect URI.
+func (s *service) Authorize(ctx context.Context, logger *zap.Logger, param model.ServiceAuthorizeParam) (string, error) {
+
+	var user model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return "", err
+	}
+
+	err = json.Unmarshal(param.AccessTokenData, &user)
+	if err != nil {
+		logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return "", err
+	}
+
+	client, err := s.repository.GetOauthClient(ctx, logger, param.ClientID)
+	if err != nil {
+		logger.Error("failed to get the client", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorInvalidClient:
+			return "", err
+		default:
+			return "", err
+		}
+	}
+
+	if !isRegisteredRedirectURI(client, param.RedirectURI) {
+		logger.Error("the redirect URI is not registered", zap.String("redirectURI", param.RedirectURI),
+			zap.String(requestIDKey, requestID))
+		return "", authorization.ErrorInvalidRedirectURI
+	}
+
+	err = s.checkClientGrant(ctx, logger, client, oauthGrantTypeAuthorizationCode)
+	if err != nil {
+		switch err {
+		case authorization.ErrorUnauthorizedClient:
+			return oauthRedirectURI(param.RedirectURI, map[string]string{
+				"error": strings.ToLower(err.Error()),
+				"state": param.State}), nil
+		default:
+			return "", err
+		}
+	}
+
+	if param.ResponseType != oauthResponseTypeCode {
+		logger.Error("the response type is not supported", zap.String("responseType", param.ResponseType),
+			zap.String(requestIDKey, requestID))
+		return oauthRedirectURI(param.RedirectURI, map[string]string{
+			"error": strings.ToLower(authorization.ErrorUnsupportedResponseType.Error()),
+			"state": param.State}), nil
+	}
+
+	if len(param.Nonce) > oidcNonceMaxLength {
+		logger.Error("the nonce is too long", zap.String(requestIDKey, requestID))
+		return oauthRedirectURI(param.RedirectURI, map[string]string{
+			"error":             strings.ToLower(authorization.ErrorInvalidRequest.Error()),
+			"error_description": "the nonce is too long",
+			"state":             param.State}), nil
+	}
+
+	// PKCE is required for all the clients, the plain method is not accepted
+
+	if param.CodeChallengeMethod != oauthCodeChallengeMethodS256 || !oauthPkceRegexp.MatchString(param.CodeChallenge) {
+		logger.Error("the code challenge is not valid", zap.String(requestIDKey, requestID))
+		return oauthRedirectURI(param.RedirectURI, map[string]string{
+			"error":             strings.ToLower(authorization.ErrorInvalidRequest.Error()),
+			"error_description": "code_challenge with the S256 method is required",
+			"state":             param.State}), nil
+	}
+
+	codeBytes := make([]byte, oauthAuthorizationCodeByteLength)
+	_, err = rand.Read(codeBytes)
+	if err != nil {
+		logger.DPanic("failed to generate the authorization code", zap.Error(err), zap.String(requestIDKey, requestID))
+		return "", err
+	}
+	code := hex.EncodeToString(codeBytes)
+
+	// The client gets openid and the scopes registered for it only
+	scope := filterClientScope(param.Scope, client)
+
+	err = s.repository.CreateAuthorizationCode(ctx, logger, model.RepoCreateAuthorizationCodeParam{
+		Code:          code,
+		ClientID:      client.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   param.RedirectURI,
+		CodeChallenge: param.CodeChallenge,
+		Scope:         scope,
+		Nonce:         param.Nonce,
+		Lifetime:      oauthAuthorizationCodeLifetime})
+	if err != nil {
+		logger.DPanic("failed to create the authorization code", zap.Error(err), zap.String(requestIDKey, requestID))
+		return "", err
+	}
+
+	return oauthRedirectURI(param.RedirectURI, map[string]string{
+		"code":  code,
+		"state": param.State}), nil
+}
+
+// ExchangeToken is the token endpoint (RFC 6749, section 3.2). The tokens are the same as CreateAccessToken issues.
+func (s *service) ExchangeToken(ctx context.Context, logger *zap.Logger,
+	param model.ServiceExchangeTokenParam) (model.ServiceAccessTokenReturn, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	if param.ClientID == "" {
+		logger.Error("the client is not specified", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidClient
+	}
+
+	// The service accounts are not the clients of the users, they authenticate with their own credentials
+	if param.GrantType == oauthGrantTypeClientCredentials {
+		return s.exchangeClientCredentials(ctx, logger, param)
+	}
+
+	client, err := s.repository.AuthenticateOauthClient(ctx, logger, model.RepoAuthenticateOauthClientParam{
+		ClientID:     param.ClientID,
+		ClientSecret: param.ClientSecret})
+	if err != nil {
+		logger.Error("failed to authenticate the client", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorInvalidClient:
+			return model.ServiceAccessTokenReturn{}, err
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	// The client may use the grant types of its registration only
+
+	switch param.GrantType {
+	case oauthGrantTypeAuthorizationCode, oauthGrantTypeRefreshToken, oauthGrantTypeDeviceCode, oauthGrantTypeTokenExchange:
+		err = s.checkClientGrant(ctx, logger, client, param.GrantType)
+		if err != nil {
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	switch param.GrantType {
+	case oauthGrantTypeAuthorizationCode:
+		return s.exchangeAuthorizationCode(ctx, logger, client, param)
+	case oauthGrantTypeRefreshToken:
+		return s.exchangeRefreshToken(ctx, logger, client, param)
+	case oauthGrantTypeDeviceCode:
+		return s.exchangeDeviceCode(ctx, logger, client, param)
+	case oauthGrantTypeTokenExchange:
+		return s.exchangeSubjectToken(ctx, logger, client, param)
+	default:
+		logger.Error("the grant type is not supported", zap.String("grantType", param.GrantType),
+			zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorUnsupportedGrantType
+	}
+}
+
+func (s *service) exchangeAuthorizationCode(ctx context.Context, logger *zap.Logger, client model.OauthClient,
+	param model.ServiceExchangeTokenParam) (model.ServiceAccessTokenReturn, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	if param.Code == "" || param.RedirectURI == "" || !oauthPkceRegexp.MatchString(param.CodeVerifier) {
+		logger.Error("the token request is not valid", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidRequest
+	}
+
+	code, err := s.repository.GetAuthorizationCode(ctx, logger, param.Code)
+	if err != nil {
+		logger.Error("failed to get the authorization code", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorAuthorizationCodeNotFound:
+			return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	if code.ClientID != client.ClientID || code.RedirectURI != param.RedirectURI {
+		logger.Error("the authorization code was issued to another client or redirect URI",
+			zap.String("clientID", client.ClientID), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+	}
+
+	verifierHash := sha256.Sum256([]byte(param.CodeVerifier))
+	codeChallenge := base64.RawURLEncoding.EncodeToString(verifierHash[:])
+	if subtle.ConstantTimeCompare([]byte(codeChallenge), []byte(code.CodeChallenge)) != 1 {
+		logger.Error("the code verifier does not match the code challenge", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+	}
+
+	user, err := s.repository.GetUserByID(ctx, logger, code.UserID)
+	if err != nil {
+		logger.Error("failed to get the user", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorUserNotFound,
+			authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
+			return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	tokens, err := s.createSession(ctx, logger, user, client, model.ServiceCreateAccessTokenParam{
+		ClientID:  client.ClientID,
+		UserAgent: param.UserAgent,
+		Device:    model.Device{Platform: client.Name},
+		Scope:     code.Scope})
+	if err != nil {
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	if hasScope(code.Scope, oidcScopeOpenID) {
+		tokens.IDToken, err = s.createIDToken(ctx, logger, user, client.ClientID, code.Nonce)
+		if err != nil {
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	return tokens, nil
+}
+
+func (s *service) exchangeRefreshToken(ctx context.Context, logger *zap.Logger, client model.OauthClient,
+	param model.ServiceExchangeTokenParam) (model.ServiceAccessTokenReturn, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	if param.RefreshToken == "" {
+		logger.Error("the refresh token is empty", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidRequest
+	}
+
+	// The refresh token is bound to the client it was issued to (RFC 6749, section 6)
+
+	jwtData, parseCodeError, err := s.jwtRefresh.Parse(param.RefreshToken)
+	if err != nil {
+		logger.Error("failed to verify the refresh token", zap.Error(err),
+			zap.String("parseCodeError", parseCodeError), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+	}
+
+	sessionClientID, err := s.repository.GetSessionClientID(ctx, logger, jwtData.Claims.JwtID)
+	if err != nil {
+		logger.Error("failed to get the client of the session", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorSessionNotFound:
+			return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+	if sessionClientID != client.ClientID {
+		logger.Error("the refresh token was issued to another client", zap.String("clientID", client.ClientID),
+			zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+	}
+
+	tokens, err := s.RefreshAccessToken(ctx, logger, model.ServiceRefreshAccessTokenParam{
+		RefreshToken: param.RefreshToken,
+		Scope:        param.Scope})
+	if err != nil {
+		switch err {
+		case authorization.ErrorBadRefreshToken, authorization.ErrorUserNotFound, authorization.ErrorRefreshTokenReused,
+			authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
+			return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	return tokens, nil
+}
+
+// isRegisteredRedirectURI compares the URIs as strings, without any normalization (RFC 6749, section 3.1.2.3)
+func isRegisteredRedirectURI(client model.OauthClient, redirectURI string) bool {
+	for _, registeredRedirectURI := range client.RedirectURIs {
+		if registeredRedirectURI == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// oauthRedirectURI adds the non-empty params to the query of the registered redirect URI
+func oauthRedirectURI(redirectURI string, params map[string]string) string {
+
+	uri, err := url.Parse(redirectURI)
+	if err != nil {
+		// The registered redirect URIs are validated by the repository
+		return redirectURI
+	}
+
+	query := uri.Query()
+	for key, value := range params {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	uri.RawQuery = query.Encode()
+
+	return uri.String()
+}
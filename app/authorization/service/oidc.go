@@ -0,0 +1,126 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/financelime-authorization/jose"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	oidcScopeOpenID = "openid"
+	// The column of the authorization code limits the nonce
+	oidcNonceMaxLength = 255
+)
+
+// GetOpenIDConfiguration returns the metadata published at /.well-known/openid-configuration
+func (s *service) GetOpenIDConfiguration() model.OpenIDConfiguration {
+
+	grantTypes := []string{oauthGrantTypeAuthorizationCode, oauthGrantTypeRefreshToken, oauthGrantTypeClientCredentials,
+		oauthGrantTypeDeviceCode, oauthGrantTypeTokenExchange}
+
+	return model.OpenIDConfiguration{
+		Issuer: s.config.OidcIssuer,
+		// The consent page of the PWA, it forwards the authorization request to the API
+		AuthorizationEndpoint:             "https://" + s.config.DomainAPP + "/oauth/authorize",
+		TokenEndpoint:                     s.config.OidcIssuer + "/oauth/token",
+		UserinfoEndpoint:                  s.config.OidcIssuer + "/oauth/userinfo",
+		IntrospectionEndpoint:             s.config.OidcIssuer + "/oauth/introspect",
+		RevocationEndpoint:                s.config.OidcIssuer + "/oauth/revoke",
+		DeviceAuthorizationEndpoint:       s.config.OidcIssuer + "/oauth/device_authorization",
+		JwksURI:                           s.config.OidcIssuer + "/.well-known/jwks.json",
+		ScopesSupported:                   []string{oidcScopeOpenID},
+		ResponseTypesSupported:            []string{oauthResponseTypeCode},
+		GrantTypesSupported:               grantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{s.idTokenSigner.Algorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{oauthCodeChallengeMethodS256},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "nonce", "email", "email_verified"},
+	}
+}
+
+// GetJwks returns the public keys of the ID tokens and the asymmetric access tokens, published at /.well-known/jwks.json
+func (s *service) GetJwks() jose.JSONWebKeySet {
+	return s.publicKeys.KeySet()
+}
+
+// GetUserInfo returns the claims about the user of the access token (OpenID Connect Core 1.0, section 5.3)
+func (s *service) GetUserInfo(ctx context.Context, logger *zap.Logger, accessTokenData []byte) (model.UserInfo, error) {
+
+	var user model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.UserInfo{}, err
+	}
+
+	err = json.Unmarshal(accessTokenData, &user)
+	if err != nil {
+		logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return model.UserInfo{}, err
+	}
+
+	// The email in the token may be outdated
+	user, err = s.repository.GetUserByID(ctx, logger, user.ID)
+	if err != nil {
+		logger.Error("failed to get the user", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.UserInfo{}, err
+	}
+
+	return model.UserInfo{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Email:   user.Email,
+		// The user is created only after the email has been confirmed
+		EmailVerified: true,
+	}, nil
+}
+
+func (s *service) createIDToken(ctx context.Context, logger *zap.Logger, user model.User, clientID string,
+	nonce string) (string, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return "", err
+	}
+
+	now := time.Now().UTC()
+
+	idToken, err := s.idTokenSigner.Sign(model.IDTokenClaims{
+		Issuer:        s.config.OidcIssuer,
+		Subject:       strconv.FormatInt(user.ID, 10),
+		Audience:      clientID,
+		ExpiresAt:     now.Add(time.Duration(s.config.AccessTokenLifetime) * time.Second).Unix(),
+		IssuedAt:      now.Unix(),
+		Nonce:         nonce,
+		Email:         user.Email,
+		EmailVerified: true,
+	})
+	if err != nil {
+		logger.DPanic("failed to sign the ID token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return "", err
+	}
+
+	return idToken, nil
+}
+
+// hasScope checks the space-separated list of scopes (RFC 6749, section 3.3)
+func hasScope(scopes string, scope string) bool {
+	for _, value := range strings.Fields(scopes) {
+		if value == scope {
+			return true
+		}
+	}
+	return false
+}
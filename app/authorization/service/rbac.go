@@ -0,0 +1,111 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+)
+
+func (s *service) GetListRoles(ctx context.Context, logger *zap.Logger) ([]model.Role, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	roles, err := s.repository.GetListRoles(ctx, logger)
+	if err != nil {
+		logger.Error("failed to get the list of the roles", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// AssignUserRole grants the role to the user, the access token gets its permissions on the next refresh
+func (s *service) AssignUserRole(ctx context.Context, logger *zap.Logger, param model.ServiceUserRoleParam) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	err = s.repository.AssignUserRole(ctx, logger, model.RepoUserRoleParam{
+		UserID: param.UserID,
+		Role:   param.Role})
+	if err != nil {
+		logger.Error("failed to assign the role", zap.Error(err), zap.Int64("userID", param.UserID),
+			zap.String("role", param.Role), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	logger.Info("the role has been assigned", zap.Int64("userID", param.UserID), zap.String("role", param.Role),
+		zap.String(requestIDKey, requestID))
+
+	return nil
+}
+
+// RevokeUserRole takes the role away from the user, the access tokens already issued keep its permissions
+// until they expire
+func (s *service) RevokeUserRole(ctx context.Context, logger *zap.Logger, param model.ServiceUserRoleParam) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	err = s.repository.RevokeUserRole(ctx, logger, model.RepoUserRoleParam{
+		UserID: param.UserID,
+		Role:   param.Role})
+	if err != nil {
+		logger.Error("failed to revoke the role", zap.Error(err), zap.Int64("userID", param.UserID),
+			zap.String("role", param.Role), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	logger.Info("the role has been revoked", zap.Int64("userID", param.UserID), zap.String("role", param.Role),
+		zap.String(requestIDKey, requestID))
+
+	return nil
+}
+
+// loadUserAccess sets the current roles and permissions of the user, they go to the token data and the claims.
+// Only the first-party session of the full access and the tokens granted the admin scope get them,
+// the tokens of the other clients never carry the roles of the user.
+func (s *service) loadUserAccess(ctx context.Context, logger *zap.Logger, user model.User,
+	scope string) (model.User, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.User{}, err
+	}
+
+	if !scopeGrantsUserAccess(scope) {
+		user.Roles, user.Permissions = nil, nil
+		return user, nil
+	}
+
+	access, err := s.repository.GetUserAccess(ctx, logger, user.ID)
+	if err != nil {
+		logger.DPanic("failed to get the roles of the user", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.User{}, err
+	}
+
+	user.Roles = access.Roles
+	user.Permissions = access.Permissions
+
+	return user, nil
+}
+
+// scopeGrantsUserAccess reports whether the token of the scope may carry the roles and the permissions
+func scopeGrantsUserAccess(scope string) bool {
+	return scope == "" || hasScope(scope, model.ScopeAdmin)
+}
@@ -0,0 +1,93 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+)
+
+// RevokeToken signs the client out with the access or refresh token (RFC 7009). The whole session is revoked,
+// so the other token of the session becomes invalid as well. The request is idempotent: an invalid token
+// or a token of an already revoked session is not an error.
+func (s *service) RevokeToken(ctx context.Context, logger *zap.Logger, param model.ServiceRevokeTokenParam) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	if param.ClientID == "" {
+		logger.Error("the client is not specified", zap.String(requestIDKey, requestID))
+		return authorization.ErrorInvalidClient
+	}
+
+	client, err := s.repository.AuthenticateOauthClient(ctx, logger, model.RepoAuthenticateOauthClientParam{
+		ClientID:     param.ClientID,
+		ClientSecret: param.ClientSecret})
+	if err != nil {
+		logger.Error("failed to authenticate the client", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorInvalidClient:
+			return err
+		default:
+			return err
+		}
+	}
+
+	if param.Token == "" {
+		logger.Error("the token is empty", zap.String(requestIDKey, requestID))
+		return authorization.ErrorInvalidRequest
+	}
+
+	// The invalid tokens are not reported, the client can't do anything about them (RFC 7009, section 2.2)
+
+	jwtData, _, ok := s.parseOauthToken(param.Token, param.TokenTypeHint)
+	if !ok {
+		logger.Info("the token to revoke is not valid", zap.String(requestIDKey, requestID))
+		return nil
+	}
+	publicSessionID := jwtData.Claims.JwtID
+
+	if isServiceAccountJwtID(publicSessionID) {
+		logger.Error("the token of the service account can't be revoked", zap.String(requestIDKey, requestID))
+		return authorization.ErrorUnsupportedTokenType
+	}
+
+	// The exchanged token expires on its own or with the session of the subject token
+	if isExchangedJwtID(publicSessionID) {
+		logger.Error("the exchanged token can't be revoked", zap.String(requestIDKey, requestID))
+		return authorization.ErrorUnsupportedTokenType
+	}
+
+	session, err := s.repository.GetActiveSession(ctx, logger, publicSessionID)
+	if err != nil {
+		switch err {
+		case authorization.ErrorSessionNotFound:
+			logger.Info("the session of the token has already been revoked", zap.String(requestIDKey, requestID))
+			return nil
+		default:
+			return err
+		}
+	}
+
+	// The client may only revoke its own tokens (RFC 7009, section 2.1)
+
+	if session.ClientID != client.ClientID {
+		logger.Error("the token was issued to another client", zap.String("clientID", client.ClientID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorUnauthorizedClient
+	}
+
+	err = s.revokeSession(ctx, logger, session.UserID, publicSessionID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
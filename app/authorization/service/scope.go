@@ -0,0 +1,111 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/financelime-authorization/jose"
+	"github.com/dmalix/jwt"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// accessClaimsJwt is the token with the aud, scope, roles and permissions claims in the clear and the lifetime
+// of the client, the jose tokens implement it
+type accessClaimsJwt interface {
+	CreateWithAccessClaims(claims jwt.Claims, accessClaims jose.AccessClaims) (string, error)
+}
+
+// lifetimeJwt is the token with the lifetime of the client, the HMAC tokens implement it. They have no room
+// for the access claims, the scope, the audience, the roles and the permissions are in the encrypted token data.
+type lifetimeJwt interface {
+	CreateWithLifetime(claims jwt.Claims, lifetime int) (string, error)
+}
+
+// createAccessToken signs the access token with the access claims and the lifetime of the client if the token
+// supports them. It returns the lifetime of the signed token.
+func (s *service) createAccessToken(claims jwt.Claims, accessClaims jose.AccessClaims) (string, int, error) {
+
+	var accessToken string
+	var err error
+
+	switch token := s.jwtAccess.(type) {
+	case accessClaimsJwt:
+		accessToken, err = token.CreateWithAccessClaims(claims, accessClaims)
+	case lifetimeJwt:
+		accessToken, err = token.CreateWithLifetime(claims, accessClaims.Lifetime)
+	default:
+		accessToken, err = s.jwtAccess.Create(claims)
+		return accessToken, s.config.AccessTokenLifetime, err
+	}
+	if err != nil || accessClaims.Lifetime <= 0 {
+		return accessToken, s.config.AccessTokenLifetime, err
+	}
+
+	return accessToken, accessClaims.Lifetime, nil
+}
+
+// createRefreshToken signs the refresh token with the lifetime of the client or of the session
+// if the token supports it
+func (s *service) createRefreshToken(claims jwt.Claims, lifetime int) (string, error) {
+
+	if lifetime > 0 {
+		switch token := s.jwtRefresh.(type) {
+		case accessClaimsJwt:
+			return token.CreateWithAccessClaims(claims, jose.AccessClaims{Lifetime: lifetime})
+		case lifetimeJwt:
+			return token.CreateWithLifetime(claims, lifetime)
+		}
+	}
+
+	return s.jwtRefresh.Create(claims)
+}
+
+// grantClientScope returns the scopes the client gets on the log in. The requested scopes must be registered
+// for the client, all of them are granted if none is requested.
+func (s *service) grantClientScope(ctx context.Context, logger *zap.Logger, client model.OauthClient,
+	requestedScope string) (string, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return "", err
+	}
+
+	if requestedScope == "" {
+		return client.Scope, nil
+	}
+
+	for _, value := range strings.Fields(requestedScope) {
+		if !hasScope(client.Scope, value) {
+			logger.Error("the scope is not registered for the client", zap.String("scope", value),
+				zap.String("clientID", client.ClientID), zap.String(requestIDKey, requestID))
+			return "", authorization.ErrorInvalidScope
+		}
+	}
+
+	return strings.Join(strings.Fields(requestedScope), " "), nil
+}
+
+// filterClientScope keeps openid and the scopes registered for the client, the others are ignored
+// (RFC 6749, section 3.3), the authorization request is not rejected because of them. The empty scope is
+// the full access of the first-party session, so the client that is granted nothing gets openid.
+func filterClientScope(requestedScope string, client model.OauthClient) string {
+
+	var scopes []string
+
+	for _, value := range strings.Fields(requestedScope) {
+		if (value == oidcScopeOpenID || hasScope(client.Scope, value)) && !hasScope(strings.Join(scopes, " "), value) {
+			scopes = append(scopes, value)
+		}
+	}
+	if len(scopes) == 0 {
+		return oidcScopeOpenID
+	}
+
+	return strings.Join(scopes, " ")
+}
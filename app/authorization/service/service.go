@@ -11,6 +11,8 @@ import (
 	"github.com/dmalix/financelime-authorization/app/authorization"
 	"github.com/dmalix/financelime-authorization/app/authorization/model"
 	"github.com/dmalix/financelime-authorization/config"
+	"github.com/dmalix/financelime-authorization/jose"
+	"github.com/dmalix/financelime-authorization/revocation"
 	"github.com/dmalix/jwt"
 	"github.com/dmalix/middleware"
 	"github.com/dmalix/requestid"
@@ -18,8 +20,8 @@ import (
 	"github.com/dmalix/sendmail"
 	"github.com/dmalix/utils/generate"
 	"go.uber.org/zap"
-	"log"
 	"net/mail"
+	"strings"
 	"time"
 )
 
@@ -32,8 +34,12 @@ type service struct {
 	repository      authorization.Repository
 	dataAccess      secretdata.SecretData
 	dataRefresh     secretdata.SecretData
+	dataMfa         secretdata.SecretData
 	jwtAccess       jwt.Jwt
 	jwtRefresh      jwt.Jwt
+	revocationStore revocation.Store
+	idTokenSigner   jose.Signer
+	publicKeys      jose.KeySource
 }
 
 func NewService(
@@ -45,8 +51,12 @@ func NewService(
 	repository authorization.Repository,
 	dataAccess secretdata.SecretData,
 	dataRefresh secretdata.SecretData,
+	dataMfa secretdata.SecretData,
 	jwtAccess jwt.Jwt,
-	jwtRefresh jwt.Jwt) *service {
+	jwtRefresh jwt.Jwt,
+	revocationStore revocation.Store,
+	idTokenSigner jose.Signer,
+	publicKeys jose.KeySource) *service {
 	return &service{
 		config:          config,
 		contextGetter:   contextGetter,
@@ -56,19 +66,17 @@ func NewService(
 		repository:      repository,
 		dataAccess:      dataAccess,
 		dataRefresh:     dataRefresh,
+		dataMfa:         dataMfa,
 		jwtAccess:       jwtAccess,
 		jwtRefresh:      jwtRefresh,
+		revocationStore: revocationStore,
+		idTokenSigner:   idTokenSigner,
+		publicKeys:      publicKeys,
 	}
 }
 
 func (s *service) SignUpStep1(ctx context.Context, logger *zap.Logger, param model.ServiceSignUpParam) error {
 
-	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
-	if err != nil {
-		logger.DPanic("failed to get RemoteAddr", zap.Error(err))
-		return err
-	}
-
 	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
 	if err != nil {
 		logger.DPanic("failed to get requestID", zap.Error(err))
@@ -100,6 +108,24 @@ func (s *service) SignUpStep1(ctx context.Context, logger *zap.Logger, param mod
 		}
 	}
 
+	return s.sendSignUpConfirmation(ctx, logger, model.User{Email: param.Email, Language: param.Language}, confirmationKey)
+}
+
+// sendSignUpConfirmation sends the link with the confirmation key of the sign-up to the user
+func (s *service) sendSignUpConfirmation(ctx context.Context, logger *zap.Logger, user model.User, confirmationKey string) error {
+
+	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
+	if err != nil {
+		logger.DPanic("failed to get RemoteAddr", zap.Error(err))
+		return err
+	}
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
 	newRequestID, err := requestid.Create(false)
 	if err != nil {
 		logger.DPanic("failed to generate requestID", zap.Error(err), zap.String(requestIDKey, requestID))
@@ -114,10 +140,10 @@ func (s *service) SignUpStep1(ctx context.Context, logger *zap.Logger, param mod
 			RequestID:     requestID,
 			RequestIDKey:  requestIDKey},
 		sendmail.Email{
-			To:      mail.Address{Address: param.Email},
-			Subject: s.languageContent.Data.User.Signup.Email.Request.Subject[s.languageContent.Language[param.Language]],
+			To:      mail.Address{Address: user.Email},
+			Subject: s.languageContent.Data.User.Signup.Email.Request.Subject[s.languageContent.Language[user.Language]],
 			Body: fmt.Sprintf(
-				s.languageContent.Data.User.Signup.Email.Request.Body[s.languageContent.Language[param.Language]],
+				s.languageContent.Data.User.Signup.Email.Request.Body[s.languageContent.Language[user.Language]],
 				s.config.DomainAPI, confirmationKey, newRequestID),
 			MessageID: fmt.Sprintf(
 				"<%s@%s>",
@@ -133,12 +159,6 @@ func (s *service) SignUpStep1(ctx context.Context, logger *zap.Logger, param mod
 
 func (s *service) SignUpStep2(ctx context.Context, logger *zap.Logger, confirmationKey string) (string, error) {
 
-	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
-	if err != nil {
-		logger.DPanic("failed to get RemoteAddr", zap.Error(err))
-		return "", err
-	}
-
 	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
 	if err != nil {
 		logger.DPanic("failed to get requestID", zap.Error(err))
@@ -151,13 +171,49 @@ func (s *service) SignUpStep2(ctx context.Context, logger *zap.Logger, confirmat
 		switch err {
 		case authorization.ErrorBadParamConfirmationKey:
 			return "", err
-		case authorization.ErrorConfirmationKeyNotFound, authorization.ErrorConfirmationKeyAlreadyConfirmed:
+		case authorization.ErrorConfirmationKeyNotFound:
 			return "", authorization.ErrorBadConfirmationKey
 		default:
 			return "", err
 		}
 	}
 
+	confirmationMessage := fmt.Sprintf(
+		s.languageContent.Data.User.Signup.Page.Text[s.languageContent.Language[user.Language]],
+		s.config.DomainAPP, confirmationKey)
+
+	return confirmationMessage, nil
+}
+
+func (s *service) SignUpStep3(ctx context.Context, logger *zap.Logger, param model.ServiceSetPasswordParam) error {
+
+	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
+	if err != nil {
+		logger.DPanic("failed to get RemoteAddr", zap.Error(err))
+		return err
+	}
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	user, err := s.repository.SignUpStep3(ctx, logger, model.RepoSetPasswordParam{
+		ConfirmationKey: param.ConfirmationKey,
+		Password:        param.Password})
+	if err != nil {
+		logger.Error("failed to complete the sign up", zap.String(requestIDKey, requestID), zap.Error(err))
+		switch err {
+		case authorization.ErrorBadParamConfirmationKey, authorization.ErrorBadParamPassword:
+			return err
+		case authorization.ErrorConfirmationKeyNotFound, authorization.ErrorConfirmationKeyAlreadyConfirmed:
+			return authorization.ErrorBadConfirmationKey
+		default:
+			return err
+		}
+	}
+
 	err = s.sendmailManager.AddMessageToQueue(
 		s.sendmailQueue,
 		sendmail.Request{
@@ -168,35 +224,41 @@ func (s *service) SignUpStep2(ctx context.Context, logger *zap.Logger, confirmat
 		},
 		sendmail.Email{
 			To:      mail.Address{Address: user.Email},
-			Subject: s.languageContent.Data.User.Signup.Email.Password.Subject[s.languageContent.Language[user.Language]],
-			Body: fmt.Sprintf(
-				s.languageContent.Data.User.Signup.Email.Password.Body[s.languageContent.Language[user.Language]],
-				user.Password),
+			Subject: s.languageContent.Data.User.Signup.Email.Complete.Subject[s.languageContent.Language[user.Language]],
+			Body:    s.languageContent.Data.User.Signup.Email.Complete.Body[s.languageContent.Language[user.Language]],
 			MessageID: fmt.Sprintf(
 				"<%s@%s>",
-				user.Password,
-				fmt.Sprintf("%s.%s", "confirm-user-email", s.config.DomainAPI))})
+				param.ConfirmationKey,
+				fmt.Sprintf("%s.%s", "complete-sign-up", s.config.DomainAPI))})
 	if err != nil {
 		logger.DPanic("failed to send message to the user", zap.String(requestIDKey, requestID), zap.Error(err))
-		return "", err
+		return err
 	}
 
-	confirmationMessage := s.languageContent.Data.User.Signup.Page.Text[s.languageContent.Language[user.Language]]
-
-	return confirmationMessage, nil
+	return nil
 }
 
 func (s *service) CreateAccessToken(ctx context.Context, logger *zap.Logger,
 	param model.ServiceCreateAccessTokenParam) (model.ServiceAccessTokenReturn, error) {
 
-	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
 	if err != nil {
-		logger.DPanic("failed to get remoteAddr", zap.Error(err))
+		logger.DPanic("failed to get requestID", zap.Error(err))
 		return model.ServiceAccessTokenReturn{}, err
 	}
-	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+
+	// The client and the scope are checked before the password, the client learns nothing about the user
+	// from the error
+
+	client, err := s.getClientForGrant(ctx, logger, param.ClientID, model.OauthGrantTypePassword)
 	if err != nil {
-		logger.DPanic("failed to get requestID", zap.Error(err))
+		logger.Error("the client is not allowed to log in the users", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	param.Scope, err = s.grantClientScope(ctx, logger, client, param.Scope)
+	if err != nil {
+		logger.Error("failed to grant the scope", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, err
 	}
 
@@ -211,23 +273,60 @@ func (s *service) CreateAccessToken(ctx context.Context, logger *zap.Logger,
 			return model.ServiceAccessTokenReturn{}, authorization.ErrorBadParams
 		case authorization.ErrorUserNotFound:
 			return model.ServiceAccessTokenReturn{}, err
+		case authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
+			return model.ServiceAccessTokenReturn{}, err
 		default:
 			return model.ServiceAccessTokenReturn{}, err
 		}
 	}
 
+	// The tokens are issued after the second factor if the user has enabled it
+
+	totp, err := s.repository.GetTotp(ctx, logger, user.ID)
+	if err != nil && err != authorization.ErrorMfaNotFound {
+		logger.DPanic("failed to get the TOTP of the user", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+	if err == nil && totp.ConfirmedAt != nil {
+		return s.createMfaChallenge(ctx, logger, user, param)
+	}
+
+	return s.createSession(ctx, logger, user, client, param)
+}
+
+// createSession issues the tokens of the client to the user who has passed all the authentication factors,
+// the tokens have the audience and the lifetimes of the client registration
+func (s *service) createSession(ctx context.Context, logger *zap.Logger, user model.User, client model.OauthClient,
+	param model.ServiceCreateAccessTokenParam) (model.ServiceAccessTokenReturn, error) {
+
+	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
+	if err != nil {
+		logger.DPanic("failed to get remoteAddr", zap.Error(err))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
 	publicSessionID, err := generate.PublicID(user.ID)
 	if err != nil {
 		logger.DPanic("failed to generate the publicSessionID", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, err
 	}
+	user, err = s.loadUserAccess(ctx, logger, user, param.Scope)
+	if err != nil {
+		return model.ServiceAccessTokenReturn{}, err
+	}
+	user.Scope = param.Scope
+	user.Audience = client.Audience
 	userData, err := json.Marshal(user)
 	if err != nil {
 		logger.DPanic("failed to marshal the user struct", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, err
 	}
 	encryptedAccessTokenData, err := s.dataAccess.Encrypt(userData)
-	log.Println("TEST1", encryptedAccessTokenData)
 	if err != nil {
 		logger.DPanic("failed to marshal the user struct", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, err
@@ -239,19 +338,30 @@ func (s *service) CreateAccessToken(ctx context.Context, logger *zap.Logger,
 		return model.ServiceAccessTokenReturn{}, err
 	}
 
-	accessToken, err := s.jwtAccess.Create(jwt.Claims{
+	accessToken, expiresIn, err := s.createAccessToken(jwt.Claims{
 		JwtID: publicSessionID,
 		Data:  encryptedAccessTokenData,
-	})
+	}, jose.AccessClaims{
+		Audience:    client.Audience,
+		Scope:       param.Scope,
+		Roles:       user.Roles,
+		Permissions: user.Permissions,
+		Lifetime:    client.AccessTokenLifetime})
 	if err != nil {
 		logger.DPanic("failed to generate an access token", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, err
 	}
 
-	refreshToken, err := s.jwtRefresh.Create(jwt.Claims{
+	idleTimeout, maxAge := s.sessionPolicy(client, param.RememberMe)
+	var expiresAt time.Time
+	if maxAge > 0 {
+		expiresAt = time.Now().Add(time.Duration(maxAge) * time.Second)
+	}
+
+	refreshToken, err := s.createRefreshToken(jwt.Claims{
 		JwtID: publicSessionID,
 		Data:  encryptedRefreshTokenData,
-	})
+	}, sessionRefreshTokenLifetime(idleTimeout, expiresAt))
 	if err != nil {
 		logger.DPanic("failed to generate an refresh token", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, err
@@ -261,9 +371,14 @@ func (s *service) CreateAccessToken(ctx context.Context, logger *zap.Logger,
 		UserID:          user.ID,
 		PublicSessionID: publicSessionID,
 		RefreshToken:    refreshToken,
-		ClientID:        param.ClientID,
+		TokenFamily:     publicSessionID,
+		ClientID:        client.ClientID,
+		Scope:           param.Scope,
 		UserAgent:       param.UserAgent,
-		Device:          param.Device})
+		Device:          param.Device,
+		IdleTimeout:     idleTimeout,
+		MaxAge:          maxAge,
+		RememberMe:      param.RememberMe})
 	if err != nil {
 		logger.DPanic("failed to create session", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, err
@@ -277,7 +392,7 @@ func (s *service) CreateAccessToken(ctx context.Context, logger *zap.Logger,
 			RequestID:     requestID,
 			RequestIDKey:  requestIDKey},
 		sendmail.Email{
-			To:      mail.Address{Address: param.Email},
+			To:      mail.Address{Address: user.Email},
 			Subject: s.languageContent.Data.User.Login.Email.Subject[s.languageContent.Language[user.Language]],
 			Body: fmt.Sprintf(
 				s.languageContent.Data.User.Login.Email.Body[s.languageContent.Language[user.Language]],
@@ -298,11 +413,17 @@ func (s *service) CreateAccessToken(ctx context.Context, logger *zap.Logger,
 	return model.ServiceAccessTokenReturn{
 		PublicSessionID: publicSessionID,
 		AccessJWT:       accessToken,
-		RefreshJWT:      refreshToken}, nil
+		RefreshJWT:      refreshToken,
+		ExpiresIn:       expiresIn,
+		Scope:           param.Scope}, nil
 }
 
+// RefreshAccessToken rotates the refresh token of the active session and issues the new tokens,
+// the reuse of a rotated refresh token revokes the whole token family
 func (s *service) RefreshAccessToken(ctx context.Context, logger *zap.Logger,
-	refreshToken string) (model.ServiceAccessTokenReturn, error) {
+	param model.ServiceRefreshAccessTokenParam) (model.ServiceAccessTokenReturn, error) {
+
+	refreshToken := param.RefreshToken
 
 	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
 	if err != nil {
@@ -310,20 +431,21 @@ func (s *service) RefreshAccessToken(ctx context.Context, logger *zap.Logger,
 		return model.ServiceAccessTokenReturn{}, err
 	}
 
-	jwtData, parseCodeError, err := s.jwtAccess.Parse(refreshToken)
+	jwtData, parseCodeError, err := s.jwtRefresh.Parse(refreshToken)
 	if err != nil {
 		logger.Error("failed to verify the refresh token", zap.Error(err),
-			zap.String("refreshToken", refreshToken),
 			zap.String("parseCodeError", parseCodeError),
 			zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, authorization.ErrorBadRefreshToken
 	}
 
 	user, err := s.repository.GetUserByRefreshToken(ctx, logger, refreshToken)
-	logger.Error("failed to refresh the access token", zap.Error(err), zap.String(requestIDKey, requestID))
 	if err != nil {
+		logger.Error("failed to get the user by the refresh token", zap.Error(err), zap.String(requestIDKey, requestID))
 		switch err {
 		case authorization.ErrorUserNotFound:
+			return model.ServiceAccessTokenReturn{}, s.detectRefreshTokenReuse(ctx, logger, refreshToken, err)
+		case authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
 			return model.ServiceAccessTokenReturn{}, err
 		default:
 			return model.ServiceAccessTokenReturn{}, err
@@ -332,31 +454,100 @@ func (s *service) RefreshAccessToken(ctx context.Context, logger *zap.Logger,
 
 	publicSessionID := jwtData.Claims.JwtID
 
+	session, err := s.repository.GetActiveSession(ctx, logger, publicSessionID)
+	if err != nil {
+		logger.Error("failed to get the session", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorSessionNotFound:
+			return model.ServiceAccessTokenReturn{}, authorization.ErrorUserNotFound
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	// The scope of the session with the full access is empty, it can be narrowed by the token exchange only
+
+	scope := session.Scope
+	if param.Scope != "" {
+		for _, value := range strings.Fields(param.Scope) {
+			if !hasScope(session.Scope, value) {
+				logger.Error("the scope exceeds the scope of the session", zap.String("scope", value),
+					zap.String(requestIDKey, requestID))
+				return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidScope
+			}
+		}
+		scope = strings.Join(strings.Fields(param.Scope), " ")
+	}
+
+	// The client may have been disabled or lost the grant since the log in
+
+	client, err := s.getClientForGrant(ctx, logger, session.ClientID, model.OauthGrantTypeRefreshToken)
+	if err != nil {
+		logger.Error("the client is not allowed to refresh the tokens", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	user, err = s.loadUserAccess(ctx, logger, user, session.Scope)
+	if err != nil {
+		return model.ServiceAccessTokenReturn{}, err
+	}
+	user.Scope = session.Scope
+	user.Audience = client.Audience
 	sourceUserData, err := json.Marshal(user)
 	if err != nil {
 		logger.DPanic("failed to marshal the user struct", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, err
 	}
 
-	encryptedUserData, err := s.dataAccess.Encrypt(sourceUserData)
+	// The narrowed scope may have lost the admin scope
+
+	user.Scope = scope
+	if !scopeGrantsUserAccess(scope) {
+		user.Roles, user.Permissions = nil, nil
+	}
+	accessUserData, err := json.Marshal(user)
+	if err != nil {
+		logger.DPanic("failed to marshal the user struct", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	encryptedAccessTokenData, err := s.dataAccess.Encrypt(accessUserData)
 	if err != nil {
 		logger.DPanic("failed to encrypt the user data", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, err
 	}
 
-	jwtAccess, err := s.jwtAccess.Create(jwt.Claims{
+	encryptedRefreshTokenData, err := s.dataRefresh.Encrypt(sourceUserData)
+	if err != nil {
+		logger.DPanic("failed to encrypt the user data", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	jwtAccess, expiresIn, err := s.createAccessToken(jwt.Claims{
 		JwtID: publicSessionID,
-		Data:  encryptedUserData,
-	})
+		Data:  encryptedAccessTokenData,
+	}, jose.AccessClaims{
+		Audience:    client.Audience,
+		Scope:       scope,
+		Roles:       user.Roles,
+		Permissions: user.Permissions,
+		Lifetime:    client.AccessTokenLifetime})
 	if err != nil {
 		logger.DPanic("failed to create an access token (JWT)", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, err
 	}
 
-	jwtRefresh, err := s.jwtRefresh.Create(jwt.Claims{
+	// The session keeps the policy of the log in, the client may have changed the lifetime since then
+
+	var sessionExpiresAt time.Time
+	if session.ExpiresAt != nil {
+		sessionExpiresAt = *session.ExpiresAt
+	}
+
+	jwtRefresh, err := s.createRefreshToken(jwt.Claims{
 		JwtID: publicSessionID,
-		Data:  encryptedUserData,
-	})
+		Data:  encryptedRefreshTokenData,
+	}, sessionRefreshTokenLifetime(session.IdleTimeout, sessionExpiresAt))
 	if err != nil {
 		logger.DPanic("failed to create an refresh token (JWT)", zap.Error(err), zap.String(requestIDKey, requestID))
 		return model.ServiceAccessTokenReturn{}, err
@@ -365,16 +556,87 @@ func (s *service) RefreshAccessToken(ctx context.Context, logger *zap.Logger,
 	err = s.repository.UpdateSession(ctx, logger, model.RepoUpdateSessionParam{
 		PublicSessionID: publicSessionID,
 		RefreshToken:    refreshToken,
+		NewRefreshToken: jwtRefresh,
 	})
 	if err != nil {
-		logger.DPanic("failed to update the session", zap.Error(err), zap.String(requestIDKey, requestID))
-		return model.ServiceAccessTokenReturn{}, err
+		logger.Error("failed to update the session", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorSessionNotFound:
+			// Another request has rotated the same token first
+			return model.ServiceAccessTokenReturn{}, s.detectRefreshTokenReuse(ctx, logger, refreshToken, err)
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
 	}
 
 	return model.ServiceAccessTokenReturn{
 		PublicSessionID: publicSessionID,
 		AccessJWT:       jwtAccess,
-		RefreshJWT:      jwtRefresh}, nil
+		RefreshJWT:      jwtRefresh,
+		ExpiresIn:       expiresIn,
+		Scope:           scope}, nil
+}
+
+// detectRefreshTokenReuse revokes the token family if the refresh token has already been rotated and warns the user.
+// Otherwise, the token is simply unknown and the notFoundError is returned.
+func (s *service) detectRefreshTokenReuse(ctx context.Context, logger *zap.Logger, refreshToken string, notFoundError error) error {
+
+	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
+	if err != nil {
+		logger.DPanic("failed to get remoteAddr", zap.Error(err))
+		return err
+	}
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	user, publicSessionIDs, err := s.repository.RevokeRefreshTokenFamily(ctx, logger, refreshToken)
+	if err != nil {
+		switch err {
+		case authorization.ErrorSessionNotFound:
+			return notFoundError
+		default:
+			logger.DPanic("failed to revoke the token family", zap.Error(err), zap.String(requestIDKey, requestID))
+			return err
+		}
+	}
+
+	err = s.revokeAccessTokens(ctx, logger, publicSessionIDs)
+	if err != nil {
+		return err
+	}
+
+	newRequestID, err := requestid.Create(false)
+	if err != nil {
+		logger.DPanic("failed to generate requestID", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = s.sendmailManager.AddMessageToQueue(
+		s.sendmailQueue,
+		sendmail.Request{
+			RemoteAddr:    remoteAddr,
+			RemoteAddrKey: remoteAddrKey,
+			RequestID:     requestID,
+			RequestIDKey:  requestIDKey},
+		sendmail.Email{
+			To:      mail.Address{Address: user.Email},
+			Subject: s.languageContent.Data.User.RefreshTokenReuse.Email.Subject[s.languageContent.Language[user.Language]],
+			Body: fmt.Sprintf(
+				s.languageContent.Data.User.RefreshTokenReuse.Email.Body[s.languageContent.Language[user.Language]],
+				remoteAddr, s.config.DomainAPP),
+			MessageID: fmt.Sprintf(
+				"<%s@%s>",
+				newRequestID,
+				fmt.Sprintf("%s.%s", "refresh-token-reuse", s.config.DomainAPI))})
+	if err != nil {
+		logger.DPanic("failed to add an email message to the queue", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return authorization.ErrorRefreshTokenReused
 }
 
 func (s *service) RevokeRefreshToken(ctx context.Context, logger *zap.Logger, param model.ServiceRevokeRefreshTokenParam) error {
@@ -393,14 +655,259 @@ func (s *service) RevokeRefreshToken(ctx context.Context, logger *zap.Logger, pa
 		return err
 	}
 
+	return s.revokeSession(ctx, logger, user.ID, param.PublicSessionID)
+}
+
+// revokeSession deletes the session and revokes its access token
+func (s *service) revokeSession(ctx context.Context, logger *zap.Logger, userID int64, publicSessionID string) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
 	err = s.repository.DeleteSession(ctx, logger, model.RepoDeleteSessionParam{
-		UserID:          user.ID,
-		PublicSessionID: param.PublicSessionID})
+		UserID:          userID,
+		PublicSessionID: publicSessionID})
 	if err != nil {
 		logger.DPanic("failed to delete the session", zap.Error(err), zap.String(requestIDKey, requestID))
 		return err
 	}
 
+	// The access token of the session stays valid until it expires, so it's revoked explicitly
+
+	err = s.revokeAccessTokens(ctx, logger, []string{publicSessionID})
+	if err != nil {
+		logger.DPanic("failed to revoke the access token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+// RevokeAllSessions signs the user out everywhere or, if the current session is excepted, on the other devices
+func (s *service) RevokeAllSessions(ctx context.Context, logger *zap.Logger, param model.ServiceRevokeAllSessionsParam) error {
+
+	var user model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	err = json.Unmarshal(param.AccessTokenData, &user)
+	if err != nil {
+		logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = s.revokeUserSessions(ctx, logger, user, param.ExceptPublicSessionID)
+	if err != nil {
+		logger.DPanic("failed to revoke the sessions", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+// deleteUserSessions deletes the sessions of the user and revokes their access tokens without notifying the user
+func (s *service) deleteUserSessions(ctx context.Context, logger *zap.Logger, userID int64, exceptPublicSessionID string) ([]string, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	publicSessionIDs, err := s.repository.DeleteUserSessions(ctx, logger, model.RepoDeleteUserSessionsParam{
+		UserID:                userID,
+		ExceptPublicSessionID: exceptPublicSessionID})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.revokeAccessTokens(ctx, logger, publicSessionIDs)
+	if err != nil {
+		logger.DPanic("failed to revoke the access tokens", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	return publicSessionIDs, nil
+}
+
+// revokeAccessTokens rejects the access tokens of the deleted sessions until they expire
+func (s *service) revokeAccessTokens(ctx context.Context, logger *zap.Logger, publicSessionIDs []string) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	if len(publicSessionIDs) == 0 {
+		return nil
+	}
+
+	lifetime, err := s.maxAccessTokenLifetime(ctx, logger)
+	if err != nil {
+		logger.DPanic("failed to get the lifetime of the access tokens", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	for _, publicSessionID := range publicSessionIDs {
+		err = s.revocationStore.Revoke(ctx, publicSessionID, time.Duration(lifetime)*time.Second)
+		if err != nil {
+			logger.DPanic("failed to revoke the access token", zap.Error(err), zap.String(requestIDKey, requestID))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// maxAccessTokenLifetime is the longest lifetime of the access tokens in seconds, the lifetime of the config
+// or of a client. The revocation lasts that long, so the revoked token expires before it's forgotten.
+func (s *service) maxAccessTokenLifetime(ctx context.Context, logger *zap.Logger) (int, error) {
+
+	lifetime, err := s.repository.GetMaxAccessTokenLifetime(ctx, logger)
+	if err != nil {
+		return 0, err
+	}
+	if s.config.AccessTokenLifetime > lifetime {
+		lifetime = s.config.AccessTokenLifetime
+	}
+
+	return lifetime, nil
+}
+
+// revokeUserSessions deletes the sessions, revokes their access tokens and notifies the user
+func (s *service) revokeUserSessions(ctx context.Context, logger *zap.Logger, user model.User, exceptPublicSessionID string) error {
+
+	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
+	if err != nil {
+		logger.DPanic("failed to get remoteAddr", zap.Error(err))
+		return err
+	}
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	publicSessionIDs, err := s.deleteUserSessions(ctx, logger, user.ID, exceptPublicSessionID)
+	if err != nil {
+		return err
+	}
+	if len(publicSessionIDs) == 0 {
+		return nil
+	}
+
+	newRequestID, err := requestid.Create(false)
+	if err != nil {
+		logger.DPanic("failed to generate requestID", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = s.sendmailManager.AddMessageToQueue(
+		s.sendmailQueue,
+		sendmail.Request{
+			RemoteAddr:    remoteAddr,
+			RemoteAddrKey: remoteAddrKey,
+			RequestID:     requestID,
+			RequestIDKey:  requestIDKey},
+		sendmail.Email{
+			To:      mail.Address{Address: user.Email},
+			Subject: s.languageContent.Data.User.RevokeSessions.Email.Subject[s.languageContent.Language[user.Language]],
+			Body: fmt.Sprintf(
+				s.languageContent.Data.User.RevokeSessions.Email.Body[s.languageContent.Language[user.Language]],
+				len(publicSessionIDs), remoteAddr, s.config.DomainAPP),
+			MessageID: fmt.Sprintf(
+				"<%s@%s>",
+				newRequestID,
+				fmt.Sprintf("%s.%s", "revoke-sessions", s.config.DomainAPI))})
+	if err != nil {
+		logger.DPanic("failed to add an email message to the queue", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+// CheckAccessTokenRevocation returns an error if the session of the access token has been revoked
+func (s *service) CheckAccessTokenRevocation(ctx context.Context, logger *zap.Logger, publicSessionID string) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	// The token of a service account carries no user, it's never accepted by the endpoints of the users
+	if isServiceAccountJwtID(publicSessionID) {
+		logger.Error("the access token of the service account is not accepted", zap.String(requestIDKey, requestID))
+		return authorization.ErrorAccessTokenRevoked
+	}
+
+	// The exchanged token is accepted by its audience only, it's not a token of this service
+	if isExchangedJwtID(publicSessionID) {
+		logger.Error("the exchanged access token is not accepted", zap.String(requestIDKey, requestID))
+		return authorization.ErrorAccessTokenRevoked
+	}
+
+	revoked, err := s.revocationStore.IsRevoked(ctx, publicSessionID)
+	if err != nil {
+		logger.DPanic("failed to check the access token revocation", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+	if revoked {
+		logger.Error("the access token has been revoked", zap.String("publicSessionID", publicSessionID),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorAccessTokenRevoked
+	}
+
+	return nil
+}
+
+// CheckUserAccessToken returns an error if the access token is not issued to the user for this API: the tokens of
+// the service accounts, the exchanged tokens and the tokens of another audience are accepted by the other services
+func (s *service) CheckUserAccessToken(ctx context.Context, logger *zap.Logger, accessTokenData []byte) error {
+
+	var user model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	err = json.Unmarshal(accessTokenData, &user)
+	if err != nil {
+		logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	switch {
+	case user.ServiceAccount != "":
+		logger.Error("the access token of the service account is not accepted",
+			zap.String("clientID", user.ServiceAccount), zap.String(requestIDKey, requestID))
+		return authorization.ErrorAccessTokenNotAccepted
+	case user.Act != nil:
+		logger.Error("the delegated access token is not accepted", zap.String("actor", user.Act.Subject),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorAccessTokenNotAccepted
+	case user.Audience != "" && user.Audience != s.config.DomainAPI:
+		logger.Error("the access token of another audience is not accepted", zap.String("audience", user.Audience),
+			zap.String(requestIDKey, requestID))
+		return authorization.ErrorAccessTokenNotAccepted
+	case user.ID == 0:
+		logger.Error("the access token has no user", zap.String(requestIDKey, requestID))
+		return authorization.ErrorAccessTokenNotAccepted
+	}
+
 	return nil
 }
 
@@ -494,12 +1001,6 @@ func (s *service) ResetUserPasswordStep1(ctx context.Context, logger *zap.Logger
 
 func (s *service) ResetUserPasswordStep2(ctx context.Context, logger *zap.Logger, confirmationKey string) (string, error) {
 
-	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
-	if err != nil {
-		logger.DPanic("failed to get RemoteAddr", zap.Error(err))
-		return "", err
-	}
-
 	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
 	if err != nil {
 		logger.DPanic("failed to get requestID", zap.Error(err))
@@ -512,14 +1013,50 @@ func (s *service) ResetUserPasswordStep2(ctx context.Context, logger *zap.Logger
 		switch err {
 		case authorization.ErrorBadParamConfirmationKey:
 			return "", err
-		case authorization.ErrorConfirmationKeyNotFound, authorization.ErrorConfirmationKeyAlreadyConfirmed,
-			authorization.ErrorUserNotFound:
+		case authorization.ErrorConfirmationKeyNotFound:
 			return "", authorization.ErrorBadConfirmationKey
 		default:
 			return "", err
 		}
 	}
 
+	confirmationMessage := fmt.Sprintf(
+		s.languageContent.Data.User.ResetPassword.Page.Text[s.languageContent.Language[user.Language]],
+		s.config.DomainAPP, confirmationKey)
+
+	return confirmationMessage, nil
+}
+
+func (s *service) ResetUserPasswordStep3(ctx context.Context, logger *zap.Logger, param model.ServiceSetPasswordParam) error {
+
+	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
+	if err != nil {
+		logger.DPanic("failed to get RemoteAddr", zap.Error(err))
+		return err
+	}
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	user, err := s.repository.ResetUserPasswordStep3(ctx, logger, model.RepoSetPasswordParam{
+		ConfirmationKey: param.ConfirmationKey,
+		Password:        param.Password})
+	if err != nil {
+		logger.Error("failed to complete the user password reset", zap.String(requestIDKey, requestID), zap.Error(err))
+		switch err {
+		case authorization.ErrorBadParamConfirmationKey, authorization.ErrorBadParamPassword:
+			return err
+		case authorization.ErrorConfirmationKeyNotFound, authorization.ErrorConfirmationKeyAlreadyConfirmed,
+			authorization.ErrorUserNotFound:
+			return authorization.ErrorBadConfirmationKey
+		default:
+			return err
+		}
+	}
+
 	err = s.sendmailManager.AddMessageToQueue(
 		s.sendmailQueue,
 		sendmail.Request{
@@ -530,20 +1067,95 @@ func (s *service) ResetUserPasswordStep2(ctx context.Context, logger *zap.Logger
 		},
 		sendmail.Email{
 			To:      mail.Address{Address: user.Email},
-			Subject: s.languageContent.Data.User.ResetPassword.Email.Password.Subject[s.languageContent.Language[user.Language]],
+			Subject: s.languageContent.Data.User.ResetPassword.Email.Complete.Subject[s.languageContent.Language[user.Language]],
 			Body: fmt.Sprintf(
-				s.languageContent.Data.User.ResetPassword.Email.Password.Body[s.languageContent.Language[user.Language]],
-				user.Password),
+				s.languageContent.Data.User.ResetPassword.Email.Complete.Body[s.languageContent.Language[user.Language]],
+				remoteAddr, s.config.DomainAPP),
 			MessageID: fmt.Sprintf(
 				"<%s@%s>",
-				user.Password,
-				fmt.Sprintf("%s.%s", "confirm-user-password-reset", s.config.DomainAPI))})
+				param.ConfirmationKey,
+				fmt.Sprintf("%s.%s", "complete-user-password-reset", s.config.DomainAPI))})
 	if err != nil {
 		logger.DPanic("failed to send message to the user", zap.String(requestIDKey, requestID), zap.Error(err))
-		return "", err
+		return err
 	}
 
-	confirmationMessage := s.languageContent.Data.User.ResetPassword.Page.Text[s.languageContent.Language[user.Language]]
+	// Whoever knew the old password could have signed in, so no session survives the reset
 
-	return confirmationMessage, nil
+	err = s.revokeUserSessions(ctx, logger, user, "")
+	if err != nil {
+		logger.DPanic("failed to revoke the sessions", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
+}
+
+func (s *service) UpdateUserPassword(ctx context.Context, logger *zap.Logger, param model.ServiceUpdateUserPasswordParam) error {
+
+	var user model.User
+
+	remoteAddr, remoteAddrKey, err := s.contextGetter.GetRemoteAddr(ctx)
+	if err != nil {
+		logger.DPanic("failed to get RemoteAddr", zap.Error(err))
+		return err
+	}
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	err = json.Unmarshal(param.AccessTokenData, &user)
+	if err != nil {
+		logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = s.repository.UpdateUserPassword(ctx, logger, model.RepoUpdateUserPasswordParam{
+		UserID:          user.ID,
+		CurrentPassword: param.CurrentPassword,
+		NewPassword:     param.NewPassword})
+	if err != nil {
+		logger.Error("failed to update the user password", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorBadParamPassword, authorization.ErrorBadCurrentPassword:
+			return err
+		default:
+			return err
+		}
+	}
+
+	newRequestID, err := requestid.Create(false)
+	if err != nil {
+		logger.DPanic("failed to generate requestID", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	err = s.sendmailManager.AddMessageToQueue(
+		s.sendmailQueue,
+		sendmail.Request{
+			RemoteAddr:    remoteAddr,
+			RemoteAddrKey: remoteAddrKey,
+			RequestID:     requestID,
+			RequestIDKey:  requestIDKey,
+		},
+		sendmail.Email{
+			To:      mail.Address{Address: user.Email},
+			Subject: s.languageContent.Data.User.ChangePassword.Email.Subject[s.languageContent.Language[user.Language]],
+			Body: fmt.Sprintf(
+				s.languageContent.Data.User.ChangePassword.Email.Body[s.languageContent.Language[user.Language]],
+				remoteAddr, s.config.DomainAPP),
+			MessageID: fmt.Sprintf(
+				"<%s@%s>",
+				newRequestID,
+				fmt.Sprintf("%s.%s", "update-user-password", s.config.DomainAPI))})
+	if err != nil {
+		logger.DPanic("failed to add an email message to the queue", zap.Error(err), zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	return nil
 }
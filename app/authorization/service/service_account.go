@@ -0,0 +1,282 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/financelime-authorization/jose"
+	"github.com/dmalix/jwt"
+	"github.com/dmalix/utils/generate"
+	"go.uber.org/zap"
+	"strings"
+)
+
+const (
+	oauthGrantTypeClientCredentials = "client_credentials"
+	// The JwtID of a service account token is not a session, the prefix tells them apart
+	serviceAccountJwtIDPrefix     = "sa-"
+	serviceAccountJwtIDByteLength = 16
+	// The secrets of the service accounts and the confidential clients are shown once, only the hashes are stored
+	clientSecretByteLength = 32
+)
+
+// exchangeClientCredentials issues the access token to the service account (RFC 6749, section 4.4).
+// There is no session and no refresh token, the account requests a new token when the old one expires.
+func (s *service) exchangeClientCredentials(ctx context.Context, logger *zap.Logger,
+	param model.ServiceExchangeTokenParam) (model.ServiceAccessTokenReturn, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	account, err := s.repository.AuthenticateServiceAccount(ctx, logger, model.RepoAuthenticateOauthClientParam{
+		ClientID:     param.ClientID,
+		ClientSecret: param.ClientSecret})
+	if err != nil {
+		logger.Error("failed to authenticate the service account", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorInvalidClient:
+			return model.ServiceAccessTokenReturn{}, err
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	scope := account.Scope
+	if param.Scope != "" {
+		for _, value := range strings.Fields(param.Scope) {
+			if !hasScope(account.Scope, value) {
+				logger.Error("the scope is not allowed to the service account", zap.String("scope", value),
+					zap.String("clientID", account.ClientID), zap.String(requestIDKey, requestID))
+				return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidScope
+			}
+		}
+		scope = strings.Join(strings.Fields(param.Scope), " ")
+	}
+
+	jwtIDBytes := make([]byte, serviceAccountJwtIDByteLength)
+	_, err = rand.Read(jwtIDBytes)
+	if err != nil {
+		logger.DPanic("failed to generate the JwtID", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	accountData, err := json.Marshal(model.User{
+		ServiceAccount: account.ClientID,
+		Scope:          scope})
+	if err != nil {
+		logger.DPanic("failed to marshal the user struct", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+	encryptedAccessTokenData, err := s.dataAccess.Encrypt(accountData)
+	if err != nil {
+		logger.DPanic("failed to encrypt the token data", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	accessToken, expiresIn, err := s.createAccessToken(jwt.Claims{
+		JwtID: serviceAccountJwtIDPrefix + hex.EncodeToString(jwtIDBytes),
+		Data:  encryptedAccessTokenData,
+	}, jose.AccessClaims{Scope: scope})
+	if err != nil {
+		logger.DPanic("failed to generate an access token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	logger.Info("the access token has been issued to the service account", zap.String("clientID", account.ClientID),
+		zap.String("scope", scope), zap.String(requestIDKey, requestID))
+
+	return model.ServiceAccessTokenReturn{
+		AccessJWT: accessToken,
+		ExpiresIn: expiresIn,
+		Scope:     scope}, nil
+}
+
+// introspectServiceAccountToken returns the inactive token if the service account has been deleted
+func (s *service) introspectServiceAccountToken(ctx context.Context, logger *zap.Logger, token string,
+	jwtData jwt.Token) (model.TokenIntrospection, error) {
+
+	var accountData model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.TokenIntrospection{}, err
+	}
+
+	decryptedData, err := s.dataAccess.Decrypt(jwtData.Claims.Data)
+	if err != nil {
+		logger.DPanic("failed to decrypt the token data", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.TokenIntrospection{}, err
+	}
+	if err = json.Unmarshal(decryptedData, &accountData); err != nil || accountData.ServiceAccount == "" {
+		logger.DPanic("failed to unmarshal the token data", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.TokenIntrospection{}, errorBadTokenPayload
+	}
+
+	account, err := s.repository.GetServiceAccount(ctx, logger, accountData.ServiceAccount)
+	if err != nil {
+		switch err {
+		case authorization.ErrorServiceAccountNotFound:
+			return model.TokenIntrospection{Active: false}, nil
+		default:
+			return model.TokenIntrospection{}, err
+		}
+	}
+
+	claims, err := readTokenClaims(token)
+	if err != nil {
+		logger.DPanic("failed to read the claims of the token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.TokenIntrospection{}, err
+	}
+
+	return model.TokenIntrospection{
+		Active:    true,
+		Subject:   account.ClientID,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		ClientID:  account.ClientID,
+		Scope:     accountData.Scope}, nil
+}
+
+func isServiceAccountJwtID(jwtID string) bool {
+	return strings.HasPrefix(jwtID, serviceAccountJwtIDPrefix)
+}
+
+func (s *service) GetListServiceAccounts(ctx context.Context, logger *zap.Logger) ([]model.ServiceAccount, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return nil, err
+	}
+
+	accounts, err := s.repository.GetListServiceAccounts(ctx, logger)
+	if err != nil {
+		logger.Error("failed to get the list of the service accounts", zap.Error(err), zap.String(requestIDKey, requestID))
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// CreateServiceAccount generates the client secret, it's returned once
+func (s *service) CreateServiceAccount(ctx context.Context, logger *zap.Logger,
+	param model.ServiceCreateServiceAccountParam) (model.ServiceClientCredentialsReturn, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceClientCredentialsReturn{}, err
+	}
+
+	if param.ClientID == "" {
+		param.ClientID = generate.StringRand(16, 16, true)
+	}
+
+	clientSecret, err := newClientSecret()
+	if err != nil {
+		logger.DPanic("failed to generate the client secret", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceClientCredentialsReturn{}, err
+	}
+
+	err = s.repository.CreateServiceAccount(ctx, logger, model.RepoCreateServiceAccountParam{
+		ClientID:     param.ClientID,
+		Name:         param.Name,
+		ClientSecret: clientSecret,
+		Scope:        param.Scope})
+	if err != nil {
+		logger.Error("failed to create the service account", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceClientCredentialsReturn{}, err
+	}
+
+	logger.Info("the service account has been created", zap.String("clientID", param.ClientID),
+		zap.String(requestIDKey, requestID))
+
+	return model.ServiceClientCredentialsReturn{
+		ClientID:     param.ClientID,
+		ClientSecret: clientSecret}, nil
+}
+
+// UpdateServiceAccount returns the new client secret if it has been rotated, the tokens already issued
+// keep their scope until they expire
+func (s *service) UpdateServiceAccount(ctx context.Context, logger *zap.Logger,
+	param model.ServiceUpdateServiceAccountParam) (model.ServiceClientCredentialsReturn, error) {
+
+	var clientSecret string
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceClientCredentialsReturn{}, err
+	}
+
+	if param.Name == "" && param.Scope == "" && !param.RotateSecret {
+		logger.Error("nothing to update", zap.String("clientID", param.ClientID), zap.String(requestIDKey, requestID))
+		return model.ServiceClientCredentialsReturn{}, authorization.ErrorBadParams
+	}
+
+	if param.RotateSecret {
+		clientSecret, err = newClientSecret()
+		if err != nil {
+			logger.DPanic("failed to generate the client secret", zap.Error(err), zap.String(requestIDKey, requestID))
+			return model.ServiceClientCredentialsReturn{}, err
+		}
+	}
+
+	err = s.repository.UpdateServiceAccount(ctx, logger, model.RepoUpdateServiceAccountParam{
+		ClientID:     param.ClientID,
+		Name:         param.Name,
+		ClientSecret: clientSecret,
+		Scope:        param.Scope})
+	if err != nil {
+		logger.Error("failed to update the service account", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceClientCredentialsReturn{}, err
+	}
+
+	logger.Info("the service account has been updated", zap.String("clientID", param.ClientID),
+		zap.Bool("rotateSecret", param.RotateSecret), zap.String(requestIDKey, requestID))
+
+	return model.ServiceClientCredentialsReturn{
+		ClientID:     param.ClientID,
+		ClientSecret: clientSecret}, nil
+}
+
+// DeleteServiceAccount makes the issued access tokens inactive for the introspection at once, they expire on their own
+func (s *service) DeleteServiceAccount(ctx context.Context, logger *zap.Logger, clientID string) error {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	err = s.repository.DeleteServiceAccount(ctx, logger, clientID)
+	if err != nil {
+		logger.Error("failed to delete the service account", zap.Error(err), zap.String("clientID", clientID),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	logger.Info("the service account has been deleted", zap.String("clientID", clientID),
+		zap.String(requestIDKey, requestID))
+
+	return nil
+}
+
+func newClientSecret() (string, error) {
+	secretBytes := make([]byte, clientSecretByteLength)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secretBytes), nil
+}
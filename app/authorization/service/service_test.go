@@ -6,21 +6,49 @@ package service
 
 import (
 	"context"
-	"errors"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dmalix/financelime-authorization/app/authorization"
 	"github.com/dmalix/financelime-authorization/app/authorization/model"
 	"github.com/dmalix/financelime-authorization/app/authorization/repository"
 	"github.com/dmalix/financelime-authorization/config"
+	"github.com/dmalix/financelime-authorization/jose"
+	"github.com/dmalix/financelime-authorization/revocation"
+	"github.com/dmalix/financelime-authorization/totp"
+	"github.com/dmalix/financelime-authorization/webauthn/webauthntest"
 	"github.com/dmalix/jwt"
 	"github.com/dmalix/middleware"
 	"github.com/dmalix/secretdata"
 	"github.com/dmalix/sendmail"
 	"go.uber.org/zap"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 const remoteAddr = "127.0.0.1"
 const requestID = "W7000-T6755-T7700-P4010-W6778"
 
+// testIDTokenSigner signs the ID tokens, the RSA key is generated once for all the tests
+var testIDTokenSigner = func() jose.Signer {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	key, err := jose.NewKey(privateKey)
+	if err != nil {
+		panic(err)
+	}
+	return jose.NewSigner(key)
+}()
+
 func TestServiceSignUp(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -69,8 +97,12 @@ func TestServiceSignUp(t *testing.T) {
 		authRepo,
 		cryptManager,
 		cryptManager,
+		cryptManager,
 		jwtManager,
-		jwtManager)
+		jwtManager,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
 
 	err = newService.SignUpStep1(ctx, logger, model.ServiceSignUpParam{
 		Email:      props.Email,
@@ -108,14 +140,13 @@ func TestServiceConfirmUserEmail_Success(t *testing.T) {
 
 	languageContent.Language = make(map[string]int)
 	languageContent.Language["abc"] = 0
-	languageContent.Data.User.Signup.Email.Password.Subject = append(languageContent.Data.User.Signup.Email.Password.Subject, "subject")
-	languageContent.Data.User.Signup.Email.Password.Body = append(languageContent.Data.User.Signup.Email.Password.Body, "%s%s")
-	languageContent.Data.User.Signup.Page.Text = append(languageContent.Data.User.Signup.Page.Text, "text")
+	languageContent.Data.User.Signup.Page.Text = append(languageContent.Data.User.Signup.Page.Text, "%s/%s")
 
 	cryptographerManager := &secretdata.Cipher{}
 	jwtManager := new(jwt.MockDescription)
 	//goland:noinspection GoBoolExpressions
 	serviceConfig := model.ConfigService{
+		DomainAPP:              "app.domain.com",
 		DomainAPI:              configDomainAPI,
 		AuthInviteCodeRequired: configAuthInviteCodeRequired,
 	}
@@ -129,8 +160,12 @@ func TestServiceConfirmUserEmail_Success(t *testing.T) {
 		authRepo,
 		cryptographerManager,
 		cryptographerManager,
+		cryptographerManager,
 		jwtManager,
-		jwtManager)
+		jwtManager,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
 
 	message, err = newService.SignUpStep2(ctx, logger, "12345")
 
@@ -139,9 +174,9 @@ func TestServiceConfirmUserEmail_Success(t *testing.T) {
 			err, nil)
 	}
 
-	if message != "text" {
+	if message != "app.domain.com/12345" {
 		t.Errorf("service returned wrong the message value: got %v want %v",
-			message, "text")
+			message, "app.domain.com/12345")
 	}
 }
 
@@ -163,14 +198,12 @@ func TestServiceConfirmUserEmail_Error(t *testing.T) {
 		contextGetter                = new(middleware.MockDescription)
 	)
 
-	authRepo.Expected.Error = nil
-	sendmail.MockData.Expected.Error = errors.New("REPO_ERROR")
+	authRepo.Expected.Error = authorization.ErrorConfirmationKeyNotFound
+	sendmail.MockData.Expected.Error = nil
 
 	languageContent.Language = make(map[string]int)
 	languageContent.Language["abc"] = 0
-	languageContent.Data.User.Signup.Email.Password.Subject = append(languageContent.Data.User.Signup.Email.Password.Subject, "subject")
-	languageContent.Data.User.Signup.Email.Password.Body = append(languageContent.Data.User.Signup.Email.Password.Body, "%s%s")
-	languageContent.Data.User.Signup.Page.Text = append(languageContent.Data.User.Signup.Page.Text, "text")
+	languageContent.Data.User.Signup.Page.Text = append(languageContent.Data.User.Signup.Page.Text, "%s/%s")
 
 	cryptographerManager := &secretdata.Cipher{}
 	jwtManager := new(jwt.MockDescription)
@@ -190,17 +223,131 @@ func TestServiceConfirmUserEmail_Error(t *testing.T) {
 		authRepo,
 		cryptographerManager,
 		cryptographerManager,
+		cryptographerManager,
 		jwtManager,
-		jwtManager)
+		jwtManager,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
 
 	_, err = newService.SignUpStep2(ctx, logger, "12345")
 
-	if err == nil {
+	if err != authorization.ErrorBadConfirmationKey {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, authorization.ErrorBadConfirmationKey)
+	}
+}
+
+func TestServiceSignUpStep3_Success(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var (
+		languageContent   config.LanguageContent
+		emailMessageQueue = make(chan sendmail.MessageBox, 1)
+		emailMessage      = new(sendmail.MockDescription)
+		authRepo          = new(repository.Mock)
+		err               error
+		contextGetter     = new(middleware.MockDescription)
+	)
+
+	authRepo.Expected.Error = nil
+	sendmail.MockData.Expected.Error = nil
+
+	languageContent.Language = make(map[string]int)
+	languageContent.Language["abc"] = 0
+	languageContent.Data.User.Signup.Email.Complete.Subject = append(languageContent.Data.User.Signup.Email.Complete.Subject, "subject")
+	languageContent.Data.User.Signup.Email.Complete.Body = append(languageContent.Data.User.Signup.Email.Complete.Body, "body")
+
+	cryptographerManager := &secretdata.Cipher{}
+	jwtManager := new(jwt.MockDescription)
+	serviceConfig := model.ConfigService{
+		DomainAPI: "domain.com",
+	}
+
+	var newService = NewService(
+		serviceConfig,
+		contextGetter,
+		languageContent,
+		emailMessageQueue,
+		emailMessage,
+		authRepo,
+		cryptographerManager,
+		cryptographerManager,
+		cryptographerManager,
+		jwtManager,
+		jwtManager,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	err = newService.SignUpStep3(ctx, logger, model.ServiceSetPasswordParam{
+		ConfirmationKey: "12345",
+		Password:        "password"})
+
+	if err != nil {
 		t.Errorf("service returned wrong the err value: got %v want %v",
 			err, nil)
 	}
 }
 
+func TestServiceSignUpStep3_Error(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var (
+		languageContent   config.LanguageContent
+		emailMessageQueue = make(chan sendmail.MessageBox, 1)
+		emailMessage      = new(sendmail.MockDescription)
+		authRepo          = new(repository.Mock)
+		err               error
+		contextGetter     = new(middleware.MockDescription)
+	)
+
+	authRepo.Expected.Error = authorization.ErrorConfirmationKeyAlreadyConfirmed
+	sendmail.MockData.Expected.Error = nil
+
+	languageContent.Language = make(map[string]int)
+	languageContent.Language["abc"] = 0
+
+	cryptographerManager := &secretdata.Cipher{}
+	jwtManager := new(jwt.MockDescription)
+	serviceConfig := model.ConfigService{
+		DomainAPI: "domain.com",
+	}
+
+	var newService = NewService(
+		serviceConfig,
+		contextGetter,
+		languageContent,
+		emailMessageQueue,
+		emailMessage,
+		authRepo,
+		cryptographerManager,
+		cryptographerManager,
+		cryptographerManager,
+		jwtManager,
+		jwtManager,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	err = newService.SignUpStep3(ctx, logger, model.ServiceSetPasswordParam{
+		ConfirmationKey: "12345",
+		Password:        "password"})
+
+	if err != authorization.ErrorBadConfirmationKey {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, authorization.ErrorBadConfirmationKey)
+	}
+}
+
 func TestServiceRequestAccessToken(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -246,8 +393,15 @@ func TestServiceRequestAccessToken(t *testing.T) {
 		authRepo,
 		tokenData,
 		tokenData,
+		tokenData,
 		token,
-		token)
+		token,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "PWA",
+		GrantTypes: []string{model.OauthGrantTypePassword, model.OauthGrantTypeRefreshToken}}
 
 	_, err = newService.CreateAccessToken(ctx, logger, model.ServiceCreateAccessTokenParam{
 		Email:     "email",
@@ -261,6 +415,38 @@ func TestServiceRequestAccessToken(t *testing.T) {
 		t.Errorf("service returned wrong the err value: got %v want %v",
 			err, nil)
 	}
+
+	// The unknown or disabled client can't log in the users
+
+	_, err = newService.CreateAccessToken(ctx, logger, model.ServiceCreateAccessTokenParam{
+		Email:     "email",
+		Password:  "password",
+		ClientID:  "unknown",
+		UserAgent: "userAgent",
+		Device:    device,
+	})
+
+	if err != authorization.ErrorInvalidClient {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, authorization.ErrorInvalidClient)
+	}
+
+	// The client without the password grant can't log in the users
+
+	authRepo.Props.OauthClient.GrantTypes = []string{model.OauthGrantTypeAuthorizationCode}
+
+	_, err = newService.CreateAccessToken(ctx, logger, model.ServiceCreateAccessTokenParam{
+		Email:     "email",
+		Password:  "password",
+		ClientID:  "PWA",
+		UserAgent: "userAgent",
+		Device:    device,
+	})
+
+	if err != authorization.ErrorUnauthorizedClient {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, authorization.ErrorUnauthorizedClient)
+	}
 }
 
 func TestServiceRefreshAccessToken(t *testing.T) {
@@ -295,6 +481,7 @@ func TestServiceRefreshAccessToken(t *testing.T) {
 	serviceConfig := model.ConfigService{
 		DomainAPI:              configDomainAPI,
 		AuthInviteCodeRequired: configAuthInviteCodeRequired,
+		AccessTokenLifetime:    60,
 	}
 
 	//noinspection GoBoolExpressions
@@ -307,15 +494,115 @@ func TestServiceRefreshAccessToken(t *testing.T) {
 		authRepo,
 		cryptographerManager,
 		cryptographerManager,
+		cryptographerManager,
+		jwtManager,
 		jwtManager,
-		jwtManager)
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	authRepo.Props.Session = model.SessionRecord{UserID: 1, ClientID: "client", Scope: "read:reports write:reports"}
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "client",
+		GrantTypes: []string{model.OauthGrantTypePassword, model.OauthGrantTypeRefreshToken}}
+
+	tokens, err := newService.RefreshAccessToken(ctx, logger, model.ServiceRefreshAccessTokenParam{RefreshToken: "refreshToken"})
 
-	_, err = newService.RefreshAccessToken(ctx, logger, "refreshToken")
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, nil)
+	}
+	if tokens.Scope != "read:reports write:reports" {
+		t.Errorf("service returned wrong the scope value: got %v want %v",
+			tokens.Scope, "read:reports write:reports")
+	}
+
+	// The access token is narrowed to the requested scope
+
+	tokens, err = newService.RefreshAccessToken(ctx, logger, model.ServiceRefreshAccessTokenParam{
+		RefreshToken: "refreshToken",
+		Scope:        "read:reports"})
 
 	if err != nil {
 		t.Errorf("service returned wrong the err value: got %v want %v",
 			err, nil)
 	}
+	if tokens.Scope != "read:reports" {
+		t.Errorf("service returned wrong the scope value: got %v want %v",
+			tokens.Scope, "read:reports")
+	}
+
+	// The scope can't exceed the scope of the session
+
+	_, err = newService.RefreshAccessToken(ctx, logger, model.ServiceRefreshAccessTokenParam{
+		RefreshToken: "refreshToken",
+		Scope:        "read:reports delete:reports"})
+
+	if err != authorization.ErrorInvalidScope {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, authorization.ErrorInvalidScope)
+	}
+
+	// The session of the disabled client can't be refreshed
+
+	authRepo.Props.OauthClient = model.OauthClient{}
+
+	_, err = newService.RefreshAccessToken(ctx, logger, model.ServiceRefreshAccessTokenParam{RefreshToken: "refreshToken"})
+
+	if err != authorization.ErrorInvalidClient {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, authorization.ErrorInvalidClient)
+	}
+
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "client",
+		GrantTypes: []string{model.OauthGrantTypePassword, model.OauthGrantTypeRefreshToken}}
+
+	// The refresh token is unknown and has never been rotated
+
+	authRepo.Expected.Error = authorization.ErrorUserNotFound
+
+	_, err = newService.RefreshAccessToken(ctx, logger, model.ServiceRefreshAccessTokenParam{RefreshToken: "refreshToken"})
+
+	if err != authorization.ErrorUserNotFound {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, authorization.ErrorUserNotFound)
+	}
+
+	// The refresh token has already been rotated, the token family is revoked
+
+	languageContent.Data.User.RefreshTokenReuse.Email.Subject = append(languageContent.Data.User.RefreshTokenReuse.Email.Subject, "subject")
+	languageContent.Data.User.RefreshTokenReuse.Email.Body = append(languageContent.Data.User.RefreshTokenReuse.Email.Body, "%s%s")
+	newService = NewService(
+		serviceConfig,
+		contextGetter,
+		languageContent,
+		emailMessageQueue,
+		emailMessage,
+		authRepo,
+		cryptographerManager,
+		cryptographerManager,
+		cryptographerManager,
+		jwtManager,
+		jwtManager,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+	authRepo.Props.RefreshTokenFamilyUser = model.User{ID: 1, Email: "test.user@financelime.com", Language: "abc"}
+	authRepo.Props.PublicSessionIDs = []string{"familySessionID"}
+
+	_, err = newService.RefreshAccessToken(ctx, logger, model.ServiceRefreshAccessTokenParam{RefreshToken: "refreshToken"})
+
+	if err != authorization.ErrorRefreshTokenReused {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, authorization.ErrorRefreshTokenReused)
+	}
+
+	// The access tokens of the revoked family are rejected right away
+
+	err = newService.CheckAccessTokenRevocation(ctx, logger, "familySessionID")
+	if err != authorization.ErrorAccessTokenRevoked {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, authorization.ErrorAccessTokenRevoked)
+	}
 }
 
 func TestServiceRevokeRefreshToken(t *testing.T) {
@@ -351,6 +638,7 @@ func TestServiceRevokeRefreshToken(t *testing.T) {
 	serviceConfig := model.ConfigService{
 		DomainAPI:              configDomainAPI,
 		AuthInviteCodeRequired: configAuthInviteCodeRequired,
+		AccessTokenLifetime:    60,
 	}
 
 	//noinspection GoBoolExpressions
@@ -363,8 +651,19 @@ func TestServiceRevokeRefreshToken(t *testing.T) {
 		authRepo,
 		cryptographerManager,
 		cryptographerManager,
+		cryptographerManager,
 		token,
-		token)
+		token,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	err = newService.CheckAccessTokenRevocation(ctx, logger, "publicSessionID")
+
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, nil)
+	}
 
 	err = newService.RevokeRefreshToken(ctx, logger, model.ServiceRevokeRefreshTokenParam{
 		AccessTokenData: accessTokenData,
@@ -374,6 +673,97 @@ func TestServiceRevokeRefreshToken(t *testing.T) {
 		t.Errorf("service returned wrong the err value: got %v want %v",
 			err, nil)
 	}
+
+	// The access token of the revoked session is rejected before it expires
+
+	err = newService.CheckAccessTokenRevocation(ctx, logger, "publicSessionID")
+
+	if err != authorization.ErrorAccessTokenRevoked {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, authorization.ErrorAccessTokenRevoked)
+	}
+}
+
+func TestServiceRevokeAllSessions(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var (
+		accessTokenData              = []byte{123, 34, 73, 68, 34, 58, 50, 44, 34, 69, 109, 97, 105, 108, 34, 58, 34, 116, 101, 115, 116, 46, 117, 115, 101, 114, 64, 102, 105, 110, 97, 110, 99, 101, 108, 105, 109, 101, 46, 99, 111, 109, 34, 44, 34, 80, 97, 115, 115, 119, 111, 114, 100, 34, 58, 34, 34, 44, 34, 76, 97, 110, 103, 117, 97, 103, 101, 34, 58, 34, 101, 110, 34, 125}
+		configDomainAPI              = "domain.com"
+		configAuthInviteCodeRequired = true
+		languageContent              config.LanguageContent
+		emailMessageQueue            = make(chan sendmail.MessageBox, 1)
+		emailMessage                 = new(sendmail.MockDescription)
+		authRepo                     = new(repository.Mock)
+		err                          error
+		contextGetter                = new(middleware.MockDescription)
+	)
+
+	authRepo.Expected.Error = nil
+	authRepo.Props.PublicSessionIDs = []string{"currentSessionID", "otherSessionID"}
+	sendmail.MockData.Expected.Error = nil
+
+	languageContent.Language = make(map[string]int)
+	languageContent.Language["abc"] = 0
+	languageContent.Data.User.Login.Email.Subject = append(languageContent.Data.User.Login.Email.Subject, "subject")
+	languageContent.Data.User.Login.Email.Body = append(languageContent.Data.User.Login.Email.Body, "%s%s")
+	languageContent.Data.User.RevokeSessions.Email.Subject = append(languageContent.Data.User.RevokeSessions.Email.Subject, "subject")
+	languageContent.Data.User.RevokeSessions.Email.Body = append(languageContent.Data.User.RevokeSessions.Email.Body, "%d%s%s")
+
+	cryptographerManager := new(secretdata.MockDescription)
+	token := new(jwt.MockDescription)
+	//goland:noinspection GoBoolExpressions
+	serviceConfig := model.ConfigService{
+		DomainAPI:              configDomainAPI,
+		AuthInviteCodeRequired: configAuthInviteCodeRequired,
+		AccessTokenLifetime:    60,
+	}
+
+	//noinspection GoBoolExpressions
+	var newService = NewService(
+		serviceConfig,
+		contextGetter,
+		languageContent,
+		emailMessageQueue,
+		emailMessage,
+		authRepo,
+		cryptographerManager,
+		cryptographerManager,
+		cryptographerManager,
+		token,
+		token,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	err = newService.RevokeAllSessions(ctx, logger, model.ServiceRevokeAllSessionsParam{
+		AccessTokenData:       accessTokenData,
+		ExceptPublicSessionID: "currentSessionID"})
+
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, nil)
+	}
+
+	// Only the access tokens of the other sessions are rejected
+
+	err = newService.CheckAccessTokenRevocation(ctx, logger, "currentSessionID")
+
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, nil)
+	}
+
+	err = newService.CheckAccessTokenRevocation(ctx, logger, "otherSessionID")
+
+	if err != authorization.ErrorAccessTokenRevoked {
+		t.Errorf("service returned wrong the err value: got %v want %v",
+			err, authorization.ErrorAccessTokenRevoked)
+	}
 }
 
 func TestServiceRequestUserPasswordReset(t *testing.T) {
@@ -420,8 +810,12 @@ func TestServiceRequestUserPasswordReset(t *testing.T) {
 		authRepo,
 		cryptographerManager,
 		cryptographerManager,
+		cryptographerManager,
+		token,
 		token,
-		token)
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
 
 	err = newService.ResetUserPasswordStep1(ctx, logger, "email")
 
@@ -477,8 +871,12 @@ func TestServiceGetListActiveSessions(t *testing.T) {
 		authRepo,
 		secretData,
 		secretData,
+		secretData,
+		token,
 		token,
-		token)
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
 
 	_, err = newService.GetListActiveSessions(ctx, logger, accessTokenData)
 	if err != nil {
@@ -486,3 +884,2087 @@ func TestServiceGetListActiveSessions(t *testing.T) {
 			err, nil)
 	}
 }
+
+func TestServiceUpdateUserPassword(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var (
+		accessTokenData   = []byte(`{"ID":2,"Email":"test.user@financelime.com","Password":"","Language":"en"}`)
+		languageContent   config.LanguageContent
+		emailMessageQueue = make(chan sendmail.MessageBox, 1)
+		emailMessage      = new(sendmail.MockDescription)
+		authRepo          = new(repository.Mock)
+		contextGetter     = new(middleware.MockDescription)
+	)
+
+	sendmail.MockData.Expected.Error = nil
+
+	languageContent.Language = make(map[string]int)
+	languageContent.Language["en"] = 0
+	languageContent.Data.User.ChangePassword.Email.Subject = append(languageContent.Data.User.ChangePassword.Email.Subject, "subject")
+	languageContent.Data.User.ChangePassword.Email.Body = append(languageContent.Data.User.ChangePassword.Email.Body, "%s%s")
+
+	secretData := new(secretdata.MockDescription)
+	token := new(jwt.MockDescription)
+	serviceConfig := model.ConfigService{
+		DomainAPI: "domain.com",
+	}
+
+	var newService = NewService(
+		serviceConfig,
+		contextGetter,
+		languageContent,
+		emailMessageQueue,
+		emailMessage,
+		authRepo,
+		secretData,
+		secretData,
+		secretData,
+		token,
+		token,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	tests := []struct {
+		repoError error
+		want      error
+	}{
+		{nil, nil},
+		{authorization.ErrorBadCurrentPassword, authorization.ErrorBadCurrentPassword},
+		{authorization.ErrorBadParamPassword, authorization.ErrorBadParamPassword},
+	}
+
+	for _, test := range tests {
+		authRepo.Expected.Error = test.repoError
+		err := newService.UpdateUserPassword(ctx, logger, model.ServiceUpdateUserPasswordParam{
+			AccessTokenData: accessTokenData,
+			CurrentPassword: "currentPassword",
+			NewPassword:     "newPassword"})
+		if err != test.want {
+			t.Errorf("service returned wrong the err value: got %v want %v",
+				err, test.want)
+		}
+	}
+}
+
+func TestServiceMfa(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var (
+		languageContent   config.LanguageContent
+		emailMessageQueue = make(chan sendmail.MessageBox, 1)
+		emailMessage      = new(sendmail.MockDescription)
+		authRepo          = new(repository.Mock)
+		contextGetter     = new(middleware.MockDescription)
+		confirmedAt       = time.Now()
+	)
+
+	sendmail.MockData.Expected.Error = nil
+
+	languageContent.Language = make(map[string]int)
+	languageContent.Language["en"] = 0
+	languageContent.Data.User.Login.Email.Subject = append(languageContent.Data.User.Login.Email.Subject, "subject")
+	languageContent.Data.User.Login.Email.Body = append(languageContent.Data.User.Login.Email.Body, "%s%s%s%s")
+	languageContent.Data.User.RecoveryCode.Email.Subject = append(languageContent.Data.User.RecoveryCode.Email.Subject, "subject")
+	languageContent.Data.User.RecoveryCode.Email.Body = append(languageContent.Data.User.RecoveryCode.Email.Body, "%s%d%s")
+
+	cryptManager := secretdata.NewSecretData("6368616e676520746869732070617373")
+	token := new(jwt.MockDescription)
+
+	var newService = NewService(
+		model.ConfigService{DomainAPI: "domain.com"},
+		contextGetter,
+		languageContent,
+		emailMessageQueue,
+		emailMessage,
+		authRepo,
+		cryptManager,
+		cryptManager,
+		cryptManager,
+		token,
+		token,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedSecret, err := cryptManager.Encrypt([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongCode := fmt.Sprintf("%06d", (atoi(t, code)+1)%1000000)
+
+	// The log in of a user with the confirmed secret stops at the challenge
+
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "PWA", GrantTypes: []string{model.OauthGrantTypePassword}}
+	authRepo.Props.Totp = model.Totp{EncryptedSecret: encryptedSecret, ConfirmedAt: &confirmedAt}
+	accessTokenReturn, err := newService.CreateAccessToken(ctx, logger, model.ServiceCreateAccessTokenParam{
+		Email:    "test.user@financelime.com",
+		Password: "password",
+		ClientID: "PWA"})
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if accessTokenReturn.MfaChallengeToken == "" || accessTokenReturn.AccessJWT != "" {
+		t.Errorf("service returned the tokens instead of the challenge: %+v", accessTokenReturn)
+	}
+
+	tests := []struct {
+		name         string
+		totp         model.Totp
+		code         string
+		recoveryCode string
+		repoError    error
+		want         error
+	}{
+		{"valid code", model.Totp{EncryptedSecret: encryptedSecret, ConfirmedAt: &confirmedAt}, code, "", nil, nil},
+		{"wrong code", model.Totp{EncryptedSecret: encryptedSecret, ConfirmedAt: &confirmedAt}, wrongCode, "", nil,
+			authorization.ErrorBadMfaCode},
+		{"used code", model.Totp{EncryptedSecret: encryptedSecret, ConfirmedAt: &confirmedAt,
+			LastUsedStep: totp.Step(time.Now()) + totp.Skew}, code, "", nil, authorization.ErrorBadMfaCode},
+		{"recovery code", model.Totp{EncryptedSecret: encryptedSecret, ConfirmedAt: &confirmedAt}, "", "kq7mz-w3tcp", nil,
+			nil},
+		{"unconfirmed secret", model.Totp{EncryptedSecret: encryptedSecret}, code, "", nil,
+			authorization.ErrorMfaChallengeNotFound},
+		{"empty code", model.Totp{EncryptedSecret: encryptedSecret, ConfirmedAt: &confirmedAt}, "", "", nil,
+			authorization.ErrorBadParams},
+		{"expired challenge", model.Totp{}, code, "", authorization.ErrorMfaChallengeNotFound,
+			authorization.ErrorMfaChallengeNotFound},
+	}
+
+	authRepo.Props.MfaChallenge = model.MfaChallenge{ClientID: "PWA"}
+
+	for _, test := range tests {
+		authRepo.Props.Totp = test.totp
+		authRepo.Expected.Error = test.repoError
+		_, err := newService.VerifyMfaChallenge(ctx, logger, model.ServiceVerifyMfaChallengeParam{
+			ChallengeToken: accessTokenReturn.MfaChallengeToken,
+			Code:           test.code,
+			RecoveryCode:   test.recoveryCode})
+		if err != test.want {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", test.name, err, test.want)
+		}
+	}
+
+	// Enrollment
+
+	authRepo.Expected.Error = nil
+	authRepo.Props.Totp = model.Totp{EncryptedSecret: encryptedSecret}
+	recoveryCodes, err := newService.ConfirmTotp(ctx, logger, model.ServiceConfirmTotpParam{
+		AccessTokenData: []byte(`{"ID":2,"Email":"test.user@financelime.com","Password":"","Language":"en"}`),
+		Code:            code})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if len(recoveryCodes) != recoveryCodesAmount {
+		t.Errorf("service returned wrong number of recovery codes: got %d want %d", len(recoveryCodes), recoveryCodesAmount)
+	}
+
+	_, err = newService.RegenerateRecoveryCodes(ctx, logger,
+		[]byte(`{"ID":2,"Email":"test.user@financelime.com","Password":"","Language":"en"}`))
+	if err != authorization.ErrorMfaNotFound {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorMfaNotFound)
+	}
+
+	authRepo.Props.Totp = model.Totp{EncryptedSecret: encryptedSecret, ConfirmedAt: &confirmedAt}
+	recoveryCodes, err = newService.RegenerateRecoveryCodes(ctx, logger,
+		[]byte(`{"ID":2,"Email":"test.user@financelime.com","Password":"","Language":"en"}`))
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	for _, recoveryCode := range recoveryCodes {
+		if len(normalizeRecoveryCode(recoveryCode)) != 2*recoveryCodeGroupLength ||
+			strings.Trim(normalizeRecoveryCode(recoveryCode), recoveryCodeAlphabet) != "" {
+			t.Errorf("service returned the malformed recovery code %q", recoveryCode)
+		}
+	}
+
+	_, err = newService.ConfirmTotp(ctx, logger, model.ServiceConfirmTotpParam{
+		AccessTokenData: []byte(`{"ID":2,"Email":"test.user@financelime.com","Password":"","Language":"en"}`),
+		Code:            code})
+	if err != authorization.ErrorMfaAlreadyEnabled {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorMfaAlreadyEnabled)
+	}
+}
+
+func TestServiceWebauthn(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var (
+		languageContent   config.LanguageContent
+		emailMessageQueue = make(chan sendmail.MessageBox, 1)
+		emailMessage      = new(sendmail.MockDescription)
+		authRepo          = new(repository.Mock)
+		contextGetter     = new(middleware.MockDescription)
+		accessTokenData   = []byte(`{"ID":2,"Email":"test.user@financelime.com","Password":"","Language":"en"}`)
+	)
+
+	sendmail.MockData.Expected.Error = nil
+
+	languageContent.Language = make(map[string]int)
+	languageContent.Language["en"] = 0
+	languageContent.Data.User.Login.Email.Subject = append(languageContent.Data.User.Login.Email.Subject, "subject")
+	languageContent.Data.User.Login.Email.Body = append(languageContent.Data.User.Login.Email.Body, "%s%s%s%s")
+
+	cryptManager := secretdata.NewSecretData("6368616e676520746869732070617373")
+	token := new(jwt.MockDescription)
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com"},
+		contextGetter,
+		languageContent,
+		emailMessageQueue,
+		emailMessage,
+		authRepo,
+		cryptManager,
+		cryptManager,
+		cryptManager,
+		token,
+		token,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	authenticator, err := webauthntest.NewAuthenticator("https://financelime.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Registration
+
+	creationOptions, err := newService.BeginWebauthnRegistration(ctx, logger, accessTokenData)
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if creationOptions.RP.ID != "financelime.com" || creationOptions.User.ID != webauthnUserHandle(2) {
+		t.Errorf("service returned wrong creation options: %+v", creationOptions)
+	}
+
+	registrationCredential, err := authenticator.Register(creationOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authRepo.Props.WebauthnChallengeUserID = 3
+	err = newService.FinishWebauthnRegistration(ctx, logger, model.ServiceFinishWebauthnRegistrationParam{
+		AccessTokenData: accessTokenData,
+		Credential:      registrationCredential})
+	if err != authorization.ErrorWebauthnChallengeNotFound {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorWebauthnChallengeNotFound)
+	}
+
+	authRepo.Props.WebauthnChallengeUserID = 2
+	err = newService.FinishWebauthnRegistration(ctx, logger, model.ServiceFinishWebauthnRegistrationParam{
+		AccessTokenData: accessTokenData,
+		Credential:      registrationCredential})
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if authRepo.Props.WebauthnCredential.UserID != 2 {
+		t.Errorf("service saved the credential of wrong user: got %d want %d", authRepo.Props.WebauthnCredential.UserID, 2)
+	}
+
+	// Log in
+
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "PWA_v0.0.1", GrantTypes: []string{model.OauthGrantTypePassword}}
+	requestOptions, err := newService.BeginWebauthnLogin(ctx, logger)
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+
+	assertionCredential, err := authenticator.Assert(requestOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newService.FinishWebauthnLogin(ctx, logger, model.ServiceFinishWebauthnLoginParam{
+		Credential: assertionCredential,
+		ClientID:   "PWA_v0.0.1"})
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+
+	// The replayed assertion has the same signature counter
+	_, err = newService.FinishWebauthnLogin(ctx, logger, model.ServiceFinishWebauthnLoginParam{
+		Credential: assertionCredential,
+		ClientID:   "PWA_v0.0.1"})
+	if err != authorization.ErrorBadWebauthnResponse {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorBadWebauthnResponse)
+	}
+
+	// A phishing site gets the assertion for its own origin
+	authenticator.Origin = "https://financelime.com.evil.com"
+	assertionCredential, err = authenticator.Assert(requestOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newService.FinishWebauthnLogin(ctx, logger, model.ServiceFinishWebauthnLoginParam{
+		Credential: assertionCredential,
+		ClientID:   "PWA_v0.0.1"})
+	if err != authorization.ErrorBadWebauthnResponse {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorBadWebauthnResponse)
+	}
+
+	_, err = newService.FinishWebauthnLogin(ctx, logger, model.ServiceFinishWebauthnLoginParam{ClientID: "PWA_v0.0.1"})
+	if err != authorization.ErrorBadParams {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorBadParams)
+	}
+}
+
+func atoi(t *testing.T, value string) int {
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return number
+}
+
+func TestServiceOauth(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var (
+		languageContent   config.LanguageContent
+		emailMessageQueue = make(chan sendmail.MessageBox, 1)
+		emailMessage      = new(sendmail.MockDescription)
+		authRepo          = new(repository.Mock)
+		contextGetter     = new(middleware.MockDescription)
+		accessTokenData   = []byte(`{"ID":2,"Email":"test.user@financelime.com","Password":"","Language":"en"}`)
+		redirectURI       = "https://client.com/callback"
+		codeVerifier      = strings.Repeat("v", 43)
+		verifierHash      = sha256.Sum256([]byte(codeVerifier))
+		codeChallenge     = base64.RawURLEncoding.EncodeToString(verifierHash[:])
+	)
+
+	authRepo.Props.OauthClient = model.OauthClient{
+		ClientID:     "client",
+		Name:         "Client",
+		RedirectURIs: []string{redirectURI},
+		GrantTypes:   []string{model.OauthGrantTypeAuthorizationCode, model.OauthGrantTypeRefreshToken}}
+	sendmail.MockData.Expected.Error = nil
+
+	languageContent.Language = make(map[string]int)
+	languageContent.Language["en"] = 0
+	languageContent.Data.User.Login.Email.Subject = append(languageContent.Data.User.Login.Email.Subject, "subject")
+	languageContent.Data.User.Login.Email.Body = append(languageContent.Data.User.Login.Email.Body, "%s%s%s%s")
+
+	cryptManager := new(secretdata.MockDescription)
+	token := new(jwt.MockDescription)
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60,
+			OidcIssuer: "https://domain.com"},
+		contextGetter,
+		languageContent,
+		emailMessageQueue,
+		emailMessage,
+		authRepo,
+		cryptManager,
+		cryptManager,
+		cryptManager,
+		token,
+		token,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	authorizeParam := model.ServiceAuthorizeParam{
+		AccessTokenData:     accessTokenData,
+		ResponseType:        "code",
+		ClientID:            "client",
+		RedirectURI:         redirectURI,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: "S256",
+		State:               "state",
+		Scope:               "openid profile",
+		Nonce:               "nonce"}
+
+	exchangeParam := model.ServiceExchangeTokenParam{
+		GrantType:    "authorization_code",
+		ClientID:     "client",
+		RedirectURI:  redirectURI,
+		CodeVerifier: codeVerifier}
+
+	authorize := func() string {
+		location, err := newService.Authorize(ctx, logger, authorizeParam)
+		if err != nil {
+			t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+		}
+		uri, err := url.Parse(location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uri.Query().Get("state") != "state" || uri.Query().Get("code") == "" {
+			t.Fatalf("service returned wrong the redirect URI: %s", location)
+		}
+		return uri.Query().Get("code")
+	}
+
+	// The authorization code is exchanged once
+
+	exchangeParam.Code = authorize()
+
+	tokens, err := newService.ExchangeToken(ctx, logger, exchangeParam)
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if tokens.AccessJWT == "" || tokens.RefreshJWT == "" || tokens.ExpiresIn != 60 {
+		t.Errorf("service returned wrong the tokens: %+v", tokens)
+	}
+
+	var idTokenClaims model.IDTokenClaims
+	err = testIDTokenSigner.Verify(tokens.IDToken, &idTokenClaims)
+	if err != nil {
+		t.Errorf("failed to verify the ID token: %v", err)
+	}
+	if idTokenClaims.Subject != "2" || idTokenClaims.Audience != "client" || idTokenClaims.Nonce != "nonce" ||
+		idTokenClaims.Issuer != "https://domain.com" || idTokenClaims.ExpiresAt != idTokenClaims.IssuedAt+60 {
+		t.Errorf("service returned wrong the ID token claims: %+v", idTokenClaims)
+	}
+
+	_, err = newService.ExchangeToken(ctx, logger, exchangeParam)
+	if err != authorization.ErrorInvalidGrant {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorInvalidGrant)
+	}
+
+	// The code verifier must match the code challenge
+
+	exchangeParam.Code = authorize()
+	exchangeParam.CodeVerifier = strings.Repeat("w", 43)
+
+	_, err = newService.ExchangeToken(ctx, logger, exchangeParam)
+	if err != authorization.ErrorInvalidGrant {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorInvalidGrant)
+	}
+
+	exchangeParam.CodeVerifier = codeVerifier
+
+	// The refresh token is bound to the client
+
+	authRepo.Props.Session = model.SessionRecord{UserID: 1, ClientID: "client", Scope: "openid"}
+
+	_, err = newService.ExchangeToken(ctx, logger, model.ServiceExchangeTokenParam{
+		GrantType:    "refresh_token",
+		ClientID:     "client",
+		RefreshToken: "refreshToken"})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+
+	// The errors
+
+	tests := []struct {
+		name          string
+		authorize     func(param *model.ServiceAuthorizeParam)
+		exchange      func(param *model.ServiceExchangeTokenParam)
+		expectedError error
+	}{
+		{"unknown client", func(param *model.ServiceAuthorizeParam) { param.ClientID = "unknown" }, nil,
+			authorization.ErrorInvalidClient},
+		{"unregistered redirect URI", func(param *model.ServiceAuthorizeParam) { param.RedirectURI = "https://evil.com" }, nil,
+			authorization.ErrorInvalidRedirectURI},
+		{"unsupported grant type", nil, func(param *model.ServiceExchangeTokenParam) { param.GrantType = "password" },
+			authorization.ErrorUnsupportedGrantType},
+		{"unknown client of the token request", nil, func(param *model.ServiceExchangeTokenParam) { param.ClientID = "unknown" },
+			authorization.ErrorInvalidClient},
+		{"missing code verifier", nil, func(param *model.ServiceExchangeTokenParam) { param.CodeVerifier = "" },
+			authorization.ErrorInvalidRequest},
+	}
+
+	for _, test := range tests {
+		if test.authorize != nil {
+			param := authorizeParam
+			test.authorize(&param)
+			_, err = newService.Authorize(ctx, logger, param)
+		} else {
+			param := exchangeParam
+			test.exchange(&param)
+			_, err = newService.ExchangeToken(ctx, logger, param)
+		}
+		if err != test.expectedError {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", test.name, err, test.expectedError)
+		}
+	}
+
+	// The other errors of the authorization request are sent to the client
+
+	param := authorizeParam
+	param.CodeChallengeMethod = "plain"
+	location, err := newService.Authorize(ctx, logger, param)
+	if err != nil || !strings.Contains(location, "error=invalid_request") {
+		t.Errorf("service returned wrong the redirect URI: got %s, %v", location, err)
+	}
+}
+
+func TestServiceOidc(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", OidcIssuer: "https://domain.com"},
+		new(middleware.MockDescription),
+		config.LanguageContent{},
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		new(repository.Mock),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(jwt.MockDescription),
+		new(jwt.MockDescription),
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	configuration := newService.GetOpenIDConfiguration()
+	if configuration.Issuer != "https://domain.com" || configuration.JwksURI != "https://domain.com/.well-known/jwks.json" {
+		t.Errorf("service returned wrong the configuration: %+v", configuration)
+	}
+
+	keySet := newService.GetJwks()
+	if len(keySet.Keys) != 1 || keySet.Keys[0].Algorithm != configuration.IDTokenSigningAlgValuesSupported[0] {
+		t.Errorf("service returned wrong the key set: %+v", keySet)
+	}
+
+	userInfo, err := newService.GetUserInfo(ctx, logger,
+		[]byte(`{"ID":2,"Email":"test.user@financelime.com","Password":"","Language":"en"}`))
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if userInfo.Subject != "2" || !userInfo.EmailVerified {
+		t.Errorf("service returned wrong the user info: %+v", userInfo)
+	}
+}
+
+func TestServiceIntrospectToken(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	authRepo := new(repository.Mock)
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "gateway", HashedSecret: "hashedSecret"}
+	authRepo.Props.Session = model.SessionRecord{UserID: 2, ClientID: "client", Scope: "openid"}
+
+	revocationStore := revocation.NewStore(revocation.NewMemoryBackend())
+
+	// The real tokens, so an access token doesn't pass for a refresh one
+
+	newToken := func(subject string) jwt.Jwt {
+		return jose.NewToken(testIDTokenSigner, jwt.Config{
+			Claims:           jwt.Claims{Issuer: "domain.com", Subject: subject},
+			ParseOptions:     jwt.ParseOptions{RequiredClaimIssuer: true, RequiredClaimSubject: true, RequiredClaimJwtID: true},
+			TokenLifetimeSec: 60})
+	}
+	jwtAccess := newToken("access")
+	jwtRefresh := newToken("refresh")
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60},
+		new(middleware.MockDescription),
+		config.LanguageContent{},
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		authRepo,
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		jwtAccess,
+		jwtRefresh,
+		revocationStore,
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	accessToken, err := jwtAccess.Create(jwt.Claims{JwtID: "sessionID", Data: "data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, err := jwtRefresh.Create(jwt.Claims{JwtID: "sessionID", Data: "data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	param := model.ServiceIntrospectTokenParam{ClientID: "gateway", ClientSecret: "secret", Token: accessToken}
+
+	for _, test := range []struct {
+		token         string
+		tokenTypeHint string
+	}{
+		{accessToken, ""},
+		{accessToken, "refresh_token"},
+		{refreshToken, "refresh_token"},
+		{refreshToken, ""},
+	} {
+		param.Token, param.TokenTypeHint = test.token, test.tokenTypeHint
+		introspection, err := newService.IntrospectToken(ctx, logger, param)
+		if err != nil {
+			t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+		}
+		if !introspection.Active || introspection.Subject != "2" || introspection.ClientID != "client" ||
+			introspection.Scope != "openid" || introspection.PublicSessionID != "sessionID" ||
+			introspection.ExpiresAt != introspection.IssuedAt+60 {
+			t.Errorf("service returned wrong the introspection: %+v", introspection)
+		}
+	}
+
+	// The inactive tokens
+
+	for _, test := range []struct {
+		name    string
+		token   string
+		prepare func()
+	}{
+		{"malformed token", "token", func() {}},
+		{"revoked access token", accessToken, func() {
+			if err := revocationStore.Revoke(ctx, "sessionID", time.Minute); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"deleted session", refreshToken, func() { authRepo.Props.Session = model.SessionRecord{} }},
+	} {
+		test.prepare()
+		param.Token, param.TokenTypeHint = test.token, ""
+		introspection, err := newService.IntrospectToken(ctx, logger, param)
+		if err != nil {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", test.name, err, nil)
+		}
+		if introspection != (model.TokenIntrospection{Active: false}) {
+			t.Errorf("%s: service returned wrong the introspection: %+v", test.name, introspection)
+		}
+	}
+
+	// The errors
+
+	for _, test := range []struct {
+		name          string
+		param         model.ServiceIntrospectTokenParam
+		prepare       func()
+		expectedError error
+	}{
+		{"unknown client", model.ServiceIntrospectTokenParam{ClientID: "unknown", Token: accessToken}, func() {},
+			authorization.ErrorInvalidClient},
+		{"empty token", model.ServiceIntrospectTokenParam{ClientID: "gateway", ClientSecret: "secret"}, func() {},
+			authorization.ErrorInvalidRequest},
+		{"public client", model.ServiceIntrospectTokenParam{ClientID: "gateway", Token: accessToken},
+			func() { authRepo.Props.OauthClient.HashedSecret = "" },
+			authorization.ErrorInvalidClient},
+	} {
+		test.prepare()
+		_, err = newService.IntrospectToken(ctx, logger, test.param)
+		if err != test.expectedError {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", test.name, err, test.expectedError)
+		}
+	}
+}
+
+func TestServiceRevokeToken(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	authRepo := new(repository.Mock)
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "client"}
+	authRepo.Props.Session = model.SessionRecord{UserID: 2, ClientID: "client"}
+
+	revocationStore := revocation.NewStore(revocation.NewMemoryBackend())
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60},
+		new(middleware.MockDescription),
+		config.LanguageContent{},
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		authRepo,
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(jwt.MockDescription),
+		new(jwt.MockDescription),
+		revocationStore,
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	param := model.ServiceRevokeTokenParam{ClientID: "client", Token: "refreshToken", TokenTypeHint: "refresh_token"}
+
+	err := newService.RevokeToken(ctx, logger, param)
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+
+	// The access token of the session is revoked as well
+
+	err = newService.CheckAccessTokenRevocation(ctx, logger, "jwtID")
+	if err != authorization.ErrorAccessTokenRevoked {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorAccessTokenRevoked)
+	}
+
+	// The revocation is idempotent
+
+	authRepo.Props.Session = model.SessionRecord{}
+	err = newService.RevokeToken(ctx, logger, param)
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+
+	// The errors
+
+	authRepo.Props.Session = model.SessionRecord{UserID: 2, ClientID: "another"}
+
+	tests := []struct {
+		name          string
+		param         model.ServiceRevokeTokenParam
+		expectedError error
+	}{
+		{"token of another client", model.ServiceRevokeTokenParam{ClientID: "client", Token: "accessToken"},
+			authorization.ErrorUnauthorizedClient},
+		{"unknown client", model.ServiceRevokeTokenParam{ClientID: "unknown", Token: "accessToken"},
+			authorization.ErrorInvalidClient},
+		{"empty token", model.ServiceRevokeTokenParam{ClientID: "client"},
+			authorization.ErrorInvalidRequest},
+	}
+
+	for _, test := range tests {
+		err = newService.RevokeToken(ctx, logger, test.param)
+		if err != test.expectedError {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", test.name, err, test.expectedError)
+		}
+	}
+}
+
+func TestServiceClientCredentials(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	authRepo := new(repository.Mock)
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "gateway", HashedSecret: "hashedSecret"}
+	authRepo.Props.ServiceAccount = model.ServiceAccount{ClientID: "billing-job", Scope: "read:users write:reports"}
+
+	jwtAccess := jose.NewToken(testIDTokenSigner, jwt.Config{
+		Claims:           jwt.Claims{Issuer: "domain.com", Subject: "access"},
+		ParseOptions:     jwt.ParseOptions{RequiredClaimIssuer: true, RequiredClaimSubject: true, RequiredClaimJwtID: true},
+		TokenLifetimeSec: 60})
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60},
+		new(middleware.MockDescription),
+		config.LanguageContent{},
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		authRepo,
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		jwtAccess,
+		new(jwt.MockDescription),
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	param := model.ServiceExchangeTokenParam{GrantType: "client_credentials", ClientID: "billing-job", ClientSecret: "secret"}
+
+	// All the scopes of the account are granted if none is requested
+
+	tokens, err := newService.ExchangeToken(ctx, logger, param)
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if tokens.AccessJWT == "" || tokens.RefreshJWT != "" || tokens.ExpiresIn != 60 ||
+		tokens.Scope != "read:users write:reports" {
+		t.Errorf("service returned wrong the tokens: %+v", tokens)
+	}
+
+	param.Scope = "read:users"
+	tokens, err = newService.ExchangeToken(ctx, logger, param)
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if tokens.Scope != "read:users" {
+		t.Errorf("service returned wrong the scope: got %v want %v", tokens.Scope, "read:users")
+	}
+
+	// The gateway sees the account and the granted scope
+
+	introspection, err := newService.IntrospectToken(ctx, logger, model.ServiceIntrospectTokenParam{
+		ClientID: "gateway", ClientSecret: "secret", Token: tokens.AccessJWT})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if !introspection.Active || introspection.Subject != "billing-job" || introspection.ClientID != "billing-job" ||
+		introspection.Scope != "read:users" || introspection.PublicSessionID != "" {
+		t.Errorf("service returned wrong the introspection: %+v", introspection)
+	}
+
+	// The token is not accepted by the endpoints of the users
+
+	jwtData, _, err := jwtAccess.Parse(tokens.AccessJWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = newService.CheckAccessTokenRevocation(ctx, logger, jwtData.Claims.JwtID)
+	if err != authorization.ErrorAccessTokenRevoked {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorAccessTokenRevoked)
+	}
+
+	// The errors
+
+	tests := []struct {
+		name          string
+		param         model.ServiceExchangeTokenParam
+		expectedError error
+	}{
+		{"scope not allowed", model.ServiceExchangeTokenParam{GrantType: "client_credentials", ClientID: "billing-job",
+			ClientSecret: "secret", Scope: "read:users delete:users"}, authorization.ErrorInvalidScope},
+		{"unknown account", model.ServiceExchangeTokenParam{GrantType: "client_credentials", ClientID: "gateway",
+			ClientSecret: "secret"}, authorization.ErrorInvalidClient},
+		{"no client", model.ServiceExchangeTokenParam{GrantType: "client_credentials"},
+			authorization.ErrorInvalidClient},
+	}
+
+	for _, test := range tests {
+		_, err = newService.ExchangeToken(ctx, logger, test.param)
+		if err != test.expectedError {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", test.name, err, test.expectedError)
+		}
+	}
+
+	// The management of the accounts
+
+	credentials, err := newService.CreateServiceAccount(ctx, logger, model.ServiceCreateServiceAccountParam{
+		Name: "Reports", Scope: "read:users"})
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if credentials.ClientID == "" || len(credentials.ClientSecret) != clientSecretByteLength*2 {
+		t.Errorf("service returned wrong the credentials: %+v", credentials)
+	}
+
+	rotated, err := newService.UpdateServiceAccount(ctx, logger, model.ServiceUpdateServiceAccountParam{
+		ClientID: credentials.ClientID, RotateSecret: true})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if rotated.ClientSecret == "" || rotated.ClientSecret == credentials.ClientSecret {
+		t.Errorf("service returned wrong the rotated secret: %+v", rotated)
+	}
+
+	_, err = newService.UpdateServiceAccount(ctx, logger, model.ServiceUpdateServiceAccountParam{
+		ClientID: credentials.ClientID})
+	if err != authorization.ErrorBadParams {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorBadParams)
+	}
+
+	err = newService.DeleteServiceAccount(ctx, logger, "unknown-job")
+	if err != authorization.ErrorServiceAccountNotFound {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorServiceAccountNotFound)
+	}
+
+	// The token is inactive once the account is deleted
+
+	authRepo.Props.ServiceAccount = model.ServiceAccount{}
+	introspection, err = newService.IntrospectToken(ctx, logger, model.ServiceIntrospectTokenParam{
+		ClientID: "gateway", ClientSecret: "secret", Token: tokens.AccessJWT})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if introspection.Active {
+		t.Errorf("service returned wrong the introspection: %+v", introspection)
+	}
+}
+
+func TestServiceDeviceAuthorization(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var (
+		languageContent config.LanguageContent
+		authRepo        = new(repository.Mock)
+		cryptManager    = new(secretdata.MockDescription)
+		token           = new(jwt.MockDescription)
+		accessTokenData = []byte(`{"ID":2,"Email":"test.user@financelime.com","Password":"","Language":"en"}`)
+	)
+
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "cli", Name: "CLI",
+		GrantTypes: []string{model.OauthGrantTypeDeviceCode, model.OauthGrantTypeRefreshToken}}
+
+	languageContent.Language = make(map[string]int)
+	languageContent.Language["en"] = 0
+	languageContent.Data.User.Login.Email.Subject = append(languageContent.Data.User.Login.Email.Subject, "subject")
+	languageContent.Data.User.Login.Email.Body = append(languageContent.Data.User.Login.Email.Body, "%s%s%s%s")
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60,
+			OidcIssuer: "https://domain.com"},
+		new(middleware.MockDescription),
+		languageContent,
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		authRepo,
+		cryptManager,
+		cryptManager,
+		cryptManager,
+		token,
+		token,
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	deviceAuthorization, err := newService.CreateDeviceAuthorization(ctx, logger, model.ServiceDeviceAuthorizationParam{
+		ClientID: "cli", Scope: "openid offline_access"})
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if deviceAuthorization.DeviceCode == "" || deviceAuthorization.ExpiresIn != 600 || deviceAuthorization.Interval != 5 ||
+		deviceAuthorization.VerificationURI != "https://financelime.com/device" {
+		t.Errorf("service returned wrong the device authorization: %+v", deviceAuthorization)
+	}
+	if !regexp.MustCompile(`^[abcefghijkmnopqrtuvwxyz23479]{4}-[abcefghijkmnopqrtuvwxyz23479]{4}$`).
+		MatchString(deviceAuthorization.UserCode) {
+		t.Errorf("service returned wrong the user code: %s", deviceAuthorization.UserCode)
+	}
+	if authRepo.Props.DeviceAuthorization.Scope != "openid" {
+		t.Errorf("service stored wrong the scope: got %v want %v", authRepo.Props.DeviceAuthorization.Scope, "openid")
+	}
+
+	exchangeParam := model.ServiceExchangeTokenParam{
+		GrantType:  "urn:ietf:params:oauth:grant-type:device_code",
+		ClientID:   "cli",
+		DeviceCode: deviceAuthorization.DeviceCode}
+
+	// The device waits for the user
+
+	_, err = newService.ExchangeToken(ctx, logger, exchangeParam)
+	if err != authorization.ErrorAuthorizationPending {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorAuthorizationPending)
+	}
+
+	// Every slow_down adds 5 seconds to the interval of the request
+
+	authRepo.Props.DeviceAuthorization.SlowDown = true
+	for i := 0; i < 2; i++ {
+		_, err = newService.ExchangeToken(ctx, logger, exchangeParam)
+		if err != authorization.ErrorSlowDown {
+			t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorSlowDown)
+		}
+	}
+	if interval := authRepo.Props.DeviceAuthorization.Interval; interval != devicePollingInterval+2*deviceSlowDownIncrement {
+		t.Errorf("service returned wrong the interval: got %v want %v", interval,
+			devicePollingInterval+2*deviceSlowDownIncrement)
+	}
+	authRepo.Props.DeviceAuthorization.SlowDown = false
+
+	// The user checks the request, the code is typed in any case and with the dash
+
+	userCode := strings.ToUpper(deviceAuthorization.UserCode)
+
+	verification, err := newService.GetDeviceAuthorization(ctx, logger, userCode)
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if verification.ClientID != "cli" || verification.ClientName != "CLI" || verification.Scope != "openid" {
+		t.Errorf("service returned wrong the verification: %+v", verification)
+	}
+
+	err = newService.ApproveDeviceAuthorization(ctx, logger, model.ServiceApproveDeviceAuthorizationParam{
+		AccessTokenData: accessTokenData, UserCode: userCode, Approved: true})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+
+	// The device of another client can't use the code
+
+	_, err = newService.ExchangeToken(ctx, logger, model.ServiceExchangeTokenParam{
+		GrantType: "urn:ietf:params:oauth:grant-type:device_code", DeviceCode: deviceAuthorization.DeviceCode})
+	if err != authorization.ErrorInvalidClient {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorInvalidClient)
+	}
+
+	// The device gets the tokens of the user once
+
+	tokens, err := newService.ExchangeToken(ctx, logger, exchangeParam)
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if tokens.AccessJWT == "" || tokens.RefreshJWT == "" || tokens.IDToken == "" {
+		t.Errorf("service returned wrong the tokens: %+v", tokens)
+	}
+
+	var idTokenClaims model.IDTokenClaims
+	err = testIDTokenSigner.Verify(tokens.IDToken, &idTokenClaims)
+	if err != nil {
+		t.Errorf("failed to verify the ID token: %v", err)
+	}
+	if idTokenClaims.Subject != "2" || idTokenClaims.Audience != "cli" {
+		t.Errorf("service returned wrong the ID token claims: %+v", idTokenClaims)
+	}
+
+	_, err = newService.ExchangeToken(ctx, logger, exchangeParam)
+	if err != authorization.ErrorInvalidGrant {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorInvalidGrant)
+	}
+
+	// The denied request
+
+	deviceAuthorization, err = newService.CreateDeviceAuthorization(ctx, logger, model.ServiceDeviceAuthorizationParam{
+		ClientID: "cli"})
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	exchangeParam.DeviceCode = deviceAuthorization.DeviceCode
+
+	err = newService.ApproveDeviceAuthorization(ctx, logger, model.ServiceApproveDeviceAuthorizationParam{
+		AccessTokenData: accessTokenData, UserCode: deviceAuthorization.UserCode, Approved: false})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	err = newService.ApproveDeviceAuthorization(ctx, logger, model.ServiceApproveDeviceAuthorizationParam{
+		AccessTokenData: accessTokenData, UserCode: deviceAuthorization.UserCode, Approved: true})
+	if err != authorization.ErrorUserCodeNotFound {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorUserCodeNotFound)
+	}
+
+	_, err = newService.ExchangeToken(ctx, logger, exchangeParam)
+	if err != authorization.ErrorAccessDenied {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorAccessDenied)
+	}
+
+	authRepo.Props.DeviceAuthorization.Expired = true
+	_, err = newService.ExchangeToken(ctx, logger, exchangeParam)
+	if err != authorization.ErrorExpiredToken {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorExpiredToken)
+	}
+
+	// The errors
+
+	tests := []struct {
+		name          string
+		userCode      string
+		expectedError error
+	}{
+		{"empty user code", "", authorization.ErrorUserCodeNotFound},
+		{"ambiguous characters", "lo01-lo01", authorization.ErrorUserCodeNotFound},
+		{"unknown user code", "wdjb-mjht", authorization.ErrorUserCodeNotFound},
+	}
+
+	for _, test := range tests {
+		_, err = newService.GetDeviceAuthorization(ctx, logger, test.userCode)
+		if err != test.expectedError {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", test.name, err, test.expectedError)
+		}
+	}
+
+	_, err = newService.CreateDeviceAuthorization(ctx, logger, model.ServiceDeviceAuthorizationParam{ClientID: "unknown"})
+	if err != authorization.ErrorInvalidClient {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorInvalidClient)
+	}
+}
+
+func TestServiceTokenExchange(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	authRepo := new(repository.Mock)
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "finance-api", HashedSecret: "hashedSecret",
+		GrantTypes: []string{model.OauthGrantTypeTokenExchange}}
+	authRepo.Props.OauthClients = []model.OauthClient{
+		{ClientID: "reporting-api", HashedSecret: "hashedSecret", GrantTypes: []string{model.OauthGrantTypeTokenExchange}},
+		{ClientID: "PWA", GrantTypes: []string{model.OauthGrantTypePassword, model.OauthGrantTypeRefreshToken}}}
+	authRepo.Props.Session = model.SessionRecord{UserID: 2, ClientID: "PWA", Scope: "read:reports write:reports"}
+
+	revocationStore := revocation.NewStore(revocation.NewMemoryBackend())
+
+	jwtAccess := jose.NewToken(testIDTokenSigner, jwt.Config{
+		Claims:           jwt.Claims{Issuer: "domain.com", Subject: "access"},
+		ParseOptions:     jwt.ParseOptions{RequiredClaimIssuer: true, RequiredClaimSubject: true, RequiredClaimJwtID: true},
+		TokenLifetimeSec: 60})
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60},
+		new(middleware.MockDescription),
+		config.LanguageContent{},
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		authRepo,
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		jwtAccess,
+		new(jwt.MockDescription),
+		revocationStore,
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	subjectToken, err := jwtAccess.Create(jwt.Claims{
+		JwtID: "publicSessionID",
+		Data:  `{"ID":2,"Email":"test.user@financelime.com","Password":"","Language":"en"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	param := model.ServiceExchangeTokenParam{
+		GrantType:        "urn:ietf:params:oauth:grant-type:token-exchange",
+		ClientID:         "finance-api",
+		ClientSecret:     "secret",
+		SubjectToken:     subjectToken,
+		SubjectTokenType: "urn:ietf:params:oauth:token-type:access_token",
+		Audience:         "reporting-api",
+		Scope:            "read:reports"}
+
+	tokens, err := newService.ExchangeToken(ctx, logger, param)
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if tokens.AccessJWT == "" || tokens.RefreshJWT != "" || tokens.Scope != "read:reports" ||
+		tokens.IssuedTokenType != "urn:ietf:params:oauth:token-type:access_token" {
+		t.Errorf("service returned wrong the tokens: %+v", tokens)
+	}
+
+	// The audience sees the user, the actor and the narrowed scope
+
+	introspection, err := newService.IntrospectToken(ctx, logger, model.ServiceIntrospectTokenParam{
+		ClientID: "finance-api", ClientSecret: "secret", Token: tokens.AccessJWT})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if !introspection.Active || introspection.Subject != "2" || introspection.Audience != "reporting-api" ||
+		introspection.ClientID != "finance-api" || introspection.Scope != "read:reports" ||
+		introspection.Act == nil || introspection.Act.Subject != "finance-api" ||
+		introspection.PublicSessionID != "publicSessionID" {
+		t.Errorf("service returned wrong the introspection: %+v", introspection)
+	}
+
+	// The exchanged token is exchanged again, the actors are nested
+
+	authRepo.Props.OauthClient.ClientID = "reporting-api"
+	authRepo.Props.OauthClients = append(authRepo.Props.OauthClients, model.OauthClient{
+		ClientID: "storage-api", HashedSecret: "hashedSecret"})
+
+	chainedTokens, err := newService.ExchangeToken(ctx, logger, model.ServiceExchangeTokenParam{
+		GrantType:        "urn:ietf:params:oauth:grant-type:token-exchange",
+		ClientID:         "reporting-api",
+		SubjectToken:     tokens.AccessJWT,
+		SubjectTokenType: "urn:ietf:params:oauth:token-type:access_token",
+		Audience:         "storage-api"})
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	introspection, err = newService.IntrospectToken(ctx, logger, model.ServiceIntrospectTokenParam{
+		ClientID: "reporting-api", ClientSecret: "secret", Token: chainedTokens.AccessJWT})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if introspection.Scope != "read:reports" || introspection.Act == nil || introspection.Act.Subject != "reporting-api" ||
+		introspection.Act.Actor == nil || introspection.Act.Actor.Subject != "finance-api" {
+		t.Errorf("service returned wrong the introspection: %+v", introspection)
+	}
+
+	// The token is not accepted by the endpoints of the users
+
+	jwtData, _, err := jwtAccess.Parse(tokens.AccessJWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = newService.CheckAccessTokenRevocation(ctx, logger, jwtData.Claims.JwtID)
+	if err != authorization.ErrorAccessTokenRevoked {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorAccessTokenRevoked)
+	}
+
+	// The errors
+
+	authRepo.Props.OauthClient.ClientID = "finance-api"
+
+	tests := []struct {
+		name          string
+		modify        func(param *model.ServiceExchangeTokenParam)
+		expectedError error
+	}{
+		{"scope not granted", func(param *model.ServiceExchangeTokenParam) { param.Scope = "delete:reports" },
+			authorization.ErrorInvalidScope},
+		{"unknown audience", func(param *model.ServiceExchangeTokenParam) { param.Audience = "unknown" },
+			authorization.ErrorInvalidTarget},
+		{"public audience", func(param *model.ServiceExchangeTokenParam) { param.Audience = "PWA" },
+			authorization.ErrorInvalidTarget},
+		{"no audience", func(param *model.ServiceExchangeTokenParam) { param.Audience = "" },
+			authorization.ErrorInvalidTarget},
+		{"public client", func(param *model.ServiceExchangeTokenParam) { param.ClientID = "PWA" },
+			authorization.ErrorUnauthorizedClient},
+		{"refresh token type", func(param *model.ServiceExchangeTokenParam) {
+			param.SubjectTokenType = "urn:ietf:params:oauth:token-type:refresh_token"
+		}, authorization.ErrorInvalidRequest},
+		{"id token requested", func(param *model.ServiceExchangeTokenParam) {
+			param.RequestedTokenType = "urn:ietf:params:oauth:token-type:id_token"
+		}, authorization.ErrorInvalidRequest},
+		{"invalid subject token", func(param *model.ServiceExchangeTokenParam) { param.SubjectToken = "token" },
+			authorization.ErrorInvalidGrant},
+	}
+
+	for _, test := range tests {
+		testParam := param
+		test.modify(&testParam)
+		_, err = newService.ExchangeToken(ctx, logger, testParam)
+		if err != test.expectedError {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", test.name, err, test.expectedError)
+		}
+	}
+
+	// The full access of the first-party session is narrowed to a scope only
+
+	authRepo.Props.Session.Scope = ""
+	testParam := param
+	testParam.Scope = ""
+	_, err = newService.ExchangeToken(ctx, logger, testParam)
+	if err != authorization.ErrorInvalidScope {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorInvalidScope)
+	}
+	testParam.Scope = "read:reports"
+	_, err = newService.ExchangeToken(ctx, logger, testParam)
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+
+	// The exchanged token is revoked with the session of the subject token
+
+	authRepo.Props.Session = model.SessionRecord{}
+	introspection, err = newService.IntrospectToken(ctx, logger, model.ServiceIntrospectTokenParam{
+		ClientID: "finance-api", ClientSecret: "secret", Token: tokens.AccessJWT})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if introspection.Active {
+		t.Errorf("service returned wrong the introspection: %+v", introspection)
+	}
+	_, err = newService.ExchangeToken(ctx, logger, param)
+	if err != authorization.ErrorInvalidGrant {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorInvalidGrant)
+	}
+}
+
+func TestServiceAccessTokenScope(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var languageContent config.LanguageContent
+	languageContent.Language = map[string]int{"en": 0}
+	languageContent.Data.User.Login.Email.Subject = []string{"subject"}
+	languageContent.Data.User.Login.Email.Body = []string{"%s%s%s%s"}
+
+	authRepo := new(repository.Mock)
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "PWA", Scope: "read:reports write:reports",
+		Audience: "finance-api", GrantTypes: []string{model.OauthGrantTypePassword}, AccessTokenLifetime: 600}
+
+	jwtAccess := jose.NewToken(testIDTokenSigner, jwt.Config{
+		Claims:           jwt.Claims{Issuer: "domain.com", Subject: "access"},
+		ParseOptions:     jwt.ParseOptions{RequiredClaimIssuer: true, RequiredClaimSubject: true, RequiredClaimJwtID: true},
+		TokenLifetimeSec: 60})
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60},
+		new(middleware.MockDescription),
+		languageContent,
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		authRepo,
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		jwtAccess,
+		new(jwt.MockDescription),
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	tests := []struct {
+		name          string
+		scope         string
+		expectedScope string
+		expectedError error
+	}{
+		{"all the registered scopes", "", "read:reports write:reports", nil},
+		{"the requested scope", "read:reports", "read:reports", nil},
+		{"the scope is not registered", "read:reports delete:reports", "", authorization.ErrorInvalidScope},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			tokens, err := newService.CreateAccessToken(ctx, logger, model.ServiceCreateAccessTokenParam{
+				Email:    "email",
+				Password: "password",
+				ClientID: "PWA",
+				Scope:    test.scope})
+
+			if err != test.expectedError {
+				t.Fatalf("service returned wrong the err value: got %v want %v", err, test.expectedError)
+			}
+			if err != nil {
+				return
+			}
+			if tokens.Scope != test.expectedScope {
+				t.Errorf("service returned wrong the scope value: got %v want %v", tokens.Scope, test.expectedScope)
+			}
+
+			claims, err := readTokenClaims(tokens.AccessJWT)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Scope != test.expectedScope || claims.Audience != "finance-api" {
+				t.Errorf("service returned wrong the claims: %+v", claims)
+			}
+
+			// The access token has the lifetime of the client, not the one of the config
+
+			if tokens.ExpiresIn != 600 || claims.ExpiresAt-claims.IssuedAt != 600 {
+				t.Errorf("service returned wrong the lifetime: got %d, the claims %+v", tokens.ExpiresIn, claims)
+			}
+		})
+	}
+}
+
+func TestServiceUserAccessToken(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60},
+		new(middleware.MockDescription),
+		config.LanguageContent{},
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		new(repository.Mock),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(jwt.MockDescription),
+		new(jwt.MockDescription),
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	tests := []struct {
+		name          string
+		user          model.User
+		expectedError error
+	}{
+		{"the token of the user", model.User{ID: 2, Scope: "read:reports"}, nil},
+		{"the token of this API", model.User{ID: 2, Audience: "domain.com"}, nil},
+		{"the token of another audience", model.User{ID: 2, Audience: "finance-api"},
+			authorization.ErrorAccessTokenNotAccepted},
+		{"the delegated token", model.User{ID: 2, Scope: "read:reports", Audience: "finance-api",
+			Act: &model.Actor{Subject: "reporting-api"}}, authorization.ErrorAccessTokenNotAccepted},
+		{"the token of the service account", model.User{ServiceAccount: "billing-job", Scope: "read:users"},
+			authorization.ErrorAccessTokenNotAccepted},
+		{"the token without the user", model.User{}, authorization.ErrorAccessTokenNotAccepted},
+	}
+
+	for _, test := range tests {
+
+		accessTokenData, err := json.Marshal(test.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = newService.CheckUserAccessToken(ctx, logger, accessTokenData)
+		if err != test.expectedError {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", test.name, err, test.expectedError)
+		}
+	}
+}
+
+func TestServiceUserAccess(t *testing.T) {
+
+	var accessClaims struct {
+		Roles       []string `json:"roles"`
+		Permissions []string `json:"permissions"`
+	}
+	var user model.User
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var languageContent config.LanguageContent
+	languageContent.Language = map[string]int{"en": 0}
+	languageContent.Data.User.Login.Email.Subject = []string{"subject"}
+	languageContent.Data.User.Login.Email.Body = []string{"%s%s%s%s"}
+
+	authRepo := new(repository.Mock)
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "PWA",
+		GrantTypes: []string{model.OauthGrantTypePassword, model.OauthGrantTypeRefreshToken}}
+	authRepo.Props.UserAccess = model.UserAccess{Roles: []string{"admin"}, Permissions: []string{"admin", "reports:write"}}
+
+	jwtAccess := jose.NewToken(testIDTokenSigner, jwt.Config{
+		Claims:           jwt.Claims{Issuer: "domain.com", Subject: "access"},
+		ParseOptions:     jwt.ParseOptions{RequiredClaimIssuer: true, RequiredClaimSubject: true, RequiredClaimJwtID: true},
+		TokenLifetimeSec: 60})
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60},
+		new(middleware.MockDescription),
+		languageContent,
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		authRepo,
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		jwtAccess,
+		new(jwt.MockDescription),
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	// readAccess reads the roles and the permissions of the claims and of the token data
+	readAccess := func(accessToken string) {
+		payload, err := base64.RawURLEncoding.DecodeString(strings.Split(accessToken, ".")[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal(payload, &accessClaims); err != nil {
+			t.Fatal(err)
+		}
+		jwtData, _, err := jwtAccess.Parse(accessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal([]byte(jwtData.Claims.Data), &user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tokens, err := newService.CreateAccessToken(ctx, logger, model.ServiceCreateAccessTokenParam{
+		Email:    "email",
+		Password: "password",
+		ClientID: "PWA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAccess(tokens.AccessJWT)
+	if strings.Join(accessClaims.Roles, " ") != "admin" || strings.Join(accessClaims.Permissions, " ") != "admin reports:write" {
+		t.Errorf("service returned wrong the claims: %+v", accessClaims)
+	}
+	if strings.Join(user.Permissions, " ") != "admin reports:write" {
+		t.Errorf("service returned wrong the token data: %+v", user)
+	}
+
+	// The role has been revoked, the refreshed token has no permissions
+
+	authRepo.Props.UserAccess = model.UserAccess{}
+	authRepo.Props.Session = model.SessionRecord{UserID: 2, ClientID: "PWA"}
+
+	tokens, err = newService.RefreshAccessToken(ctx, logger, model.ServiceRefreshAccessTokenParam{
+		RefreshToken: tokens.RefreshJWT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessClaims.Roles, accessClaims.Permissions, user.Permissions = nil, nil, nil
+	readAccess(tokens.AccessJWT)
+	if len(accessClaims.Roles) != 0 || len(accessClaims.Permissions) != 0 || len(user.Permissions) != 0 {
+		t.Errorf("service returned the revoked permissions: %+v, %+v", accessClaims, user)
+	}
+
+	// The token of the authorization code has no roles of the admin, it's the same with the admin scope granted
+
+	authRepo.Props.UserAccess = model.UserAccess{Roles: []string{"admin"}, Permissions: []string{"admin"}}
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "client", Scope: "user admin",
+		RedirectURIs: []string{"https://client.com/callback"},
+		GrantTypes:   []string{model.OauthGrantTypeAuthorizationCode, model.OauthGrantTypeRefreshToken}}
+	codeVerifier := strings.Repeat("v", 43)
+	verifierHash := sha256.Sum256([]byte(codeVerifier))
+
+	for _, test := range []struct {
+		scope       string
+		permissions string
+	}{
+		{"openid user", ""},
+		{"openid admin", "admin"},
+	} {
+		location, err := newService.Authorize(ctx, logger, model.ServiceAuthorizeParam{
+			AccessTokenData:     []byte(`{"ID":2,"Email":"test.user@financelime.com","Language":"en"}`),
+			ResponseType:        "code",
+			ClientID:            "client",
+			RedirectURI:         "https://client.com/callback",
+			CodeChallenge:       base64.RawURLEncoding.EncodeToString(verifierHash[:]),
+			CodeChallengeMethod: "S256",
+			Scope:               test.scope})
+		if err != nil {
+			t.Fatal(err)
+		}
+		uri, err := url.Parse(location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens, err = newService.ExchangeToken(ctx, logger, model.ServiceExchangeTokenParam{
+			GrantType:    "authorization_code",
+			ClientID:     "client",
+			Code:         uri.Query().Get("code"),
+			RedirectURI:  "https://client.com/callback",
+			CodeVerifier: codeVerifier})
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessClaims.Roles, accessClaims.Permissions, user.Permissions = nil, nil, nil
+		readAccess(tokens.AccessJWT)
+		if strings.Join(accessClaims.Permissions, " ") != test.permissions ||
+			strings.Join(user.Permissions, " ") != test.permissions {
+			t.Errorf("%s: service returned wrong the permissions: %+v, %+v", test.scope, accessClaims, user)
+		}
+	}
+
+	// The role must exist
+
+	authRepo.Props.UserAccess = model.UserAccess{}
+
+	err = newService.AssignUserRole(ctx, logger, model.ServiceUserRoleParam{UserID: 2, Role: "support"})
+	if err != authorization.ErrorRoleNotFound {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorRoleNotFound)
+	}
+	err = newService.RevokeUserRole(ctx, logger, model.ServiceUserRoleParam{UserID: 2, Role: "admin"})
+	if err != authorization.ErrorRoleNotFound {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorRoleNotFound)
+	}
+}
+
+func TestServiceAdminUser(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var languageContent config.LanguageContent
+	languageContent.Language = map[string]int{"en": 0}
+	languageContent.Data.User.ResetPassword.Email.Request.Subject = []string{"subject"}
+	languageContent.Data.User.ResetPassword.Email.Request.Body = []string{"%s%s%s"}
+	languageContent.Data.User.Signup.Email.Request.Subject = []string{"subject"}
+	languageContent.Data.User.Signup.Email.Request.Body = []string{"%s%s%s"}
+
+	authRepo := new(repository.Mock)
+	authRepo.Props.UserRecord = model.UserRecord{ID: 2, Email: "test.user@financelime.com", Language: "en"}
+	authRepo.Props.UserAccess = model.UserAccess{Roles: []string{"admin"}}
+	authRepo.Props.Totp = model.Totp{ConfirmedAt: &time.Time{}}
+	sendmail.MockData.Expected.Error = nil
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60},
+		new(middleware.MockDescription),
+		languageContent,
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		authRepo,
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(jwt.MockDescription),
+		new(jwt.MockDescription),
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	detail, err := newService.GetUserDetail(ctx, logger, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.User.Email != "test.user@financelime.com" || !detail.Mfa.Totp || strings.Join(detail.Roles, " ") != "admin" {
+		t.Errorf("service returned wrong the detail: %+v", detail)
+	}
+
+	if _, err = newService.GetUserDetail(ctx, logger, 3); err != authorization.ErrorUserNotFound {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorUserNotFound)
+	}
+
+	// The sessions are revoked by all the actions that lock the user out
+
+	for sessionID, action := range map[string]func(ctx context.Context, logger *zap.Logger, userID int64) error{
+		"disabledSessionID": newService.DisableUser,
+		"resetSessionID":    newService.ForceUserPasswordReset,
+		"deletedSessionID":  newService.DeleteUser} {
+
+		authRepo.Props.PublicSessionIDs = []string{sessionID}
+		if err = newService.CheckAccessTokenRevocation(ctx, logger, sessionID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = action(ctx, logger, 2); err != nil {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", sessionID, err, nil)
+		}
+		if err = newService.CheckAccessTokenRevocation(ctx, logger, sessionID); err != authorization.ErrorAccessTokenRevoked {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", sessionID, err,
+				authorization.ErrorAccessTokenRevoked)
+		}
+
+		if err = action(ctx, logger, 3); err != authorization.ErrorUserNotFound {
+			t.Errorf("%s: service returned wrong the err value: got %v want %v", sessionID, err,
+				authorization.ErrorUserNotFound)
+		}
+	}
+
+	if err = newService.ResendSignUpConfirmation(ctx, logger, "new.user@financelime.com"); err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+
+	authRepo.Expected.Error = authorization.ErrorUserAlreadyExist
+	if err = newService.ResendSignUpConfirmation(ctx, logger, "test.user@financelime.com"); err != authorization.ErrorUserAlreadyExist {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorUserAlreadyExist)
+	}
+}
+
+func TestServiceUserStatus(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	authRepo := new(repository.Mock)
+	authRepo.Props.UserRecord = model.UserRecord{ID: 2, Email: "test.user@financelime.com", Language: "en"}
+	authRepo.Props.Session = model.SessionRecord{UserID: 2, ClientID: "PWA"}
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "PWA",
+		GrantTypes: []string{model.OauthGrantTypePassword, model.OauthGrantTypeRefreshToken}}
+
+	var newService = NewService(
+		model.ConfigService{DomainAPI: "domain.com", AccessTokenLifetime: 60},
+		new(middleware.MockDescription),
+		config.LanguageContent{},
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		authRepo,
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(jwt.MockDescription),
+		new(jwt.MockDescription),
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	// The user who is not active can't get the tokens
+
+	authRepo.Props.UserStatus = model.UserStatusSuspended
+
+	_, err := newService.CreateAccessToken(ctx, logger, model.ServiceCreateAccessTokenParam{
+		Email:     "test.user@financelime.com",
+		Password:  "password",
+		ClientID:  "PWA",
+		UserAgent: "userAgent",
+	})
+	if err != authorization.ErrorUserSuspended {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorUserSuspended)
+	}
+
+	authRepo.Props.UserStatus = model.UserStatusLocked
+
+	_, err = newService.RefreshAccessToken(ctx, logger, model.ServiceRefreshAccessTokenParam{RefreshToken: "refreshToken"})
+	if err != authorization.ErrorUserLocked {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorUserLocked)
+	}
+
+	// The user got by the ID has the error of the status as well
+
+	authRepo.Props.UserStatus = model.UserStatusBanned
+
+	_, err = newService.GetUserInfo(ctx, logger, []byte(`{"ID":2}`))
+	if err != authorization.ErrorUserBanned {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorUserBanned)
+	}
+
+	// The disabled user is locked without a limit, the disabling is idempotent
+
+	authRepo.Props.UserRecord.Status = model.UserStatusLocked
+	authRepo.Props.PublicSessionIDs = []string{"disabledSessionID"}
+
+	if err = newService.DisableUser(ctx, logger, 2); err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if len(authRepo.Props.PublicSessionIDs) != 1 {
+		t.Errorf("service disabled the user again: %v", authRepo.Props.PublicSessionIDs)
+	}
+	authRepo.Props.UserRecord.Status = model.UserStatusActive
+
+	// The sessions are revoked on the suspension
+
+	authRepo.Props.UserStatus = model.UserStatusActive
+	authRepo.Props.PublicSessionIDs = []string{"suspendedSessionID"}
+
+	expiresAt := time.Now().Add(time.Hour)
+	err = newService.UpdateUserStatus(ctx, logger, model.ServiceUpdateUserStatusParam{
+		UserID:    2,
+		Status:    model.UserStatusSuspended,
+		Reason:    "chargeback",
+		ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if err = newService.CheckAccessTokenRevocation(ctx, logger, "suspendedSessionID"); err != authorization.ErrorAccessTokenRevoked {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorAccessTokenRevoked)
+	}
+
+	err = newService.UpdateUserStatus(ctx, logger, model.ServiceUpdateUserStatusParam{UserID: 2, Status: "frozen"})
+	if err != authorization.ErrorBadParams {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorBadParams)
+	}
+
+	err = newService.UpdateUserStatus(ctx, logger, model.ServiceUpdateUserStatusParam{UserID: 3, Status: model.UserStatusBanned})
+	if err != authorization.ErrorUserNotFound {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorUserNotFound)
+	}
+}
+
+func TestServiceSessionPolicy(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var languageContent config.LanguageContent
+	languageContent.Language = map[string]int{"en": 0}
+	languageContent.Data.User.Login.Email.Subject = []string{"subject"}
+	languageContent.Data.User.Login.Email.Body = []string{"%s%s%s%s"}
+
+	tests := []struct {
+		name                string
+		absoluteExpiry      bool
+		rememberMe          bool
+		clientLifetime      int
+		expectedIdleTimeout int
+		expectedMaxAge      int
+	}{
+		{"sliding", false, false, 0, 3600, 86400},
+		{"remember me", false, true, 0, 604800, 2592000},
+		{"refresh token lifetime of the client", false, false, 1800, 1800, 86400},
+		{"remember me ignores the client lifetime", false, true, 1800, 604800, 2592000},
+		{"absolute", true, false, 0, 3600, 3600},
+		{"absolute remember me", true, true, 0, 604800, 604800},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			authRepo := new(repository.Mock)
+			authRepo.Props.OauthClient = model.OauthClient{ClientID: "PWA",
+				GrantTypes: []string{model.OauthGrantTypePassword}, RefreshTokenLifetime: test.clientLifetime}
+
+			var newService = NewService(
+				model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60,
+					SessionAbsoluteExpiry:        test.absoluteExpiry,
+					SessionIdleTimeout:           3600,
+					SessionMaxAge:                86400,
+					SessionRememberMeIdleTimeout: 604800,
+					SessionRememberMeMaxAge:      2592000},
+				new(middleware.MockDescription),
+				languageContent,
+				make(chan sendmail.MessageBox, 1),
+				new(sendmail.MockDescription),
+				authRepo,
+				new(secretdata.MockDescription),
+				new(secretdata.MockDescription),
+				new(secretdata.MockDescription),
+				new(jwt.MockDescription),
+				new(jwt.MockDescription),
+				revocation.NewStore(revocation.NewMemoryBackend()),
+				testIDTokenSigner,
+				testIDTokenSigner)
+
+			_, err := newService.CreateAccessToken(ctx, logger, model.ServiceCreateAccessTokenParam{
+				Email:      "email",
+				Password:   "password",
+				ClientID:   "PWA",
+				RememberMe: test.rememberMe})
+			if err != nil {
+				t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+			}
+
+			session := authRepo.Props.CreatedSession
+			if session.IdleTimeout != test.expectedIdleTimeout || session.MaxAge != test.expectedMaxAge ||
+				session.RememberMe != test.rememberMe {
+				t.Errorf("service created the session with wrong the policy: %+v", session)
+			}
+		})
+	}
+}
+
+// hmacJwtMock is the token of the HMAC algorithms, it has the lifetime of the client but no access claims
+type hmacJwtMock struct {
+	jwt.MockDescription
+	lifetimes []int
+}
+
+func (m *hmacJwtMock) CreateWithLifetime(claims jwt.Claims, lifetime int) (string, error) {
+	m.lifetimes = append(m.lifetimes, lifetime)
+	return m.Create(claims)
+}
+
+func TestServiceHmacTokenLifetime(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var languageContent config.LanguageContent
+	languageContent.Language = map[string]int{"en": 0}
+	languageContent.Data.User.Login.Email.Subject = []string{"subject"}
+	languageContent.Data.User.Login.Email.Body = []string{"%s%s%s%s"}
+
+	tests := []struct {
+		name                    string
+		rememberMe              bool
+		accessTokenLifetime     int
+		refreshTokenLifetime    int
+		expectedAccessLifetime  int
+		expectedRefreshLifetime int
+	}{
+		{"the lifetimes of the config", false, 0, 0, 0, 3600},
+		{"the lifetimes of the client", false, 900, 7200, 900, 7200},
+		{"remember me", true, 900, 7200, 900, 604800},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			authRepo := new(repository.Mock)
+			authRepo.Props.OauthClient = model.OauthClient{ClientID: "PWA",
+				GrantTypes:           []string{model.OauthGrantTypePassword},
+				AccessTokenLifetime:  test.accessTokenLifetime,
+				RefreshTokenLifetime: test.refreshTokenLifetime}
+
+			jwtAccess, jwtRefresh := new(hmacJwtMock), new(hmacJwtMock)
+
+			var newService = NewService(
+				model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60,
+					SessionIdleTimeout:           3600,
+					SessionRememberMeIdleTimeout: 604800},
+				new(middleware.MockDescription),
+				languageContent,
+				make(chan sendmail.MessageBox, 1),
+				new(sendmail.MockDescription),
+				authRepo,
+				new(secretdata.MockDescription),
+				new(secretdata.MockDescription),
+				new(secretdata.MockDescription),
+				jwtAccess,
+				jwtRefresh,
+				revocation.NewStore(revocation.NewMemoryBackend()),
+				testIDTokenSigner,
+				testIDTokenSigner)
+
+			tokens, err := newService.CreateAccessToken(ctx, logger, model.ServiceCreateAccessTokenParam{
+				Email:      "email",
+				Password:   "password",
+				ClientID:   "PWA",
+				RememberMe: test.rememberMe})
+			if err != nil {
+				t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+			}
+
+			expectedExpiresIn := test.expectedAccessLifetime
+			if expectedExpiresIn == 0 {
+				expectedExpiresIn = 60
+			}
+			if tokens.ExpiresIn != expectedExpiresIn {
+				t.Errorf("service returned wrong the lifetime: got %d want %d", tokens.ExpiresIn, expectedExpiresIn)
+			}
+			if len(jwtAccess.lifetimes) != 1 || jwtAccess.lifetimes[0] != test.expectedAccessLifetime {
+				t.Errorf("service created the access token with wrong the lifetime: got %v want %d",
+					jwtAccess.lifetimes, test.expectedAccessLifetime)
+			}
+			if len(jwtRefresh.lifetimes) != 1 || jwtRefresh.lifetimes[0] != test.expectedRefreshLifetime {
+				t.Errorf("service created the refresh token with wrong the lifetime: got %v want %d",
+					jwtRefresh.lifetimes, test.expectedRefreshLifetime)
+			}
+		})
+	}
+}
+
+func TestSessionRefreshTokenLifetime(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		idleTimeout int
+		expiresAt   time.Time
+		expected    int
+	}{
+		{"no max age", 3600, time.Time{}, 3600},
+		{"the idle timeout ends first", 3600, time.Now().Add(2 * time.Hour), 3600},
+		{"the session ends first", 3600, time.Now().Add(10*time.Minute + time.Second), 600},
+		{"the session has just ended", 3600, time.Now().Add(-time.Second), 1},
+		{"the lifetime of the config", 0, time.Time{}, 0},
+	}
+
+	for _, test := range tests {
+		if lifetime := sessionRefreshTokenLifetime(test.idleTimeout, test.expiresAt); lifetime != test.expected {
+			t.Errorf("%s: wrong the lifetime: got %d want %d", test.name, lifetime, test.expected)
+		}
+	}
+}
+
+func TestFilterClientScope(t *testing.T) {
+
+	client := model.OauthClient{ClientID: "client", Scope: "user profile"}
+
+	tests := []struct {
+		name           string
+		requestedScope string
+		expected       string
+	}{
+		{"the registered scopes", "openid user", "openid user"},
+		{"the unknown scopes are ignored", "user admin", "user"},
+		{"no scope is requested", "", "openid"},
+		{"nothing is granted", "admin", "openid"},
+	}
+
+	for _, test := range tests {
+		if scope := filterClientScope(test.requestedScope, client); scope != test.expected {
+			t.Errorf("%s: wrong the scope: got %q want %q", test.name, scope, test.expected)
+		}
+	}
+}
+
+func TestServiceOauthClientManagement(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	var newService = NewService(
+		model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60},
+		new(middleware.MockDescription),
+		config.LanguageContent{},
+		make(chan sendmail.MessageBox, 1),
+		new(sendmail.MockDescription),
+		new(repository.Mock),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(secretdata.MockDescription),
+		new(jwt.MockDescription),
+		new(jwt.MockDescription),
+		revocation.NewStore(revocation.NewMemoryBackend()),
+		testIDTokenSigner,
+		testIDTokenSigner)
+
+	// The public client has no secret, the confidential one gets it once
+
+	credentials, err := newService.CreateOauthClient(ctx, logger, model.ServiceCreateOauthClientParam{
+		ClientID: "Android_v1.0.0", Name: "Financelime Android",
+		GrantTypes: []string{model.OauthGrantTypePassword, model.OauthGrantTypeRefreshToken}})
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if credentials.ClientID != "Android_v1.0.0" || credentials.ClientSecret != "" {
+		t.Errorf("service returned wrong the credentials: %+v", credentials)
+	}
+
+	credentials, err = newService.CreateOauthClient(ctx, logger, model.ServiceCreateOauthClientParam{
+		Name: "Finance API", GrantTypes: []string{model.OauthGrantTypeTokenExchange}, Confidential: true})
+	if err != nil {
+		t.Fatalf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	if credentials.ClientID == "" || len(credentials.ClientSecret) != clientSecretByteLength*2 {
+		t.Errorf("service returned wrong the credentials: %+v", credentials)
+	}
+
+	// The lifetime of zero is a change, the empty params are not
+
+	lifetime := 0
+	err = newService.UpdateOauthClient(ctx, logger, model.ServiceUpdateOauthClientParam{
+		ClientID: "Android_v1.0.0", AccessTokenLifetime: &lifetime})
+	if err != nil {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, nil)
+	}
+	err = newService.UpdateOauthClient(ctx, logger, model.ServiceUpdateOauthClientParam{ClientID: "Android_v1.0.0"})
+	if err != authorization.ErrorBadParams {
+		t.Errorf("service returned wrong the err value: got %v want %v", err, authorization.ErrorBadParams)
+	}
+}
+
+func TestServiceMaxAccessTokenLifetime(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, _ := zap.NewProduction()
+
+	tests := []struct {
+		name             string
+		clients          []model.OauthClient
+		expectedLifetime int
+	}{
+		{"the lifetime of the config", []model.OauthClient{{ClientID: "PWA"}}, 60},
+		{"the lifetime of a client", []model.OauthClient{{ClientID: "PWA", AccessTokenLifetime: 30},
+			{ClientID: "cli", AccessTokenLifetime: 3600}}, 3600},
+	}
+
+	for _, test := range tests {
+
+		authRepo := new(repository.Mock)
+		authRepo.Props.OauthClients = test.clients
+
+		var newService = NewService(
+			model.ConfigService{DomainAPP: "financelime.com", DomainAPI: "domain.com", AccessTokenLifetime: 60},
+			new(middleware.MockDescription),
+			config.LanguageContent{},
+			make(chan sendmail.MessageBox, 1),
+			new(sendmail.MockDescription),
+			authRepo,
+			new(secretdata.MockDescription),
+			new(secretdata.MockDescription),
+			new(secretdata.MockDescription),
+			new(jwt.MockDescription),
+			new(jwt.MockDescription),
+			revocation.NewStore(revocation.NewMemoryBackend()),
+			testIDTokenSigner,
+			testIDTokenSigner)
+
+		lifetime, err := newService.maxAccessTokenLifetime(ctx, logger)
+		if err != nil {
+			t.Fatalf("%s: service returned wrong the err value: got %v want %v", test.name, err, nil)
+		}
+		if lifetime != test.expectedLifetime {
+			t.Errorf("%s: service returned wrong the lifetime: got %v want %v", test.name, lifetime, test.expectedLifetime)
+		}
+	}
+}
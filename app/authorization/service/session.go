@@ -0,0 +1,48 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"time"
+)
+
+// sessionPolicy returns the idle timeout and the max age of the new session in seconds. The refresh token lifetime
+// of the client takes the place of the idle timeout of the config, unless the user has asked to be remembered.
+// The absolute session ends after the idle timeout since the log in at the latest, the refresh doesn't extend it.
+func (s *service) sessionPolicy(client model.OauthClient, rememberMe bool) (int, int) {
+
+	idleTimeout, maxAge := s.config.SessionIdleTimeout, s.config.SessionMaxAge
+	if rememberMe {
+		idleTimeout, maxAge = s.config.SessionRememberMeIdleTimeout, s.config.SessionRememberMeMaxAge
+	} else if client.RefreshTokenLifetime > 0 {
+		idleTimeout = client.RefreshTokenLifetime
+	}
+
+	if s.config.SessionAbsoluteExpiry && idleTimeout > 0 && (maxAge == 0 || maxAge > idleTimeout) {
+		maxAge = idleTimeout
+	}
+
+	return idleTimeout, maxAge
+}
+
+// sessionRefreshTokenLifetime returns the lifetime of the refresh token, it doesn't outlive the session.
+// Zero is the lifetime of the config.
+func sessionRefreshTokenLifetime(idleTimeout int, expiresAt time.Time) int {
+
+	if expiresAt.IsZero() {
+		return idleTimeout
+	}
+
+	remaining := int(time.Until(expiresAt).Seconds())
+	if remaining < 1 {
+		remaining = 1
+	}
+	if idleTimeout > 0 && idleTimeout < remaining {
+		return idleTimeout
+	}
+
+	return remaining
+}
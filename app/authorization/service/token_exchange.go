@@ -0,0 +1,263 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/financelime-authorization/jose"
+	"github.com/dmalix/jwt"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+)
+
+const (
+	oauthGrantTypeTokenExchange = model.OauthGrantTypeTokenExchange
+	oauthTokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+	// The JwtID of the exchanged token is the session of the subject token with the prefix,
+	// the token is revoked with the session, but it's not accepted by the endpoints of the users
+	exchangedJwtIDPrefix = "te-"
+)
+
+// exchangeSubjectToken issues the token of the user to the service that calls another service on behalf of the user
+// (RFC 8693). The new token is accepted by the audience only, it carries the act claim of the calling client
+// and the same or fewer scopes than the subject token. The audience is a confidential client, so it can introspect
+// the token. The subject token may be an exchanged token itself, the actors are nested then.
+func (s *service) exchangeSubjectToken(ctx context.Context, logger *zap.Logger, client model.OauthClient,
+	param model.ServiceExchangeTokenParam) (model.ServiceAccessTokenReturn, error) {
+
+	var subject model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	if param.SubjectToken == "" || param.SubjectTokenType != oauthTokenTypeAccessToken ||
+		(param.RequestedTokenType != "" && param.RequestedTokenType != oauthTokenTypeAccessToken) {
+		logger.Error("the token exchange request is not valid", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidRequest
+	}
+	if param.Audience == "" {
+		logger.Error("the audience of the token exchange is empty", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidTarget
+	}
+
+	// Only a backend service acts for the users, a public client has no secret to prove it's the service
+
+	if client.HashedSecret == "" {
+		logger.Error("the public client is not allowed to exchange the tokens", zap.String("clientID", client.ClientID),
+			zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorUnauthorizedClient
+	}
+
+	audience, err := s.repository.GetOauthClient(ctx, logger, param.Audience)
+	if err != nil {
+		logger.Error("failed to get the audience", zap.Error(err), zap.String("audience", param.Audience),
+			zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorInvalidClient:
+			return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidTarget
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+	if audience.HashedSecret == "" {
+		logger.Error("the audience is not a confidential client", zap.String("audience", param.Audience),
+			zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidTarget
+	}
+
+	// The subject token must be an active access token of a user
+
+	jwtData, _, err := s.jwtAccess.Parse(param.SubjectToken)
+	if err != nil {
+		logger.Error("the subject token is not valid", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+	}
+	if isServiceAccountJwtID(jwtData.Claims.JwtID) {
+		logger.Error("the subject token is the token of the service account", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidGrant
+	}
+	publicSessionID := strings.TrimPrefix(jwtData.Claims.JwtID, exchangedJwtIDPrefix)
+
+	session, err := s.activeExchangeSession(ctx, logger, publicSessionID)
+	if err != nil {
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	err = s.decryptAccessTokenData(jwtData, &subject)
+	if err != nil {
+		logger.DPanic("failed to read the data of the subject token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	// The scopes of the exchanged token can only be narrowed. The scope of the first-party session is empty,
+	// it's the full access, so the token exchange is the only way to narrow it.
+
+	subjectScope := session.Scope
+	if subject.Act != nil {
+		subjectScope = subject.Scope
+	}
+	scope := subjectScope
+	if param.Scope != "" {
+		for _, value := range strings.Fields(param.Scope) {
+			if subjectScope != "" && !hasScope(subjectScope, value) {
+				logger.Error("the scope exceeds the scope of the subject token", zap.String("scope", value),
+					zap.String(requestIDKey, requestID))
+				return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidScope
+			}
+		}
+		scope = strings.Join(strings.Fields(param.Scope), " ")
+	}
+	if scope == "" {
+		logger.Error("the exchanged token of the full access is not allowed", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorInvalidScope
+	}
+
+	exchangedData, err := json.Marshal(model.User{
+		ID:       subject.ID,
+		Email:    subject.Email,
+		Language: subject.Language,
+		Scope:    scope,
+		Audience: audience.ClientID,
+		Act:      &model.Actor{Subject: client.ClientID, Actor: subject.Act}})
+	if err != nil {
+		logger.DPanic("failed to marshal the user struct", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+	encryptedAccessTokenData, err := s.dataAccess.Encrypt(exchangedData)
+	if err != nil {
+		logger.DPanic("failed to encrypt the token data", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	// The token is issued to the actor, it has the lifetime of the actor's tokens
+
+	accessToken, expiresIn, err := s.createAccessToken(jwt.Claims{
+		JwtID: exchangedJwtIDPrefix + publicSessionID,
+		Data:  encryptedAccessTokenData,
+	}, jose.AccessClaims{
+		Audience: audience.ClientID,
+		Scope:    scope,
+		Lifetime: client.AccessTokenLifetime})
+	if err != nil {
+		logger.DPanic("failed to generate an access token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	logger.Info("the token has been exchanged", zap.String("clientID", client.ClientID),
+		zap.String("audience", audience.ClientID), zap.String("scope", scope), zap.String(requestIDKey, requestID))
+
+	return model.ServiceAccessTokenReturn{
+		PublicSessionID: publicSessionID,
+		AccessJWT:       accessToken,
+		ExpiresIn:       expiresIn,
+		Scope:           scope,
+		IssuedTokenType: oauthTokenTypeAccessToken}, nil
+}
+
+// activeExchangeSession returns the session of the subject token, the token of the revoked session is the invalid grant
+func (s *service) activeExchangeSession(ctx context.Context, logger *zap.Logger,
+	publicSessionID string) (model.SessionRecord, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.SessionRecord{}, err
+	}
+
+	revoked, err := s.revocationStore.IsRevoked(ctx, publicSessionID)
+	if err != nil {
+		logger.DPanic("failed to check the access token revocation", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.SessionRecord{}, err
+	}
+	if revoked {
+		logger.Error("the session of the subject token has been revoked", zap.String(requestIDKey, requestID))
+		return model.SessionRecord{}, authorization.ErrorInvalidGrant
+	}
+
+	session, err := s.repository.GetActiveSession(ctx, logger, publicSessionID)
+	if err != nil {
+		logger.Error("failed to get the session of the subject token", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorSessionNotFound:
+			return model.SessionRecord{}, authorization.ErrorInvalidGrant
+		default:
+			return model.SessionRecord{}, err
+		}
+	}
+
+	return session, nil
+}
+
+// introspectExchangedToken returns the inactive token if the session of the subject token has been revoked
+func (s *service) introspectExchangedToken(ctx context.Context, logger *zap.Logger, token string,
+	jwtData jwt.Token) (model.TokenIntrospection, error) {
+
+	var exchangedData model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.TokenIntrospection{}, err
+	}
+
+	publicSessionID := strings.TrimPrefix(jwtData.Claims.JwtID, exchangedJwtIDPrefix)
+
+	session, err := s.activeExchangeSession(ctx, logger, publicSessionID)
+	if err != nil {
+		switch err {
+		case authorization.ErrorInvalidGrant:
+			return model.TokenIntrospection{Active: false}, nil
+		default:
+			return model.TokenIntrospection{}, err
+		}
+	}
+
+	err = s.decryptAccessTokenData(jwtData, &exchangedData)
+	if err != nil || exchangedData.Act == nil {
+		logger.DPanic("failed to read the data of the exchanged token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.TokenIntrospection{}, errorBadTokenPayload
+	}
+
+	claims, err := readTokenClaims(token)
+	if err != nil {
+		logger.DPanic("failed to read the claims of the token", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.TokenIntrospection{}, err
+	}
+
+	// The token is issued to the actor, the audience is the resource server that accepts it
+
+	return model.TokenIntrospection{
+		Active:          true,
+		Subject:         strconv.FormatInt(session.UserID, 10),
+		ExpiresAt:       claims.ExpiresAt,
+		IssuedAt:        claims.IssuedAt,
+		ClientID:        exchangedData.Act.Subject,
+		Scope:           exchangedData.Scope,
+		PublicSessionID: publicSessionID,
+		Audience:        exchangedData.Audience,
+		Act:             exchangedData.Act}, nil
+}
+
+// decryptAccessTokenData reads the user data of the verified access token
+func (s *service) decryptAccessTokenData(jwtData jwt.Token, user *model.User) error {
+
+	decryptedData, err := s.dataAccess.Decrypt(jwtData.Claims.Data)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(decryptedData, user)
+}
+
+func isExchangedJwtID(jwtID string) bool {
+	return strings.HasPrefix(jwtID, exchangedJwtIDPrefix)
+}
@@ -0,0 +1,313 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/financelime-authorization/webauthn"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	webauthnCeremonyRegistration = "registration"
+	webauthnCeremonyLogin        = "login"
+
+	webauthnRPName = "Financelime"
+	// The challenge lifetime in seconds
+	webauthnChallengeLifetime = int(webauthn.Timeout / time.Second)
+)
+
+func (s *service) BeginWebauthnRegistration(ctx context.Context, logger *zap.Logger, accessTokenData []byte) (webauthn.CreationOptions, error) {
+
+	var user model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return webauthn.CreationOptions{}, err
+	}
+
+	err = json.Unmarshal(accessTokenData, &user)
+	if err != nil {
+		logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return webauthn.CreationOptions{}, err
+	}
+
+	credentials, err := s.repository.GetListWebauthnCredentials(ctx, logger, user.ID)
+	if err != nil {
+		logger.DPanic("failed to get the list of the credentials", zap.Error(err), zap.String(requestIDKey, requestID))
+		return webauthn.CreationOptions{}, err
+	}
+	excludeCredentialIDs := make([]string, 0, len(credentials))
+	for _, credential := range credentials {
+		excludeCredentialIDs = append(excludeCredentialIDs, credential.CredentialID)
+	}
+
+	challenge, err := s.createWebauthnChallenge(ctx, logger, webauthnCeremonyRegistration, user.ID)
+	if err != nil {
+		logger.DPanic("failed to create the challenge", zap.Error(err), zap.String(requestIDKey, requestID))
+		return webauthn.CreationOptions{}, err
+	}
+
+	return s.webauthnConfig().CreationOptions(
+		challenge,
+		webauthn.User{
+			ID:          webauthnUserHandle(user.ID),
+			Name:        user.Email,
+			DisplayName: user.Email},
+		excludeCredentialIDs), nil
+}
+
+func (s *service) FinishWebauthnRegistration(ctx context.Context, logger *zap.Logger,
+	param model.ServiceFinishWebauthnRegistrationParam) error {
+
+	var user model.User
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return err
+	}
+
+	err = json.Unmarshal(param.AccessTokenData, &user)
+	if err != nil {
+		logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+			zap.String(requestIDKey, requestID))
+		return err
+	}
+
+	if param.Credential.ID == "" || param.Credential.Response.AttestationObject == "" {
+		logger.Error("the credential is empty", zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadParams
+	}
+
+	challenge, err := webauthn.Challenge(param.Credential.Response.ClientDataJSON)
+	if err != nil {
+		logger.Error("failed to get the challenge from the client data", zap.Error(err), zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadWebauthnResponse
+	}
+
+	challengeUserID, err := s.repository.GetWebauthnChallenge(ctx, logger, model.RepoGetWebauthnChallengeParam{
+		Ceremony:  webauthnCeremonyRegistration,
+		Challenge: challenge})
+	if err != nil {
+		logger.Error("failed to get the challenge", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorWebauthnChallengeNotFound:
+			return err
+		default:
+			return err
+		}
+	}
+	if challengeUserID != user.ID {
+		logger.Error("the challenge was created for another user", zap.String(requestIDKey, requestID))
+		return authorization.ErrorWebauthnChallengeNotFound
+	}
+
+	credential, err := s.webauthnConfig().VerifyRegistration(challenge, param.Credential)
+	if err != nil {
+		logger.Error("failed to verify the registration", zap.Error(err), zap.String(requestIDKey, requestID))
+		return authorization.ErrorBadWebauthnResponse
+	}
+
+	err = s.repository.CreateWebauthnCredential(ctx, logger, model.RepoCreateWebauthnCredentialParam{
+		UserID:       user.ID,
+		CredentialID: credential.ID,
+		PublicKey:    webauthn.Encode(credential.PublicKey),
+		SignCount:    credential.SignCount})
+	if err != nil {
+		logger.Error("failed to create the credential", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorWebauthnCredentialAlreadyExist:
+			return err
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *service) BeginWebauthnLogin(ctx context.Context, logger *zap.Logger) (webauthn.RequestOptions, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return webauthn.RequestOptions{}, err
+	}
+
+	// The user is not known until the authenticator answers with one of the passkeys
+
+	challenge, err := s.createWebauthnChallenge(ctx, logger, webauthnCeremonyLogin, 0)
+	if err != nil {
+		logger.DPanic("failed to create the challenge", zap.Error(err), zap.String(requestIDKey, requestID))
+		return webauthn.RequestOptions{}, err
+	}
+
+	return s.webauthnConfig().RequestOptions(challenge), nil
+}
+
+// FinishWebauthnLogin issues the same tokens as CreateAccessToken. The second factor is not asked:
+// the passkey is something the user has, and the authenticator has verified the user with a PIN or biometrics.
+func (s *service) FinishWebauthnLogin(ctx context.Context, logger *zap.Logger,
+	param model.ServiceFinishWebauthnLoginParam) (model.ServiceAccessTokenReturn, error) {
+
+	requestID, requestIDKey, err := s.contextGetter.GetRequestID(ctx)
+	if err != nil {
+		logger.DPanic("failed to get requestID", zap.Error(err))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	if param.Credential.ID == "" || param.Credential.Response.Signature == "" {
+		logger.Error("the credential is empty", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorBadParams
+	}
+
+	client, err := s.getClientForGrant(ctx, logger, param.ClientID, model.OauthGrantTypePassword)
+	if err != nil {
+		logger.Error("the client is not allowed to log in the users", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	challenge, err := webauthn.Challenge(param.Credential.Response.ClientDataJSON)
+	if err != nil {
+		logger.Error("failed to get the challenge from the client data", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorBadWebauthnResponse
+	}
+
+	_, err = s.repository.GetWebauthnChallenge(ctx, logger, model.RepoGetWebauthnChallengeParam{
+		Ceremony:  webauthnCeremonyLogin,
+		Challenge: challenge})
+	if err != nil {
+		logger.Error("failed to get the challenge", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorWebauthnChallengeNotFound:
+			return model.ServiceAccessTokenReturn{}, err
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	credentialID, err := webauthn.Decode(param.Credential.ID)
+	if err != nil {
+		logger.Error("failed to decode the credential ID", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorBadWebauthnResponse
+	}
+
+	storedCredential, err := s.repository.GetWebauthnCredential(ctx, logger, webauthn.Encode(credentialID))
+	if err != nil {
+		logger.Error("failed to get the credential", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorWebauthnCredentialNotFound:
+			return model.ServiceAccessTokenReturn{}, err
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	publicKey, err := webauthn.Decode(storedCredential.PublicKey)
+	if err != nil {
+		logger.DPanic("failed to decode the stored public key", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	signCount, err := s.webauthnConfig().VerifyAssertion(challenge,
+		webauthn.Credential{
+			ID:        storedCredential.CredentialID,
+			PublicKey: publicKey,
+			SignCount: storedCredential.SignCount},
+		param.Credential)
+	if err != nil {
+		logger.Error("failed to verify the assertion", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorBadWebauthnResponse
+	}
+
+	if param.Credential.Response.UserHandle != "" &&
+		param.Credential.Response.UserHandle != webauthnUserHandle(storedCredential.UserID) {
+		logger.Error("the user handle does not match the credential", zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, authorization.ErrorBadWebauthnResponse
+	}
+
+	err = s.repository.UpdateWebauthnSignCount(ctx, logger, model.RepoUpdateWebauthnSignCountParam{
+		CredentialID: storedCredential.CredentialID,
+		SignCount:    signCount})
+	if err != nil {
+		logger.Error("failed to update the signature counter", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorBadWebauthnResponse:
+			return model.ServiceAccessTokenReturn{}, err
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	user, err := s.repository.GetUserByID(ctx, logger, storedCredential.UserID)
+	if err != nil {
+		logger.Error("failed to get the user", zap.Error(err), zap.String(requestIDKey, requestID))
+		switch err {
+		case authorization.ErrorUserNotFound:
+			return model.ServiceAccessTokenReturn{}, err
+		case authorization.ErrorUserSuspended, authorization.ErrorUserLocked, authorization.ErrorUserBanned:
+			return model.ServiceAccessTokenReturn{}, err
+		default:
+			return model.ServiceAccessTokenReturn{}, err
+		}
+	}
+
+	// The passkey log in asks for no scope, the client gets all the scopes registered for it
+
+	scope, err := s.grantClientScope(ctx, logger, client, "")
+	if err != nil {
+		logger.DPanic("failed to grant the scope", zap.Error(err), zap.String(requestIDKey, requestID))
+		return model.ServiceAccessTokenReturn{}, err
+	}
+
+	return s.createSession(ctx, logger, user, client, model.ServiceCreateAccessTokenParam{
+		ClientID:   param.ClientID,
+		UserAgent:  param.UserAgent,
+		Device:     param.Device,
+		Scope:      scope,
+		RememberMe: param.RememberMe})
+}
+
+func (s *service) createWebauthnChallenge(ctx context.Context, logger *zap.Logger, ceremony string, userID int64) (string, error) {
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repository.CreateWebauthnChallenge(ctx, logger, model.RepoCreateWebauthnChallengeParam{
+		Ceremony:  ceremony,
+		UserID:    userID,
+		Challenge: challenge,
+		Lifetime:  webauthnChallengeLifetime})
+	if err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+// webauthnConfig describes the PWA as the relying party, the passkeys are bound to its domain
+func (s *service) webauthnConfig() webauthn.Config {
+	return webauthn.Config{
+		RPID:   s.config.DomainAPP,
+		RPName: webauthnRPName,
+		Origin: "https://" + s.config.DomainAPP}
+}
+
+// webauthnUserHandle returns the user handle of the passkeys, the authenticator keeps it in place of the email
+func webauthnUserHandle(userID int64) string {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return webauthn.Encode(handle)
+}
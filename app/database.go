@@ -0,0 +1,134 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	authorizationModel "github.com/dmalix/financelime-authorization/app/authorization/model"
+	authorizationRepository "github.com/dmalix/financelime-authorization/app/authorization/repository"
+	"github.com/dmalix/financelime-authorization/config"
+	"github.com/dmalix/financelime-authorization/hasher"
+	"github.com/dmalix/financelime-authorization/migration"
+	"github.com/dmalix/middleware"
+	"go.uber.org/zap"
+)
+
+// Keys of the PostgreSQL advisory locks held while the databases are being migrated
+const (
+	MigrationLockIDAuthMain int64 = 72656001
+	MigrationLockIDBlade    int64 = 72656002
+)
+
+type Databases struct {
+	AuthMain *sql.DB
+	AuthRead *sql.DB
+	Blade    *sql.DB
+}
+
+func NewDatabases(logger *zap.Logger, appConfig config.App) (Databases, error) {
+
+	var (
+		databases Databases
+		err       error
+	)
+
+	databases.AuthMain, err = authorizationRepository.NewPostgresDB(logger, authorizationModel.ConfigPostgresDB{
+		Host:     appConfig.Db.AuthMain.Connect.Host,
+		Port:     appConfig.Db.AuthMain.Connect.Port,
+		SSLMode:  appConfig.Db.AuthMain.Connect.SslMode,
+		DBName:   appConfig.Db.AuthMain.Connect.DbName,
+		User:     appConfig.Db.AuthMain.Connect.User,
+		Password: appConfig.Db.AuthMain.Connect.Password,
+	})
+	if err != nil {
+		return Databases{}, fmt.Errorf("failed to init the AuthMain DB: %s", err)
+	}
+	databases.AuthRead, err = authorizationRepository.NewPostgresDB(logger, authorizationModel.ConfigPostgresDB{
+		Host:     appConfig.Db.AuthRead.Connect.Host,
+		Port:     appConfig.Db.AuthRead.Connect.Port,
+		SSLMode:  appConfig.Db.AuthRead.Connect.SslMode,
+		DBName:   appConfig.Db.AuthRead.Connect.DbName,
+		User:     appConfig.Db.AuthRead.Connect.User,
+		Password: appConfig.Db.AuthRead.Connect.Password,
+	})
+	if err != nil {
+		if err := databases.AuthMain.Close(); err != nil {
+			logger.Error("failed to close AuthMain DB", zap.Error(err))
+		}
+		return Databases{}, fmt.Errorf("failed to init the AuthRead DB: %s", err)
+	}
+	databases.Blade, err = authorizationRepository.NewPostgresDB(logger, authorizationModel.ConfigPostgresDB{
+		Host:     appConfig.Db.Blade.Connect.Host,
+		Port:     appConfig.Db.Blade.Connect.Port,
+		SSLMode:  appConfig.Db.Blade.Connect.SslMode,
+		DBName:   appConfig.Db.Blade.Connect.DbName,
+		User:     appConfig.Db.Blade.Connect.User,
+		Password: appConfig.Db.Blade.Connect.Password,
+	})
+	if err != nil {
+		if err := databases.AuthMain.Close(); err != nil {
+			logger.Error("failed to close AuthMain DB", zap.Error(err))
+		}
+		if err := databases.AuthRead.Close(); err != nil {
+			logger.Error("failed to close AuthRead DB", zap.Error(err))
+		}
+		return Databases{}, fmt.Errorf("failed to init the Blade DB: %s", err)
+	}
+
+	return databases, nil
+}
+
+func (d Databases) Close() error {
+	if err := d.AuthMain.Close(); err != nil {
+		return fmt.Errorf("failed to close AuthMain DB: %s", err)
+	}
+	if err := d.AuthRead.Close(); err != nil {
+		return fmt.Errorf("failed to close AuthRead DB: %s", err)
+	}
+	if err := d.Blade.Close(); err != nil {
+		return fmt.Errorf("failed to close Blade DB: %s", err)
+	}
+	return nil
+}
+
+// NewMigrators returns the migrators of the AuthMain and Blade databases, in the order they must be applied
+func NewMigrators(appConfig config.App, databases Databases, dryRun bool) (migration.Migrator, migration.Migrator) {
+	authMain := migration.NewMigrator(migration.Config{
+		Dir:    appConfig.Db.AuthMain.Migration.Dir,
+		LockID: MigrationLockIDAuthMain,
+		DryRun: dryRun,
+	}, databases.AuthMain)
+	blade := migration.NewMigrator(migration.Config{
+		Dir:    appConfig.Db.Blade.Migration.Dir,
+		LockID: MigrationLockIDBlade,
+		DryRun: dryRun,
+	}, databases.Blade)
+	return authMain, blade
+}
+
+func NewAuthorizationRepository(appConfig config.App, databases Databases,
+	contextGetter middleware.ContextGetter) (authorization.Repository, error) {
+
+	passwordHasher, err := hasher.NewHasher(hasher.Config{
+		Algorithm:  appConfig.Crypto.PasswordHashAlgorithm,
+		LegacySalt: appConfig.Crypto.Salt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to init the password hasher: %s", err)
+	}
+
+	return authorizationRepository.NewRepository(
+		authorizationModel.ConfigRepository{
+			CryptoSalt:              appConfig.Crypto.Salt,
+			JwtRefreshTokenLifetime: appConfig.Jwt.RefreshTokenLifetime,
+		},
+		contextGetter,
+		passwordHasher,
+		databases.AuthMain,
+		databases.AuthRead,
+		databases.Blade), nil
+}
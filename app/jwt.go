@@ -0,0 +1,167 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package app
+
+import (
+	"fmt"
+	"github.com/dmalix/financelime-authorization/jose"
+	"github.com/dmalix/jwt"
+	"github.com/dmalix/secretdata"
+	"os"
+	"time"
+)
+
+// KeyRing is reloaded by the application to pick up the generated and promoted keys
+type KeyRing interface {
+	Reload() error
+}
+
+type JwtKeys struct {
+	// The tokens of these keys are still accepted, they are replaced by the secret key of the config
+	PreviousSecretKeys []string
+	// The key of the asymmetric algorithm, either the PEM file or the key ring directory
+	PrivateKeyFile string
+	KeyRingDir     string
+}
+
+type Jwt struct {
+	Token jwt.Jwt
+	// The public keys of the asymmetric token, nothing for the secret keys
+	PublicKeys jose.KeySource
+	// Nil if the keys are not in the key ring directory
+	KeyRing KeyRing
+}
+
+// NewJwt creates the token signed with the secret key of the config for the HMAC algorithms,
+// or with the private key of the PEM file or of the key ring for the asymmetric ones.
+func NewJwt(config jwt.Config, keys JwtKeys) (Jwt, error) {
+
+	if !jose.IsAsymmetric(config.Headers.SignatureAlgorithm) {
+		ring := jwtRing{config: config}
+		for _, secretKey := range append([]string{config.Key}, keys.PreviousSecretKeys...) {
+			config.Key = secretKey
+			token, err := jwt.NewToken(config)
+			if err != nil {
+				return Jwt{}, fmt.Errorf("failed to create the %s token: %s", config.Claims.Subject, err)
+			}
+			ring.tokens = append(ring.tokens, token)
+		}
+		return Jwt{Token: ring, PublicKeys: jose.JoinKeySets()}, nil
+	}
+
+	if keys.KeyRingDir != "" {
+		keyRing, err := jose.LoadKeyRing(keys.KeyRingDir, time.Duration(config.TokenLifetimeSec)*time.Second)
+		if err != nil {
+			return Jwt{}, fmt.Errorf("failed to load the key ring of the %s token: %s", config.Claims.Subject, err)
+		}
+		if keyRing.Algorithm() != config.Headers.SignatureAlgorithm {
+			return Jwt{}, fmt.Errorf("the active key of the %s token is for the '%s' algorithm, not %s",
+				config.Claims.Subject, keyRing.Algorithm(), config.Headers.SignatureAlgorithm)
+		}
+		token := jose.NewToken(keyRing, config)
+		return Jwt{Token: token, PublicKeys: token, KeyRing: keyRing}, nil
+	}
+
+	privateKeyPEM, err := os.ReadFile(keys.PrivateKeyFile)
+	if err != nil {
+		return Jwt{}, fmt.Errorf("failed to read the key of the %s token: %s", config.Claims.Subject, err)
+	}
+	key, err := jose.ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return Jwt{}, fmt.Errorf("failed to parse the key of the %s token: %s", config.Claims.Subject, err)
+	}
+	if key.Algorithm != config.Headers.SignatureAlgorithm {
+		return Jwt{}, fmt.Errorf("the key of the %s token is for the %s algorithm, not %s",
+			config.Claims.Subject, key.Algorithm, config.Headers.SignatureAlgorithm)
+	}
+
+	token := jose.NewToken(jose.NewSigner(key), config)
+
+	return Jwt{Token: token, PublicKeys: token}, nil
+}
+
+// jwtRing creates the tokens with the first token and parses them with any of the tokens,
+// so the tokens signed with the previous secret keys stay valid after the rotation
+type jwtRing struct {
+	// The config of the current secret key
+	config jwt.Config
+	tokens []jwt.Jwt
+}
+
+func (r jwtRing) Create(claims jwt.Claims) (string, error) {
+	return r.tokens[0].Create(claims)
+}
+
+// CreateWithLifetime creates the token with the current secret key and the lifetime of the client or
+// of the session instead of the lifetime of the config. The HMAC tokens have no room for the aud and scope claims,
+// the encrypted token data has them.
+func (r jwtRing) CreateWithLifetime(claims jwt.Claims, lifetime int) (string, error) {
+
+	if lifetime <= 0 {
+		return r.Create(claims)
+	}
+
+	config := r.config
+	config.TokenLifetimeSec = lifetime
+	token, err := jwt.NewToken(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to create the %s token: %s", config.Claims.Subject, err)
+	}
+
+	return token.Create(claims)
+}
+
+func (r jwtRing) Parse(value string) (jwt.Token, string, error) {
+
+	var firstParseCodeError string
+	var firstErr error
+
+	for i, token := range r.tokens {
+		parsedToken, parseCodeError, err := token.Parse(value)
+		if err == nil {
+			return parsedToken, parseCodeError, nil
+		}
+		if i == 0 {
+			firstParseCodeError, firstErr = parseCodeError, err
+		}
+	}
+
+	return jwt.Token{}, firstParseCodeError, firstErr
+}
+
+// secretDataRing encrypts with the first key and decrypts with any of the keys
+type secretDataRing []secretdata.SecretData
+
+// NewSecretData returns the cipher of the token data, the data of the previous secret keys is still decrypted
+func NewSecretData(secretKey string, previousSecretKeys []string) secretdata.SecretData {
+
+	ring := secretDataRing{secretdata.NewSecretData(secretKey)}
+	for _, previousSecretKey := range previousSecretKeys {
+		ring = append(ring, secretdata.NewSecretData(previousSecretKey))
+	}
+
+	return ring
+}
+
+func (r secretDataRing) Encrypt(data []byte) (string, error) {
+	return r[0].Encrypt(data)
+}
+
+func (r secretDataRing) Decrypt(data string) ([]byte, error) {
+
+	var firstErr error
+
+	for i, cipher := range r {
+		decryptedData, err := cipher.Decrypt(data)
+		if err == nil {
+			return decryptedData, nil
+		}
+		if i == 0 {
+			firstErr = err
+		}
+	}
+
+	return nil, firstErr
+}
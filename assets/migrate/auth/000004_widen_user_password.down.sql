@@ -0,0 +1,6 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+-- Fails while the Argon2id or bcrypt hashes are stored, they are longer than the legacy SHA-256 ones
+ALTER TABLE "public"."user" ALTER COLUMN "password" TYPE VARCHAR ( 64 ) COLLATE "pg_catalog"."default";
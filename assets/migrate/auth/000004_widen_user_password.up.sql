@@ -0,0 +1,5 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."user" ALTER COLUMN "password" TYPE VARCHAR ( 255 ) COLLATE "pg_catalog"."default";
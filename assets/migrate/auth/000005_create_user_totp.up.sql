@@ -0,0 +1,17 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+CREATE TABLE IF NOT EXISTS "public"."user_totp" (
+	"id" int4 NOT NULL GENERATED BY DEFAULT AS IDENTITY ( INCREMENT 1 MINVALUE 1 MAXVALUE 2147483647 START 1 ),
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	"updated_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"deleted_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"user_id" int4 NOT NULL,
+	"encrypted_secret" TEXT COLLATE "pg_catalog"."default" NOT NULL,
+	"confirmed_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"last_used_step" int8 NOT NULL DEFAULT 0,
+	CONSTRAINT "user_totp_pkey" PRIMARY KEY ( "id" )
+);
+ALTER TABLE "public"."user_totp" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."user_totp" IS 'TOTP secrets of the two-factor authentication';
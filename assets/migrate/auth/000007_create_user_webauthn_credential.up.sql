@@ -0,0 +1,18 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+CREATE TABLE IF NOT EXISTS "public"."user_webauthn_credential" (
+	"id" int4 NOT NULL GENERATED BY DEFAULT AS IDENTITY ( INCREMENT 1 MINVALUE 1 MAXVALUE 2147483647 START 1 ),
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	"updated_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"deleted_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"user_id" int4 NOT NULL,
+	"credential_id" TEXT COLLATE "pg_catalog"."default" NOT NULL,
+	"public_key" TEXT COLLATE "pg_catalog"."default" NOT NULL,
+	"sign_count" int8 NOT NULL DEFAULT 0,
+	"last_used_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	CONSTRAINT "user_webauthn_credential_pkey" PRIMARY KEY ( "id" )
+);
+ALTER TABLE "public"."user_webauthn_credential" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."user_webauthn_credential" IS 'WebAuthn credentials (passkeys) of the users: the base64url credential ID and COSE public key';
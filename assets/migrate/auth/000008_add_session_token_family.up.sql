@@ -0,0 +1,17 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."session" ADD COLUMN IF NOT EXISTS "token_family" VARCHAR ( 64 ) COLLATE "pg_catalog"."default";
+UPDATE "public"."session" SET "token_family" = "public_id" WHERE "token_family" IS NULL;
+ALTER TABLE "public"."session" ALTER COLUMN "token_family" SET NOT NULL;
+
+CREATE TABLE IF NOT EXISTS "public"."rotated_refresh_token" (
+	"id" int4 NOT NULL GENERATED BY DEFAULT AS IDENTITY ( INCREMENT 1 MINVALUE 1 MAXVALUE 2147483647 START 1 ),
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	"token_family" VARCHAR ( 64 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"hashed_refresh_token" VARCHAR ( 64 ) COLLATE "pg_catalog"."default" NOT NULL,
+	CONSTRAINT "rotated_refresh_token_pkey" PRIMARY KEY ( "id" )
+);
+ALTER TABLE "public"."rotated_refresh_token" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."rotated_refresh_token" IS 'Refresh tokens replaced by the rotation, presenting one of them again revokes the token family';
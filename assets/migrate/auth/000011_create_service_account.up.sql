@@ -0,0 +1,18 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+CREATE TABLE IF NOT EXISTS "public"."service_account" (
+	"id" int4 NOT NULL GENERATED BY DEFAULT AS IDENTITY ( INCREMENT 1 MINVALUE 1 MAXVALUE 2147483647 START 1 ),
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	"updated_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"deleted_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"client_id" VARCHAR ( 32 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"name" VARCHAR ( 255 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"hashed_secret" VARCHAR ( 64 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"scope" VARCHAR ( 255 ) COLLATE "pg_catalog"."default" NOT NULL,
+	CONSTRAINT "service_account_pkey" PRIMARY KEY ( "id" ),
+	CONSTRAINT "service_account_client_id_key" UNIQUE ( "client_id" )
+);
+ALTER TABLE "public"."service_account" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."service_account" IS 'The non-human principals of the client_credentials grant: the scope is the space-separated list of the scopes the account may request';
@@ -0,0 +1,8 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."oauth_client" ADD COLUMN IF NOT EXISTS "scope" VARCHAR ( 255 ) COLLATE "pg_catalog"."default" NOT NULL DEFAULT '';
+ALTER TABLE "public"."oauth_client" ADD COLUMN IF NOT EXISTS "audience" VARCHAR ( 255 ) COLLATE "pg_catalog"."default" NOT NULL DEFAULT '';
+COMMENT ON COLUMN "public"."oauth_client"."scope" IS 'The space-separated scopes the client may request, all of them are granted if none is requested';
+COMMENT ON COLUMN "public"."oauth_client"."audience" IS 'The resource server the access tokens of the client are issued for, it is the aud claim';
@@ -0,0 +1,8 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."oauth_client" DROP COLUMN IF EXISTS "disabled_at";
+ALTER TABLE "public"."oauth_client" DROP COLUMN IF EXISTS "refresh_token_lifetime";
+ALTER TABLE "public"."oauth_client" DROP COLUMN IF EXISTS "access_token_lifetime";
+ALTER TABLE "public"."oauth_client" DROP COLUMN IF EXISTS "grant_types";
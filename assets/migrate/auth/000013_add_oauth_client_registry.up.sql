@@ -0,0 +1,16 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."oauth_client" ADD COLUMN IF NOT EXISTS "grant_types" TEXT COLLATE "pg_catalog"."default" NOT NULL DEFAULT '';
+ALTER TABLE "public"."oauth_client" ADD COLUMN IF NOT EXISTS "access_token_lifetime" int4 NOT NULL DEFAULT 0;
+ALTER TABLE "public"."oauth_client" ADD COLUMN IF NOT EXISTS "refresh_token_lifetime" int4 NOT NULL DEFAULT 0;
+ALTER TABLE "public"."oauth_client" ADD COLUMN IF NOT EXISTS "disabled_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE;
+COMMENT ON COLUMN "public"."oauth_client"."grant_types" IS 'The space-separated grant types the client may use, password is the log in of the first-party apps';
+COMMENT ON COLUMN "public"."oauth_client"."access_token_lifetime" IS 'The lifetime of the access tokens in seconds, the lifetime of the config if zero';
+COMMENT ON COLUMN "public"."oauth_client"."refresh_token_lifetime" IS 'The lifetime of the refresh tokens in seconds, the lifetime of the config if zero';
+COMMENT ON COLUMN "public"."oauth_client"."disabled_at" IS 'The disabled client is rejected as an unknown one';
+/* The registered clients keep the grants of the authorization code flow, the other grants are registered explicitly */
+UPDATE "public"."oauth_client"
+SET grant_types = 'authorization_code refresh_token'
+WHERE grant_types = '';
@@ -0,0 +1,7 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."session" DROP COLUMN IF EXISTS "remember_me";
+ALTER TABLE "public"."session" DROP COLUMN IF EXISTS "expires_at";
+ALTER TABLE "public"."session" DROP COLUMN IF EXISTS "idle_timeout";
@@ -0,0 +1,10 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."session" ADD COLUMN IF NOT EXISTS "idle_timeout" int4 NOT NULL DEFAULT 0;
+ALTER TABLE "public"."session" ADD COLUMN IF NOT EXISTS "expires_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE;
+ALTER TABLE "public"."session" ADD COLUMN IF NOT EXISTS "remember_me" BOOLEAN NOT NULL DEFAULT FALSE;
+COMMENT ON COLUMN "public"."session"."idle_timeout" IS 'The seconds of the inactivity after which the session expires, zero for the lifetime of the refresh tokens';
+COMMENT ON COLUMN "public"."session"."expires_at" IS 'The session expires at this time regardless of the activity: the max age or the end of the absolute session, NULL for no limit';
+COMMENT ON COLUMN "public"."session"."remember_me" IS 'The user has asked for the long-lived session';
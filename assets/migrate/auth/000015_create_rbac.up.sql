@@ -0,0 +1,52 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+CREATE TABLE IF NOT EXISTS "public"."role" (
+	"id" int4 NOT NULL GENERATED BY DEFAULT AS IDENTITY ( INCREMENT 1 MINVALUE 1 MAXVALUE 2147483647 START 1 ),
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	"updated_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"name" VARCHAR ( 64 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"description" VARCHAR ( 255 ) COLLATE "pg_catalog"."default" NOT NULL DEFAULT '',
+	CONSTRAINT "role_pkey" PRIMARY KEY ( "id" ),
+	CONSTRAINT "role_name_key" UNIQUE ( "name" )
+);
+ALTER TABLE "public"."role" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."role" IS 'The roles of the users, a role is the named set of the permissions';
+
+CREATE TABLE IF NOT EXISTS "public"."permission" (
+	"id" int4 NOT NULL GENERATED BY DEFAULT AS IDENTITY ( INCREMENT 1 MINVALUE 1 MAXVALUE 2147483647 START 1 ),
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	"name" VARCHAR ( 64 ) COLLATE "pg_catalog"."default" NOT NULL,
+	CONSTRAINT "permission_pkey" PRIMARY KEY ( "id" ),
+	CONSTRAINT "permission_name_key" UNIQUE ( "name" )
+);
+ALTER TABLE "public"."permission" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."permission" IS 'The permissions the services check on their routes, e.g. admin or reports:write';
+
+CREATE TABLE IF NOT EXISTS "public"."role_permission" (
+	"role_id" int4 NOT NULL,
+	"permission_id" int4 NOT NULL,
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	CONSTRAINT "role_permission_pkey" PRIMARY KEY ( "role_id", "permission_id" ),
+	CONSTRAINT "role_permission_role_id_fkey" FOREIGN KEY ( "role_id" ) REFERENCES "public"."role" ( "id" ) ON DELETE CASCADE,
+	CONSTRAINT "role_permission_permission_id_fkey" FOREIGN KEY ( "permission_id" ) REFERENCES "public"."permission" ( "id" ) ON DELETE CASCADE
+);
+ALTER TABLE "public"."role_permission" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."role_permission" IS 'The permissions of the roles';
+
+CREATE TABLE IF NOT EXISTS "public"."user_role" (
+	"user_id" int4 NOT NULL,
+	"role_id" int4 NOT NULL,
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	CONSTRAINT "user_role_pkey" PRIMARY KEY ( "user_id", "role_id" ),
+	CONSTRAINT "user_role_role_id_fkey" FOREIGN KEY ( "role_id" ) REFERENCES "public"."role" ( "id" ) ON DELETE CASCADE
+);
+ALTER TABLE "public"."user_role" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."user_role" IS 'The roles assigned to the users, the access tokens get the roles and their permissions';
+
+INSERT INTO "role" ( created_at, "name", description ) VALUES ( NOW( ), 'admin', 'The administrators of the users' ) ON CONFLICT DO NOTHING;
+INSERT INTO "permission" ( created_at, "name" ) VALUES ( NOW( ), 'admin' ) ON CONFLICT DO NOTHING;
+INSERT INTO role_permission ( role_id, permission_id, created_at )
+SELECT "role"."id", "permission"."id", NOW( ) FROM "role", "permission" WHERE "role"."name" = 'admin' AND "permission"."name" = 'admin'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,9 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."user" DROP CONSTRAINT IF EXISTS "user_status_check";
+ALTER TABLE "public"."user" DROP COLUMN IF EXISTS "status_expires_at";
+ALTER TABLE "public"."user" DROP COLUMN IF EXISTS "status_changed_at";
+ALTER TABLE "public"."user" DROP COLUMN IF EXISTS "status_reason";
+ALTER TABLE "public"."user" DROP COLUMN IF EXISTS "status";
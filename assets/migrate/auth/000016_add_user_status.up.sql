@@ -0,0 +1,14 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."user" ADD COLUMN IF NOT EXISTS "status" VARCHAR ( 16 ) NOT NULL DEFAULT 'active';
+ALTER TABLE "public"."user" ADD COLUMN IF NOT EXISTS "status_reason" VARCHAR ( 255 ) NOT NULL DEFAULT '';
+ALTER TABLE "public"."user" ADD COLUMN IF NOT EXISTS "status_changed_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE;
+ALTER TABLE "public"."user" ADD COLUMN IF NOT EXISTS "status_expires_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE;
+ALTER TABLE "public"."user" DROP CONSTRAINT IF EXISTS "user_status_check";
+ALTER TABLE "public"."user" ADD CONSTRAINT "user_status_check" CHECK ( "status" IN ( 'active', 'suspended', 'locked', 'banned' ) );
+COMMENT ON COLUMN "public"."user"."status" IS 'The account status: active, suspended, locked or banned, only the active users can sign in';
+COMMENT ON COLUMN "public"."user"."status_reason" IS 'The reason of the last change of the status, e.g. for the support';
+COMMENT ON COLUMN "public"."user"."status_changed_at" IS 'The time of the last change of the status, NULL if it has never been changed';
+COMMENT ON COLUMN "public"."user"."status_expires_at" IS 'The user is active again at this time, NULL if the status has no limit';
@@ -0,0 +1,7 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+DROP INDEX IF EXISTS "public"."session_token_family_idx";
+DROP INDEX IF EXISTS "public"."rotated_refresh_token_created_at_idx";
+DROP INDEX IF EXISTS "public"."rotated_refresh_token_hashed_refresh_token_idx";
@@ -0,0 +1,7 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+CREATE INDEX IF NOT EXISTS "rotated_refresh_token_hashed_refresh_token_idx" ON "public"."rotated_refresh_token" ( "hashed_refresh_token" );
+CREATE INDEX IF NOT EXISTS "rotated_refresh_token_created_at_idx" ON "public"."rotated_refresh_token" ( "created_at" );
+CREATE INDEX IF NOT EXISTS "session_token_family_idx" ON "public"."session" ( "token_family" );
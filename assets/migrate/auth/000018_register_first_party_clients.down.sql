@@ -0,0 +1,12 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+/* The clients registered by the up migration have the name of the client ID and no redirect URIs */
+DELETE FROM "public"."oauth_client"
+WHERE
+	client_id IN ( 'PWA_v0.0.1' )
+	AND name = client_id
+	AND redirect_uris = ''
+	AND hashed_secret = ''
+	AND grant_types = 'password refresh_token';
@@ -0,0 +1,27 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+/* The first-party apps log in with the password grant. The released apps are registered here, the next releases
+   are registered with the admin API. The sessions of the unknown client IDs end on the next refresh. */
+INSERT INTO "public"."oauth_client" ( created_at, client_id, name, redirect_uris, grant_types )
+SELECT
+	NOW( ),
+	first_party.client_id,
+	first_party.client_id,
+	'',
+	'password refresh_token'
+FROM
+	( VALUES ( 'PWA_v0.0.1' ) ) AS first_party ( client_id )
+WHERE
+	NOT EXISTS ( SELECT 1 FROM "public"."oauth_client" WHERE oauth_client.client_id = first_party.client_id );
+/* The apps that have already been registered get the grants of the log in */
+UPDATE "public"."oauth_client"
+SET
+	updated_at = NOW( ),
+	grant_types = 'password refresh_token'
+WHERE
+	client_id ~ '^(PWA|iOS|Android)_'
+	AND hashed_secret = ''
+	AND grant_types = 'authorization_code refresh_token'
+	AND redirect_uris = '';
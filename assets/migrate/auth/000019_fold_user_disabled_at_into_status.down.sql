@@ -0,0 +1,17 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."user" ADD COLUMN IF NOT EXISTS "disabled_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE;
+/* The users locked by the disabling are disabled again */
+UPDATE "public"."user"
+SET
+	updated_at = NOW( ),
+	disabled_at = status_changed_at,
+	status = 'active',
+	status_reason = '',
+	status_expires_at = NULL
+WHERE
+	status = 'locked'
+	AND status_reason = 'disabled'
+	AND status_expires_at IS NULL;
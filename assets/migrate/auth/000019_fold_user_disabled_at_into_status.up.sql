@@ -0,0 +1,16 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+/* The disabled users are locked without a limit, the status is the only flag of the users who can't sign in */
+UPDATE "public"."user"
+SET
+	updated_at = NOW( ),
+	status = 'locked',
+	status_reason = 'disabled',
+	status_changed_at = disabled_at,
+	status_expires_at = NULL
+WHERE
+	disabled_at IS NOT NULL
+	AND status <> 'banned';
+ALTER TABLE "public"."user" DROP COLUMN IF EXISTS "disabled_at";
@@ -0,0 +1,25 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+CREATE TABLE IF NOT EXISTS "public"."mfa_challenge" (
+	"id" int4 NOT NULL GENERATED BY DEFAULT AS IDENTITY ( INCREMENT 1 MINVALUE 1 MAXVALUE 2147483647 START 1 ),
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	"updated_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"deleted_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"user_id" int4 NOT NULL,
+	"hashed_challenge_token" VARCHAR ( 64 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"expires_at" TIMESTAMP ( 6 ) NOT NULL,
+	"attempts" int2 NOT NULL DEFAULT 0,
+	"remote_addr" VARCHAR ( 45 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"client_id" VARCHAR ( 32 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"platform" TEXT COLLATE "pg_catalog"."default",
+	"height" int2,
+	"width" int2,
+	"language" TEXT COLLATE "pg_catalog"."default",
+	"timezone" TEXT COLLATE "pg_catalog"."default",
+	"user_agent" TEXT COLLATE "pg_catalog"."default",
+	CONSTRAINT "mfa_challenge_pkey" PRIMARY KEY ( "id" )
+);
+ALTER TABLE "public"."mfa_challenge" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."mfa_challenge" IS 'Log in attempts waiting for the second factor';
@@ -0,0 +1,17 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+CREATE TABLE IF NOT EXISTS "public"."webauthn_challenge" (
+	"id" int4 NOT NULL GENERATED BY DEFAULT AS IDENTITY ( INCREMENT 1 MINVALUE 1 MAXVALUE 2147483647 START 1 ),
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	"updated_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"deleted_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"ceremony" VARCHAR ( 16 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"user_id" int4 NOT NULL DEFAULT 0,
+	"hashed_challenge" VARCHAR ( 64 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"expires_at" TIMESTAMP ( 6 ) NOT NULL,
+	CONSTRAINT "webauthn_challenge_pkey" PRIMARY KEY ( "id" )
+);
+ALTER TABLE "public"."webauthn_challenge" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."webauthn_challenge" IS 'WebAuthn ceremonies waiting for the authenticator response, the user_id is 0 for the log in ceremony';
@@ -0,0 +1,19 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+CREATE TABLE IF NOT EXISTS "public"."authorization_code" (
+	"id" int4 NOT NULL GENERATED BY DEFAULT AS IDENTITY ( INCREMENT 1 MINVALUE 1 MAXVALUE 2147483647 START 1 ),
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	"updated_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"deleted_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"hashed_code" VARCHAR ( 64 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"client_id" VARCHAR ( 32 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"user_id" int4 NOT NULL,
+	"redirect_uri" TEXT COLLATE "pg_catalog"."default" NOT NULL,
+	"code_challenge" VARCHAR ( 128 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"expires_at" TIMESTAMP ( 6 ) NOT NULL,
+	CONSTRAINT "authorization_code_pkey" PRIMARY KEY ( "id" )
+);
+ALTER TABLE "public"."authorization_code" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."authorization_code" IS 'OAuth 2.0 authorization codes waiting for the exchange, the code_challenge is the PKCE S256 challenge';
@@ -0,0 +1,6 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."authorization_code" DROP COLUMN IF EXISTS "nonce";
+ALTER TABLE "public"."authorization_code" DROP COLUMN IF EXISTS "scope";
@@ -0,0 +1,7 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."authorization_code" ADD COLUMN IF NOT EXISTS "scope" VARCHAR ( 255 ) COLLATE "pg_catalog"."default" NOT NULL DEFAULT '';
+ALTER TABLE "public"."authorization_code" ADD COLUMN IF NOT EXISTS "nonce" VARCHAR ( 255 ) COLLATE "pg_catalog"."default" NOT NULL DEFAULT '';
+COMMENT ON COLUMN "public"."authorization_code"."nonce" IS 'The OpenID Connect nonce, it is copied to the ID token';
@@ -0,0 +1,21 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+CREATE TABLE IF NOT EXISTS "public"."device_authorization" (
+	"id" int4 NOT NULL GENERATED BY DEFAULT AS IDENTITY ( INCREMENT 1 MINVALUE 1 MAXVALUE 2147483647 START 1 ),
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	"updated_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"deleted_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"hashed_device_code" VARCHAR ( 64 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"user_code" VARCHAR ( 8 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"client_id" VARCHAR ( 32 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"scope" VARCHAR ( 255 ) COLLATE "pg_catalog"."default" NOT NULL DEFAULT '',
+	"status" VARCHAR ( 16 ) COLLATE "pg_catalog"."default" NOT NULL DEFAULT 'pending',
+	"user_id" int4 DEFAULT NULL,
+	"polled_at" TIMESTAMP ( 6 ) DEFAULT NULL :: TIMESTAMP WITHOUT TIME ZONE,
+	"expires_at" TIMESTAMP ( 6 ) NOT NULL,
+	CONSTRAINT "device_authorization_pkey" PRIMARY KEY ( "id" )
+);
+ALTER TABLE "public"."device_authorization" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."device_authorization" IS 'OAuth 2.0 device authorization requests (RFC 8628): the status is pending, approved or denied by the user, the request is deleted when the device has got the tokens';
@@ -0,0 +1,6 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."mfa_challenge" ADD COLUMN IF NOT EXISTS "scope" VARCHAR ( 255 ) COLLATE "pg_catalog"."default" NOT NULL DEFAULT '';
+COMMENT ON COLUMN "public"."mfa_challenge"."scope" IS 'The scopes granted to the client, the session gets them after the second factor';
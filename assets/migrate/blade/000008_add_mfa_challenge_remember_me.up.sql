@@ -0,0 +1,6 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."mfa_challenge" ADD COLUMN IF NOT EXISTS "remember_me" BOOLEAN NOT NULL DEFAULT FALSE;
+COMMENT ON COLUMN "public"."mfa_challenge"."remember_me" IS 'The user has asked for the long-lived session, the session gets it after the second factor';
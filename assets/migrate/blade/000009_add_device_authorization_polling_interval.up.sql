@@ -0,0 +1,6 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+ALTER TABLE "public"."device_authorization" ADD COLUMN IF NOT EXISTS "polling_interval" int4 NOT NULL DEFAULT 5;
+COMMENT ON COLUMN "public"."device_authorization"."polling_interval" IS 'The minimum seconds between the polls of the device, every slow_down adds 5 seconds (RFC 8628, section 3.5)';
@@ -0,0 +1,15 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+CREATE TABLE IF NOT EXISTS "public"."revoked_token" (
+	"id" int4 NOT NULL GENERATED BY DEFAULT AS IDENTITY ( INCREMENT 1 MINVALUE 1 MAXVALUE 2147483647 START 1 ),
+	"created_at" TIMESTAMP ( 6 ) NOT NULL,
+	"key" VARCHAR ( 128 ) COLLATE "pg_catalog"."default" NOT NULL,
+	"value" VARCHAR ( 255 ) COLLATE "pg_catalog"."default" NOT NULL DEFAULT '',
+	"expires_at" TIMESTAMP ( 6 ) NOT NULL,
+	CONSTRAINT "revoked_token_pkey" PRIMARY KEY ( "id" ),
+	CONSTRAINT "revoked_token_key_key" UNIQUE ( "key" )
+);
+ALTER TABLE "public"."revoked_token" OWNER TO "financelime_user";
+COMMENT ON TABLE "public"."revoked_token" IS 'The IDs of the revoked access tokens shared by the instances of the service and the CLI, the row is deleted after the token has expired';
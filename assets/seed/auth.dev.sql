@@ -0,0 +1,20 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+/* The fixtures of the development environment. They are not a part of the migrations and must never be loaded
+   into production: financelime-authorization migrate seed -db auth -file assets/seed/auth.dev.sql */
+
+INSERT INTO "user" ( created_at, email, "language", "password" )
+SELECT
+	NOW( ), 'dmalix@financelime.com', 'en', '594ceaa7946ce360a86f727a2d2c78162e67174a0044bfd143013c2921d2c048'
+WHERE
+	NOT EXISTS ( SELECT 1 FROM "user" WHERE "user".email = 'dmalix@financelime.com' );
+INSERT INTO invite_code ( created_at, user_id, expires_at, number_limit, "value" )
+SELECT
+	NOW( ), "user"."id", '2021-12-31 21:23:21', 2, 'testInviteCode'
+FROM
+	"user"
+WHERE
+	"user".email = 'dmalix@financelime.com'
+	AND NOT EXISTS ( SELECT 1 FROM invite_code WHERE invite_code."value" = 'testInviteCode' );
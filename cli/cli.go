@@ -0,0 +1,245 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	authorizationApp "github.com/dmalix/financelime-authorization/app"
+	"github.com/dmalix/financelime-authorization/app/authorization"
+	"github.com/dmalix/financelime-authorization/config"
+	"github.com/dmalix/financelime-authorization/revocation"
+	"github.com/dmalix/middleware"
+	"github.com/dmalix/requestid"
+	"go.uber.org/zap"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const remoteAddr = "127.0.0.1"
+
+const usage = `Usage: financelime-authorization <command> [<subcommand>] [flags]
+
+Commands:
+  serve                                Start the HTTP server (the default command)
+  migrate up|down|status|seed          Manage the database schema and the development fixtures
+  user create|disable|status|list      Manage the users
+  invite create|list|revoke            Manage the invite codes
+  session revoke --user <email>        Revoke all sessions of the user
+  client create|list|update|disable|enable
+                                       Manage the registered OAuth 2.0 clients
+  service-account create|list|update|delete
+                                       Manage the service accounts of the client_credentials grant
+  role create|list|delete|assign|revoke
+                                       Manage the roles and their assignments to the users
+  config check                         Check the configuration and the database connections
+  keys rotate                          Generate new secret keys
+  keys generate|promote|list           Manage the key ring of the asymmetric tokens
+
+Run 'financelime-authorization <command> <subcommand> -h' for the subcommand flags.
+`
+
+var ErrorUsage = errors.New("invalid command line")
+
+type handler func(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error
+
+var commands = map[string]map[string]handler{
+	"migrate": {
+		"up":     migrateUp,
+		"down":   migrateDown,
+		"status": migrateStatus,
+		"seed":   migrateSeed,
+	},
+	"user": {
+		"create":  userCreate,
+		"disable": userDisable,
+		"status":  userStatus,
+		"list":    userList,
+	},
+	"invite": {
+		"create": inviteCreate,
+		"list":   inviteList,
+		"revoke": inviteRevoke,
+	},
+	"session": {
+		"revoke": sessionRevoke,
+	},
+	"client": {
+		"create":  clientCreate,
+		"list":    clientList,
+		"update":  clientUpdate,
+		"disable": clientDisable,
+		"enable":  clientEnable,
+	},
+	"service-account": {
+		"create": serviceAccountCreate,
+		"list":   serviceAccountList,
+		"update": serviceAccountUpdate,
+		"delete": serviceAccountDelete,
+	},
+	"role": {
+		"create": roleCreate,
+		"list":   roleList,
+		"delete": roleDelete,
+		"assign": roleAssign,
+		"revoke": roleRevoke,
+	},
+	"config": {
+		"check": configCheck,
+	},
+	"keys": {
+		"rotate":   keysRotate,
+		"generate": keysGenerate,
+		"promote":  keysPromote,
+		"list":     keysList,
+	},
+}
+
+// Run executes the administrative command. The args don't include the program name.
+func Run(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		_, _ = fmt.Fprint(out, usage)
+		return nil
+	}
+
+	subcommands, ok := commands[args[0]]
+	if !ok {
+		_, _ = fmt.Fprint(out, usage)
+		return fmt.Errorf("%w: unknown command '%s'", ErrorUsage, args[0])
+	}
+
+	if len(args) < 2 {
+		return fmt.Errorf("%w: the '%s' command requires a subcommand: %s", ErrorUsage, args[0], names(subcommands))
+	}
+
+	run, ok := subcommands[args[1]]
+	if !ok {
+		return fmt.Errorf("%w: unknown subcommand '%s %s', expected one of: %s", ErrorUsage, args[0], args[1], names(subcommands))
+	}
+
+	err := run(ctx, logger.Named(args[0]), out, args[2:])
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+
+	return err
+}
+
+func names(subcommands map[string]handler) string {
+	list := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+func newFlagSet(name string, out io.Writer) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagSet.SetOutput(out)
+	return flagSet
+}
+
+// environment holds the same wiring as the HTTP service, built from config.InitConfig
+type environment struct {
+	config     config.App
+	databases  authorizationApp.Databases
+	repository authorization.Repository
+	// The revoked access tokens are shared with the HTTP service
+	revocationStore revocation.Store
+}
+
+func newEnvironment(logger *zap.Logger) (*environment, error) {
+
+	appConfig, err := config.InitConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to init the config: %s", err)
+	}
+
+	databases, err := authorizationApp.NewDatabases(logger, appConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := authorizationApp.NewAuthorizationRepository(appConfig, databases, middleware.NewContextGetter())
+	if err != nil {
+		if err := databases.Close(); err != nil {
+			logger.Error("failed to close the databases", zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return &environment{
+		config:          appConfig,
+		databases:       databases,
+		repository:      repository,
+		revocationStore: revocation.NewStore(revocation.NewPostgresBackend(databases.Blade)),
+	}, nil
+}
+
+// revokeAccessTokens rejects the access tokens of the deleted sessions until they expire, the revocation lasts
+// the longest lifetime of the access tokens of the config and of the clients
+func (e *environment) revokeAccessTokens(ctx context.Context, logger *zap.Logger, publicSessionIDs []string) error {
+
+	if len(publicSessionIDs) == 0 {
+		return nil
+	}
+
+	lifetime, err := e.repository.GetMaxAccessTokenLifetime(ctx, logger)
+	if err != nil {
+		return fmt.Errorf("failed to get the lifetime of the access tokens: %s", err)
+	}
+	if e.config.Jwt.AccessTokenLifetime > lifetime {
+		lifetime = e.config.Jwt.AccessTokenLifetime
+	}
+
+	for _, publicSessionID := range publicSessionIDs {
+		err = e.revocationStore.Revoke(ctx, publicSessionID, time.Duration(lifetime)*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to revoke the access token: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (e *environment) close(logger *zap.Logger) {
+	if err := e.databases.Close(); err != nil {
+		logger.Error("failed to close the databases", zap.Error(err))
+	}
+}
+
+// newRequestContext fills the context with the values the repository expects from the HTTP middleware
+func newRequestContext(ctx context.Context) (context.Context, error) {
+	requestID, err := requestid.Create(false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate requestID: %s", err)
+	}
+	ctx = context.WithValue(ctx, middleware.ContextKeyRemoteAddr, remoteAddr)
+	ctx = context.WithValue(ctx, middleware.ContextKeyRequestID, requestID)
+	return ctx, nil
+}
+
+func parseFlags(flagSet *flag.FlagSet, args []string) error {
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if flagSet.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected arguments: %s", ErrorUsage, strings.Join(flagSet.Args(), " "))
+	}
+	return nil
+}
+
+func requireFlag(name string, value string) error {
+	if value == "" {
+		return fmt.Errorf("%w: the --%s flag is required", ErrorUsage, name)
+	}
+	return nil
+}
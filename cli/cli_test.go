@@ -0,0 +1,128 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/financelime-authorization/app/authorization/repository"
+	"github.com/dmalix/financelime-authorization/config"
+	"github.com/dmalix/financelime-authorization/revocation"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+)
+
+func TestRun_Success(t *testing.T) {
+
+	tests := []struct {
+		args     []string
+		contains string
+	}{
+		{nil, "Usage:"},
+		{[]string{"help"}, "Usage:"},
+		{[]string{"keys", "rotate"}, "JWT_REFRESH_SECRET_KEY="},
+		{[]string{"keys", "rotate", "-token", "access"}, "JWT_ACCESS_SECRET_KEY="},
+		{[]string{"migrate", "seed", "-h"}, "-file"},
+		{[]string{"user", "create", "-h"}, "-email"},
+		{[]string{"user", "status", "-h"}, "-duration"},
+		{[]string{"client", "create", "-h"}, "-redirect-uri"},
+		{[]string{"client", "create", "-h"}, "-audience"},
+		{[]string{"client", "create", "-h"}, "-grant-type"},
+		{[]string{"client", "update", "-h"}, "-access-token-lifetime"},
+		{[]string{"service-account", "update", "-h"}, "-rotate-secret"},
+		{[]string{"role", "create", "-h"}, "-permissions"},
+		{[]string{"role", "assign", "-h"}, "-user"},
+		{[]string{"keys", "generate", "-h"}, "-activate-after"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := Run(context.Background(), zap.NewNop(), &out, test.args)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %s", test.args, err)
+			continue
+		}
+		if !strings.Contains(out.String(), test.contains) {
+			t.Errorf("%v: the output doesn't contain '%s': %s", test.args, test.contains, out.String())
+		}
+	}
+}
+
+func TestRun_Error(t *testing.T) {
+
+	tests := [][]string{
+		{"unknown"},
+		{"user"},
+		{"user", "unknown"},
+		{"user", "create"},
+		{"user", "status", "-email", "user@domain.com"},
+		{"user", "status", "-email", "user@domain.com", "-status", "frozen"},
+		{"user", "status", "-email", "user@domain.com", "-status", "suspended", "-duration", "-1h"},
+		{"client", "create", "-name", "Client"},
+		{"client", "update", "-name", "Client"},
+		{"client", "update", "-id", "client"},
+		{"client", "disable"},
+		{"client", "enable"},
+		{"client", "list", "extra"},
+		{"service-account", "create", "-name", "Job"},
+		{"service-account", "update", "-name", "Job"},
+		{"service-account", "update", "-id", "job"},
+		{"service-account", "delete"},
+		{"service-account", "list", "extra"},
+		{"role", "create", "-permissions", "admin"},
+		{"role", "delete"},
+		{"role", "assign", "-name", "admin"},
+		{"role", "revoke", "-user", "user@domain.com"},
+		{"role", "list", "extra"},
+		{"migrate", "down", "-db", "all"},
+		{"migrate", "seed"},
+		{"migrate", "seed", "-db", "all", "-file", "auth.dev.sql"},
+		{"keys", "rotate", "-token", "unknown"},
+		{"keys", "rotate", "extra"},
+		{"keys", "generate"},
+		{"keys", "generate", "-token", "unknown"},
+		{"keys", "generate", "-token", "access", "-activate-after", "-1h"},
+		{"keys", "promote", "-token", "unknown"},
+		{"keys", "list"},
+	}
+
+	for _, args := range tests {
+		var out bytes.Buffer
+		err := Run(context.Background(), zap.NewNop(), &out, args)
+		if !errors.Is(err, ErrorUsage) {
+			t.Errorf("%v: expected the usage error, got: %v", args, err)
+		}
+	}
+}
+
+func TestEnvironmentRevokeAccessTokens(t *testing.T) {
+
+	ctx := context.Background()
+
+	authRepo := new(repository.Mock)
+	authRepo.Props.OauthClient = model.OauthClient{ClientID: "client", AccessTokenLifetime: 900}
+
+	var appConfig config.App
+	appConfig.Jwt.AccessTokenLifetime = 60
+
+	// The HTTP service shares the backend with the CLI
+	backend := revocation.NewMemoryBackend()
+	env := &environment{
+		config:          appConfig,
+		repository:      authRepo,
+		revocationStore: revocation.NewStore(backend)}
+
+	if err := env.revokeAccessTokens(ctx, zap.NewNop(), []string{"session"}); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := revocation.NewStore(backend).IsRevoked(ctx, "session")
+	if err != nil || !revoked {
+		t.Errorf("expected the ID is revoked for the HTTP service, got %v (%v)", revoked, err)
+	}
+}
@@ -0,0 +1,271 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/utils/generate"
+	"go.uber.org/zap"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const clientSecretByteLength = 32
+
+func clientCreate(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	var clientSecret string
+
+	flagSet := newFlagSet("client create", out)
+	clientID := flagSet.String("id", "", "the client ID, a random one is generated if empty")
+	name := flagSet.String("name", "", "the client name shown to the users")
+	grantTypes := flagSet.String("grant-type", "", "the space-separated list of the grant types the client may use")
+	redirectURIs := flagSet.String("redirect-uri", "",
+		"the space-separated list of the redirect URIs, required for the authorization_code grant")
+	accessTokenLifetime := flagSet.Int("access-token-lifetime", 0,
+		"the lifetime of the access tokens in seconds, zero for the lifetime of the config")
+	refreshTokenLifetime := flagSet.Int("refresh-token-lifetime", 0,
+		"the lifetime of the refresh tokens in seconds, zero for the lifetime of the config")
+	confidential := flagSet.Bool("confidential", false, "generate the client secret, a public client has none")
+	scope := flagSet.String("scope", "", "the space-separated scopes the client may request")
+	audience := flagSet.String("audience", "", "the aud claim of the access tokens issued to the client")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("name", *name); err != nil {
+		return err
+	}
+	if err := requireFlag("grant-type", *grantTypes); err != nil {
+		return err
+	}
+
+	if *clientID == "" {
+		*clientID = generate.StringRand(16, 16, true)
+	}
+
+	if *confidential {
+		var err error
+		clientSecret, err = newClientSecret()
+		if err != nil {
+			return err
+		}
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = env.repository.CreateOauthClient(ctx, logger, model.RepoCreateOauthClientParam{
+		ClientID:             *clientID,
+		Name:                 *name,
+		ClientSecret:         clientSecret,
+		RedirectURIs:         strings.Fields(*redirectURIs),
+		Scope:                *scope,
+		Audience:             *audience,
+		GrantTypes:           strings.Fields(*grantTypes),
+		AccessTokenLifetime:  *accessTokenLifetime,
+		RefreshTokenLifetime: *refreshTokenLifetime})
+	if err != nil {
+		return fmt.Errorf("failed to create the client: %s", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "The client '%s' has been created\n", *clientID)
+	if clientSecret != "" {
+		// Only the hash is stored, the secret can't be shown again
+		_, _ = fmt.Fprintf(out, "CLIENT_SECRET=%s\n", clientSecret)
+	}
+
+	return nil
+}
+
+func clientList(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("client list", out)
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	clients, err := env.repository.GetListOauthClients(ctx, logger)
+	if err != nil {
+		return fmt.Errorf("failed to get the list of clients: %s", err)
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "CLIENT ID\tNAME\tGRANT TYPES\tSCOPE\tACCESS TTL\tREFRESH TTL\tSTATUS\tCREATED AT")
+	for _, client := range clients {
+		status := "enabled"
+		if client.DisabledAt != nil {
+			status = "disabled"
+		}
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			client.ClientID, client.Name, strings.Join(client.GrantTypes, " "), client.Scope,
+			formatLifetime(client.AccessTokenLifetime), formatLifetime(client.RefreshTokenLifetime), status,
+			client.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	return writer.Flush()
+}
+
+func clientUpdate(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	var accessTokenLifetime, refreshTokenLifetime *int
+
+	flagSet := newFlagSet("client update", out)
+	clientID := flagSet.String("id", "", "the client ID")
+	name := flagSet.String("name", "", "the new name, it's not changed if empty")
+	grantTypes := flagSet.String("grant-type", "", "the new space-separated list of the grant types, it's not changed if empty")
+	redirectURIs := flagSet.String("redirect-uri", "", "the new space-separated list of the redirect URIs, it's not changed if empty")
+	scope := flagSet.String("scope", "", "the new space-separated list of the scopes, it's not changed if empty")
+	audience := flagSet.String("audience", "", "the new aud claim of the access tokens, it's not changed if empty")
+	accessTokenLifetimeFlag := flagSet.Int("access-token-lifetime", 0,
+		"the new lifetime of the access tokens in seconds, zero for the lifetime of the config")
+	refreshTokenLifetimeFlag := flagSet.Int("refresh-token-lifetime", 0,
+		"the new lifetime of the refresh tokens in seconds, zero for the lifetime of the config")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("id", *clientID); err != nil {
+		return err
+	}
+
+	// The lifetimes are changed only if the flags are set, zero is a valid value
+	flagSet.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "access-token-lifetime":
+			accessTokenLifetime = accessTokenLifetimeFlag
+		case "refresh-token-lifetime":
+			refreshTokenLifetime = refreshTokenLifetimeFlag
+		}
+	})
+
+	if *name == "" && *grantTypes == "" && *redirectURIs == "" && *scope == "" && *audience == "" &&
+		accessTokenLifetime == nil && refreshTokenLifetime == nil {
+		return fmt.Errorf("%w: nothing to update, set --name, --grant-type, --redirect-uri, --scope, --audience "+
+			"or the token lifetimes", ErrorUsage)
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = env.repository.UpdateOauthClient(ctx, logger, model.RepoUpdateOauthClientParam{
+		ClientID:             *clientID,
+		Name:                 *name,
+		RedirectURIs:         strings.Fields(*redirectURIs),
+		Scope:                *scope,
+		Audience:             *audience,
+		GrantTypes:           strings.Fields(*grantTypes),
+		AccessTokenLifetime:  accessTokenLifetime,
+		RefreshTokenLifetime: refreshTokenLifetime})
+	if err != nil {
+		return fmt.Errorf("failed to update the client: %s", err)
+	}
+
+	// The tokens issued before keep their lifetime and scopes until they are refreshed
+	_, _ = fmt.Fprintf(out, "The client '%s' has been updated\n", *clientID)
+
+	return nil
+}
+
+func clientDisable(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("client disable", out)
+	clientID := flagSet.String("id", "", "the client ID")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("id", *clientID); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = env.repository.DisableOauthClient(ctx, logger, *clientID)
+	if err != nil {
+		return fmt.Errorf("failed to disable the client: %s", err)
+	}
+
+	// The sessions of the client are closed, the issued access tokens expire on their own
+	_, _ = fmt.Fprintf(out, "The client '%s' has been disabled\n", *clientID)
+
+	return nil
+}
+
+func clientEnable(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("client enable", out)
+	clientID := flagSet.String("id", "", "the client ID")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("id", *clientID); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = env.repository.EnableOauthClient(ctx, logger, *clientID)
+	if err != nil {
+		return fmt.Errorf("failed to enable the client: %s", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "The client '%s' has been enabled\n", *clientID)
+
+	return nil
+}
+
+func formatLifetime(lifetime int) string {
+	if lifetime == 0 {
+		return "default"
+	}
+	return fmt.Sprintf("%ds", lifetime)
+}
@@ -0,0 +1,110 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/dmalix/financelime-authorization/config"
+	"github.com/dmalix/financelime-authorization/jose"
+	"go.uber.org/zap"
+	"io"
+	"os"
+)
+
+func configCheck(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("config check", out)
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+	_, _ = fmt.Fprintln(out, "Config: OK")
+	_, _ = fmt.Fprintln(out, "Databases: OK")
+
+	_, err = config.InitLanguageContent(env.config.LanguageContent.File)
+	if err != nil {
+		return fmt.Errorf("failed to init the language content: %s", err)
+	}
+	_, _ = fmt.Fprintln(out, "Language content: OK")
+
+	oidcSigningKeyPEM, err := os.ReadFile(env.config.Oidc.SigningKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read the OIDC signing key: %s", err)
+	}
+	if _, err = jose.ParsePrivateKey(oidcSigningKeyPEM); err != nil {
+		return fmt.Errorf("failed to parse the OIDC signing key: %s", err)
+	}
+	_, _ = fmt.Fprintln(out, "OIDC signing key: OK")
+
+	for _, token := range []struct {
+		name           string
+		algorithm      string
+		privateKeyFile string
+		keyRingDir     string
+	}{
+		{"access", env.config.Jwt.AccessSignatureAlgorithm, env.config.Jwt.AccessPrivateKeyFile,
+			env.config.Jwt.AccessKeyRingDir},
+		{"refresh", env.config.Jwt.RefreshSignatureAlgorithm, env.config.Jwt.RefreshPrivateKeyFile,
+			env.config.Jwt.RefreshKeyRingDir},
+	} {
+		if !jose.IsAsymmetric(token.algorithm) {
+			continue
+		}
+		if token.keyRingDir != "" {
+			keyRing, err := jose.LoadKeyRing(token.keyRingDir, 0)
+			if err != nil {
+				return fmt.Errorf("failed to load the key ring of the %s token: %s", token.name, err)
+			}
+			if keyRing.Algorithm() != token.algorithm {
+				return fmt.Errorf("the active key of the %s token is for the '%s' algorithm, not %s",
+					token.name, keyRing.Algorithm(), token.algorithm)
+			}
+			_, _ = fmt.Fprintf(out, "Key ring of the %s token: OK (%s)\n", token.name, token.algorithm)
+			continue
+		}
+		privateKeyPEM, err := os.ReadFile(token.privateKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the key of the %s token: %s", token.name, err)
+		}
+		key, err := jose.ParsePrivateKey(privateKeyPEM)
+		if err != nil {
+			return fmt.Errorf("failed to parse the key of the %s token: %s", token.name, err)
+		}
+		if key.Algorithm != token.algorithm {
+			return fmt.Errorf("the key of the %s token is for the %s algorithm, not %s", token.name, key.Algorithm, token.algorithm)
+		}
+		_, _ = fmt.Fprintf(out, "Key of the %s token: OK (%s, kid %s)\n", token.name, key.Algorithm, key.ID)
+	}
+
+	migrators, err := selectMigrators(env, dbAll, false)
+	if err != nil {
+		return err
+	}
+	for _, item := range migrators {
+		statuses, err := item.migrator.Status(ctx, logger.Named(item.name))
+		if err != nil {
+			return fmt.Errorf("failed to get the status of the '%s' database: %s", item.name, err)
+		}
+		pending := 0
+		for _, status := range statuses {
+			if !status.Applied {
+				pending++
+			}
+		}
+		if pending > 0 {
+			_, _ = fmt.Fprintf(out, "Migrations of the '%s' database: %d pending\n", item.name, pending)
+		} else {
+			_, _ = fmt.Fprintf(out, "Migrations of the '%s' database: OK\n", item.name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/utils/generate"
+	"go.uber.org/zap"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+func inviteCreate(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("invite create", out)
+	owner := flagSet.String("owner", "", "the email of the user who owns the invite code")
+	value := flagSet.String("value", "", "the invite code, a random one is generated if empty")
+	limit := flagSet.Int("limit", 1, "the number of users who can sign up with the invite code")
+	lifetime := flagSet.Duration("lifetime", 30*24*time.Hour, "the invite code lifetime")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("owner", *owner); err != nil {
+		return err
+	}
+
+	if *value == "" {
+		*value = generate.StringRand(16, 16, true)
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := env.repository.GetUserByEmail(ctx, logger, *owner)
+	if err != nil {
+		return fmt.Errorf("failed to get the owner of the invite code: %s", err)
+	}
+
+	inviteCode, err := env.repository.CreateInviteCode(ctx, logger, model.RepoCreateInviteCodeParam{
+		UserID:      user.ID,
+		Value:       *value,
+		LimitAmount: *limit,
+		ExpiresAt:   time.Now().UTC().Add(*lifetime)})
+	if err != nil {
+		return fmt.Errorf("failed to create the invite code: %s", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "The invite code '%s' has been created, it expires at %s\n",
+		inviteCode.Value, inviteCode.ExpiresAt.Format("2006-01-02 15:04:05"))
+
+	return nil
+}
+
+func inviteList(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	var ownerID int64
+
+	flagSet := newFlagSet("invite list", out)
+	owner := flagSet.String("owner", "", "show only the invite codes of this user")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *owner != "" {
+		user, err := env.repository.GetUserByEmail(ctx, logger, *owner)
+		if err != nil {
+			return fmt.Errorf("failed to get the owner of the invite codes: %s", err)
+		}
+		ownerID = user.ID
+	}
+
+	inviteCodes, err := env.repository.GetListInviteCodes(ctx, logger, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to get the list of invite codes: %s", err)
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "VALUE\tOWNER\tISSUED\tLIMIT\tEXPIRES AT")
+	for _, inviteCode := range inviteCodes {
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%s\n",
+			inviteCode.Value, inviteCode.UserEmail, inviteCode.IssuedAmount, inviteCode.LimitAmount,
+			inviteCode.ExpiresAt.Format("2006-01-02 15:04:05"))
+	}
+
+	return writer.Flush()
+}
+
+func inviteRevoke(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("invite revoke", out)
+	value := flagSet.String("value", "", "the invite code")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("value", *value); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = env.repository.RevokeInviteCode(ctx, logger, *value)
+	if err != nil {
+		return fmt.Errorf("failed to revoke the invite code: %s", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "The invite code '%s' has been revoked\n", *value)
+
+	return nil
+}
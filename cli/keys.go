@@ -0,0 +1,257 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/dmalix/financelime-authorization/config"
+	"github.com/dmalix/financelime-authorization/jose"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+const keySize = 32
+
+const keyTimeLayout = "2006-01-02 15:04:05"
+
+func keysRotate(_ context.Context, _ *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("keys rotate", out)
+	token := flagSet.String("token", "all", "the key to generate: all, access or refresh")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	var variables []string
+	switch *token {
+	case "all":
+		variables = []string{"JWT_ACCESS_SECRET_KEY", "JWT_REFRESH_SECRET_KEY"}
+	case "access":
+		variables = []string{"JWT_ACCESS_SECRET_KEY"}
+	case "refresh":
+		variables = []string{"JWT_REFRESH_SECRET_KEY"}
+	default:
+		return fmt.Errorf("%w: unknown token '%s', expected one of: all, access, refresh", ErrorUsage, *token)
+	}
+
+	for _, variable := range variables {
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate the key: %s", err)
+		}
+		_, _ = fmt.Fprintf(out, "%s=%s\n", variable, hex.EncodeToString(key))
+	}
+
+	_, _ = fmt.Fprintln(out, "# Set the variables and restart the service. To keep the issued tokens valid, "+
+		"move the old keys to JWT_ACCESS_PREVIOUS_SECRET_KEYS and JWT_REFRESH_PREVIOUS_SECRET_KEYS "+
+		"until the tokens expire.")
+
+	return nil
+}
+
+// keyRingConfig is the key ring of the token in the config
+type keyRingConfig struct {
+	dir       string
+	algorithm string
+	// A replaced key verifies the tokens for the lifetime of the tokens
+	retention time.Duration
+}
+
+func checkKeyRingToken(token string) error {
+	switch token {
+	case "access", "refresh":
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown token '%s', expected one of: access, refresh", ErrorUsage, token)
+	}
+}
+
+func newKeyRingConfig(token string) (keyRingConfig, error) {
+
+	appConfig, err := config.InitConfig()
+	if err != nil {
+		return keyRingConfig{}, fmt.Errorf("failed to init the config: %s", err)
+	}
+
+	ring := keyRingConfig{
+		dir:       appConfig.Jwt.AccessKeyRingDir,
+		algorithm: appConfig.Jwt.AccessSignatureAlgorithm,
+		retention: time.Duration(appConfig.Jwt.AccessTokenLifetime) * time.Second,
+	}
+	if token == "refresh" {
+		ring = keyRingConfig{
+			dir:       appConfig.Jwt.RefreshKeyRingDir,
+			algorithm: appConfig.Jwt.RefreshSignatureAlgorithm,
+			retention: time.Duration(appConfig.Jwt.RefreshTokenLifetime) * time.Second,
+		}
+	}
+
+	if ring.dir == "" {
+		return keyRingConfig{}, fmt.Errorf("the key ring directory of the %s token is not set", token)
+	}
+	if !jose.IsAsymmetric(ring.algorithm) {
+		return keyRingConfig{}, fmt.Errorf("the %s algorithm of the %s token doesn't use the key ring", ring.algorithm, token)
+	}
+
+	return ring, nil
+}
+
+// keysGenerate adds the next key to the ring. The key is published at once and signs the tokens
+// after the delay, so the relying parties have the time to refresh the cached JWK Set.
+func keysGenerate(_ context.Context, _ *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("keys generate", out)
+	token := flagSet.String("token", "", "the key ring of the token: access or refresh")
+	activateAfter := flagSet.Duration("activate-after", 24*time.Hour, "the key becomes active after the delay")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("token", *token); err != nil {
+		return err
+	}
+	if err := checkKeyRingToken(*token); err != nil {
+		return err
+	}
+	if *activateAfter < 0 {
+		return fmt.Errorf("%w: the --activate-after flag must not be negative", ErrorUsage)
+	}
+
+	ring, err := newKeyRingConfig(*token)
+	if err != nil {
+		return err
+	}
+
+	privateKeyPEM, err := jose.GeneratePrivateKey(ring.algorithm)
+	if err != nil {
+		return fmt.Errorf("failed to generate the key: %s", err)
+	}
+	key, err := jose.ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to parse the generated key: %s", err)
+	}
+
+	activatesAt := time.Now().UTC().Add(*activateAfter).Truncate(time.Second)
+	file := filepath.Join(ring.dir, jose.KeyFileName(activatesAt))
+
+	// O_EXCL keeps the key of the same activation time
+	keyFile, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create the key file: %s", err)
+	}
+	_, err = keyFile.Write(privateKeyPEM)
+	if closeErr := keyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write the key file: %s", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "Key %s (%s) is generated, it becomes active at %s UTC: %s\n",
+		key.ID, key.Algorithm, activatesAt.Format(keyTimeLayout), file)
+
+	return nil
+}
+
+// keysPromote activates the earliest next key at once and deletes the files of the expired keys.
+// The previous active key keeps verifying the issued tokens, so nobody is logged out.
+func keysPromote(_ context.Context, _ *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("keys promote", out)
+	token := flagSet.String("token", "", "the key ring of the token: access or refresh")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("token", *token); err != nil {
+		return err
+	}
+	if err := checkKeyRingToken(*token); err != nil {
+		return err
+	}
+
+	ring, err := newKeyRingConfig(*token)
+	if err != nil {
+		return err
+	}
+
+	keyRing, err := jose.LoadKeyRing(ring.dir, ring.retention)
+	if err != nil {
+		return fmt.Errorf("failed to load the key ring: %s", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var next *jose.KeyStatus
+	for _, status := range keyRing.Status(now) {
+		status := status
+		switch status.State {
+		case jose.KeyStateNext:
+			if next == nil {
+				next = &status
+			}
+		case jose.KeyStateExpired:
+			if err := os.Remove(status.File); err != nil {
+				return fmt.Errorf("failed to delete the expired key file: %s", err)
+			}
+			_, _ = fmt.Fprintf(out, "Expired key %s is deleted\n", status.Key.ID)
+		}
+	}
+
+	if next == nil {
+		return fmt.Errorf("no next key in the key ring, run 'keys generate' first")
+	}
+
+	if err := os.Rename(next.File, filepath.Join(ring.dir, jose.KeyFileName(now))); err != nil {
+		return fmt.Errorf("failed to promote the key: %s", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "Key %s is active, the instances pick it up on the next reload of the key ring\n", next.Key.ID)
+
+	return nil
+}
+
+func keysList(_ context.Context, _ *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("keys list", out)
+	token := flagSet.String("token", "", "the key ring of the token: access or refresh")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("token", *token); err != nil {
+		return err
+	}
+	if err := checkKeyRingToken(*token); err != nil {
+		return err
+	}
+
+	ring, err := newKeyRingConfig(*token)
+	if err != nil {
+		return err
+	}
+
+	keyRing, err := jose.LoadKeyRing(ring.dir, ring.retention)
+	if err != nil {
+		return fmt.Errorf("failed to load the key ring: %s", err)
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "KID\tALGORITHM\tSTATE\tACTIVATES AT (UTC)\tRETIRES AT (UTC)")
+	for _, status := range keyRing.Status(time.Now().UTC()) {
+		retiresAt := "-"
+		if !status.RetiresAt.IsZero() {
+			retiresAt = status.RetiresAt.Format(keyTimeLayout)
+		}
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", status.Key.ID, status.Key.Algorithm, status.State,
+			status.ActivatesAt.Format(keyTimeLayout), retiresAt)
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,200 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	authorizationApp "github.com/dmalix/financelime-authorization/app"
+	"github.com/dmalix/financelime-authorization/migration"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"text/tabwriter"
+)
+
+const (
+	dbAll      = "all"
+	dbAuthMain = "auth"
+	dbBlade    = "blade"
+)
+
+type namedMigrator struct {
+	name     string
+	migrator migration.Migrator
+}
+
+// selectMigrators returns the migrators of the selected databases in the order they must be applied
+func selectMigrators(env *environment, db string, dryRun bool) ([]namedMigrator, error) {
+	authMain, blade := authorizationApp.NewMigrators(env.config, env.databases, dryRun)
+	switch db {
+	case dbAll:
+		return []namedMigrator{{dbAuthMain, authMain}, {dbBlade, blade}}, nil
+	case dbAuthMain:
+		return []namedMigrator{{dbAuthMain, authMain}}, nil
+	case dbBlade:
+		return []namedMigrator{{dbBlade, blade}}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown database '%s', expected one of: %s, %s, %s",
+			ErrorUsage, db, dbAll, dbAuthMain, dbBlade)
+	}
+}
+
+func migrateUp(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("migrate up", out)
+	db := flagSet.String("db", dbAll, "the database to migrate: all, auth or blade")
+	steps := flagSet.Int("steps", 0, "the number of migrations to apply, all pending migrations if zero")
+	dryRun := flagSet.Bool("dry-run", false, "only show the migrations that would be applied")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	migrators, err := selectMigrators(env, *db, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range migrators {
+		if err = item.migrator.Up(ctx, logger.Named(item.name), *steps); err != nil {
+			return fmt.Errorf("failed to migrate the '%s' database: %s", item.name, err)
+		}
+	}
+
+	return nil
+}
+
+func migrateDown(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("migrate down", out)
+	db := flagSet.String("db", "", "the database to roll back: auth or blade")
+	steps := flagSet.Int("steps", 1, "the number of migrations to roll back")
+	dryRun := flagSet.Bool("dry-run", false, "only show the migrations that would be rolled back")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("db", *db); err != nil {
+		return err
+	}
+	if *db == dbAll {
+		return fmt.Errorf("%w: the rollback is allowed for one database at a time", ErrorUsage)
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	migrators, err := selectMigrators(env, *db, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range migrators {
+		if err = item.migrator.Down(ctx, logger.Named(item.name), *steps); err != nil {
+			return fmt.Errorf("failed to roll back the '%s' database: %s", item.name, err)
+		}
+	}
+
+	return nil
+}
+
+// migrateSeed loads the fixtures of the development environment, they are not a part of the migrations
+func migrateSeed(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("migrate seed", out)
+	db := flagSet.String("db", dbAuthMain, "the database to seed: auth or blade")
+	file := flagSet.String("file", "", "the SQL file with the fixtures")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("file", *file); err != nil {
+		return err
+	}
+	if *db != dbAuthMain && *db != dbBlade {
+		return fmt.Errorf("%w: unknown database '%s', expected one of: %s, %s", ErrorUsage, *db, dbAuthMain, dbBlade)
+	}
+
+	body, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return fmt.Errorf("failed to read the seed file: %s", err)
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	database := env.databases.AuthMain
+	if *db == dbBlade {
+		database = env.databases.Blade
+	}
+
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin the transaction: %s", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if _, err = tx.ExecContext(ctx, string(body)); err != nil {
+		return fmt.Errorf("failed to load the fixtures into the '%s' database: %s", *db, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit the fixtures: %s", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "the fixtures have been loaded into the '%s' database\n", *db)
+
+	return nil
+}
+
+func migrateStatus(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("migrate status", out)
+	db := flagSet.String("db", dbAll, "the database to inspect: all, auth or blade")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	migrators, err := selectMigrators(env, *db, false)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "DB\tVERSION\tNAME\tAPPLIED AT")
+	for _, item := range migrators {
+		statuses, err := item.migrator.Status(ctx, logger.Named(item.name))
+		if err != nil {
+			return fmt.Errorf("failed to get the status of the '%s' database: %s", item.name, err)
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+			_, _ = fmt.Fprintf(writer, "%s\t%06d\t%s\t%s\n", item.name, status.Version, status.Name, appliedAt)
+		}
+	}
+
+	return writer.Flush()
+}
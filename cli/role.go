@@ -0,0 +1,180 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+func roleCreate(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("role create", out)
+	name := flagSet.String("name", "", "the name of the role, e.g. support")
+	description := flagSet.String("description", "", "the description of the role")
+	permissions := flagSet.String("permissions", "", "the space-separated list of the permissions, e.g. \"admin reports:write\"")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("name", *name); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = env.repository.CreateRole(ctx, logger, model.RepoCreateRoleParam{
+		Name:        *name,
+		Description: *description,
+		Permissions: strings.Fields(*permissions)})
+	if err != nil {
+		return fmt.Errorf("failed to create the role: %s", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "The role '%s' has been created\n", *name)
+
+	return nil
+}
+
+func roleList(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("role list", out)
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	roles, err := env.repository.GetListRoles(ctx, logger)
+	if err != nil {
+		return fmt.Errorf("failed to get the list of roles: %s", err)
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "NAME\tPERMISSIONS\tDESCRIPTION\tCREATED AT")
+	for _, role := range roles {
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n",
+			role.Name, strings.Join(role.Permissions, " "), role.Description, role.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	return writer.Flush()
+}
+
+func roleDelete(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("role delete", out)
+	name := flagSet.String("name", "", "the name of the role")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("name", *name); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = env.repository.DeleteRole(ctx, logger, *name)
+	if err != nil {
+		return fmt.Errorf("failed to delete the role: %s", err)
+	}
+
+	// The issued access tokens keep the permissions of the role until they expire
+	_, _ = fmt.Fprintf(out, "The role '%s' has been deleted\n", *name)
+
+	return nil
+}
+
+// roleAssign grants the role to the user, it's the way to make the first administrator
+func roleAssign(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+	return changeUserRole(ctx, logger, out, args, "assign")
+}
+
+func roleRevoke(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+	return changeUserRole(ctx, logger, out, args, "revoke")
+}
+
+func changeUserRole(ctx context.Context, logger *zap.Logger, out io.Writer, args []string, action string) error {
+
+	flagSet := newFlagSet("role "+action, out)
+	email := flagSet.String("user", "", "the email of the user")
+	name := flagSet.String("name", "", "the name of the role")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("user", *email); err != nil {
+		return err
+	}
+	if err := requireFlag("name", *name); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := env.repository.GetUserByEmail(ctx, logger, *email)
+	if err != nil {
+		return fmt.Errorf("failed to get the user: %s", err)
+	}
+
+	param := model.RepoUserRoleParam{
+		UserID: user.ID,
+		Role:   *name}
+	if action == "assign" {
+		err = env.repository.AssignUserRole(ctx, logger, param)
+	} else {
+		err = env.repository.RevokeUserRole(ctx, logger, param)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s the role: %s", action, err)
+	}
+
+	// The access tokens get the change on the next refresh
+	if action == "assign" {
+		_, _ = fmt.Fprintf(out, "The role '%s' has been assigned to the user %d <%s>\n", *name, user.ID, user.Email)
+	} else {
+		_, _ = fmt.Fprintf(out, "The role '%s' of the user %d <%s> has been revoked\n", *name, user.ID, user.Email)
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/utils/generate"
+	"go.uber.org/zap"
+	"io"
+	"text/tabwriter"
+)
+
+func serviceAccountCreate(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("service-account create", out)
+	clientID := flagSet.String("id", "", "the client ID, a random one is generated if empty")
+	name := flagSet.String("name", "", "the name of the backend job or service")
+	scope := flagSet.String("scope", "", "the space-separated list of the scopes the account may request")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("name", *name); err != nil {
+		return err
+	}
+	if err := requireFlag("scope", *scope); err != nil {
+		return err
+	}
+
+	if *clientID == "" {
+		*clientID = generate.StringRand(16, 16, true)
+	}
+
+	clientSecret, err := newClientSecret()
+	if err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = env.repository.CreateServiceAccount(ctx, logger, model.RepoCreateServiceAccountParam{
+		ClientID:     *clientID,
+		Name:         *name,
+		ClientSecret: clientSecret,
+		Scope:        *scope})
+	if err != nil {
+		return fmt.Errorf("failed to create the service account: %s", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "The service account '%s' has been created\n", *clientID)
+	// Only the hash is stored, the secret can't be shown again
+	_, _ = fmt.Fprintf(out, "CLIENT_ID=%s\nCLIENT_SECRET=%s\n", *clientID, clientSecret)
+
+	return nil
+}
+
+func serviceAccountList(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("service-account list", out)
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	accounts, err := env.repository.GetListServiceAccounts(ctx, logger)
+	if err != nil {
+		return fmt.Errorf("failed to get the list of service accounts: %s", err)
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "CLIENT ID\tNAME\tSCOPE\tCREATED AT")
+	for _, account := range accounts {
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n",
+			account.ClientID, account.Name, account.Scope, account.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	return writer.Flush()
+}
+
+func serviceAccountUpdate(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	var clientSecret string
+
+	flagSet := newFlagSet("service-account update", out)
+	clientID := flagSet.String("id", "", "the client ID")
+	name := flagSet.String("name", "", "the new name, it's not changed if empty")
+	scope := flagSet.String("scope", "", "the new space-separated list of the scopes, it's not changed if empty")
+	rotateSecret := flagSet.Bool("rotate-secret", false, "generate the new client secret, the old one stops working")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("id", *clientID); err != nil {
+		return err
+	}
+	if *name == "" && *scope == "" && !*rotateSecret {
+		return fmt.Errorf("%w: nothing to update, set --name, --scope or --rotate-secret", ErrorUsage)
+	}
+
+	if *rotateSecret {
+		var err error
+		clientSecret, err = newClientSecret()
+		if err != nil {
+			return err
+		}
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = env.repository.UpdateServiceAccount(ctx, logger, model.RepoUpdateServiceAccountParam{
+		ClientID:     *clientID,
+		Name:         *name,
+		ClientSecret: clientSecret,
+		Scope:        *scope})
+	if err != nil {
+		return fmt.Errorf("failed to update the service account: %s", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "The service account '%s' has been updated\n", *clientID)
+	if clientSecret != "" {
+		_, _ = fmt.Fprintf(out, "CLIENT_SECRET=%s\n", clientSecret)
+	}
+
+	return nil
+}
+
+func serviceAccountDelete(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("service-account delete", out)
+	clientID := flagSet.String("id", "", "the client ID")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("id", *clientID); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = env.repository.DeleteServiceAccount(ctx, logger, *clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete the service account: %s", err)
+	}
+
+	// The issued access tokens are inactive for the introspection at once and expire on their own
+	_, _ = fmt.Fprintf(out, "The service account '%s' has been deleted\n", *clientID)
+
+	return nil
+}
+
+func newClientSecret() (string, error) {
+	secretBytes := make([]byte, clientSecretByteLength)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", fmt.Errorf("failed to generate the client secret: %s", err)
+	}
+	return hex.EncodeToString(secretBytes), nil
+}
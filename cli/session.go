@@ -0,0 +1,56 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"go.uber.org/zap"
+	"io"
+)
+
+func sessionRevoke(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("session revoke", out)
+	email := flagSet.String("user", "", "the email of the user whose sessions must be revoked")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("user", *email); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := env.repository.GetUserByEmail(ctx, logger, *email)
+	if err != nil {
+		return fmt.Errorf("failed to get the user: %s", err)
+	}
+
+	publicSessionIDs, err := env.repository.DeleteUserSessions(ctx, logger, model.RepoDeleteUserSessionsParam{
+		UserID: user.ID})
+	if err != nil {
+		return fmt.Errorf("failed to revoke the sessions: %s", err)
+	}
+
+	err = env.revokeAccessTokens(ctx, logger, publicSessionIDs)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(out, "%d session(s) of the user %d <%s> have been revoked\n", len(publicSessionIDs), user.ID, user.Email)
+
+	return nil
+}
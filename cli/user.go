@@ -0,0 +1,220 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/dmalix/financelime-authorization/app/authorization/model"
+	"github.com/dmalix/utils/generate"
+	"go.uber.org/zap"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+func userCreate(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("user create", out)
+	email := flagSet.String("email", "", "the user email")
+	language := flagSet.String("language", "en", "the user language")
+	password := flagSet.String("password", "", "the user password, a random one is generated if empty")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("email", *email); err != nil {
+		return err
+	}
+
+	generatedPassword := *password == ""
+	if generatedPassword {
+		*password = generate.StringRand(16, 16, false)
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := env.repository.CreateUser(ctx, logger, model.RepoCreateUserParam{
+		Email:    *email,
+		Language: *language,
+		Password: *password})
+	if err != nil {
+		return fmt.Errorf("failed to create the user: %s", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "The user %d <%s> has been created\n", user.ID, user.Email)
+	if generatedPassword {
+		_, _ = fmt.Fprintf(out, "Password: %s\n", *password)
+	}
+
+	return nil
+}
+
+func userDisable(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("user disable", out)
+	email := flagSet.String("email", "", "the user email")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("email", *email); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := env.repository.GetUserByEmail(ctx, logger, *email)
+	if err != nil {
+		return fmt.Errorf("failed to get the user: %s", err)
+	}
+
+	publicSessionIDs, err := env.repository.DisableUser(ctx, logger, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to disable the user: %s", err)
+	}
+
+	err = env.revokeAccessTokens(ctx, logger, publicSessionIDs)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(out, "The user %d <%s> has been disabled and the sessions have been revoked\n", user.ID, user.Email)
+
+	return nil
+}
+
+// userStatus changes the account status, the sessions of the user who is not active anymore are revoked
+func userStatus(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	var expiresAt *time.Time
+
+	flagSet := newFlagSet("user status", out)
+	email := flagSet.String("email", "", "the user email")
+	status := flagSet.String("status", "", "the account status: active, suspended, locked or banned")
+	reason := flagSet.String("reason", "", "the reason of the change")
+	duration := flagSet.Duration("duration", 0, "the user is active again after the duration, zero for no limit")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if err := requireFlag("email", *email); err != nil {
+		return err
+	}
+	if err := requireFlag("status", *status); err != nil {
+		return err
+	}
+	switch *status {
+	case model.UserStatusActive, model.UserStatusSuspended, model.UserStatusLocked, model.UserStatusBanned:
+	default:
+		return fmt.Errorf("%w: the --status flag must be active, suspended, locked or banned", ErrorUsage)
+	}
+	if *duration < 0 {
+		return fmt.Errorf("%w: the --duration flag must not be negative", ErrorUsage)
+	}
+	if *duration > 0 {
+		value := time.Now().UTC().Add(*duration).Truncate(time.Second)
+		expiresAt = &value
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := env.repository.GetUserByEmail(ctx, logger, *email)
+	if err != nil {
+		return fmt.Errorf("failed to get the user: %s", err)
+	}
+
+	publicSessionIDs, err := env.repository.UpdateUserStatus(ctx, logger, model.RepoUpdateUserStatusParam{
+		UserID:    user.ID,
+		Status:    *status,
+		Reason:    *reason,
+		ExpiresAt: expiresAt})
+	if err != nil {
+		return fmt.Errorf("failed to update the status of the user: %s", err)
+	}
+
+	err = env.revokeAccessTokens(ctx, logger, publicSessionIDs)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(out, "The status of the user %d <%s> is %s, %d sessions have been revoked\n",
+		user.ID, user.Email, *status, len(publicSessionIDs))
+
+	return nil
+}
+
+func userList(ctx context.Context, logger *zap.Logger, out io.Writer, args []string) error {
+
+	flagSet := newFlagSet("user list", out)
+	limit := flagSet.Int("limit", 50, "the maximum number of users")
+	offset := flagSet.Int("offset", 0, "the number of users to skip")
+	email := flagSet.String("email", "", "the part of the email to search by")
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	env, err := newEnvironment(logger)
+	if err != nil {
+		return err
+	}
+	defer env.close(logger)
+
+	ctx, err = newRequestContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	users, err := env.repository.GetListUsers(ctx, logger, model.RepoGetListUsersParam{
+		Email:  *email,
+		Limit:  *limit,
+		Offset: *offset})
+	if err != nil {
+		return fmt.Errorf("failed to get the list of users: %s", err)
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "ID\tEMAIL\tLANGUAGE\tCREATED AT\tSTATUS")
+	for _, user := range users {
+		status := user.Status
+		if user.Status == model.UserStatusLocked && user.StatusReason == model.UserStatusReasonDisabled {
+			status = "disabled"
+		}
+		if user.Status != model.UserStatusActive && user.StatusChangedAt != nil {
+			status += " at " + user.StatusChangedAt.UTC().Format("2006-01-02 15:04:05")
+		}
+		if user.Status != model.UserStatusActive && user.StatusExpiresAt != nil {
+			status += " until " + user.StatusExpiresAt.UTC().Format("2006-01-02 15:04:05")
+		}
+		_, _ = fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\n",
+			user.ID, user.Email, user.Language, user.CreatedAt.UTC().Format("2006-01-02 15:04:05"), status)
+	}
+
+	return writer.Flush()
+}
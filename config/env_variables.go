@@ -9,6 +9,12 @@ const (
 	envHttpServerPort = "HTTP_SERVER_PORT"
 
 	envAuthInviteCodeRequired = "AUTH_INVITE_CODE_REQUIRED"
+	// The session policy, the variables are optional
+	envAuthSessionExpiry                = "AUTH_SESSION_EXPIRY"
+	envAuthSessionIdleTimeout           = "AUTH_SESSION_IDLE_TIMEOUT"
+	envAuthSessionMaxAge                = "AUTH_SESSION_MAX_AGE"
+	envAuthSessionRememberMeIdleTimeout = "AUTH_SESSION_REMEMBER_ME_IDLE_TIMEOUT"
+	envAuthSessionRememberMeMaxAge      = "AUTH_SESSION_REMEMBER_ME_MAX_AGE"
 
 	envDbAuthMainConnectHost     = "DB_AUTH_MAIN_CONNECT_HOST"
 	envDbAuthMainConnectPort     = "DB_AUTH_MAIN_CONNECT_PORT"
@@ -24,9 +30,7 @@ const (
 	envDbAuthReadConnectUser     = "DB_AUTH_READ_CONNECT_USER"
 	envDbAuthReadConnectPassword = "DB_AUTH_READ_CONNECT_PASSWORD"
 
-	envDbAuthMainMigrateDropfile   = "DB_AUTH_MAIN_MIGRATE_DROPFILE"
-	envDbAuthMainMigrateCreateFile = "DB_AUTH_MAIN_MIGRATE_CREATEFILE"
-	envDbAuthMainMigrateInsertFile = "DB_AUTH_MAIN_MIGRATE_INSERTFILE"
+	envDbAuthMainMigrateDir = "DB_AUTH_MAIN_MIGRATE_DIR"
 
 	envDbBladeConnectHost     = "DB_BLADE_CONNECT_HOST"
 	envDbBladeConnectPort     = "DB_BLADE_CONNECT_PORT"
@@ -35,8 +39,10 @@ const (
 	envDbBladeConnectUser     = "DB_BLADE_CONNECT_USER"
 	envDbBladeConnectPassword = "DB_BLADE_CONNECT_PASSWORD"
 
-	envDbBladeMigrateDropFile   = "DB_BLADE_MIGRATE_DROPFILE"
-	envDbBladeMigrateCreateFile = "DB_BLADE_MIGRATE_CREATEFILE"
+	envDbBladeMigrateDir = "DB_BLADE_MIGRATE_DIR"
+
+	envDbMigrateOnStart = "DB_MIGRATE_ON_START"
+	envDbMigrateDryRun  = "DB_MIGRATE_DRY_RUN"
 
 	envSmtpUser     = "SMTP_USER"
 	envSmtpPassword = "SMTP_PASSWORD"
@@ -46,7 +52,9 @@ const (
 	envMailMessageFromName = "MAIL_MESSAGE_FROM_NAME"
 	envMailMessageFromAddr = "MAIL_MESSAGE_FROM_ADDR"
 
-	envCryptoSalt = "CRYPTO_SALT"
+	envCryptoSalt                  = "CRYPTO_SALT"
+	envCryptoPasswordHashAlgorithm = "CRYPTO_PASSWORD_HASH_ALGORITHM"
+	envCryptoMfaSecretKey          = "CRYPTO_MFA_SECRET_KEY"
 
 	envJwtIssuer                    = "JWT_ISSUER"
 	envJwtAccessSecretKey           = "JWT_ACCESS_SECRET_KEY"
@@ -55,4 +63,13 @@ const (
 	envJwtRefreshSecretKey          = "JWT_REFRESH_SECRET_KEY"
 	envJwtRefreshSignatureAlgorithm = "JWT_REFRESH_SIGNATURE_ALGORITHM"
 	envJwtRefreshTokenLifeTime      = "JWT_REFRESH_TOKEN_LIFETIME"
+	envJwtAccessPrivateKeyFile      = "JWT_ACCESS_PRIVATE_KEY_FILE"
+	envJwtRefreshPrivateKeyFile     = "JWT_REFRESH_PRIVATE_KEY_FILE"
+	envJwtAccessKeyRingDir          = "JWT_ACCESS_KEY_RING_DIR"
+	envJwtRefreshKeyRingDir         = "JWT_REFRESH_KEY_RING_DIR"
+	// The comma-separated lists of the secret keys
+	envJwtAccessPreviousSecretKeys  = "JWT_ACCESS_PREVIOUS_SECRET_KEYS"
+	envJwtRefreshPreviousSecretKeys = "JWT_REFRESH_PREVIOUS_SECRET_KEYS"
+
+	envOidcSigningKeyFile = "OIDC_SIGNING_KEY_FILE"
 )
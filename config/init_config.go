@@ -6,8 +6,11 @@ package config
 
 import (
 	"fmt"
+	"github.com/dmalix/financelime-authorization/hasher"
+	"github.com/dmalix/financelime-authorization/jose"
 	"os"
 	"strconv"
+	"strings"
 )
 
 func InitConfig() (App, error) {
@@ -94,14 +97,8 @@ func InitConfig() (App, error) {
 	}
 
 	// DB AuthMain Migrate
-	if config.Db.AuthMain.Migration.DropFile = os.Getenv(envDbAuthMainMigrateDropfile); config.Db.AuthMain.Migration.DropFile == "" {
-		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envDbAuthMainMigrateDropfile)
-	}
-	if config.Db.AuthMain.Migration.CreateFile = os.Getenv(envDbAuthMainMigrateCreateFile); config.Db.AuthMain.Migration.CreateFile == "" {
-		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envDbAuthMainMigrateCreateFile)
-	}
-	if config.Db.AuthMain.Migration.InsertFile = os.Getenv(envDbAuthMainMigrateInsertFile); config.Db.AuthMain.Migration.InsertFile == "" {
-		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envDbAuthMainMigrateInsertFile)
+	if config.Db.AuthMain.Migration.Dir = os.Getenv(envDbAuthMainMigrateDir); config.Db.AuthMain.Migration.Dir == "" {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envDbAuthMainMigrateDir)
 	}
 
 	// DB Blade
@@ -128,11 +125,16 @@ func InitConfig() (App, error) {
 	}
 
 	// DB Blade Migrate
-	if config.Db.Blade.Migration.DropFile = os.Getenv(envDbBladeMigrateDropFile); config.Db.Blade.Migration.DropFile == "" {
-		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envDbBladeMigrateDropFile)
+	if config.Db.Blade.Migration.Dir = os.Getenv(envDbBladeMigrateDir); config.Db.Blade.Migration.Dir == "" {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envDbBladeMigrateDir)
+	}
+
+	// DB Migrate
+	if config.Db.Migrate.OnStart, err = strconv.ParseBool(os.Getenv(envDbMigrateOnStart)); err != nil {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsNotBoolean, envDbMigrateOnStart, err)
 	}
-	if config.Db.Blade.Migration.CreateFile = os.Getenv(envDbBladeMigrateCreateFile); config.Db.Blade.Migration.CreateFile == "" {
-		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envDbBladeMigrateCreateFile)
+	if config.Db.Migrate.DryRun, err = strconv.ParseBool(os.Getenv(envDbMigrateDryRun)); err != nil {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsNotBoolean, envDbMigrateDryRun, err)
 	}
 
 	// SMTP
@@ -164,6 +166,13 @@ func InitConfig() (App, error) {
 	if config.Crypto.Salt = os.Getenv(envCryptoSalt); config.Crypto.Salt == "" {
 		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envCryptoSalt)
 	}
+	// The new password hashes are made with Argon2id unless another algorithm is set
+	if config.Crypto.PasswordHashAlgorithm = os.Getenv(envCryptoPasswordHashAlgorithm); config.Crypto.PasswordHashAlgorithm == "" {
+		config.Crypto.PasswordHashAlgorithm = hasher.AlgorithmArgon2id
+	}
+	if config.Crypto.MfaSecretKey = os.Getenv(envCryptoMfaSecretKey); config.Crypto.MfaSecretKey == "" {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envCryptoMfaSecretKey)
+	}
 
 	// JWT
 	if config.Jwt.Issuer = os.Getenv(envJwtIssuer); config.Jwt.Issuer == "" {
@@ -187,6 +196,77 @@ func InitConfig() (App, error) {
 	if config.Jwt.RefreshTokenLifetime, err = strconv.Atoi(os.Getenv(envJwtRefreshTokenLifeTime)); err != nil {
 		return App{}, fmt.Errorf(messageEnvironmentVariableIsNotNumber, envJwtRefreshTokenLifeTime, err)
 	}
+	config.Jwt.AccessPrivateKeyFile = os.Getenv(envJwtAccessPrivateKeyFile)
+	config.Jwt.AccessKeyRingDir = os.Getenv(envJwtAccessKeyRingDir)
+	if jose.IsAsymmetric(config.Jwt.AccessSignatureAlgorithm) &&
+		config.Jwt.AccessPrivateKeyFile == "" && config.Jwt.AccessKeyRingDir == "" {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envJwtAccessPrivateKeyFile+" or "+envJwtAccessKeyRingDir)
+	}
+	config.Jwt.RefreshPrivateKeyFile = os.Getenv(envJwtRefreshPrivateKeyFile)
+	config.Jwt.RefreshKeyRingDir = os.Getenv(envJwtRefreshKeyRingDir)
+	if jose.IsAsymmetric(config.Jwt.RefreshSignatureAlgorithm) &&
+		config.Jwt.RefreshPrivateKeyFile == "" && config.Jwt.RefreshKeyRingDir == "" {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envJwtRefreshPrivateKeyFile+" or "+envJwtRefreshKeyRingDir)
+	}
+	config.Jwt.AccessPreviousSecretKeys = splitList(os.Getenv(envJwtAccessPreviousSecretKeys))
+	config.Jwt.RefreshPreviousSecretKeys = splitList(os.Getenv(envJwtRefreshPreviousSecretKeys))
+
+	// Session policy, the sessions live as long as the refresh tokens by default
+	switch config.Auth.SessionExpiry = os.Getenv(envAuthSessionExpiry); config.Auth.SessionExpiry {
+	case "":
+		config.Auth.SessionExpiry = SessionExpirySliding
+	case SessionExpirySliding, SessionExpiryAbsolute:
+	default:
+		return App{}, fmt.Errorf("the %s environment variable is not one of: %s, %s",
+			envAuthSessionExpiry, SessionExpirySliding, SessionExpiryAbsolute)
+	}
+	if config.Auth.SessionIdleTimeout, err = atoiOptional(envAuthSessionIdleTimeout, config.Jwt.RefreshTokenLifetime); err != nil {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsNotNumber, envAuthSessionIdleTimeout, err)
+	}
+	if config.Auth.SessionMaxAge, err = atoiOptional(envAuthSessionMaxAge, 0); err != nil {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsNotNumber, envAuthSessionMaxAge, err)
+	}
+	if config.Auth.SessionRememberMeIdleTimeout, err = atoiOptional(envAuthSessionRememberMeIdleTimeout,
+		config.Auth.SessionIdleTimeout); err != nil {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsNotNumber, envAuthSessionRememberMeIdleTimeout, err)
+	}
+	if config.Auth.SessionRememberMeMaxAge, err = atoiOptional(envAuthSessionRememberMeMaxAge,
+		config.Auth.SessionMaxAge); err != nil {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsNotNumber, envAuthSessionRememberMeMaxAge, err)
+	}
+	if config.Auth.SessionIdleTimeout <= 0 || config.Auth.SessionRememberMeIdleTimeout <= 0 {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsNull, envAuthSessionIdleTimeout+" or "+
+			envAuthSessionRememberMeIdleTimeout)
+	}
+	if config.Auth.SessionMaxAge < 0 || config.Auth.SessionRememberMeMaxAge < 0 {
+		return App{}, fmt.Errorf("the %s or %s environment variable is negative", envAuthSessionMaxAge,
+			envAuthSessionRememberMeMaxAge)
+	}
+
+	// OpenID Connect
+	if config.Oidc.SigningKeyFile = os.Getenv(envOidcSigningKeyFile); config.Oidc.SigningKeyFile == "" {
+		return App{}, fmt.Errorf(messageEnvironmentVariableIsEmpty, envOidcSigningKeyFile)
+	}
 
 	return config, nil
 }
+
+// atoiOptional returns the default value if the variable is not set
+func atoiOptional(name string, defaultValue int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// splitList returns the non-empty items of the comma-separated list
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -4,6 +4,13 @@ import (
 	"net/mail"
 )
 
+const (
+	// The refresh extends the session until the max age
+	SessionExpirySliding = "sliding"
+	// The session expires after the idle timeout or the max age from the log in, the refresh doesn't extend it
+	SessionExpiryAbsolute = "absolute"
+)
+
 type Version struct {
 	DevelopmentMode bool
 	Number          string
@@ -25,11 +32,24 @@ type App struct {
 	}
 	Auth struct {
 		InviteCodeRequired bool
+		// SessionExpirySliding or SessionExpiryAbsolute
+		SessionExpiry string
+		// The seconds of the inactivity after which the session expires
+		SessionIdleTimeout int
+		// The seconds after the log in after which the session expires regardless of the activity, zero for no limit
+		SessionMaxAge int
+		// The same for the sessions of the users who have checked "remember me"
+		SessionRememberMeIdleTimeout int
+		SessionRememberMeMaxAge      int
 	}
 	Db struct {
 		AuthMain DB
 		AuthRead DB
 		Blade    DB
+		Migrate  struct {
+			OnStart bool
+			DryRun  bool
+		}
 	}
 	Smtp struct {
 		User     string
@@ -41,7 +61,9 @@ type App struct {
 		From mail.Address
 	}
 	Crypto struct {
-		Salt string
+		Salt                  string
+		PasswordHashAlgorithm string
+		MfaSecretKey          string
 	}
 	Jwt struct {
 		Issuer                    string
@@ -51,5 +73,19 @@ type App struct {
 		RefreshSecretKey          string
 		RefreshSignatureAlgorithm string
 		RefreshTokenLifetime      int
+		// The PEM files of the private keys, required for the asymmetric algorithms (RS256, ES256, EdDSA) only.
+		// The secret keys still encrypt the data of the tokens.
+		AccessPrivateKeyFile  string
+		RefreshPrivateKeyFile string
+		// The key ring directories, they take the place of the key files to rotate the keys without logouts
+		AccessKeyRingDir  string
+		RefreshKeyRingDir string
+		// The replaced secret keys, they are accepted until the tokens of them expire
+		AccessPreviousSecretKeys  []string
+		RefreshPreviousSecretKeys []string
+	}
+	Oidc struct {
+		// The PEM file of the RSA private key, the ID tokens are signed with it
+		SigningKeyFile string
 	}
 }
@@ -10,8 +10,6 @@ type DB struct {
 		Password string
 	}
 	Migration struct {
-		DropFile   string
-		CreateFile string
-		InsertFile string
+		Dir string
 	}
 }
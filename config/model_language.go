@@ -21,7 +21,7 @@ type UserDataLanguageContent struct {
 				Subject []string
 				Body    []string
 			}
-			Password struct {
+			Complete struct {
 				Subject []string
 				Body    []string
 			}
@@ -36,7 +36,7 @@ type UserDataLanguageContent struct {
 				Subject []string
 				Body    []string
 			}
-			Password struct {
+			Complete struct {
 				Subject []string
 				Body    []string
 			}
@@ -45,10 +45,34 @@ type UserDataLanguageContent struct {
 			Text []string
 		}
 	}
+	ChangePassword struct {
+		Email struct {
+			Subject []string
+			Body    []string
+		}
+	}
 	Login struct {
 		Email struct {
 			Subject []string
 			Body    []string
 		}
 	}
+	RecoveryCode struct {
+		Email struct {
+			Subject []string
+			Body    []string
+		}
+	}
+	RefreshTokenReuse struct {
+		Email struct {
+			Subject []string
+			Body    []string
+		}
+	}
+	RevokeSessions struct {
+		Email struct {
+			Subject []string
+			Body    []string
+		}
+	}
 }
@@ -16,4 +16,5 @@ require (
 	github.com/swaggo/http-swagger v1.0.0
 	github.com/swaggo/swag v1.7.0
 	go.uber.org/zap v1.17.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 )
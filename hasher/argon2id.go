@@ -0,0 +1,123 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+type Argon2idParams struct {
+	// The memory in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the RFC 9106 recommendations for the memory-constrained environments
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+const argon2idPrefix = "$" + AlgorithmArgon2id + "$"
+
+type argon2id struct {
+	params Argon2idParams
+}
+
+func newArgon2id(params Argon2idParams) *argon2id {
+	if params == (Argon2idParams{}) {
+		params = DefaultArgon2idParams
+	}
+	return &argon2id{params: params}
+}
+
+func (a *argon2id) identify(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, argon2idPrefix)
+}
+
+// hash returns the hash in the PHC string format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func (a *argon2id) hash(password string) (string, error) {
+
+	salt := make([]byte, a.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate the salt: %s", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.params.Iterations, a.params.Memory, a.params.Parallelism,
+		a.params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, a.params.Memory, a.params.Iterations, a.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *argon2id) verify(password string, encodedHash string) (bool, error) {
+
+	params, salt, key, err := a.decode(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism,
+		params.KeyLength)
+
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+func (a *argon2id) needsRehash(encodedHash string) bool {
+	params, _, _, err := a.decode(encodedHash)
+	return err != nil || params != a.params
+}
+
+func (a *argon2id) decode(encodedHash string) (Argon2idParams, []byte, []byte, error) {
+
+	var (
+		params  Argon2idParams
+		version int
+	)
+
+	// "", "argon2id", "v=19", "m=65536,t=3,p=2", "<salt>", "<key>"
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return Argon2idParams{}, nil, nil, ErrorBadHashFormat
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("%w: %s", ErrorBadHashFormat, err)
+	}
+	if version != argon2.Version {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("%w: unsupported version %d", ErrorBadHashFormat, version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d",
+		&params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("%w: %s", ErrorBadHashFormat, err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("%w: %s", ErrorBadHashFormat, err)
+	}
+	params.SaltLength = uint32(len(salt))
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("%w: %s", ErrorBadHashFormat, err)
+	}
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,61 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package hasher
+
+import (
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+type BcryptParams struct {
+	Cost int
+}
+
+var DefaultBcryptParams = BcryptParams{
+	Cost: 12,
+}
+
+type bcryptAlgorithm struct {
+	params BcryptParams
+}
+
+func newBcrypt(params BcryptParams) *bcryptAlgorithm {
+	if params == (BcryptParams{}) {
+		params = DefaultBcryptParams
+	}
+	return &bcryptAlgorithm{params: params}
+}
+
+func (b *bcryptAlgorithm) identify(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$2a$") ||
+		strings.HasPrefix(encodedHash, "$2b$") ||
+		strings.HasPrefix(encodedHash, "$2y$")
+}
+
+// hash returns the hash in the modular crypt format, the salt is a part of it: $2a$12$<salt><key>
+func (b *bcryptAlgorithm) hash(password string) (string, error) {
+	encodedHash, err := bcrypt.GenerateFromPassword([]byte(password), b.params.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(encodedHash), nil
+}
+
+func (b *bcryptAlgorithm) verify(password string, encodedHash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *bcryptAlgorithm) needsRehash(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	return err != nil || cost != b.params.Cost
+}
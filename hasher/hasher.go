@@ -0,0 +1,106 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package hasher
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var ErrorUnknownAlgorithm = errors.New("unknown password hash algorithm")
+var ErrorUnknownHashFormat = errors.New("unknown password hash format")
+var ErrorBadHashFormat = errors.New("bad password hash format")
+
+// Hasher hashes the user passwords. The hashes are encoded in the PHC string format
+// (the bcrypt hashes in its own modular crypt format), so every hash carries its algorithm,
+// parameters and salt, and the hashes made with other algorithms can still be verified.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password string, encodedHash string) (bool, error)
+	// NeedsRehash reports whether the hash was made with another algorithm or other parameters
+	NeedsRehash(encodedHash string) bool
+}
+
+type Config struct {
+	// The algorithm of the new hashes: argon2id or bcrypt
+	Algorithm string
+	Argon2id  Argon2idParams
+	Bcrypt    BcryptParams
+	// The global salt of the legacy hex-encoded sha256(password + salt) hashes
+	LegacySalt string
+}
+
+// algorithm is implemented by each supported hash format
+type algorithm interface {
+	identify(encodedHash string) bool
+	hash(password string) (string, error)
+	verify(password string, encodedHash string) (bool, error)
+	needsRehash(encodedHash string) bool
+}
+
+type hasher struct {
+	current    algorithm
+	algorithms []algorithm
+}
+
+func NewHasher(config Config) (*hasher, error) {
+
+	var current algorithm
+
+	argon2idAlgorithm := newArgon2id(config.Argon2id)
+	bcryptAlgorithm := newBcrypt(config.Bcrypt)
+
+	switch config.Algorithm {
+	case AlgorithmArgon2id:
+		current = argon2idAlgorithm
+	case AlgorithmBcrypt:
+		current = bcryptAlgorithm
+	default:
+		return nil, fmt.Errorf("%w: '%s'", ErrorUnknownAlgorithm, config.Algorithm)
+	}
+
+	return &hasher{
+		current: current,
+		algorithms: []algorithm{
+			argon2idAlgorithm,
+			bcryptAlgorithm,
+			newLegacySHA256(config.LegacySalt),
+		},
+	}, nil
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	return h.current.hash(password)
+}
+
+func (h *hasher) Verify(password string, encodedHash string) (bool, error) {
+	item, err := h.identify(encodedHash)
+	if err != nil {
+		return false, err
+	}
+	return item.verify(password, encodedHash)
+}
+
+func (h *hasher) NeedsRehash(encodedHash string) bool {
+	item, err := h.identify(encodedHash)
+	if err != nil || item != h.current {
+		return true
+	}
+	return item.needsRehash(encodedHash)
+}
+
+func (h *hasher) identify(encodedHash string) (algorithm, error) {
+	for _, item := range h.algorithms {
+		if item.identify(encodedHash) {
+			return item, nil
+		}
+	}
+	return nil, ErrorUnknownHashFormat
+}
@@ -0,0 +1,160 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package hasher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const legacySalt = "legacySalt"
+
+var testArgon2idParams = Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var testBcryptParams = BcryptParams{
+	Cost: 4,
+}
+
+func newTestHasher(t *testing.T, algorithm string) *hasher {
+	h, err := NewHasher(Config{
+		Algorithm:  algorithm,
+		Argon2id:   testArgon2idParams,
+		Bcrypt:     testBcryptParams,
+		LegacySalt: legacySalt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestHasher_Success(t *testing.T) {
+
+	tests := []struct {
+		algorithm string
+		prefix    string
+	}{
+		{AlgorithmArgon2id, "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{AlgorithmBcrypt, "$2a$04$"},
+	}
+
+	for _, test := range tests {
+
+		h := newTestHasher(t, test.algorithm)
+
+		encodedHash, err := h.Hash("qmhVXVC1%hVNa0Hcq")
+		if err != nil {
+			t.Fatalf("%s: failed to hash: %s", test.algorithm, err)
+		}
+		if !strings.HasPrefix(encodedHash, test.prefix) {
+			t.Errorf("%s: the hash has a wrong prefix: %s", test.algorithm, encodedHash)
+		}
+
+		otherEncodedHash, err := h.Hash("qmhVXVC1%hVNa0Hcq")
+		if err != nil {
+			t.Fatalf("%s: failed to hash: %s", test.algorithm, err)
+		}
+		if test.algorithm == AlgorithmArgon2id && otherEncodedHash == encodedHash {
+			t.Errorf("%s: the hashes of the same password must have different salts", test.algorithm)
+		}
+
+		ok, err := h.Verify("qmhVXVC1%hVNa0Hcq", encodedHash)
+		if err != nil || !ok {
+			t.Errorf("%s: failed to verify the right password: %v, %v", test.algorithm, ok, err)
+		}
+
+		ok, err = h.Verify("wrongPassword", encodedHash)
+		if err != nil || ok {
+			t.Errorf("%s: the wrong password is verified: %v, %v", test.algorithm, ok, err)
+		}
+
+		if h.NeedsRehash(encodedHash) {
+			t.Errorf("%s: the hash of the current algorithm doesn't need a rehash", test.algorithm)
+		}
+	}
+}
+
+func TestHasher_Rehash(t *testing.T) {
+
+	argon2idHasher := newTestHasher(t, AlgorithmArgon2id)
+	bcryptHasher := newTestHasher(t, AlgorithmBcrypt)
+
+	bcryptHash, err := bcryptHasher.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := argon2idHasher.Verify("password", bcryptHash); err != nil || !ok {
+		t.Errorf("failed to verify the hash of another algorithm: %v, %v", ok, err)
+	}
+	if !argon2idHasher.NeedsRehash(bcryptHash) {
+		t.Errorf("the hash of another algorithm needs a rehash")
+	}
+
+	strongerHasher, err := NewHasher(Config{
+		Algorithm: AlgorithmArgon2id,
+		Argon2id: Argon2idParams{
+			Memory:      2048,
+			Iterations:  1,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon2idHash, err := argon2idHasher.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strongerHasher.NeedsRehash(argon2idHash) {
+		t.Errorf("the hash with other parameters needs a rehash")
+	}
+
+	sum := sha256.Sum256([]byte("password" + legacySalt))
+	legacyHash := hex.EncodeToString(sum[:])
+	if ok, err := argon2idHasher.Verify("password", legacyHash); err != nil || !ok {
+		t.Errorf("failed to verify the legacy hash: %v, %v", ok, err)
+	}
+	if ok, err := argon2idHasher.Verify("wrongPassword", legacyHash); err != nil || ok {
+		t.Errorf("the wrong password is verified with the legacy hash: %v, %v", ok, err)
+	}
+	if !argon2idHasher.NeedsRehash(legacyHash) {
+		t.Errorf("the legacy hash needs a rehash")
+	}
+}
+
+func TestHasher_Error(t *testing.T) {
+
+	_, err := NewHasher(Config{Algorithm: "sha256"})
+	if !errors.Is(err, ErrorUnknownAlgorithm) {
+		t.Errorf("expected the unknown algorithm error, got: %v", err)
+	}
+
+	h := newTestHasher(t, AlgorithmArgon2id)
+
+	_, err = h.Verify("password", "plaintext")
+	if !errors.Is(err, ErrorUnknownHashFormat) {
+		t.Errorf("expected the unknown hash format error, got: %v", err)
+	}
+
+	_, err = h.Verify("password", "$argon2id$v=19$m=1024$salt")
+	if !errors.Is(err, ErrorBadHashFormat) {
+		t.Errorf("expected the bad hash format error, got: %v", err)
+	}
+
+	if !h.NeedsRehash("plaintext") {
+		t.Errorf("the hash of an unknown format needs a rehash")
+	}
+}
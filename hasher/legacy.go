@@ -0,0 +1,42 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package hasher
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"regexp"
+)
+
+var legacySHA256Regexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// legacySHA256 verifies the hex-encoded sha256(password + salt) hashes made with one global salt.
+// It can't make new hashes, the users are moved to the current algorithm at the next login.
+type legacySHA256 struct {
+	salt string
+}
+
+func newLegacySHA256(salt string) *legacySHA256 {
+	return &legacySHA256{salt: salt}
+}
+
+func (l *legacySHA256) identify(encodedHash string) bool {
+	return legacySHA256Regexp.MatchString(encodedHash)
+}
+
+func (l *legacySHA256) hash(_ string) (string, error) {
+	return "", errors.New("the legacy sha256 hashes are only verified")
+}
+
+func (l *legacySHA256) verify(password string, encodedHash string) (bool, error) {
+	sum := sha256.Sum256([]byte(password + l.salt))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(encodedHash)) == 1, nil
+}
+
+func (l *legacySHA256) needsRehash(_ string) bool {
+	return true
+}
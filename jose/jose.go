@@ -0,0 +1,374 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+// Package jose signs the JSON Web Tokens (RFC 7519) with the asymmetric keys and publishes the public keys
+// as a JSON Web Key Set (RFC 7517), so the relying parties verify the tokens without any shared secret.
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+
+	tokenType = "JWT"
+	// The smallest RSA modulus allowed for RS256 (RFC 7518, section 3.3)
+	minRSAKeyBits = 2048
+	// The size of the P-256 coordinates and of the R and S halves of the ES256 signature
+	p256ByteLength = 32
+)
+
+var (
+	ErrorBadKey       = errors.New("bad private key")
+	ErrorBadToken     = errors.New("bad token")
+	ErrorBadSignature = errors.New("bad token signature")
+)
+
+// IsAsymmetric reports whether the JWS algorithm is signed with a key pair supported by the package
+func IsAsymmetric(algorithm string) bool {
+	switch algorithm {
+	case AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA:
+		return true
+	default:
+		return false
+	}
+}
+
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	// The RSA public key
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// The EC (P-256) and OKP (Ed25519, RFC 8037) public keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// KeySource publishes the public keys, the service joins the keys of all the signers into one JWK Set
+type KeySource interface {
+	KeySet() JSONWebKeySet
+}
+
+type keySources []KeySource
+
+// JoinKeySets returns the source of the keys of all the sources, a key is published once even if it's shared
+func JoinKeySets(sources ...KeySource) keySources {
+	return sources
+}
+
+func (s keySources) KeySet() JSONWebKeySet {
+
+	keySet := JSONWebKeySet{Keys: []JSONWebKey{}}
+	published := make(map[string]bool)
+
+	for _, source := range s {
+		for _, key := range source.KeySet().Keys {
+			if !published[key.KeyID] {
+				published[key.KeyID] = true
+				keySet.Keys = append(keySet.Keys, key)
+			}
+		}
+	}
+
+	return keySet
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Type      string `json:"typ"`
+}
+
+// Key is a signing key, its ID is the JWK thumbprint (RFC 7638), so it doesn't have to be configured.
+// The algorithm follows the type of the key: RS256 for RSA, ES256 for ECDSA P-256 and EdDSA for Ed25519.
+type Key struct {
+	ID         string
+	Algorithm  string
+	privateKey crypto.Signer
+}
+
+// ParsePrivateKey reads the private key from a PEM block of the PKCS #1, SEC 1 or PKCS #8 form, as generated by
+// openssl genpkey -algorithm RSA -pkeyopt rsa_keygen_bits:2048 (or -algorithm EC -pkeyopt ec_paramgen_curve:P-256,
+// or -algorithm ED25519)
+func ParsePrivateKey(data []byte) (*Key, error) {
+
+	var privateKey interface{}
+	var err error
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrorBadKey
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, ErrorBadKey
+	}
+	if err != nil {
+		return nil, ErrorBadKey
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, ErrorBadKey
+	}
+
+	return NewKey(signer)
+}
+
+func NewKey(privateKey crypto.Signer) (*Key, error) {
+
+	key := &Key{privateKey: privateKey}
+
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if privateKey.N.BitLen() < minRSAKeyBits {
+			return nil, ErrorBadKey
+		}
+		key.Algorithm = AlgorithmRS256
+	case *ecdsa.PrivateKey:
+		if privateKey.Curve != elliptic.P256() {
+			return nil, ErrorBadKey
+		}
+		key.Algorithm = AlgorithmES256
+	case ed25519.PrivateKey:
+		key.Algorithm = AlgorithmEdDSA
+	default:
+		return nil, ErrorBadKey
+	}
+
+	key.ID = thumbprint(key.PublicJWK())
+
+	return key, nil
+}
+
+func (k *Key) PublicJWK() JSONWebKey {
+
+	jwk := JSONWebKey{
+		Use:       "sig",
+		Algorithm: k.Algorithm,
+		KeyID:     k.ID,
+	}
+
+	switch publicKey := k.privateKey.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.KeyType = "EC"
+		jwk.Curve = "P-256"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey.X.FillBytes(make([]byte, p256ByteLength)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(publicKey.Y.FillBytes(make([]byte, p256ByteLength)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	}
+
+	return jwk
+}
+
+func (k *Key) sign(signingInput []byte) ([]byte, error) {
+
+	digest := sha256.Sum256(signingInput)
+
+	switch privateKey := k.privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, privateKey, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS uses the fixed-size R || S form instead of the ASN.1 one (RFC 7518, section 3.4)
+		signature := make([]byte, 2*p256ByteLength)
+		r.FillBytes(signature[:p256ByteLength])
+		s.FillBytes(signature[p256ByteLength:])
+		return signature, nil
+	case ed25519.PrivateKey:
+		// Ed25519 signs the message itself, not its digest
+		return ed25519.Sign(privateKey, signingInput), nil
+	default:
+		return k.privateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+}
+
+func (k *Key) verify(signingInput []byte, signature []byte) bool {
+
+	digest := sha256.Sum256(signingInput)
+
+	switch publicKey := k.privateKey.Public().(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		if len(signature) != 2*p256ByteLength {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:p256ByteLength])
+		s := new(big.Int).SetBytes(signature[p256ByteLength:])
+		return ecdsa.Verify(publicKey, digest[:], r, s)
+	case ed25519.PublicKey:
+		return ed25519.Verify(publicKey, signingInput, signature)
+	default:
+		return false
+	}
+}
+
+// thumbprint returns the SHA-256 JWK thumbprint of the public key (RFC 7638, section 3; RFC 8037, section 2)
+func thumbprint(jwk JSONWebKey) string {
+
+	var members string
+
+	// The required members in the lexicographic order, without whitespace
+	switch jwk.KeyType {
+	case "RSA":
+		members = `{"e":"` + jwk.E + `","kty":"RSA","n":"` + jwk.N + `"}`
+	case "EC":
+		members = `{"crv":"` + jwk.Curve + `","kty":"EC","x":"` + jwk.X + `","y":"` + jwk.Y + `"}`
+	case "OKP":
+		members = `{"crv":"` + jwk.Curve + `","kty":"OKP","x":"` + jwk.X + `"}`
+	}
+
+	digest := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+type Signer interface {
+	KeySource
+	// Sign returns the compact serialization of the token with the JSON-encoded claims
+	Sign(claims interface{}) (string, error)
+	// Verify checks the signature and decodes the claims, the caller checks the claims such as exp and aud
+	Verify(token string, claims interface{}) error
+	// Algorithm is the JWS algorithm of the new tokens
+	Algorithm() string
+}
+
+type signer struct {
+	key *Key
+}
+
+func NewSigner(key *Key) *signer {
+	return &signer{key: key}
+}
+
+func (s *signer) Sign(claims interface{}) (string, error) {
+	return sign(s.key, claims)
+}
+
+func (s *signer) Verify(token string, claims interface{}) error {
+	return verify(token, claims, func(keyID string) *Key {
+		if keyID == s.key.ID {
+			return s.key
+		}
+		return nil
+	})
+}
+
+func (s *signer) KeySet() JSONWebKeySet {
+	return JSONWebKeySet{Keys: []JSONWebKey{s.key.PublicJWK()}}
+}
+
+func (s *signer) Algorithm() string {
+	return s.key.Algorithm
+}
+
+func sign(key *Key, claims interface{}) (string, error) {
+
+	headerJSON, err := json.Marshal(header{
+		Algorithm: key.Algorithm,
+		KeyID:     key.ID,
+		Type:      tokenType,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." +
+		base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// verify finds the key by the kid header with the lookup function
+func verify(token string, claims interface{}, lookup func(keyID string) *Key) error {
+
+	var tokenHeader header
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrorBadToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrorBadToken
+	}
+	if err = json.Unmarshal(headerJSON, &tokenHeader); err != nil {
+		return ErrorBadToken
+	}
+
+	// The algorithm is never taken from the token alone, it must be the algorithm of the own key
+	key := lookup(tokenHeader.KeyID)
+	if key == nil || tokenHeader.Algorithm != key.Algorithm {
+		return ErrorBadSignature
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrorBadToken
+	}
+
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return ErrorBadSignature
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrorBadToken
+	}
+	if err = json.Unmarshal(claimsJSON, claims); err != nil {
+		return ErrorBadToken
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package jose
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestThumbprint(t *testing.T) {
+
+	// RFC 7638, section 3.1
+	jwk := JSONWebKey{
+		KeyType: "RSA",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4" +
+			"n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZ" +
+			"Hzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEg" +
+			"U8awapJzKnqDKgw",
+		E: "AQAB",
+	}
+
+	if id := thumbprint(jwk); id != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("wrong thumbprint: %s", id)
+	}
+
+	// RFC 8037, appendix A.3
+	jwk = JSONWebKey{
+		KeyType: "OKP",
+		Curve:   "Ed25519",
+		X:       "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo",
+	}
+
+	if id := thumbprint(jwk); id != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("wrong thumbprint: %s", id)
+	}
+}
+
+func TestSigner(t *testing.T) {
+
+	type claims struct {
+		Subject string `json:"sub"`
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		algorithm string
+		keyPEM    []byte
+	}{
+		{AlgorithmRS256, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})},
+		{AlgorithmRS256, marshalPKCS8(t, rsaKey)},
+		{AlgorithmES256, func() []byte {
+			der, err := x509.MarshalECPrivateKey(ecdsaKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		}()},
+		{AlgorithmES256, marshalPKCS8(t, ecdsaKey)},
+		{AlgorithmEdDSA, marshalPKCS8(t, ed25519Key)},
+	}
+
+	for _, test := range tests {
+		key, err := ParsePrivateKey(test.keyPEM)
+		if err != nil {
+			t.Fatalf("%s: failed to parse the key: %v", test.algorithm, err)
+		}
+		if key.Algorithm != test.algorithm {
+			t.Errorf("%s: wrong algorithm of the key: %s", test.algorithm, key.Algorithm)
+		}
+
+		signer := NewSigner(key)
+
+		token, err := signer.Sign(claims{Subject: "2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var verified claims
+		if err = signer.Verify(token, &verified); err != nil || verified.Subject != "2" {
+			t.Errorf("%s: failed to verify the token: %v, %+v", test.algorithm, err, verified)
+		}
+
+		keySet := signer.KeySet()
+		if len(keySet.Keys) != 1 || keySet.Keys[0].KeyID != key.ID || keySet.Keys[0].Algorithm != test.algorithm {
+			t.Errorf("%s: wrong key set: %+v", test.algorithm, keySet)
+		}
+
+		parts := strings.Split(token, ".")
+		tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+		if err = signer.Verify(tampered, &verified); err != ErrorBadSignature {
+			t.Errorf("%s: expected %v, got %v", test.algorithm, ErrorBadSignature, err)
+		}
+	}
+}
+
+func TestJoinKeySets(t *testing.T) {
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := NewSigner(key)
+
+	keySet := JoinKeySets(signer, JoinKeySets(), signer).KeySet()
+	if len(keySet.Keys) != 1 || keySet.Keys[0].KeyID != key.ID {
+		t.Errorf("wrong key set: %+v", keySet)
+	}
+}
+
+func marshalPKCS8(t *testing.T, privateKey interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestParsePrivateKey_Error(t *testing.T) {
+
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range [][]byte{
+		nil,
+		[]byte("-----BEGIN PUBLIC KEY-----\nAAAA\n-----END PUBLIC KEY-----\n"),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("bad")}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weakKey)}),
+		marshalPKCS8(t, p384Key),
+	} {
+		if _, err := ParsePrivateKey(data); err != ErrorBadKey {
+			t.Errorf("expected %v, got %v", ErrorBadKey, err)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The states of the keys in the ring. The state follows from the activation times, so all the instances
+// of the service agree on it without any coordination:
+//   - next: published, so the relying parties cache it before it signs anything
+//   - active: the latest activated key, it signs the new tokens
+//   - retiring: replaced by a newer key, it verifies the tokens it has signed until they expire
+//   - expired: neither published nor accepted, the file can be deleted
+const (
+	KeyStateNext     = "next"
+	KeyStateActive   = "active"
+	KeyStateRetiring = "retiring"
+	KeyStateExpired  = "expired"
+)
+
+const (
+	// The key files of the ring directory are named by the activation time, e.g. 20211018T120000Z.pem
+	keyFileTimeLayout = "20060102T150405Z"
+	keyFileExtension  = ".pem"
+)
+
+var ErrorNoActiveKey = errors.New("no active key in the key ring")
+
+type RingKey struct {
+	Key         *Key
+	ActivatesAt time.Time
+	// The file of the key in the ring directory
+	File string
+}
+
+type KeyStatus struct {
+	RingKey
+	State string
+	// When the retiring key stops verifying the tokens, zero for the next and active keys
+	RetiresAt time.Time
+}
+
+type keyRing struct {
+	mutex sync.RWMutex
+	// Sorted by the activation time
+	keys []RingKey
+	// The lifetime of the tokens, a replaced key verifies the tokens for this time
+	retention time.Duration
+	// Empty if the ring is not loaded from a directory
+	dir string
+}
+
+func NewKeyRing(keys []RingKey, retention time.Duration) *keyRing {
+	ring := &keyRing{retention: retention}
+	ring.setKeys(keys)
+	return ring
+}
+
+// LoadKeyRing reads all the key files of the directory, see KeyFileName
+func LoadKeyRing(dir string, retention time.Duration) (*keyRing, error) {
+
+	ring := &keyRing{retention: retention, dir: dir}
+
+	if err := ring.Reload(); err != nil {
+		return nil, err
+	}
+
+	return ring, nil
+}
+
+// Reload reads the directory again to pick up the generated and promoted keys. The ring is not changed on error.
+func (r *keyRing) Reload() error {
+
+	var keys []RingKey
+
+	if r.dir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(r.dir, "*"+keyFileExtension))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		activatesAt, err := time.Parse(keyFileTimeLayout, strings.TrimSuffix(filepath.Base(file), keyFileExtension))
+		if err != nil {
+			return fmt.Errorf("the name of the key file %s is not the activation time: %s", file, err)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		key, err := ParsePrivateKey(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse the key file %s: %s", file, err)
+		}
+		keys = append(keys, RingKey{Key: key, ActivatesAt: activatesAt, File: file})
+	}
+
+	r.setKeys(keys)
+
+	return nil
+}
+
+func (r *keyRing) setKeys(keys []RingKey) {
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].ActivatesAt.Before(keys[j].ActivatesAt)
+	})
+
+	r.mutex.Lock()
+	r.keys = keys
+	r.mutex.Unlock()
+}
+
+// Status returns the keys with their states at the moment, in the order of the activation
+func (r *keyRing) Status(now time.Time) []KeyStatus {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	statuses := make([]KeyStatus, len(r.keys))
+
+	for i, key := range r.keys {
+		statuses[i].RingKey = key
+		switch {
+		case key.ActivatesAt.After(now):
+			statuses[i].State = KeyStateNext
+		case i == len(r.keys)-1 || r.keys[i+1].ActivatesAt.After(now):
+			statuses[i].State = KeyStateActive
+		default:
+			statuses[i].RetiresAt = r.keys[i+1].ActivatesAt.Add(r.retention)
+			if statuses[i].RetiresAt.After(now) {
+				statuses[i].State = KeyStateRetiring
+			} else {
+				statuses[i].State = KeyStateExpired
+			}
+		}
+	}
+
+	return statuses
+}
+
+func (r *keyRing) activeKey() (*Key, error) {
+	for _, status := range r.Status(time.Now().UTC()) {
+		if status.State == KeyStateActive {
+			return status.Key, nil
+		}
+	}
+	return nil, ErrorNoActiveKey
+}
+
+func (r *keyRing) Sign(claims interface{}) (string, error) {
+
+	key, err := r.activeKey()
+	if err != nil {
+		return "", err
+	}
+
+	return sign(key, claims)
+}
+
+// Verify accepts the tokens of all the keys but the expired ones. The next keys are accepted
+// as well, an instance with the clock ahead may already sign with them.
+func (r *keyRing) Verify(token string, claims interface{}) error {
+
+	statuses := r.Status(time.Now().UTC())
+
+	return verify(token, claims, func(keyID string) *Key {
+		for _, status := range statuses {
+			if status.Key.ID == keyID && status.State != KeyStateExpired {
+				return status.Key
+			}
+		}
+		return nil
+	})
+}
+
+func (r *keyRing) KeySet() JSONWebKeySet {
+
+	keySet := JSONWebKeySet{Keys: []JSONWebKey{}}
+
+	for _, status := range r.Status(time.Now().UTC()) {
+		if status.State != KeyStateExpired {
+			keySet.Keys = append(keySet.Keys, status.Key.PublicJWK())
+		}
+	}
+
+	return keySet
+}
+
+func (r *keyRing) Algorithm() string {
+
+	key, err := r.activeKey()
+	if err != nil {
+		return ""
+	}
+
+	return key.Algorithm
+}
+
+// KeyFileName is the name of the key file in the ring directory, the key is activated at the time
+func KeyFileName(activatesAt time.Time) string {
+	return activatesAt.UTC().Format(keyFileTimeLayout) + keyFileExtension
+}
+
+// GeneratePrivateKey returns the new private key for the algorithm in the PKCS #8 PEM form
+func GeneratePrivateKey(algorithm string) ([]byte, error) {
+
+	var privateKey crypto.Signer
+	var err error
+
+	switch algorithm {
+	case AlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	case AlgorithmES256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("the %s algorithm is not supported", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
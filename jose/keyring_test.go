@@ -0,0 +1,184 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package jose
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func generateRingKey(t *testing.T, activatesAt time.Time) RingKey {
+
+	privateKeyPEM, err := GeneratePrivateKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return RingKey{Key: key, ActivatesAt: activatesAt}
+}
+
+func TestKeyRing_Status(t *testing.T) {
+
+	now := time.Now().UTC()
+	retention := time.Hour
+
+	expired := generateRingKey(t, now.Add(-3*time.Hour))
+	retiring := generateRingKey(t, now.Add(-90*time.Minute))
+	active := generateRingKey(t, now.Add(-30*time.Minute))
+	next := generateRingKey(t, now.Add(time.Hour))
+
+	ring := NewKeyRing([]RingKey{next, active, expired, retiring}, retention)
+
+	expectedStates := []struct {
+		key   RingKey
+		state string
+	}{
+		{expired, KeyStateExpired},
+		{retiring, KeyStateRetiring},
+		{active, KeyStateActive},
+		{next, KeyStateNext},
+	}
+
+	statuses := ring.Status(now)
+	if len(statuses) != len(expectedStates) {
+		t.Fatalf("wrong number of the keys: %d", len(statuses))
+	}
+	for i, expected := range expectedStates {
+		if statuses[i].Key.ID != expected.key.Key.ID || statuses[i].State != expected.state {
+			t.Errorf("key %d: expected the %s state, got %s", i, expected.state, statuses[i].State)
+		}
+	}
+	if !statuses[1].RetiresAt.Equal(active.ActivatesAt.Add(retention)) {
+		t.Errorf("wrong retirement time of the retiring key: %s", statuses[1].RetiresAt)
+	}
+
+	// The new tokens are signed with the active key, the tokens of the retiring key stay valid
+
+	type claims struct {
+		Subject string `json:"sub"`
+	}
+
+	token, err := ring.Sign(claims{Subject: "subject"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = NewSigner(active.Key).Verify(token, &claims{}); err != nil {
+		t.Errorf("the token is not signed with the active key: %s", err)
+	}
+
+	for _, test := range []struct {
+		key   RingKey
+		valid bool
+	}{
+		{retiring, true},
+		{active, true},
+		{next, true},
+		{expired, false},
+	} {
+		token, err := NewSigner(test.key.Key).Sign(claims{Subject: "subject"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ring.Verify(token, &claims{})
+		if test.valid && err != nil {
+			t.Errorf("the token of the %s key is rejected: %s", test.key.Key.ID, err)
+		}
+		if !test.valid && err != ErrorBadSignature {
+			t.Errorf("the token of the expired key is not rejected: %v", err)
+		}
+	}
+
+	keySet := ring.KeySet()
+	if len(keySet.Keys) != 3 {
+		t.Errorf("expected the retiring, active and next keys to be published, got %d keys", len(keySet.Keys))
+	}
+	for _, jwk := range keySet.Keys {
+		if jwk.KeyID == expired.Key.ID {
+			t.Errorf("the expired key is published")
+		}
+	}
+
+	if ring.Algorithm() != AlgorithmES256 {
+		t.Errorf("wrong algorithm: %s", ring.Algorithm())
+	}
+}
+
+func TestKeyRing_NoActiveKey(t *testing.T) {
+
+	ring := NewKeyRing([]RingKey{generateRingKey(t, time.Now().UTC().Add(time.Hour))}, time.Hour)
+
+	if _, err := ring.Sign(struct{}{}); err != ErrorNoActiveKey {
+		t.Errorf("expected ErrorNoActiveKey, got: %v", err)
+	}
+	if ring.Algorithm() != "" {
+		t.Errorf("expected no algorithm, got: %s", ring.Algorithm())
+	}
+}
+
+func TestLoadKeyRing(t *testing.T) {
+
+	dir := t.TempDir()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var keyIDs []string
+	for _, activatesAt := range []time.Time{now.Add(-time.Hour), now.Add(time.Hour)} {
+		privateKeyPEM, err := GeneratePrivateKey(AlgorithmEdDSA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ParsePrivateKey(privateKeyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyIDs = append(keyIDs, key.ID)
+		if err = os.WriteFile(filepath.Join(dir, KeyFileName(activatesAt)), privateKeyPEM, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ring, err := LoadKeyRing(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := ring.Status(now)
+	if len(statuses) != 2 ||
+		statuses[0].Key.ID != keyIDs[0] || statuses[0].State != KeyStateActive ||
+		statuses[1].Key.ID != keyIDs[1] || statuses[1].State != KeyStateNext {
+		t.Fatalf("wrong keys of the ring: %+v", statuses)
+	}
+
+	// The promoted key is picked up by the reload
+
+	if err = os.Rename(statuses[1].File, filepath.Join(dir, KeyFileName(now.Add(-time.Minute)))); err != nil {
+		t.Fatal(err)
+	}
+	if err = ring.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	statuses = ring.Status(now)
+	if len(statuses) != 2 || statuses[1].Key.ID != keyIDs[1] || statuses[1].State != KeyStateActive ||
+		statuses[0].State != KeyStateRetiring {
+		t.Errorf("the promoted key is not active: %+v", statuses)
+	}
+
+	// A file with a bad name fails the reload, the loaded keys are kept
+
+	if err = os.WriteFile(filepath.Join(dir, "key.pem"), []byte{}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ring.Reload(); err == nil {
+		t.Errorf("expected the error of the bad file name")
+	}
+	if len(ring.Status(now)) != 2 {
+		t.Errorf("the keys are changed by the failed reload")
+	}
+}
@@ -0,0 +1,135 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package jose
+
+import (
+	"errors"
+	"github.com/dmalix/jwt"
+	"time"
+)
+
+// The codes of the parse errors, they are logged by the callers of jwt.Jwt
+const (
+	ParseCodeBadToken     = "BAD_TOKEN"
+	ParseCodeBadSignature = "BAD_SIGNATURE"
+	ParseCodeBadClaims    = "BAD_CLAIMS"
+	ParseCodeExpired      = "TOKEN_EXPIRED"
+)
+
+var (
+	ErrorBadClaims    = errors.New("bad token claims")
+	ErrorTokenExpired = errors.New("token expired")
+)
+
+type tokenClaims struct {
+	Issuer   string `json:"iss,omitempty"`
+	Subject  string `json:"sub,omitempty"`
+	JwtID    string `json:"jti,omitempty"`
+	Data     string `json:"data,omitempty"`
+	Audience string `json:"aud,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// The roles and the permissions of the user (RFC 9068, section 2.2.3.1)
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	IssuedAt    int64    `json:"iat"`
+	ExpiresAt   int64    `json:"exp"`
+}
+
+// AccessClaims are the claims of the access token the jwt.Claims have no fields for (RFC 9068, section 2.2).
+// They are in the clear, so the resource server checks them without the token data.
+type AccessClaims struct {
+	Audience string
+	// The space-separated scopes
+	Scope string
+	// The roles of the user and the permissions of the roles
+	Roles       []string
+	Permissions []string
+	// The lifetime of the token in seconds for the exp claim, the lifetime of the config if zero
+	Lifetime int
+}
+
+// token is the jwt.Jwt implementation with the asymmetric signer, it replaces the token of jwt.NewToken
+// without any change in the middleware and the service
+type token struct {
+	signer Signer
+	config jwt.Config
+}
+
+// NewToken takes the issuer, the subject, the parse options and the lifetime from the config,
+// the algorithm and the key come from the signer
+func NewToken(signer Signer, config jwt.Config) *token {
+	return &token{signer: signer, config: config}
+}
+
+func (t *token) Create(claims jwt.Claims) (string, error) {
+	return t.CreateWithAccessClaims(claims, AccessClaims{})
+}
+
+// CreateWithAccessClaims adds the aud, scope, roles and permissions claims, the empty ones are omitted
+func (t *token) CreateWithAccessClaims(claims jwt.Claims, accessClaims AccessClaims) (string, error) {
+
+	now := time.Now().UTC()
+
+	lifetime := t.config.TokenLifetimeSec
+	if accessClaims.Lifetime > 0 {
+		lifetime = accessClaims.Lifetime
+	}
+
+	return t.signer.Sign(tokenClaims{
+		Issuer:      t.config.Claims.Issuer,
+		Subject:     t.config.Claims.Subject,
+		JwtID:       claims.JwtID,
+		Data:        claims.Data,
+		Audience:    accessClaims.Audience,
+		Scope:       accessClaims.Scope,
+		Roles:       accessClaims.Roles,
+		Permissions: accessClaims.Permissions,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(time.Duration(lifetime) * time.Second).Unix(),
+	})
+}
+
+func (t *token) Parse(value string) (jwt.Token, string, error) {
+
+	var claims tokenClaims
+
+	err := t.signer.Verify(value, &claims)
+	if err != nil {
+		if err == ErrorBadSignature {
+			return jwt.Token{}, ParseCodeBadSignature, err
+		}
+		return jwt.Token{}, ParseCodeBadToken, err
+	}
+
+	// The subject is the token use, an access token must not pass for a refresh one even with a shared key
+
+	if (t.config.ParseOptions.RequiredClaimIssuer && claims.Issuer != t.config.Claims.Issuer) ||
+		(t.config.ParseOptions.RequiredClaimSubject && claims.Subject != t.config.Claims.Subject) ||
+		(t.config.ParseOptions.RequiredClaimJwtID && claims.JwtID == "") ||
+		(t.config.ParseOptions.RequiredClaimData && claims.Data == "") {
+		return jwt.Token{}, ParseCodeBadClaims, ErrorBadClaims
+	}
+
+	if time.Now().UTC().Unix() >= claims.ExpiresAt {
+		return jwt.Token{}, ParseCodeExpired, ErrorTokenExpired
+	}
+
+	return jwt.Token{
+		Headers: jwt.Headers{
+			Type:               tokenType,
+			SignatureAlgorithm: t.signer.Algorithm(),
+		},
+		Claims: jwt.Claims{
+			Issuer:  claims.Issuer,
+			Subject: claims.Subject,
+			JwtID:   claims.JwtID,
+			Data:    claims.Data,
+		},
+	}, "", nil
+}
+
+func (t *token) KeySet() JSONWebKeySet {
+	return t.signer.KeySet()
+}
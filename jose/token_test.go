@@ -0,0 +1,124 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package jose
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dmalix/jwt"
+	"strings"
+	"testing"
+)
+
+func TestToken(t *testing.T) {
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := NewSigner(key)
+
+	newConfig := func(subject string, lifetime int) jwt.Config {
+		return jwt.Config{
+			Claims: jwt.Claims{
+				Issuer:  "financelime.com",
+				Subject: subject,
+			},
+			ParseOptions: jwt.ParseOptions{
+				RequiredClaimIssuer:  true,
+				RequiredClaimSubject: true,
+				RequiredClaimJwtID:   true,
+				RequiredClaimData:    true,
+			},
+			TokenLifetimeSec: lifetime,
+		}
+	}
+
+	accessToken := NewToken(signer, newConfig(jwt.TokenUseAccess, 60))
+
+	value, err := accessToken.Create(jwt.Claims{JwtID: "sessionID", Data: "data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokenHeader header
+	if err = signer.Verify(value, &struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(strings.Split(value, ".")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(headerJSON, &tokenHeader); err != nil || tokenHeader.KeyID != key.ID {
+		t.Errorf("wrong header of the token: %s", headerJSON)
+	}
+
+	parsedToken, parseCodeError, err := accessToken.Parse(value)
+	if err != nil {
+		t.Fatalf("failed to parse the token: %v, %s", err, parseCodeError)
+	}
+	if parsedToken.Claims.JwtID != "sessionID" || parsedToken.Claims.Data != "data" ||
+		parsedToken.Headers.SignatureAlgorithm != AlgorithmES256 {
+		t.Errorf("wrong token: %+v", parsedToken)
+	}
+
+	// The access claims are in the clear, the parse ignores them
+
+	value, err = accessToken.CreateWithAccessClaims(jwt.Claims{JwtID: "sessionID", Data: "data"},
+		AccessClaims{Audience: "reporting-api", Scope: "read:reports", Roles: []string{"admin"},
+			Permissions: []string{"admin", "reports:write"}, Lifetime: 600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims tokenClaims
+	if err = signer.Verify(value, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Audience != "reporting-api" || claims.Scope != "read:reports" || claims.JwtID != "sessionID" ||
+		strings.Join(claims.Roles, " ") != "admin" || strings.Join(claims.Permissions, " ") != "admin reports:write" ||
+		claims.ExpiresAt-claims.IssuedAt != 600 {
+		t.Errorf("wrong claims of the token: %+v", claims)
+	}
+	if _, parseCodeError, err = accessToken.Parse(value); err != nil {
+		t.Errorf("failed to parse the token: %v, %s", err, parseCodeError)
+	}
+
+	tests := []struct {
+		name           string
+		token          *token
+		value          string
+		parseCodeError string
+	}{
+		{"another subject", NewToken(signer, newConfig(jwt.TokenUseRefresh, 60)), value, ParseCodeBadClaims},
+		{"expired", accessToken, func() string {
+			value, err := NewToken(signer, newConfig(jwt.TokenUseAccess, -1)).Create(jwt.Claims{JwtID: "sessionID", Data: "data"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return value
+		}(), ParseCodeExpired},
+		{"no JwtID", accessToken, func() string {
+			value, err := accessToken.Create(jwt.Claims{Data: "data"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return value
+		}(), ParseCodeBadClaims},
+		{"malformed", accessToken, "token", ParseCodeBadToken},
+	}
+
+	for _, test := range tests {
+		_, parseCodeError, err := test.token.Parse(test.value)
+		if err == nil || parseCodeError != test.parseCodeError {
+			t.Errorf("%s: expected the %s error, got %s, %v", test.name, test.parseCodeError, parseCodeError, err)
+		}
+	}
+}
@@ -7,10 +7,12 @@ package main
 import (
 	"context"
 	authorizationApp "github.com/dmalix/financelime-authorization/app"
+	"github.com/dmalix/financelime-authorization/cli"
 	"github.com/dmalix/financelime-authorization/config"
 	"go.uber.org/zap"
 	"log"
 	"math/rand"
+	"os"
 	"time"
 )
 
@@ -57,6 +59,13 @@ func main() {
 
 	logger = logger.Named("main")
 
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		if err = cli.Run(ctx, logger.Named("cli"), os.Stdout, os.Args[1:]); err != nil {
+			logger.Fatal("failed to run the command", zap.Error(err))
+		}
+		return
+	}
+
 	logger.Info("Welcome to the Financelime authorization service", zap.Any("version", version))
 
 	loggerApp := logger.Named("app")
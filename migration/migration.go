@@ -0,0 +1,347 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+type Migrator interface {
+	Up(ctx context.Context, logger *zap.Logger, steps int) error
+	Down(ctx context.Context, logger *zap.Logger, steps int) error
+	Status(ctx context.Context, logger *zap.Logger) ([]Status, error)
+}
+
+type Config struct {
+	// Directory with the numbered migration files
+	Dir string
+	// The key of the PostgreSQL advisory lock. Must be unique for each database.
+	LockID int64
+	// Only log the migrations that would be applied or rolled back
+	DryRun bool
+}
+
+type Migration struct {
+	Version  int64
+	Name     string
+	UpSQL    string
+	DownSQL  string
+	Checksum string
+}
+
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type appliedMigration struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+type migrator struct {
+	config Config
+	db     *sql.DB
+}
+
+func NewMigrator(config Config, db *sql.DB) *migrator {
+	return &migrator{
+		config: config,
+		db:     db,
+	}
+}
+
+// Up applies the pending migrations. If steps is zero or less, all pending migrations will be applied.
+func (m *migrator) Up(ctx context.Context, logger *zap.Logger, steps int) error {
+
+	migrations, err := LoadMigrations(m.config.Dir)
+	if err != nil {
+		return err
+	}
+
+	return m.withLock(ctx, logger, func(conn *sql.Conn) error {
+
+		applied, err := m.verify(ctx, conn, migrations)
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if steps > 0 && count >= steps {
+				break
+			}
+
+			if m.config.DryRun {
+				logger.Info("the migration would be applied (dry run)",
+					zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+				count++
+				continue
+			}
+
+			err = m.apply(ctx, conn, migration.UpSQL, "/* postgreSQL query */\n"+
+				"INSERT\n"+
+				"    INTO\n"+
+				"    schema_migrations (\n"+
+				"        version,\n"+
+				"        name,\n"+
+				"        checksum,\n"+
+				"        applied_at\n"+
+				"    )\n"+
+				"VALUES (\n"+
+				"    $1,\n"+
+				"    $2,\n"+
+				"    $3,\n"+
+				"    NOW( )\n"+
+				")\n",
+				migration.Version, migration.Name, migration.Checksum)
+			if err != nil {
+				return fmt.Errorf("failed to apply the migration %d_%s: %s", migration.Version, migration.Name, err)
+			}
+			logger.Info("the migration applied",
+				zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+			count++
+		}
+
+		if count == 0 {
+			logger.Info("no pending migrations")
+		}
+
+		return nil
+	})
+}
+
+// Down rolls back the last applied migrations. If steps is zero or less, only the last migration will be rolled back.
+func (m *migrator) Down(ctx context.Context, logger *zap.Logger, steps int) error {
+
+	migrations, err := LoadMigrations(m.config.Dir)
+	if err != nil {
+		return err
+	}
+
+	if steps <= 0 {
+		steps = 1
+	}
+
+	return m.withLock(ctx, logger, func(conn *sql.Conn) error {
+
+		applied, err := m.verify(ctx, conn, migrations)
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.DownSQL == "" {
+				return fmt.Errorf("the migration %d_%s has no 'down' file", migration.Version, migration.Name)
+			}
+
+			if m.config.DryRun {
+				logger.Info("the migration would be rolled back (dry run)",
+					zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+				count++
+				continue
+			}
+
+			err = m.apply(ctx, conn, migration.DownSQL, "/* postgreSQL query */\n"+
+				"DELETE\n"+
+				"FROM\n"+
+				"    schema_migrations\n"+
+				"WHERE\n"+
+				"    schema_migrations.version = $1\n",
+				migration.Version)
+			if err != nil {
+				return fmt.Errorf("failed to roll back the migration %d_%s: %s", migration.Version, migration.Name, err)
+			}
+			logger.Info("the migration rolled back",
+				zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+			count++
+		}
+
+		if count == 0 {
+			logger.Info("no applied migrations")
+		}
+
+		return nil
+	})
+}
+
+// Status returns the list of known migrations, both applied and pending.
+func (m *migrator) Status(ctx context.Context, _ *zap.Logger) ([]Status, error) {
+
+	migrations, err := LoadMigrations(m.config.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a DB connection: %s", err)
+	}
+	defer func(conn *sql.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	applied, err := m.verify(ctx, conn, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// withLock holds the advisory lock on a dedicated connection, so that only one replica migrates the database
+func (m *migrator) withLock(ctx context.Context, logger *zap.Logger, run func(conn *sql.Conn) error) error {
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a DB connection: %s", err)
+	}
+	defer func(conn *sql.Conn) {
+		if err := conn.Close(); err != nil {
+			logger.Error("failed to close the DB connection", zap.Error(err))
+		}
+	}(conn)
+
+	_, err = conn.ExecContext(ctx, "/* postgreSQL query */\n"+
+		"SELECT pg_advisory_lock($1)\n", m.config.LockID)
+	if err != nil {
+		return fmt.Errorf("failed to acquire the advisory lock: %s", err)
+	}
+	defer func(conn *sql.Conn) {
+		_, err := conn.ExecContext(context.Background(), "/* postgreSQL query */\n"+
+			"SELECT pg_advisory_unlock($1)\n", m.config.LockID)
+		if err != nil {
+			logger.Error("failed to release the advisory lock", zap.Error(err))
+		}
+	}(conn)
+
+	if !m.config.DryRun {
+		_, err = conn.ExecContext(ctx, "/* postgreSQL query */\n"+
+			"CREATE TABLE IF NOT EXISTS schema_migrations (\n"+
+			"    version int8 NOT NULL,\n"+
+			"    name VARCHAR ( 255 ) NOT NULL,\n"+
+			"    checksum VARCHAR ( 64 ) NOT NULL,\n"+
+			"    applied_at TIMESTAMP ( 6 ) NOT NULL,\n"+
+			"    CONSTRAINT schema_migrations_pkey PRIMARY KEY ( version )\n"+
+			")\n")
+		if err != nil {
+			return fmt.Errorf("failed to create the schema_migrations table: %s", err)
+		}
+	}
+
+	return run(conn)
+}
+
+// verify loads the applied migrations and checks that their files have not been changed or removed
+func (m *migrator) verify(ctx context.Context, conn *sql.Conn, migrations []Migration) (map[int64]appliedMigration, error) {
+
+	var tableName sql.NullString
+
+	applied := make(map[int64]appliedMigration)
+
+	err := conn.QueryRowContext(ctx, "/* postgreSQL query */\n"+
+		"SELECT to_regclass('schema_migrations')::TEXT\n").Scan(&tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the schema_migrations table: %s", err)
+	}
+	if !tableName.Valid {
+		return applied, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, "/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    schema_migrations.version,\n"+
+		"    schema_migrations.name,\n"+
+		"    schema_migrations.checksum,\n"+
+		"    schema_migrations.applied_at\n"+
+		"FROM\n"+
+		"    schema_migrations\n"+
+		"ORDER BY\n"+
+		"    schema_migrations.version\n")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the applied migrations: %s", err)
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		var record appliedMigration
+		err = rows.Scan(&record.version, &record.name, &record.checksum, &record.appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan the applied migration: %s", err)
+		}
+		applied[record.version] = record
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load the applied migrations: %s", err)
+	}
+
+	known := make(map[int64]Migration, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	for version, record := range applied {
+		migration, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("the applied migration %d_%s is missing from %s", version, record.name, m.config.Dir)
+		}
+		if migration.Checksum != record.checksum {
+			return nil, fmt.Errorf("the checksum of the applied migration %d_%s does not match the file", version, record.name)
+		}
+	}
+
+	return applied, nil
+}
+
+// apply executes the migration body and the bookkeeping query in one transaction
+func (m *migrator) apply(ctx context.Context, conn *sql.Conn, body string, query string, args ...interface{}) error {
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if _, err = tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,100 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The file name looks like "000001_create_tables.up.sql"
+var fileNameRegexp = regexp.MustCompile(`^([0-9]+)_([0-9a-z_]+)\.(up|down)\.sql$`)
+
+const (
+	directionUp   = "up"
+	directionDown = "down"
+)
+
+// LoadMigrations reads the migration files from the directory and returns them sorted by version.
+// Every version must have the non-empty "up" file, the "down" file is optional.
+func LoadMigrations(dir string) ([]Migration, error) {
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the migration directory: %s", err)
+	}
+
+	migrationsByVersion := make(map[int64]*Migration)
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		match := fileNameRegexp.FindStringSubmatch(file.Name())
+		if match == nil {
+			return nil, fmt.Errorf("the migration file name is not valid: %s", file.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the migration version: %s", err)
+		}
+		if version == 0 {
+			return nil, fmt.Errorf("the migration version must be greater than zero: %s", file.Name())
+		}
+
+		body, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the migration file: %s", err)
+		}
+
+		migration, ok := migrationsByVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			migrationsByVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("the migration %d has different names: %s and %s", version, migration.Name, match[2])
+		}
+
+		switch match[3] {
+		case directionUp:
+			if len(strings.TrimSpace(string(body))) == 0 {
+				return nil, fmt.Errorf("the 'up' file of the migration %d is empty: %s", version, file.Name())
+			}
+			migration.UpSQL = string(body)
+			migration.Checksum = checksum(body)
+		case directionDown:
+			migration.DownSQL = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(migrationsByVersion))
+	for _, migration := range migrationsByVersion {
+		if migration.UpSQL == "" {
+			return nil, fmt.Errorf("the migration %d has no 'up' file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func checksum(body []byte) string {
+	hs := sha256.Sum256(body)
+	return hex.EncodeToString(hs[:])
+}
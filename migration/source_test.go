@@ -0,0 +1,78 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package migration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeMigrationFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "migration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadMigrations_Success(t *testing.T) {
+
+	dir := writeMigrationFiles(t, map[string]string{
+		"000002_add_column.up.sql":      "ALTER TABLE a ADD COLUMN b int4;",
+		"000001_create_tables.up.sql":   "CREATE TABLE a ( id int4 );",
+		"000001_create_tables.down.sql": "DROP TABLE a;",
+	})
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		t.Fatalf("LoadMigrations returned wrong the err value: got %v want %v", err, nil)
+	}
+
+	if len(migrations) != 2 {
+		t.Fatalf("LoadMigrations returned wrong number of migrations: got %v want %v", len(migrations), 2)
+	}
+
+	if migrations[0].Version != 1 || migrations[0].Name != "create_tables" || migrations[0].DownSQL != "DROP TABLE a;" {
+		t.Errorf("LoadMigrations returned wrong the first migration: got %+v", migrations[0])
+	}
+
+	if migrations[1].Version != 2 || migrations[1].DownSQL != "" {
+		t.Errorf("LoadMigrations returned wrong the second migration: got %+v", migrations[1])
+	}
+
+	if migrations[0].Checksum != checksum([]byte("CREATE TABLE a ( id int4 );")) {
+		t.Errorf("LoadMigrations returned wrong the checksum value: got %v", migrations[0].Checksum)
+	}
+}
+
+func TestLoadMigrations_Error(t *testing.T) {
+
+	cases := map[string]map[string]string{
+		"bad name":      {"create_tables.up.sql": ""},
+		"no up file":    {"000001_create_tables.down.sql": ""},
+		"empty up file": {"000001_create_tables.up.sql": " \n"},
+		"zero version":  {"000000_create_tables.up.sql": ""},
+		"name mismatch": {
+			"000001_create_tables.up.sql": "CREATE TABLE a ( id int4 );",
+			"000001_drop_tables.down.sql": "DROP TABLE a;",
+		},
+	}
+
+	for name, files := range cases {
+		dir := writeMigrationFiles(t, files)
+		if _, err := LoadMigrations(dir); err == nil {
+			t.Errorf("%s: LoadMigrations returned wrong the err value: got %v want an error", name, err)
+		}
+		_ = os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,83 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+// Package rbac checks the permissions of the access token on the routes of the services.
+// The authorization middleware verifies the token and puts its decrypted data into the context,
+// the data has the permissions of the roles the user had when the token was issued.
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+var ErrorInsufficientPermission = errors.New("INSUFFICIENT_PERMISSION")
+
+// ContextGetter reads the context the authorization middleware has filled, middleware.ContextGetter implements it
+type ContextGetter interface {
+	GetRequestID(ctx context.Context) (string, string, error)
+	GetJwtData(ctx context.Context) ([]byte, error)
+}
+
+// tokenData is the part of the access token data the permissions are checked by
+type tokenData struct {
+	Permissions []string
+}
+
+// RequirePermission rejects the access token that has not been granted all the permissions of the route,
+// it must follow the authorization middleware
+func RequirePermission(logger *zap.Logger, contextGetter ContextGetter,
+	permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			var data tokenData
+
+			requestID, requestIDKey, err := contextGetter.GetRequestID(r.Context())
+			if err != nil {
+				logger.DPanic("failed to get requestID", zap.Error(err))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			accessTokenData, err := contextGetter.GetJwtData(r.Context())
+			if err != nil {
+				logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			err = json.Unmarshal(accessTokenData, &data)
+			if err != nil {
+				logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+					zap.String(requestIDKey, requestID))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			for _, permission := range permissions {
+				if !HasPermission(data.Permissions, permission) {
+					logger.Error("the access token has not been granted the permission",
+						zap.String("permission", permission), zap.String(requestIDKey, requestID))
+					http.Error(w, ErrorInsufficientPermission.Error(), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasPermission reports whether the permission is among the granted ones
+func HasPermission(granted []string, permission string) bool {
+	for _, value := range granted {
+		if value == permission {
+			return true
+		}
+	}
+	return false
+}
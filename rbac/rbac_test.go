@@ -0,0 +1,74 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package rbac
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type contextGetter struct {
+	jwtData []byte
+}
+
+func (g contextGetter) GetRequestID(_ context.Context) (string, string, error) {
+	return "requestID", "request-id", nil
+}
+
+func (g contextGetter) GetJwtData(_ context.Context) ([]byte, error) {
+	return g.jwtData, nil
+}
+
+func TestRequirePermission(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		jwtData     string
+		permissions []string
+		statusCode  int
+		body        string
+	}{
+		{"granted", `{"ID":2,"Permissions":["admin","reports:write"]}`, []string{"admin"}, http.StatusOK, ""},
+		{"all granted", `{"ID":2,"Permissions":["admin","reports:write"]}`, []string{"reports:write", "admin"},
+			http.StatusOK, ""},
+		{"one is missing", `{"ID":2,"Permissions":["reports:write"]}`, []string{"reports:write", "admin"},
+			http.StatusForbidden, ErrorInsufficientPermission.Error()},
+		{"no permissions", `{"ID":2}`, []string{"admin"}, http.StatusForbidden, ErrorInsufficientPermission.Error()},
+		{"bad data", `ID`, []string{"admin"}, http.StatusInternalServerError, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			handler := RequirePermission(zap.NewNop(), contextGetter{jwtData: []byte(test.jwtData)},
+				test.permissions...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/reports", nil))
+
+			if recorder.Code != test.statusCode {
+				t.Errorf("expected the status code %d, got %d", test.statusCode, recorder.Code)
+			}
+			if test.body != "" && strings.TrimSpace(recorder.Body.String()) != test.body {
+				t.Errorf("expected the body %s, got %s", test.body, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	if !HasPermission([]string{"admin", "reports:write"}, "reports:write") {
+		t.Error("expected the permission is granted")
+	}
+	if HasPermission([]string{"reports:read"}, "reports:write") || HasPermission(nil, "admin") {
+		t.Error("expected the permission is not granted")
+	}
+}
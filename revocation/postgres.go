@@ -0,0 +1,69 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package revocation
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type postgresBackend struct {
+	db *sql.DB
+}
+
+// NewPostgresBackend returns the backend shared by all the instances of the service and the CLI,
+// the revoked IDs are kept in the revoked_token table of the Blade DB
+func NewPostgresBackend(db *sql.DB) *postgresBackend {
+	return &postgresBackend{db: db}
+}
+
+// Set keeps the later expiry of the key, a revocation is never shortened
+func (p *postgresBackend) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+
+	// The expired keys are deleted by the next revocation
+
+	_, err := p.db.ExecContext(ctx, "/* postgreSQL query */\n"+
+		"DELETE FROM\n"+
+		"    revoked_token\n"+
+		"WHERE\n"+
+		"    revoked_token.expires_at <= NOW( )\n")
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx, "/* postgreSQL query */\n"+
+		"INSERT INTO revoked_token\n"+
+		"    ( created_at, \"key\", \"value\", expires_at )\n"+
+		"VALUES\n"+
+		"    ( NOW( ), $1, $2, NOW( ) + $3 * INTERVAL '1 millisecond' )\n"+
+		"ON CONFLICT ( \"key\" ) DO UPDATE\n"+
+		"SET\n"+
+		"    \"value\" = EXCLUDED.\"value\",\n"+
+		"    expires_at = GREATEST( revoked_token.expires_at, EXCLUDED.expires_at )\n",
+		key, value, ttl.Milliseconds())
+
+	return err
+}
+
+func (p *postgresBackend) Exists(ctx context.Context, key string) (bool, error) {
+
+	var exists bool
+
+	err := p.db.QueryRowContext(ctx, "/* postgreSQL query */\n"+
+		"SELECT\n"+
+		"    EXISTS (\n"+
+		"        SELECT\n"+
+		"            1\n"+
+		"        FROM\n"+
+		"            revoked_token\n"+
+		"        WHERE\n"+
+		"            revoked_token.\"key\" = $1\n"+
+		"            AND revoked_token.expires_at > NOW( )\n"+
+		"    )\n",
+		key).Scan(&exists)
+
+	return exists, err
+}
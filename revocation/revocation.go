@@ -0,0 +1,144 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+// Package revocation keeps the IDs of the revoked access tokens until the tokens expire.
+// An access token (JWT) is verified without the database, so deleting the session does not stop it,
+// the authorization middleware has to ask the store.
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	keyPrefix = "revoked:"
+	// cacheLifetime limits how long an ID revoked by another instance is kept in the cache
+	cacheLifetime = time.Minute
+)
+
+// Backend is the shared storage of the revoked IDs. It follows the Redis commands
+// SET key value EX ttl and EXISTS key, so a Redis client can be plugged in
+type Backend interface {
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+type Store interface {
+	// Revoke marks the JwtID (the public session ID) as revoked for the ttl, it should not be shorter than the token lifetime
+	Revoke(ctx context.Context, jwtID string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, jwtID string) (bool, error)
+}
+
+type store struct {
+	backend Backend
+	mutex   sync.RWMutex
+	// The in-process cache of the revoked IDs: jwtID -> expiry. A revocation is never cancelled,
+	// so a cached ID can be trusted until it expires, and only the unknown IDs go to the backend
+	cache map[string]time.Time
+}
+
+func NewStore(backend Backend) *store {
+	return &store{
+		backend: backend,
+		cache:   make(map[string]time.Time),
+	}
+}
+
+func (s *store) Revoke(ctx context.Context, jwtID string, ttl time.Duration) error {
+
+	if err := s.backend.Set(ctx, keyPrefix+jwtID, "1", ttl); err != nil {
+		return err
+	}
+
+	s.remember(jwtID, ttl)
+
+	return nil
+}
+
+func (s *store) IsRevoked(ctx context.Context, jwtID string) (bool, error) {
+
+	s.mutex.RLock()
+	expiry, ok := s.cache[jwtID]
+	s.mutex.RUnlock()
+	if ok && time.Now().Before(expiry) {
+		return true, nil
+	}
+
+	revoked, err := s.backend.Exists(ctx, keyPrefix+jwtID)
+	if err != nil {
+		return false, err
+	}
+	if revoked {
+		// The backend does not tell the remaining ttl, the ID is cached for a short time only
+		s.remember(jwtID, cacheLifetime)
+	}
+
+	return revoked, nil
+}
+
+func (s *store) remember(jwtID string, ttl time.Duration) {
+
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, expiry := range s.cache {
+		if now.After(expiry) {
+			delete(s.cache, id)
+		}
+	}
+	s.cache[jwtID] = now.Add(ttl)
+}
+
+type memoryBackend struct {
+	mutex sync.Mutex
+	items map[string]memoryItem
+}
+
+type memoryItem struct {
+	value  string
+	expiry time.Time
+}
+
+// NewMemoryBackend returns the backend for a single instance of the service, the revoked IDs are lost on restart
+func NewMemoryBackend() *memoryBackend {
+	return &memoryBackend{items: make(map[string]memoryItem)}
+}
+
+func (m *memoryBackend) Set(_ context.Context, key string, value string, ttl time.Duration) error {
+
+	now := time.Now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for k, item := range m.items {
+		if now.After(item.expiry) {
+			delete(m.items, k)
+		}
+	}
+	m.items[key] = memoryItem{value: value, expiry: now.Add(ttl)}
+
+	return nil
+}
+
+func (m *memoryBackend) Exists(_ context.Context, key string) (bool, error) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	item, ok := m.items[key]
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(item.expiry) {
+		delete(m.items, key)
+		return false, nil
+	}
+
+	return true, nil
+}
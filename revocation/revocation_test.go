@@ -0,0 +1,47 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	store := NewStore(backend)
+
+	revoked, err := store.IsRevoked(ctx, "session")
+	if err != nil || revoked {
+		t.Errorf("expected the unknown ID is not revoked, got %v (%v)", revoked, err)
+	}
+
+	if err = store.Revoke(ctx, "session", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	revoked, err = store.IsRevoked(ctx, "session")
+	if err != nil || !revoked {
+		t.Errorf("expected the ID is revoked, got %v (%v)", revoked, err)
+	}
+
+	// Another instance of the service shares the backend
+	other := NewStore(backend)
+	revoked, err = other.IsRevoked(ctx, "session")
+	if err != nil || !revoked {
+		t.Errorf("expected the ID is revoked for another instance, got %v (%v)", revoked, err)
+	}
+
+	if err = store.Revoke(ctx, "expired", time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	revoked, err = other.IsRevoked(ctx, "expired")
+	if err != nil || revoked {
+		t.Errorf("expected the expired ID is not revoked, got %v (%v)", revoked, err)
+	}
+}
@@ -0,0 +1,94 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+// Package scope checks the scopes of the access token on the routes of the services (RFC 6750, section 3.1).
+// The authorization middleware verifies the token and puts its decrypted data into the context,
+// the data has the scopes granted to the client the token was issued to.
+package scope
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+var ErrorInsufficientScope = errors.New("INSUFFICIENT_SCOPE")
+
+// ContextGetter reads the context the authorization middleware has filled, middleware.ContextGetter implements it
+type ContextGetter interface {
+	GetRequestID(ctx context.Context) (string, string, error)
+	GetJwtData(ctx context.Context) ([]byte, error)
+}
+
+// tokenData is the part of the access token data the scopes are checked by
+type tokenData struct {
+	Scope          string
+	ServiceAccount string
+	Act            json.RawMessage
+}
+
+// RequireScope rejects the access token that has not been granted all the scopes of the route,
+// it must follow the authorization middleware. The token of the first-party session without a scope has
+// the full access, the tokens of the service accounts and the exchanged tokens always have the scope.
+func RequireScope(logger *zap.Logger, contextGetter ContextGetter, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			var data tokenData
+
+			requestID, requestIDKey, err := contextGetter.GetRequestID(r.Context())
+			if err != nil {
+				logger.DPanic("failed to get requestID", zap.Error(err))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			accessTokenData, err := contextGetter.GetJwtData(r.Context())
+			if err != nil {
+				logger.DPanic("failed to get accessTokenData", zap.Error(err), zap.String(requestIDKey, requestID))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			err = json.Unmarshal(accessTokenData, &data)
+			if err != nil {
+				logger.DPanic("failed to unmarshal the accessTokenData value to struct", zap.Error(err),
+					zap.String(requestIDKey, requestID))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			if data.Scope == "" && data.ServiceAccount == "" && (len(data.Act) == 0 || string(data.Act) == "null") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, value := range scopes {
+				if !HasScope(data.Scope, value) {
+					logger.Error("the access token has not been granted the scope", zap.String("scope", value),
+						zap.String(requestIDKey, requestID))
+					w.Header().Set("WWW-Authenticate",
+						fmt.Sprintf("Bearer error=\"insufficient_scope\", scope=\"%s\"", strings.Join(scopes, " ")))
+					http.Error(w, ErrorInsufficientScope.Error(), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasScope reports whether the scope is in the space-separated list of the granted scopes
+func HasScope(granted string, scope string) bool {
+	for _, value := range strings.Fields(granted) {
+		if value == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package scope
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type contextGetter struct {
+	jwtData []byte
+}
+
+func (g contextGetter) GetRequestID(_ context.Context) (string, string, error) {
+	return "requestID", "request-id", nil
+}
+
+func (g contextGetter) GetJwtData(_ context.Context) ([]byte, error) {
+	return g.jwtData, nil
+}
+
+func TestRequireScope(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		jwtData    string
+		scopes     []string
+		statusCode int
+		body       string
+	}{
+		{"granted", `{"ID":2,"Scope":"read:reports write:reports"}`, []string{"read:reports"}, http.StatusOK, ""},
+		{"one is missing", `{"ID":2,"Scope":"read:reports"}`, []string{"read:reports", "write:reports"},
+			http.StatusForbidden, ErrorInsufficientScope.Error()},
+		{"the first-party session", `{"ID":2}`, []string{"admin"}, http.StatusOK, ""},
+		{"the delegated token without the scope", `{"ID":2,"Act":{"sub":"reporting-api"}}`, []string{"admin"},
+			http.StatusForbidden, ErrorInsufficientScope.Error()},
+		{"the service account without the scope", `{"ServiceAccount":"billing-job"}`, []string{"admin"},
+			http.StatusForbidden, ErrorInsufficientScope.Error()},
+		{"bad data", `ID`, []string{"admin"}, http.StatusInternalServerError, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			handler := RequireScope(zap.NewNop(), contextGetter{jwtData: []byte(test.jwtData)},
+				test.scopes...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/reports", nil))
+
+			if recorder.Code != test.statusCode {
+				t.Errorf("expected the status code %d, got %d", test.statusCode, recorder.Code)
+			}
+			if test.body != "" && strings.TrimSpace(recorder.Body.String()) != test.body {
+				t.Errorf("expected the body %s, got %s", test.body, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+
+	if !HasScope("openid read:reports", "read:reports") {
+		t.Error("expected the scope to be granted")
+	}
+	if HasScope("openid read:reports", "read") {
+		t.Error("expected the part of the scope not to be granted")
+	}
+}
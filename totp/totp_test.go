@@ -0,0 +1,105 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// The ASCII string "12345678901234567890" of the RFC 6238 test vectors
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateCode(t *testing.T) {
+
+	// RFC 6238, Appendix B, the SHA1 codes truncated to 6 digits
+	tests := []struct {
+		unixTime int64
+		code     string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		code, err := GenerateCode(rfcSecret, time.Unix(test.unixTime, 0))
+		if err != nil {
+			t.Fatalf("unixTime %d: %v", test.unixTime, err)
+		}
+		if code != test.code {
+			t.Errorf("unixTime %d: expected %s, got %s", test.unixTime, test.code, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	moment := time.Unix(1234567890, 0)
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		codeTime time.Time
+		valid    bool
+	}{
+		{"current period", moment, true},
+		{"previous period", moment.Add(-Period), true},
+		{"next period", moment.Add(Period), true},
+		{"expired period", moment.Add(-2 * Period), false},
+		{"future period", moment.Add(2 * Period), false},
+	}
+
+	for _, test := range tests {
+		code, err := GenerateCode(secret, test.codeTime)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		step, valid, err := Validate(secret, code, moment)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if valid != test.valid {
+			t.Errorf("%s: expected valid %t, got %t", test.name, test.valid, valid)
+		}
+		if valid && step != Step(test.codeTime) {
+			t.Errorf("%s: expected step %d, got %d", test.name, Step(test.codeTime), step)
+		}
+	}
+
+	if _, valid, _ := Validate(secret, "12345", moment); valid {
+		t.Error("a code of the wrong length must not be valid")
+	}
+
+	if _, _, err := Validate("not base32!", "123456", moment); err != ErrorBadSecret {
+		t.Errorf("expected %v, got %v", ErrorBadSecret, err)
+	}
+}
+
+func TestURI(t *testing.T) {
+
+	uri, err := url.Parse(URI("financelime.com", "test.user@financelime.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" {
+		t.Errorf("unexpected URI: %s", uri)
+	}
+	if uri.Path != "/financelime.com:test.user@financelime.com" {
+		t.Errorf("unexpected label: %s", uri.Path)
+	}
+	if uri.Query().Get("secret") != rfcSecret || uri.Query().Get("issuer") != "financelime.com" {
+		t.Errorf("unexpected query: %s", uri.RawQuery)
+	}
+}
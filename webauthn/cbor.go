@@ -0,0 +1,157 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// The subset of CBOR (RFC 8949) that authenticators use for the attestation objects and the COSE keys:
+// definite lengths only, integers are decoded as int64, maps as map[interface{}]interface{}.
+
+const cborMaxDepth = 16
+
+var errorBadCbor = errors.New("bad CBOR")
+
+// cborDecode decodes the first item of the data and returns it with the number of bytes it occupies
+func cborDecode(data []byte) (interface{}, int, error) {
+	decoder := cborDecoder{data: data}
+	item, err := decoder.decode(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return item, decoder.offset, nil
+}
+
+type cborDecoder struct {
+	data   []byte
+	offset int
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+
+	if depth > cborMaxDepth {
+		return nil, errorBadCbor
+	}
+
+	if d.offset >= len(d.data) {
+		return nil, errorBadCbor
+	}
+	initial := d.data[d.offset]
+	d.offset++
+	major, info := initial>>5, initial&0x1f
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		default:
+			return nil, errorBadCbor
+		}
+	}
+
+	argument, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if argument > math.MaxInt64 {
+			return nil, errorBadCbor
+		}
+		return int64(argument), nil
+	case 1:
+		if argument > math.MaxInt64 {
+			return nil, errorBadCbor
+		}
+		return -1 - int64(argument), nil
+	case 2, 3:
+		if argument > uint64(len(d.data)-d.offset) {
+			return nil, errorBadCbor
+		}
+		value := d.data[d.offset : d.offset+int(argument)]
+		d.offset += int(argument)
+		if major == 3 {
+			return string(value), nil
+		}
+		return append([]byte(nil), value...), nil
+	case 4:
+		if argument > uint64(len(d.data)-d.offset) {
+			return nil, errorBadCbor
+		}
+		array := make([]interface{}, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+		return array, nil
+	case 5:
+		if argument > uint64(len(d.data)-d.offset) {
+			return nil, errorBadCbor
+		}
+		object := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, errorBadCbor
+			}
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			object[key] = value
+		}
+		return object, nil
+	case 6:
+		// The tags carry no meaning for the WebAuthn structures, so the tagged item is returned as is
+		return d.decode(depth + 1)
+	}
+
+	return nil, errorBadCbor
+}
+
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		// The indefinite lengths are not used by authenticators
+		return 0, errorBadCbor
+	}
+
+	if len(d.data)-d.offset < size {
+		return 0, errorBadCbor
+	}
+	buffer := make([]byte, 8)
+	copy(buffer[8-size:], d.data[d.offset:d.offset+size])
+	d.offset += size
+
+	return binary.BigEndian.Uint64(buffer), nil
+}
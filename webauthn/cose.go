@@ -0,0 +1,117 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+)
+
+// COSE_Key parameters, RFC 8152
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+
+	coseCurve = -1
+	coseX     = -2
+	coseY     = -3
+	coseN     = -1
+	coseE     = -2
+
+	rsaMinBits = 2048
+)
+
+func parsePublicKey(coseKey []byte) (crypto.PublicKey, error) {
+
+	item, _, err := cborDecode(coseKey)
+	if err != nil {
+		return nil, ErrorBadPublicKey
+	}
+	key, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrorBadPublicKey
+	}
+
+	keyType, _ := key[int64(coseKeyType)].(int64)
+	algorithm, _ := key[int64(coseAlgorithm)].(int64)
+
+	switch {
+	case keyType == coseKeyTypeEC2 && algorithm == AlgorithmES256:
+		curve, _ := key[int64(coseCurve)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		y, _ := key[int64(coseY)].([]byte)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrorBadPublicKey
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, ErrorBadPublicKey
+		}
+		return publicKey, nil
+
+	case keyType == coseKeyTypeOKP && algorithm == AlgorithmEdDSA:
+		curve, _ := key[int64(coseCurve)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrorBadPublicKey
+		}
+		return ed25519.PublicKey(x), nil
+
+	case keyType == coseKeyTypeRSA && algorithm == AlgorithmRS256:
+		n, _ := key[int64(coseN)].([]byte)
+		e, _ := key[int64(coseE)].([]byte)
+		if len(n)*8 < rsaMinBits || len(e) == 0 || len(e) > 4 {
+			return nil, ErrorBadPublicKey
+		}
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+		if exponent < 3 || exponent%2 == 0 {
+			return nil, ErrorBadPublicKey
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+	}
+
+	return nil, ErrorBadPublicKey
+}
+
+func verifySignature(coseKey []byte, data []byte, signature []byte) error {
+
+	publicKey, err := parsePublicKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	switch publicKey := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(publicKey, digest[:], signature) {
+			return ErrorBadSignature
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(publicKey, data, signature) {
+			return ErrorBadSignature
+		}
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrorBadSignature
+		}
+	default:
+		return ErrorBadPublicKey
+	}
+
+	return nil
+}
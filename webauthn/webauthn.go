@@ -0,0 +1,403 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+// Package webauthn implements the relying party side of the WebAuthn Level 2 registration and
+// assertion ceremonies for the passkeys. The attestation statements are not verified (the "none"
+// conveyance), the credential public keys may be ES256, EdDSA (Ed25519) or RS256.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	AlgorithmES256 = -7
+	AlgorithmEdDSA = -8
+	AlgorithmRS256 = -257
+
+	// Timeout is the time given to the user to complete a ceremony
+	Timeout = 5 * time.Minute
+
+	challengeLength = 32
+	credentialType  = "public-key"
+
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+)
+
+var (
+	ErrorBadEncoding          = errors.New("bad base64url encoding")
+	ErrorBadClientData        = errors.New("bad client data")
+	ErrorBadChallenge         = errors.New("the challenge does not match")
+	ErrorBadOrigin            = errors.New("the origin does not match")
+	ErrorBadAuthenticatorData = errors.New("bad authenticator data")
+	ErrorBadRelyingParty      = errors.New("the relying party ID hash does not match")
+	ErrorUserNotVerified      = errors.New("the user is not present or not verified")
+	ErrorBadCredentialID      = errors.New("the credential ID does not match")
+	ErrorBadPublicKey         = errors.New("bad or unsupported credential public key")
+	ErrorBadSignature         = errors.New("bad signature")
+	ErrorBadSignCount         = errors.New("the signature counter did not increase, the authenticator may be cloned")
+)
+
+// Config describes the relying party
+type Config struct {
+	RPID   string
+	RPName string
+	Origin string
+}
+
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type User struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are the JSON form of PublicKeyCredentialCreationOptions,
+// the binary values are base64url encoded
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   User                   `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the JSON form of PublicKeyCredentialRequestOptions,
+// the binary values are base64url encoded
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationCredential is the JSON form of the PublicKeyCredential returned by navigator.credentials.create()
+type RegistrationCredential struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionCredential is the JSON form of the PublicKeyCredential returned by navigator.credentials.get()
+type AssertionCredential struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential is what the relying party stores for a registered authenticator
+type Credential struct {
+	// ID is base64url encoded without padding
+	ID string
+	// PublicKey is the COSE_Key of the credential
+	PublicKey []byte
+	SignCount uint32
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// NewChallenge returns a new random challenge encoded in base64url
+func NewChallenge() (string, error) {
+	challenge := make([]byte, challengeLength)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+	return Encode(challenge), nil
+}
+
+// Encode encodes the binary value in base64url without padding, as WebAuthn clients do
+func Encode(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+// Decode decodes the base64url value with or without padding
+func Decode(value string) ([]byte, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, ErrorBadEncoding
+	}
+	return decoded, nil
+}
+
+// Challenge returns the challenge the client has signed, so the caller can find the ceremony it belongs to
+func Challenge(clientDataJSON string) (string, error) {
+	data, err := decodeClientData(clientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return data.Challenge, nil
+}
+
+// CreationOptions returns the options of the registration ceremony. The already registered
+// credentials are excluded, so the user does not register the same authenticator twice.
+func (c Config) CreationOptions(challenge string, user User, excludeCredentialIDs []string) CreationOptions {
+	excludeCredentials := make([]CredentialDescriptor, 0, len(excludeCredentialIDs))
+	for _, credentialID := range excludeCredentialIDs {
+		excludeCredentials = append(excludeCredentials, CredentialDescriptor{Type: credentialType, ID: credentialID})
+	}
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        RelyingParty{ID: c.RPID, Name: c.RPName},
+		User:      user,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: credentialType, Algorithm: AlgorithmES256},
+			{Type: credentialType, Algorithm: AlgorithmEdDSA},
+			{Type: credentialType, Algorithm: AlgorithmRS256},
+		},
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: excludeCredentials,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options of the assertion ceremony. The allowed credentials are
+// not listed, the authenticator offers the user the passkeys it keeps for the relying party.
+func (c Config) RequestOptions(challenge string) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             c.RPID,
+		Timeout:          Timeout.Milliseconds(),
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "required",
+	}
+}
+
+// VerifyRegistration verifies the response of the registration ceremony and returns the new credential
+func (c Config) VerifyRegistration(challenge string, credential RegistrationCredential) (Credential, error) {
+
+	if err := c.verifyClientData(credential.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return Credential{}, err
+	}
+
+	attestationObject, err := Decode(credential.Response.AttestationObject)
+	if err != nil {
+		return Credential{}, err
+	}
+	item, _, err := cborDecode(attestationObject)
+	if err != nil {
+		return Credential{}, err
+	}
+	object, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return Credential{}, ErrorBadAuthenticatorData
+	}
+	rawAuthData, ok := object["authData"].([]byte)
+	if !ok {
+		return Credential{}, ErrorBadAuthenticatorData
+	}
+
+	authData, err := c.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if authData.credentialID == nil {
+		return Credential{}, ErrorBadAuthenticatorData
+	}
+
+	credentialID, err := Decode(credential.ID)
+	if err != nil {
+		return Credential{}, err
+	}
+	if !bytes.Equal(credentialID, authData.credentialID) {
+		return Credential{}, ErrorBadCredentialID
+	}
+
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:        Encode(authData.credentialID),
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion verifies the response of the assertion ceremony against the stored credential
+// and returns the new value of the signature counter
+func (c Config) VerifyAssertion(challenge string, stored Credential, credential AssertionCredential) (uint32, error) {
+
+	credentialID, err := Decode(credential.ID)
+	if err != nil {
+		return 0, err
+	}
+	if Encode(credentialID) != stored.ID {
+		return 0, ErrorBadCredentialID
+	}
+
+	if err := c.verifyClientData(credential.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	rawAuthData, err := Decode(credential.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	authData, err := c.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+
+	rawClientData, err := Decode(credential.Response.ClientDataJSON)
+	if err != nil {
+		return 0, err
+	}
+	signature, err := Decode(credential.Response.Signature)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(rawClientData)
+	if err := verifySignature(stored.PublicKey, append(rawAuthData, clientDataHash[:]...), signature); err != nil {
+		return 0, err
+	}
+
+	// Authenticators that do not implement the counter always return zero
+	if (authData.signCount != 0 || stored.SignCount != 0) && authData.signCount <= stored.SignCount {
+		return 0, ErrorBadSignCount
+	}
+
+	return authData.signCount, nil
+}
+
+func decodeClientData(clientDataJSON string) (clientData, error) {
+	var data clientData
+	raw, err := Decode(clientDataJSON)
+	if err != nil {
+		return data, err
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return data, ErrorBadClientData
+	}
+	return data, nil
+}
+
+func (c Config) verifyClientData(clientDataJSON string, ceremonyType string, challenge string) error {
+	data, err := decodeClientData(clientDataJSON)
+	if err != nil {
+		return err
+	}
+	if data.Type != ceremonyType {
+		return ErrorBadClientData
+	}
+	if subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return ErrorBadChallenge
+	}
+	if data.Origin != c.Origin {
+		return ErrorBadOrigin
+	}
+	return nil
+}
+
+func (c Config) verifyAuthenticatorData(raw []byte) (authenticatorData, error) {
+
+	authData, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return authData, err
+	}
+
+	rpIDHash := sha256.Sum256([]byte(c.RPID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return authData, ErrorBadRelyingParty
+	}
+	if authData.flags&flagUserPresent == 0 || authData.flags&flagUserVerified == 0 {
+		return authData, ErrorUserNotVerified
+	}
+
+	return authData, nil
+}
+
+func parseAuthenticatorData(raw []byte) (authenticatorData, error) {
+
+	var authData authenticatorData
+
+	// rpIdHash (32) | flags (1) | signCount (4) | [aaguid (16) | credentialIdLength (2) | credentialId | publicKey]
+	if len(raw) < 37 {
+		return authData, ErrorBadAuthenticatorData
+	}
+	authData.rpIDHash = raw[:32]
+	authData.flags = raw[32]
+	authData.signCount = binary.BigEndian.Uint32(raw[33:37])
+
+	if authData.flags&flagAttestedCredential == 0 {
+		return authData, nil
+	}
+
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return authData, ErrorBadAuthenticatorData
+	}
+	length := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if length == 0 || len(rest) < length {
+		return authData, ErrorBadAuthenticatorData
+	}
+	authData.credentialID = rest[:length]
+	rest = rest[length:]
+
+	_, size, err := cborDecode(rest)
+	if err != nil {
+		return authData, ErrorBadPublicKey
+	}
+	authData.publicKey = rest[:size]
+
+	return authData, nil
+}
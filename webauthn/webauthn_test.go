@@ -0,0 +1,131 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+package webauthn_test
+
+import (
+	"testing"
+
+	"github.com/dmalix/financelime-authorization/webauthn"
+	"github.com/dmalix/financelime-authorization/webauthn/webauthntest"
+)
+
+var config = webauthn.Config{
+	RPID:   "financelime.com",
+	RPName: "Financelime",
+	Origin: "https://financelime.com",
+}
+
+func register(t *testing.T, authenticator *webauthntest.Authenticator) webauthn.Credential {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := config.CreationOptions(challenge, webauthn.User{ID: "AAAAAAAAAAE", Name: "test.user@financelime.com"}, nil)
+	response, err := authenticator.Register(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := config.VerifyRegistration(challenge, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return credential
+}
+
+func TestRegistration(t *testing.T) {
+
+	authenticator, err := webauthntest.NewAuthenticator(config.Origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential := register(t, authenticator)
+	if credential.ID != webauthn.Encode(authenticator.CredentialID) {
+		t.Errorf("expected credential ID %s, got %s", webauthn.Encode(authenticator.CredentialID), credential.ID)
+	}
+	if string(credential.PublicKey) != string(authenticator.PublicKey()) {
+		t.Error("the public key does not match")
+	}
+
+	challenge, _ := webauthn.NewChallenge()
+	options := config.CreationOptions(challenge, webauthn.User{ID: "AAAAAAAAAAE"}, nil)
+
+	tests := []struct {
+		name     string
+		origin   string
+		rpID     string
+		expected error
+	}{
+		{"wrong origin", "https://evil.com", config.RPID, webauthn.ErrorBadOrigin},
+		{"wrong relying party", config.Origin, "evil.com", webauthn.ErrorBadRelyingParty},
+	}
+
+	for _, test := range tests {
+		authenticator.Origin = test.origin
+		options.RP.ID = test.rpID
+		response, err := authenticator.Register(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := config.VerifyRegistration(challenge, response); err != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+
+	authenticator.Origin = config.Origin
+	options.RP.ID = config.RPID
+	response, _ := authenticator.Register(options)
+	otherChallenge, _ := webauthn.NewChallenge()
+	if _, err := config.VerifyRegistration(otherChallenge, response); err != webauthn.ErrorBadChallenge {
+		t.Errorf("expected %v, got %v", webauthn.ErrorBadChallenge, err)
+	}
+}
+
+func TestAssertion(t *testing.T) {
+
+	authenticator, err := webauthntest.NewAuthenticator(config.Origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential := register(t, authenticator)
+
+	challenge, _ := webauthn.NewChallenge()
+	options := config.RequestOptions(challenge)
+
+	response, err := authenticator.Assert(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signCount, err := config.VerifyAssertion(challenge, credential, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signCount != authenticator.SignCount {
+		t.Errorf("expected sign count %d, got %d", authenticator.SignCount, signCount)
+	}
+
+	// A replayed assertion does not increase the counter
+	credential.SignCount = signCount
+	if _, err := config.VerifyAssertion(challenge, credential, response); err != webauthn.ErrorBadSignCount {
+		t.Errorf("expected %v, got %v", webauthn.ErrorBadSignCount, err)
+	}
+
+	response, _ = authenticator.Assert(options)
+	response.Response.Signature = webauthn.Encode([]byte("not a signature"))
+	if _, err := config.VerifyAssertion(challenge, credential, response); err != webauthn.ErrorBadSignature {
+		t.Errorf("expected %v, got %v", webauthn.ErrorBadSignature, err)
+	}
+
+	other, _ := webauthntest.NewAuthenticator(config.Origin)
+	response, _ = other.Assert(options)
+	if _, err := config.VerifyAssertion(challenge, credential, response); err != webauthn.ErrorBadCredentialID {
+		t.Errorf("expected %v, got %v", webauthn.ErrorBadCredentialID, err)
+	}
+
+	gotChallenge, err := webauthn.Challenge(response.Response.ClientDataJSON)
+	if err != nil || gotChallenge != challenge {
+		t.Errorf("expected challenge %s, got %s (%v)", challenge, gotChallenge, err)
+	}
+}
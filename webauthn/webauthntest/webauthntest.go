@@ -0,0 +1,188 @@
+/* Copyright © 2021. Financelime, https://financelime.com. All rights reserved.
+   Author: DmAlix. Contacts: <dmalix@financelime.com>, <dmalix@yahoo.com>
+   License: GNU General Public License v3.0, https://www.gnu.org/licenses/gpl-3.0.html */
+
+// Package webauthntest provides a software authenticator for testing the WebAuthn ceremonies.
+// It plays the part of both the browser and the authenticator: it answers the creation and
+// request options with the JSON credentials a browser would send to the relying party.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/dmalix/financelime-authorization/webauthn"
+)
+
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+
+	credentialIDLength = 16
+)
+
+// Authenticator keeps one ES256 passkey
+type Authenticator struct {
+	// Origin is the origin the browser reports in the client data
+	Origin       string
+	CredentialID []byte
+	UserHandle   string
+	SignCount    uint32
+	privateKey   *ecdsa.PrivateKey
+}
+
+func NewAuthenticator(origin string) (*Authenticator, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	credentialID := make([]byte, credentialIDLength)
+	if _, err := rand.Read(credentialID); err != nil {
+		return nil, err
+	}
+	return &Authenticator{
+		Origin:       origin,
+		CredentialID: credentialID,
+		privateKey:   privateKey,
+	}, nil
+}
+
+// Register creates the passkey for the user of the options and returns the registration credential
+func (a *Authenticator) Register(options webauthn.CreationOptions) (webauthn.RegistrationCredential, error) {
+
+	var credential webauthn.RegistrationCredential
+
+	a.UserHandle = options.User.ID
+
+	clientDataJSON, err := a.clientDataJSON("webauthn.create", options.Challenge)
+	if err != nil {
+		return credential, err
+	}
+
+	authData := a.authenticatorData(options.RP.ID, flagUserPresent|flagUserVerified|flagAttestedCredential)
+	authData = append(authData, make([]byte, 16)...) // aaguid
+	authData = append(authData, byte(len(a.CredentialID)>>8), byte(len(a.CredentialID)))
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, a.PublicKey()...)
+
+	attestationObject := encodeMap(
+		encodeText("fmt"), encodeText("none"),
+		encodeText("attStmt"), encodeMap(),
+		encodeText("authData"), encodeBytes(authData),
+	)
+
+	credential.ID = webauthn.Encode(a.CredentialID)
+	credential.Type = "public-key"
+	credential.Response.ClientDataJSON = webauthn.Encode(clientDataJSON)
+	credential.Response.AttestationObject = webauthn.Encode(attestationObject)
+
+	return credential, nil
+}
+
+// Assert signs the challenge of the options with the passkey and returns the assertion credential
+func (a *Authenticator) Assert(options webauthn.RequestOptions) (webauthn.AssertionCredential, error) {
+
+	var credential webauthn.AssertionCredential
+
+	clientDataJSON, err := a.clientDataJSON("webauthn.get", options.Challenge)
+	if err != nil {
+		return credential, err
+	}
+
+	a.SignCount++
+	authData := a.authenticatorData(options.RPID, flagUserPresent|flagUserVerified)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.privateKey, digest[:])
+	if err != nil {
+		return credential, err
+	}
+
+	credential.ID = webauthn.Encode(a.CredentialID)
+	credential.Type = "public-key"
+	credential.Response.ClientDataJSON = webauthn.Encode(clientDataJSON)
+	credential.Response.AuthenticatorData = webauthn.Encode(authData)
+	credential.Response.Signature = webauthn.Encode(signature)
+	credential.Response.UserHandle = a.UserHandle
+
+	return credential, nil
+}
+
+// PublicKey returns the COSE_Key of the passkey
+func (a *Authenticator) PublicKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.privateKey.X.FillBytes(x)
+	a.privateKey.Y.FillBytes(y)
+	return encodeMap(
+		encodeInt(1), encodeInt(2), // kty: EC2
+		encodeInt(3), encodeInt(webauthn.AlgorithmES256),
+		encodeInt(-1), encodeInt(1), // crv: P-256
+		encodeInt(-2), encodeBytes(x),
+		encodeInt(-3), encodeBytes(y),
+	)
+}
+
+func (a *Authenticator) clientDataJSON(ceremonyType string, challenge string) ([]byte, error) {
+	return json.Marshal(struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}{ceremonyType, challenge, a.Origin, false})
+}
+
+func (a *Authenticator) authenticatorData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	authData := append([]byte(nil), rpIDHash[:]...)
+	authData = append(authData, flags)
+	var signCount [4]byte
+	binary.BigEndian.PutUint32(signCount[:], a.SignCount)
+	return append(authData, signCount[:]...)
+}
+
+func encodeHead(major byte, argument uint64) []byte {
+	switch {
+	case argument < 24:
+		return []byte{major<<5 | byte(argument)}
+	case argument <= 0xff:
+		return []byte{major<<5 | 24, byte(argument)}
+	case argument <= 0xffff:
+		return []byte{major<<5 | 25, byte(argument >> 8), byte(argument)}
+	default:
+		head := make([]byte, 9)
+		head[0] = major<<5 | 27
+		binary.BigEndian.PutUint64(head[1:], argument)
+		return head
+	}
+}
+
+func encodeInt(value int64) []byte {
+	if value < 0 {
+		return encodeHead(1, uint64(-1-value))
+	}
+	return encodeHead(0, uint64(value))
+}
+
+func encodeBytes(value []byte) []byte {
+	return append(encodeHead(2, uint64(len(value))), value...)
+}
+
+func encodeText(value string) []byte {
+	return append(encodeHead(3, uint64(len(value))), value...)
+}
+
+// encodeMap encodes the already encoded keys and values given in turn
+func encodeMap(items ...[]byte) []byte {
+	encoded := encodeHead(5, uint64(len(items)/2))
+	for _, item := range items {
+		encoded = append(encoded, item...)
+	}
+	return encoded
+}